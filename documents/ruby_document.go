@@ -1,7 +1,10 @@
 package documents
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"unicode/utf8"
 )
 
@@ -12,6 +15,17 @@ type RubyDocument struct {
 	Source     string
 	LanguageID string
 	LastEdit   *Edit
+	HasBOM     bool // the source started with a UTF-8 BOM, stripped so offsets match the editor
+
+	// Parsed AST memoized for astVersion, invalidated by Update
+	ast        *Node
+	astVersion int
+	astMutex   sync.Mutex
+
+	// Byte offset where each line starts, memoized for linesVersion
+	lineStarts   []int
+	linesVersion int
+	linesMutex   sync.Mutex
 }
 
 // Edit represents an edit operation
@@ -39,30 +53,55 @@ type Node struct {
 	Children  []*Node `json:"children"`
 }
 
-// New creates a new RubyDocument
+// UTF8BOM is the byte order mark some editors write at the start of a file
+const UTF8BOM = "\uFEFF"
+
+// New creates a new RubyDocument. A leading BOM is stripped from the source and
+// remembered in HasBOM so it can be restored when writing the file back.
 func New(uri string, source string, version int, languageID string) *RubyDocument {
+	hasBOM := strings.HasPrefix(source, UTF8BOM)
+
 	doc := &RubyDocument{
 		URI:        uri,
 		Version:    version,
-		Source:     source,
+		Source:     strings.TrimPrefix(source, UTF8BOM),
 		LanguageID: languageID,
 		LastEdit:   nil,
+		HasBOM:     hasBOM,
 	}
 	
 	return doc
 }
 
-// Parse parses the Ruby document and returns an AST
+// Text returns the source as it should be written to disk, restoring a stripped BOM
+func (r *RubyDocument) Text() string {
+	if r.HasBOM {
+		return UTF8BOM + r.Source
+	}
+	return r.Source
+}
+
+// Parse parses the Ruby document and returns an AST.
+// The result is cached per Version, so repeated requests on an unchanged buffer are free.
 func (r *RubyDocument) Parse() (*Node, error) {
+	r.astMutex.Lock()
+	defer r.astMutex.Unlock()
+
+	if r.ast != nil && r.astVersion == r.Version {
+		return r.ast, nil
+	}
+
 	// This is a simplified parser for demonstration purposes
 	// In a real implementation, we would use a Ruby parser like Prism (Ruby 3.2+) or Ripper
 	nodes := r.tokenize()
-	return &Node{
+	r.ast = &Node{
 		Type:     "program",
 		Name:     "root",
 		Location: &Range{Start: Position{Line: 0, Character: 0}, End: r.computeEndPosition()},
 		Children: nodes,
-	}, nil
+	}
+	r.astVersion = r.Version
+	return r.ast, nil
 }
 
 // tokenize creates a basic tokenization for the Ruby document
@@ -191,18 +230,30 @@ func (r *RubyDocument) computeEndPosition() Position {
 	}
 }
 
-// Update applies text edits to the document
-func (r *RubyDocument) Update(edits []TextEdit) {
+// Update applies the content changes of a didChange notification in order, each
+// to the text the previous one produced; a change without a range replaces the
+// whole text. If any range lies outside the text, the document is left as it was
+// and the error says which, since the editor's buffer and ours no longer agree.
+func (r *RubyDocument) Update(edits []TextEdit) error {
 	source := []rune(r.Source)
-	
-	// Apply edits in reverse order to maintain position consistency
-	for i := len(edits) - 1; i >= 0; i-- {
-		edit := edits[i]
-		r.applyEdit(&source, edit)
+	for i, edit := range edits {
+		var err error
+		if source, err = applyEdit(source, edit); err != nil {
+			return fmt.Errorf("change %d of %d: %w", i+1, len(edits), err)
+		}
 	}
-	
+
 	r.Source = string(source)
 	r.Version++
+
+	r.astMutex.Lock()
+	r.ast = nil
+	r.astMutex.Unlock()
+
+	r.linesMutex.Lock()
+	r.lineStarts = nil
+	r.linesMutex.Unlock()
+	return nil
 }
 
 // TextEdit represents a single text edit
@@ -212,37 +263,126 @@ type TextEdit struct {
 }
 
 // applyEdit applies a single text edit to the source
-func (r *RubyDocument) applyEdit(source *[]rune, edit TextEdit) {
-	startPos := r.positionToOffset(edit.Range.Start)
-	endPos := r.positionToOffset(edit.Range.End)
-	
-	if startPos >= 0 && endPos <= len(*source) {
-		newSource := make([]rune, 0, len(*source)-endPos+startPos+len([]rune(edit.NewText)))
-		newSource = append(newSource, (*source)[:startPos]...)
-		newSource = append(newSource, []rune(edit.NewText)...)
-		newSource = append(newSource, (*source)[endPos:]...)
-		*source = newSource
+func applyEdit(source []rune, edit TextEdit) ([]rune, error) {
+	if edit.Range == nil {
+		return []rune(edit.NewText), nil
+	}
+
+	startPos, startOK := positionToOffset(source, edit.Range.Start)
+	endPos, endOK := positionToOffset(source, edit.Range.End)
+	if !startOK || !endOK || endPos < startPos {
+		return source, fmt.Errorf("range %d:%d-%d:%d is outside the document",
+			edit.Range.Start.Line, edit.Range.Start.Character, edit.Range.End.Line, edit.Range.End.Character)
 	}
+
+	newSource := make([]rune, 0, len(source)-endPos+startPos+utf8.RuneCountInString(edit.NewText))
+	newSource = append(newSource, source[:startPos]...)
+	newSource = append(newSource, []rune(edit.NewText)...)
+	newSource = append(newSource, source[endPos:]...)
+	return newSource, nil
 }
 
-// positionToOffset converts a position to a rune offset in the source
-func (r *RubyDocument) positionToOffset(pos Position) int {
-	lines := strings.Split(r.Source, "\n")
-	offset := 0
-	
-	for i := 0; i < pos.Line && i < len(lines); i++ {
-		offset += len([]rune(lines[i])) + 1 // +1 for newline
+// positionToOffset converts a position to a rune offset in the source. As the
+// protocol says, a character past the end of its line means the end of the line.
+// A line past the last is only accepted as the start of the line after the text.
+func positionToOffset(source []rune, pos Position) (int, bool) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, false
 	}
-	
-	if pos.Line < len(lines) {
-		line := []rune(lines[pos.Line])
-		if pos.Character <= len(line) {
-			return offset + pos.Character
+
+	offset, line := 0, 0
+	for line < pos.Line {
+		newline := indexRune(source[offset:], '\n')
+		if newline < 0 {
+			if line == pos.Line-1 && pos.Character == 0 {
+				return len(source), true
+			}
+			return 0, false
 		}
-		return offset + len(line)
+		offset += newline + 1
+		line++
 	}
-	
-	return len([]rune(r.Source))
+
+	lineLength := indexRune(source[offset:], '\n')
+	if lineLength < 0 {
+		lineLength = len(source) - offset
+	}
+	if pos.Character > lineLength {
+		return offset + lineLength, true
+	}
+	return offset + pos.Character, true
+}
+
+// OffsetToPosition converts a byte offset in the source, as external tools such
+// as syntax_tree report them, to its position, counting characters in UTF-16 code
+// units as LSP clients do. Offsets outside the source are clamped to it, and an
+// offset inside a multibyte character stands for the character's start.
+func (r *RubyDocument) OffsetToPosition(offset int) Position {
+	offset = max(0, min(offset, len(r.Source)))
+	for offset > 0 && offset < len(r.Source) && !utf8.RuneStart(r.Source[offset]) {
+		offset--
+	}
+
+	starts := r.lines()
+	line := sort.Search(len(starts), func(i int) bool { return starts[i] > offset }) - 1
+	return Position{Line: line, Character: utf16Length(r.Source[starts[line]:offset])}
+}
+
+// utf16Length counts the UTF-16 code units of a string: two for characters
+// outside the Basic Multilingual Plane (emoji), one for the rest
+func utf16Length(text string) int {
+	length := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+	return length
+}
+
+// LineText returns a line of the source without its line break, "" for a line
+// outside the source
+func (r *RubyDocument) LineText(line int) string {
+	starts := r.lines()
+	if line < 0 || line >= len(starts) {
+		return ""
+	}
+	end := len(r.Source)
+	if line+1 < len(starts) {
+		end = starts[line+1] - 1
+	}
+	return strings.TrimSuffix(r.Source[starts[line]:end], "\r")
+}
+
+// lines returns the byte offset where each line of the source starts, computed
+// once per Version
+func (r *RubyDocument) lines() []int {
+	r.linesMutex.Lock()
+	defer r.linesMutex.Unlock()
+
+	if r.lineStarts != nil && r.linesVersion == r.Version {
+		return r.lineStarts
+	}
+	starts := make([]int, 1, strings.Count(r.Source, "\n")+1)
+	for i := 0; i < len(r.Source); i++ {
+		if r.Source[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	r.lineStarts, r.linesVersion = starts, r.Version
+	return starts
+}
+
+// indexRune returns the index of the first r in runes, -1 if there is none
+func indexRune(runes []rune, r rune) int {
+	for i, candidate := range runes {
+		if candidate == r {
+			return i
+		}
+	}
+	return -1
 }
 
 // GetSymbolAtPosition returns the symbol at a given position
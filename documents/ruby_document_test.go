@@ -0,0 +1,169 @@
+package documents
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestOffsetToPositionRoundTripsMultibyteContent(t *testing.T) {
+	source := "# café ☕\nclass Ünïcode\n  def 日本(😀)\n  end\r\nend"
+	doc := New("file:///workspace/app.rb", source, 1, "ruby")
+
+	line, character, lineStart := 0, 0, 0
+	for offset := 0; offset <= len(source); {
+		pos := Position{Line: line, Character: character}
+		if got := doc.OffsetToPosition(offset); got != pos {
+			t.Fatalf("OffsetToPosition(%d) = %+v, want %+v", offset, got, pos)
+		}
+		// Walking the line's UTF-16 units back to a byte offset lands where we started
+		if back := lineStart + utf16ByteOffset(doc.LineText(pos.Line)+"\n", pos.Character); back != offset {
+			t.Fatalf("position %+v maps back to byte %d, want %d", pos, back, offset)
+		}
+
+		if offset == len(source) {
+			break
+		}
+		char, size := utf8.DecodeRuneInString(source[offset:])
+		switch {
+		case char == '\n':
+			line, character, lineStart = line+1, 0, offset+size
+		case char >= 0x10000:
+			// Outside the Basic Multilingual Plane: a surrogate pair in UTF-16
+			character += 2
+		default:
+			character++
+		}
+		offset += size
+	}
+}
+
+// utf16ByteOffset returns the byte offset in a line of a UTF-16 column
+func utf16ByteOffset(line string, character int) int {
+	for offset, r := range line {
+		if character <= 0 {
+			return offset
+		}
+		character--
+		if r >= 0x10000 {
+			character--
+		}
+	}
+	return len(line)
+}
+
+func TestOffsetToPositionClampsOffsets(t *testing.T) {
+	doc := New("file:///workspace/app.rb", "é\nab", 1, "ruby")
+
+	tests := []struct {
+		offset int
+		want   Position
+	}{
+		{-5, Position{Line: 0, Character: 0}},
+		// The second byte of é stands for the character's start
+		{1, Position{Line: 0, Character: 0}},
+		{2, Position{Line: 0, Character: 1}},
+		{3, Position{Line: 1, Character: 0}},
+		{100, Position{Line: 1, Character: 2}},
+	}
+	for _, test := range tests {
+		if got := doc.OffsetToPosition(test.offset); got != test.want {
+			t.Errorf("OffsetToPosition(%d) = %+v, want %+v", test.offset, got, test.want)
+		}
+	}
+}
+
+func TestLineText(t *testing.T) {
+	doc := New("file:///workspace/app.rb", "class Café\r\n  def 日本\n\nend", 1, "ruby")
+
+	want := []string{"class Café", "  def 日本", "", "end"}
+	for line, text := range want {
+		if got := doc.LineText(line); got != text {
+			t.Errorf("LineText(%d) = %q, want %q", line, got, text)
+		}
+	}
+	for _, line := range []int{-1, len(want)} {
+		if got := doc.LineText(line); got != "" {
+			t.Errorf("LineText(%d) = %q, want \"\"", line, got)
+		}
+	}
+}
+
+func TestLineTextFollowsUpdates(t *testing.T) {
+	doc := New("file:///workspace/app.rb", "a\nb", 1, "ruby")
+	if got := doc.LineText(1); got != "b" {
+		t.Fatalf("LineText(1) = %q, want \"b\"", got)
+	}
+
+	edit := TextEdit{Range: &Range{Start: Position{Line: 0, Character: 1}, End: Position{Line: 0, Character: 1}}, NewText: "é\nc"}
+	if err := doc.Update([]TextEdit{edit}); err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.LineText(1); got != "c" {
+		t.Errorf("LineText(1) after an edit = %q, want \"c\"", got)
+	}
+	if got := doc.OffsetToPosition(len("aé\nc\nb")); got != (Position{Line: 2, Character: 1}) {
+		t.Errorf("OffsetToPosition at the end after an edit = %+v, want 2:1", got)
+	}
+}
+
+func TestUpdateRejectsEditsOutsideTheDocument(t *testing.T) {
+	source := "class Café\n  def name\n  end\nend"
+	tests := []struct {
+		name  string
+		edits []TextEdit
+	}{
+		{"end past the last line", []TextEdit{
+			{Range: &Range{Start: Position{Line: 3, Character: 0}, End: Position{Line: 7, Character: 2}}, NewText: "x"},
+		}},
+		{"end before start", []TextEdit{
+			{Range: &Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 0, Character: 2}}, NewText: "x"},
+		}},
+		{"negative character", []TextEdit{
+			{Range: &Range{Start: Position{Line: 0, Character: -1}, End: Position{Line: 0, Character: 2}}, NewText: "x"},
+		}},
+		// A batch applies in full or not at all
+		{"second edit of a batch", []TextEdit{
+			{Range: &Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 0, Character: 5}}, NewText: "module"},
+			{Range: &Range{Start: Position{Line: 9, Character: 0}, End: Position{Line: 9, Character: 1}}, NewText: "x"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := New("file:///workspace/app.rb", source, 1, "ruby")
+			if err := doc.Update(test.edits); err == nil {
+				t.Error("Update = nil, want an error for the range outside the document")
+			}
+			if doc.Source != source || doc.Version != 1 {
+				t.Errorf("document changed to %q (version %d), want it left as it was", doc.Source, doc.Version)
+			}
+		})
+	}
+}
+
+func TestUpdateClampsCharactersPastTheLineEnd(t *testing.T) {
+	doc := New("file:///workspace/app.rb", "class Café\nend", 1, "ruby")
+	edit := TextEdit{Range: &Range{Start: Position{Line: 0, Character: 10}, End: Position{Line: 0, Character: 99}}, NewText: " < Base"}
+	if err := doc.Update([]TextEdit{edit}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "class Café < Base\nend"; doc.Source != want {
+		t.Errorf("Source = %q, want %q", doc.Source, want)
+	}
+}
+
+func TestNewStripsTheBOM(t *testing.T) {
+	doc := New("file:///workspace/app.rb", UTF8BOM+"class Café\nend\n", 1, "ruby")
+	if !doc.HasBOM || doc.Source != "class Café\nend\n" {
+		t.Fatalf("New = HasBOM %v, Source %q; want the BOM stripped and remembered", doc.HasBOM, doc.Source)
+	}
+	if got := doc.OffsetToPosition(len("class")); got != (Position{Line: 0, Character: 5}) {
+		t.Errorf("OffsetToPosition past class = %+v, want 0:5 as if there were no BOM", got)
+	}
+	if doc.Text() != UTF8BOM+"class Café\nend\n" {
+		t.Errorf("Text() = %q, want the BOM restored", doc.Text())
+	}
+
+	if plain := New("file:///workspace/app.rb", "class Café\nend\n", 1, "ruby"); plain.HasBOM || plain.Text() != plain.Source {
+		t.Errorf("New without a BOM = HasBOM %v, Text %q", plain.HasBOM, plain.Text())
+	}
+}
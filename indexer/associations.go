@@ -0,0 +1,62 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// classNameDetail separates an association's type from the class_name option
+// overriding its model in the entry's Detail (has_many class_name: Person)
+const classNameDetail = " class_name: "
+
+// The class_name option of an association, in either hash syntax
+var associationClassNamePattern = regexp.MustCompile(`(?:\bclass_name:|:class_name\s*=>)\s*["']((?:::)?[A-Z]\w*(?:::[A-Z]\w*)*)["']`)
+
+// associationDetail builds the Detail of an association entry from its type and
+// the line declaring it
+func associationDetail(assocType string, line string) string {
+	if matches := associationClassNamePattern.FindStringSubmatch(line); matches != nil {
+		return assocType + classNameDetail + strings.TrimPrefix(matches[1], "::")
+	}
+	return assocType
+}
+
+// AssociationType returns the macro declaring an association (has_many, belongs_to, ...)
+func AssociationType(entry SymbolEntry) string {
+	assocType, _, _ := strings.Cut(entry.Detail, classNameDetail)
+	return assocType
+}
+
+// AssociationClassName returns the model an association refers to: its
+// class_name option when given, otherwise the association name camelized,
+// singularized first for has_many and has_and_belongs_to_many
+// (has_many :line_items -> LineItem, has_many :people -> Person)
+func (idx *Index) AssociationClassName(entry SymbolEntry) string {
+	if entry.Type != SymbolAssociation {
+		return ""
+	}
+	assocType, className, found := strings.Cut(entry.Detail, classNameDetail)
+	if found {
+		return className
+	}
+	if assocType == "has_many" || assocType == "has_and_belongs_to_many" {
+		return idx.inflections.ModelName(entry.Name)
+	}
+	return snakeToCamel(entry.Name)
+}
+
+// AssociationTarget returns the class definitions of the model an association
+// refers to, resolved from the model declaring it
+func (idx *Index) AssociationTarget(entry SymbolEntry) []SymbolEntry {
+	className := idx.AssociationClassName(entry)
+	if className == "" {
+		return nil
+	}
+	var targets []SymbolEntry
+	for _, candidate := range idx.LookupInScope(className, entry.Parent) {
+		if candidate.Type == SymbolClass {
+			targets = append(targets, candidate)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,43 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func TestAssociationClassNames(t *testing.T) {
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	entries := idx.ParseSource(`class Post < ApplicationRecord
+  belongs_to :author, class_name: "User"
+  belongs_to :category
+  has_one :cover_image
+  has_many :comments
+  has_many :line_items
+  has_many :editors, :class_name => "::Admin::User"
+  has_and_belongs_to_many :tags
+end
+`, "/workspace/app/models/post.rb")
+	tests := []struct {
+		fqn       string
+		assocType string
+		className string
+	}{
+		{"Post#author", "belongs_to", "User"},
+		{"Post#category", "belongs_to", "Category"},
+		{"Post#cover_image", "has_one", "CoverImage"},
+		{"Post#comments", "has_many", "Comment"},
+		{"Post#line_items", "has_many", "LineItem"},
+		{"Post#editors", "has_many", "Admin::User"},
+		{"Post#tags", "has_and_belongs_to_many", "Tag"},
+	}
+	for _, test := range tests {
+		entry := findEntry(t, entries, test.fqn)
+		if got := AssociationType(entry); got != test.assocType {
+			t.Errorf("AssociationType(%s) = %q, want %q", test.fqn, got, test.assocType)
+		}
+		if got := idx.AssociationClassName(entry); got != test.className {
+			t.Errorf("AssociationClassName(%s) = %q, want %q", test.fqn, got, test.className)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// An attribute name given to attr_accessor and friends, as a symbol or a string,
+// or a percent literal array of them (%i[name email], %w(name email))
+var attrArgumentPattern = regexp.MustCompile(`:(\w+)|"(\w+)"|'(\w+)'|%[iIwW](?:\[([^\]]*)\]|\(([^)]*)\)|\{([^}]*)\})`)
+
+// A member of a percent literal array
+var percentMemberPattern = regexp.MustCompile(`\w+`)
+
+// Groups of attrArgumentPattern holding the body of a percent literal array
+const firstPercentGroup = 8
+
+// attrArgument is an attribute named on a line, at a byte offset of the line
+type attrArgument struct {
+	name   string
+	offset int
+}
+
+// attrArguments extracts the attribute names from the argument text starting
+// at byte start of a line, whose masked code tells arguments from comments
+func attrArguments(line string, code string, start int) []attrArgument {
+	var arguments []attrArgument
+	for _, loc := range attrArgumentPattern.FindAllStringSubmatchIndex(line[start:], -1) {
+		// Inside a comment the masked code is blank
+		if code[start+loc[0]] == ' ' {
+			continue
+		}
+		for group := 2; group < len(loc); group += 2 {
+			if loc[group] >= 0 && group >= firstPercentGroup {
+				body := start + loc[group]
+				for _, member := range percentMemberPattern.FindAllStringIndex(line[body:start+loc[group+1]], -1) {
+					arguments = append(arguments, attrArgument{
+						name:   line[body+member[0] : body+member[1]],
+						offset: body + member[0],
+					})
+				}
+				break
+			}
+			if loc[group] >= 0 {
+				arguments = append(arguments, attrArgument{
+					name:   line[start+loc[group] : start+loc[group+1]],
+					offset: start + loc[group],
+				})
+				break
+			}
+		}
+	}
+	return arguments
+}
+
+// symbolNames returns the names listed in argument text as symbols, strings or
+// percent literal arrays (module_function :a, :b; only: %i[index show])
+func symbolNames(text string) []string {
+	var names []string
+	for _, argument := range attrArguments(text, text, 0) {
+		names = append(names, argument.name)
+	}
+	return names
+}
+
+// attrEntries builds the entries of attributes declared by attr_accessor,
+// attr_reader or attr_writer on a line
+func attrEntries(attrType string, arguments []attrArgument, line string, lineNumber int, filePath string, parent string, visibility string) []SymbolEntry {
+	entries := make([]SymbolEntry, 0, len(arguments))
+	for _, argument := range arguments {
+		entries = append(entries, SymbolEntry{
+			Name:               argument.name,
+			FullyQualifiedName: parent + "#" + argument.name,
+			Type:               SymbolAttrAccessor,
+			FilePath:           filePath,
+			Line:               lineNumber,
+			Character:          utf8.RuneCountInString(line[:argument.offset]),
+			Parent:             parent,
+			Visibility:         visibility,
+			Detail:             attrType,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringAndMultiLineAttributes(t *testing.T) {
+	entries := parseTestSource(t, `class Customer
+  attr_reader :a, "b", 'c'
+  attr_accessor :name,
+                "email",
+                'phone'
+  attr_writer("notes")
+end
+`)
+	for _, fqn := range []string{"Customer#a", "Customer#b", "Customer#c", "Customer#name", "Customer#email", "Customer#phone", "Customer#notes"} {
+		if entry := findEntry(t, entries, fqn); entry.Type != SymbolAttrAccessor || entry.Parent != "Customer" {
+			t.Errorf("%s: type %d in %q, want an attribute of Customer", fqn, entry.Type, entry.Parent)
+		}
+	}
+	// Continued members are located on their own lines
+	if email := findEntry(t, entries, "Customer#email"); email.Line != 4 || email.Character != 17 {
+		t.Errorf("Customer#email at %d:%d, want 4:17", email.Line, email.Character)
+	}
+	checkEntries(t, entries, []entrySpec{{"Customer", "", "public", 7}})
+}
+
+func TestPercentLiteralAttributes(t *testing.T) {
+	entries := parseTestSource(t, `class Address
+  attr_reader *%i[street city postcode]
+  attr_accessor(*%w(country region))
+
+  private
+
+  attr_writer *%I{geocode}
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Address", "", "public", 8},
+		{"Address#street", "Address", "public", 0},
+		{"Address#city", "Address", "public", 0},
+		{"Address#postcode", "Address", "public", 0},
+		{"Address#country", "Address", "public", 0},
+		{"Address#region", "Address", "public", 0},
+		{"Address#geocode", "Address", "private", 0},
+	})
+
+	// Each member is located at its own name
+	if city := findEntry(t, entries, "Address#city"); city.Line != 2 || city.Character != 25 {
+		t.Errorf("Address#city at %d:%d, want 2:25", city.Line, city.Character)
+	}
+}
+
+func TestSymbolNames(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{":index, :show", []string{"index", "show"}},
+		{"only: %i[index show]", []string{"index", "show"}},
+		{"%w(new create) + ['edit', \"update\"]", []string{"new", "create", "edit", "update"}},
+		{"nothing", nil},
+	}
+	for _, test := range tests {
+		if got := symbolNames(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("symbolNames(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
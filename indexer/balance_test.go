@@ -0,0 +1,81 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Source whose bodies never close, as a template or a truncated file parsed as Ruby
+var malformedSource = "class Broken\n  def helper\n  end\n" + strings.Repeat("  if ready?\n    go\n", 25)
+
+func TestMalformedFileIsSkippedWithALoggedReason(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"app/views/broken.rb": malformedSource,
+		"app/models/user.rb":  "class User\nend\n",
+	})
+	var logs bytes.Buffer
+	idx := New(root, log.New(&logs, "", 0))
+	idx.BuildIndex(context.Background())
+
+	broken := filepath.Join(root, "app/views/broken.rb")
+	if symbols := idx.GetFileSymbols(broken); len(symbols) != 0 {
+		t.Errorf("malformed file indexed %d symbols, want none", len(symbols))
+	}
+	if entries := idx.Lookup("User"); len(entries) != 1 {
+		t.Errorf("Lookup(User) = %+v, want the well-formed file indexed", entries)
+	}
+
+	stats := idx.Stats()
+	if len(stats.Errors) != 1 || stats.Errors[0].Path != broken {
+		t.Fatalf("Stats().Errors = %+v, want the malformed file", stats.Errors)
+	}
+	if reason := stats.Errors[0].Err.Error(); !strings.Contains(reason, "26 left open") {
+		t.Errorf("recorded reason %q, want the class and its 25 ifs left open", reason)
+	}
+	if !strings.Contains(logs.String(), broken) || !strings.Contains(logs.String(), "symbols discarded") {
+		t.Errorf("log does not explain why %s was skipped:\n%s", broken, logs.String())
+	}
+}
+
+func TestUnbalancedBufferKeepsTheLastGoodSymbols(t *testing.T) {
+	idx := New("/workspace", log.New(&bytes.Buffer{}, "", 0))
+	path := "/workspace/app/models/report.rb"
+
+	idx.UpdateFileFromSource(path, "class Report\n  def helper\n  end\nend\n")
+	idx.UpdateFileFromSource(path, malformedSource)
+
+	if entries := idx.Lookup("Report#helper"); len(entries) != 1 {
+		t.Errorf("Lookup(Report#helper) = %+v after an unbalanced edit, want the last good symbols", entries)
+	}
+	if errors := idx.Stats().Errors; len(errors) != 1 || errors[0].Path != path {
+		t.Errorf("Stats().Errors = %+v, want the unbalanced buffer recorded", errors)
+	}
+
+	idx.UpdateFileFromSource(path, "class Report\n  def summary\n  end\nend\n")
+	if entries := idx.Lookup("Report#summary"); len(entries) != 1 {
+		t.Errorf("Lookup(Report#summary) = %+v, want the fixed buffer indexed", entries)
+	}
+	if errors := idx.Stats().Errors; len(errors) != 0 {
+		t.Errorf("Stats().Errors = %+v, want the failure cleared", errors)
+	}
+}
+
+func TestBufferThatParsesToNothingReplacesItsSymbols(t *testing.T) {
+	idx := New("/workspace", log.New(&bytes.Buffer{}, "", 0))
+	path := "/workspace/app/models/report.rb"
+
+	// An emptied buffer, and one whose scan stops at an overlong first line,
+	// hold no symbols but are not unbalanced
+	for _, source := range []string{"", "# " + strings.Repeat("x", 70*1024) + "\nclass Report\nend\n"} {
+		idx.UpdateFileFromSource(path, "class Report\n  def helper\n  end\nend\n")
+		idx.UpdateFileFromSource(path, source)
+		if symbols := idx.GetFileSymbols(path); len(symbols) != 0 {
+			t.Errorf("GetFileSymbols() = %+v after a %d-byte buffer, want the old symbols dropped", symbols, len(source))
+		}
+	}
+}
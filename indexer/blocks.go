@@ -0,0 +1,230 @@
+package indexer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Keywords opening a body closed by `end`, when they start a statement
+var (
+	blockStartPattern     = regexp.MustCompile(`^\s*(if|unless|while|until|case|begin|for)\b`)
+	blockValuePattern     = regexp.MustCompile(`(?:[^=!<>]=|\(|\|\||&&|<<)\s*(if|unless|while|until|case|begin)\b`)
+	blockDoPattern        = regexp.MustCompile(`\bdo\s*(\|[^|]*\|)?\s*$`)
+	singletonClassPattern = regexp.MustCompile(`^\s*class\s*<<`)
+	blockClosedPattern    = regexp.MustCompile(`\bend\s*$`)
+)
+
+// Keywords continuing a body at the indentation of its opener (rescue, else, when)
+var midBodyPattern = regexp.MustCompile(`^\s*(?:rescue|ensure|else|elsif|when|in|then)\b`)
+
+// opensBlock reports whether a line of masked code opens a body that needs a
+// matching `end`: a statement-initial if/unless/while/until/case/begin/for, one
+// whose value is assigned (x = if ...), a `do` block or `class << self`.
+// Modifiers (return x if done, raise unless valid?) do not open a body,
+// nor do one-liners closed on the same line (if x then y end).
+func opensBlock(code string) bool {
+	if !blockStartPattern.MatchString(code) && !blockValuePattern.MatchString(code) &&
+		!blockDoPattern.MatchString(code) && !singletonClassPattern.MatchString(code) {
+		return false
+	}
+	return !blockClosedPattern.MatchString(code)
+}
+
+// BodyRange spans a class, module, method or block from its opening line
+// through its matching end. Lines are 1-based; characters are UTF-16 columns.
+type BodyRange struct {
+	Line         int
+	Character    int
+	EndLine      int
+	EndCharacter int
+}
+
+// BodyRanges finds the bodies closed by `end` in Ruby source, matching each end
+// with the open body indented alike like the indexer does. Comments, strings and
+// heredoc bodies cannot open or close a body.
+func BodyRanges(source string) []BodyRange {
+	return matchBodies(source, false).ranges
+}
+
+// openBody is a body whose end has not been seen yet while matching ends
+type openBody struct {
+	indent    int
+	line      int
+	character int
+	keyword   string // class, module or def; "" for if/do/... blocks
+	name      string // name of a class, module or method
+}
+
+// bodyMatch is the outcome of matching the ends of Ruby source with its bodies
+type bodyMatch struct {
+	ranges    []BodyRange
+	unclosed  []openBody  // left without an end, in the order they were given up on
+	strayEnds []BodyRange // ends found with no body open at all
+}
+
+// matchBodies pairs each end of Ruby source with the body it closes. Strictly,
+// an end less indented than a class, module or def leaves that definition
+// unterminated and closes the body at its own level, as when a def lacks its end.
+func matchBodies(source string, strict bool) bodyMatch {
+	heredocLines := make(map[int]bool)
+	for _, span := range FoldingSpans(source) {
+		if span.Heredoc {
+			for line := span.Line + 1; line <= span.EndLine; line++ {
+				heredocLines[line] = true
+			}
+		}
+	}
+
+	var match bodyMatch
+	var open []openBody
+	inBlockComment := false
+
+	// Ends indented deeper than the innermost open body close it once a line of
+	// code no deeper than its opener, and not continuing it, shows it has ended
+	var pendingEnds []BodyRange
+	closeBody := func(end BodyRange) {
+		body := open[len(open)-1]
+		open = open[:len(open)-1]
+		match.ranges = append(match.ranges, BodyRange{
+			Line:         body.line,
+			Character:    body.character,
+			EndLine:      end.EndLine,
+			EndCharacter: end.EndCharacter,
+		})
+	}
+	closePendingEnds := func(indent int, code string) {
+		for len(pendingEnds) > 0 && !midBodyPattern.MatchString(code) && len(open) > 0 && indent <= open[len(open)-1].indent {
+			closeBody(pendingEnds[0])
+			pendingEnds = pendingEnds[1:]
+		}
+		pendingEnds = nil
+	}
+	var indents statementIndents
+	for i, line := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		if inBlockComment {
+			inBlockComment = !blockCommentEndPattern.MatchString(line)
+			continue
+		}
+		if blockCommentStartPattern.MatchString(line) {
+			inBlockComment = true
+			continue
+		}
+		if heredocLines[lineNumber] {
+			continue
+		}
+		if line == "__END__" {
+			break
+		}
+
+		code := maskStringsAndComments(line)
+		indent := indents.of(line, code)
+		isEnd := endPattern.MatchString(code)
+		if !isEnd && len(pendingEnds) > 0 && strings.TrimSpace(code) != "" {
+			closePendingEnds(indent, code)
+		}
+
+		if isEnd {
+			for len(open) > 0 && (strict || open[len(open)-1].keyword == "") && indent < open[len(open)-1].indent {
+				if body := open[len(open)-1]; body.keyword != "" {
+					match.unclosed = append(match.unclosed, body)
+				}
+				open = open[:len(open)-1]
+			}
+			endRange := BodyRange{
+				Line:         lineNumber,
+				Character:    UTF16Column(line, strings.Index(line, "end")),
+				EndLine:      lineNumber,
+				EndCharacter: UTF16Column(line, strings.Index(line, "end")) + 3,
+			}
+			switch {
+			case len(open) == 0:
+				match.strayEnds = append(match.strayEnds, endRange)
+			case indent > open[len(open)-1].indent:
+				pendingEnds = append(pendingEnds, endRange)
+			default:
+				pendingEnds = nil
+				closeBody(endRange)
+			}
+			continue
+		}
+
+		body := openBody{
+			indent:    indent,
+			line:      lineNumber,
+			character: UTF16Column(line, len(line)-len(strings.TrimLeft(line, " \t"))),
+		}
+		if matches := classPattern.FindStringSubmatch(code); matches != nil {
+			body.keyword, body.name = "class", matches[1]
+		} else if matches := modulePattern.FindStringSubmatch(code); matches != nil {
+			body.keyword, body.name = "module", matches[1]
+		} else if matches := methodPattern.FindStringSubmatch(code); matches != nil &&
+			!singleLineDefPattern.MatchString(code) && !endlessDefPattern.MatchString(code) {
+			body.keyword, body.name = "def", matches[4]
+		} else if !opensBlock(code) {
+			continue
+		}
+		// One-liners (class Foo; end) close on their own line
+		if body.keyword != "def" && blockClosedPattern.MatchString(code) {
+			continue
+		}
+		open = append(open, body)
+	}
+
+	closePendingEnds(-1, "")
+
+	for _, body := range open {
+		if body.keyword != "" {
+			match.unclosed = append(match.unclosed, body)
+		}
+	}
+	return match
+}
+
+// StructureWarning is a clear imbalance between the bodies of Ruby source and
+// their ends. Lines are 1-based; characters are UTF-16 columns.
+type StructureWarning struct {
+	Line         int
+	Character    int
+	EndCharacter int
+	Message      string
+}
+
+// Names of the definition keywords in structure warnings
+var bodyKeywordNames = map[string]string{"class": "class", "module": "module", "def": "method"}
+
+// StructureWarnings reports the classes, modules and methods of Ruby source left
+// without an end, and ends found where nothing is open. Blocks are not reported:
+// whether a DSL line opens one is not always clear, and a block missing its end
+// is taken to close with the definition around it. Source whose ends balance is
+// never flagged, however it is indented; otherwise indentation tells which
+// definition lacks its end.
+func StructureWarnings(source string) []StructureWarning {
+	match := matchBodies(source, false)
+	if len(match.unclosed) == 0 && len(match.strayEnds) == 0 {
+		return nil
+	}
+	match = matchBodies(source, true)
+
+	var warnings []StructureWarning
+	for _, body := range match.unclosed {
+		warnings = append(warnings, StructureWarning{
+			Line:         body.line,
+			Character:    body.character,
+			EndCharacter: body.character + len(body.keyword),
+			Message:      fmt.Sprintf("unterminated %s `%s`: missing `end`", bodyKeywordNames[body.keyword], body.name),
+		})
+	}
+	for _, end := range match.strayEnds {
+		warnings = append(warnings, StructureWarning{
+			Line:         end.Line,
+			Character:    end.Character,
+			EndCharacter: end.EndCharacter,
+			Message:      "unexpected `end` with nothing to close",
+		})
+	}
+	return warnings
+}
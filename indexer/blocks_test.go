@@ -0,0 +1,146 @@
+package indexer
+
+import "testing"
+
+func TestStructureWarnings(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []StructureWarning
+	}{
+		{
+			name: "balanced",
+			source: `class Order
+  has_many :items
+
+  def total
+    items.sum do |item|
+      item.price
+    end
+  end
+
+  def paid?
+    payments.any? { |payment| payment.settled? }
+  end
+end
+`,
+		},
+		{
+			name:   "balanced but misindented",
+			source: "class Order\n  def total\n    1\nend\nend\n",
+		},
+		{
+			name:   "method missing its end",
+			source: "class Foo\n  def bar\n    1\nend\n",
+			want:   []StructureWarning{{Line: 2, Character: 2, EndCharacter: 5, Message: "unterminated method `bar`: missing `end`"}},
+		},
+		{
+			name:   "class missing its end",
+			source: "class Foo\n  def bar\n    1\n  end\n",
+			want:   []StructureWarning{{Line: 1, Character: 0, EndCharacter: 5, Message: "unterminated class `Foo`: missing `end`"}},
+		},
+		{
+			name:   "stray end",
+			source: "module Billing\nend\nend\n",
+			want:   []StructureWarning{{Line: 3, Character: 0, EndCharacter: 3, Message: "unexpected `end` with nothing to close"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := StructureWarnings(test.source)
+			if len(got) != len(test.want) {
+				t.Fatalf("StructureWarnings = %+v, want %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("warning %d = %+v, want %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBodyRangesKeepMisindentedBodies(t *testing.T) {
+	ranges := BodyRanges("class Order\n  def total\n    1\nend\nend\n")
+	want := []BodyRange{{Line: 2, Character: 2, EndLine: 4, EndCharacter: 3}, {Line: 1, Character: 0, EndLine: 5, EndCharacter: 3}}
+	if len(ranges) != len(want) {
+		t.Fatalf("BodyRanges = %+v, want %+v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("range %d = %+v, want %+v", i, ranges[i], want[i])
+		}
+	}
+}
+
+func TestBodyRangesCloseEndsIndentedDeeperThanTheirOpener(t *testing.T) {
+	ranges := BodyRanges("class Invoice\n  def total\n    1\n    end\n\n  def paid?\n  end\nend\n")
+	want := []BodyRange{
+		{Line: 2, Character: 2, EndLine: 4, EndCharacter: 7},
+		{Line: 6, Character: 2, EndLine: 7, EndCharacter: 5},
+		{Line: 1, Character: 0, EndLine: 8, EndCharacter: 3},
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("BodyRanges = %+v, want %+v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Errorf("range %d = %+v, want %+v", i, ranges[i], want[i])
+		}
+	}
+}
+
+func TestOpensBlock(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"    if valid?", true},
+		{"    unless paid", true},
+		{"    while queue.any?", true},
+		{"    until done", true},
+		{"    total = if discount", true},
+		{"    items.each do |item|", true},
+		{"  class << self", true},
+		{"    return total if items.empty?", false},
+		{"    raise ArgumentError unless valid?", false},
+		{"    retry while attempts < 3", false},
+		{"    if paid then ship end", false},
+		{"    ship", false},
+	}
+	for _, test := range tests {
+		if got := opensBlock(test.code); got != test.want {
+			t.Errorf("opensBlock(%q) = %v, want %v", test.code, got, test.want)
+		}
+	}
+}
+
+func TestModifiersDoNotOpenBodies(t *testing.T) {
+	entries := parseTestSource(t, `class Order
+  def total
+    return 0 if items.empty?
+    raise ArgumentError unless valid?
+    items.sum(&:price)
+  end
+
+  def ship
+    if paid?
+      deliver
+    end
+    unless cancelled?
+      notify
+    end
+  end
+
+  def cancel
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Order", "", "public", 19},
+		{"Order#total", "Order", "public", 6},
+		{"Order#ship", "Order", "public", 15},
+		{"Order#cancel", "Order", "public", 18},
+	})
+}
@@ -0,0 +1,29 @@
+package indexer
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/documents"
+)
+
+func TestFileStartingWithBOM(t *testing.T) {
+	source := documents.UTF8BOM + "# Settings loaded at boot\nclass Settings\n  def self.load\n  end\nend\n"
+	entries := parseTestSource(t, documents.UTF8BOM+"class Config\n  def path\n  end\nend\n")
+	checkEntries(t, entries, []entrySpec{
+		{"Config", "", "public", 4},
+		{"Config#path", "Config", "public", 3},
+	})
+	if config := findEntry(t, entries, "Config"); config.Line != 1 || config.Character != 6 {
+		t.Errorf("Config at %d:%d, want 1:6 as if there were no BOM", config.Line, config.Character)
+	}
+
+	idx, root := newTestIndex(t, map[string]string{"config/settings.rb": source}, Options{})
+	if entries := idx.Lookup("Settings"); len(entries) != 1 || entries[0].Line != 2 {
+		t.Fatalf("Lookup(Settings) = %+v, want the class on line 2", entries)
+	}
+	if comment := ReadDocComment(filepath.Join(root, "config/settings.rb"), 2); !reflect.DeepEqual(comment, []string{"Settings loaded at boot"}) {
+		t.Errorf("ReadDocComment = %q, want the first line without its BOM", comment)
+	}
+}
@@ -0,0 +1,41 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// aliasDetailPrefix marks the Detail of a constant assigned another constant
+const aliasDetailPrefix = "alias of "
+
+// A constant assigned a single constant path (User = Account, Alias = Foo::Bar),
+// not a call or a literal
+var constantAliasPattern = regexp.MustCompile(`^\s*((?:(?:self|[A-Z]\w*)::)*)([A-Z]\w*)\s*=\s*((?:::)?[A-Z]\w*(?:::[A-Z]\w*)*)\s*$`)
+
+// AliasTarget returns the constant path a constant alias was assigned, as written
+func AliasTarget(entry SymbolEntry) (string, bool) {
+	if entry.Type != SymbolConstant || !strings.HasPrefix(entry.Detail, aliasDetailPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(entry.Detail, aliasDetailPrefix), true
+}
+
+// ResolveAlias returns the definitions a constant alias stands for, following
+// aliases of aliases. It returns nil when the entry is not an alias or its
+// target is not indexed.
+func (idx *Index) ResolveAlias(entry SymbolEntry) []SymbolEntry {
+	seen := map[string]bool{entry.FullyQualifiedName: true}
+	var targets []SymbolEntry
+	for {
+		target, ok := AliasTarget(entry)
+		if !ok {
+			return targets
+		}
+		targets = idx.LookupInScope(target, entry.Parent)
+		if len(targets) != 1 || seen[targets[0].FullyQualifiedName] {
+			return targets
+		}
+		seen[targets[0].FullyQualifiedName] = true
+		entry = targets[0]
+	}
+}
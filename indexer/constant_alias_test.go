@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func TestConstantAliases(t *testing.T) {
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	idx.IndexSources(map[string]string{
+		"/workspace/app/models/account.rb": "class Account\nend\n",
+		"/workspace/lib/billing.rb":        "module Billing\n  module Gateways\n    class Stripe\n    end\n  end\n\n  Gateway = Gateways::Stripe\nend\n",
+		"/workspace/config/aliases.rb":     "User = Account\nDefaultGateway = Billing::Gateway\nTIMEOUT = Integer(5)\nNAME = \"Account\"\nPRIMARY = Account.first\n",
+	})
+
+	tests := []struct {
+		fqn    string
+		target string // as written, "" for constants that alias nothing
+		class  string // what the alias stands for
+	}{
+		{"User", "Account", "Account"},
+		{"Billing::Gateway", "Gateways::Stripe", "Billing::Gateways::Stripe"},
+		// Aliases of aliases are followed
+		{"DefaultGateway", "Billing::Gateway", "Billing::Gateways::Stripe"},
+		{"TIMEOUT", "", ""},
+		{"NAME", "", ""},
+		{"PRIMARY", "", ""},
+	}
+	for _, test := range tests {
+		entries := idx.Lookup(test.fqn)
+		if len(entries) != 1 {
+			t.Errorf("Lookup(%s) = %d entries, want 1", test.fqn, len(entries))
+			continue
+		}
+		target, ok := AliasTarget(entries[0])
+		if target != test.target || ok != (test.target != "") {
+			t.Errorf("AliasTarget(%s) = %q, %v; want %q", test.fqn, target, ok, test.target)
+		}
+		resolved := idx.ResolveAlias(entries[0])
+		switch {
+		case test.class == "" && resolved != nil:
+			t.Errorf("ResolveAlias(%s) = %+v, want nil", test.fqn, resolved)
+		case test.class != "" && (len(resolved) != 1 || resolved[0].FullyQualifiedName != test.class):
+			t.Errorf("ResolveAlias(%s) = %+v, want %s", test.fqn, resolved, test.class)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// constantTarget is a constant assigned by a line
+type constantTarget struct {
+	qualifier string // namespace written before the name ("Foo", "self"), "" for a bare name
+	name      string
+	offset    int // byte offset of the name in the line
+}
+
+var (
+	multipleAssignPattern = regexp.MustCompile(`^\s*([^=]*,[^=]*?)\s*=(?:[^=~>]|$)`)
+	assignTargetPattern   = regexp.MustCompile(`^\*?(?:((?:(?:self|[A-Z]\w*)::)*)([A-Z][A-Z0-9_]*)|@{0,2}[a-z_]\w*|\$\w+)$`)
+)
+
+// constantTargets returns the constants assigned by a line of code: one for
+// A = 0, each of a chain (A = B = 0), and the capitalized targets of a multiple
+// assignment (X, y = 1, 2), whose lowercase targets are locals
+func constantTargets(code string) []constantTarget {
+	if matches := multipleAssignPattern.FindStringSubmatchIndex(code); matches != nil {
+		var targets []constantTarget
+		offset := matches[2]
+		for _, part := range strings.Split(code[matches[2]:matches[3]], ",") {
+			target := strings.TrimSpace(part)
+			targetMatches := assignTargetPattern.FindStringSubmatch(target)
+			if targetMatches == nil {
+				// Not a list of targets, but the arguments of a call (foo(a, b = 1))
+				return nil
+			}
+			if name := targetMatches[2]; name != "" {
+				targets = append(targets, constantTarget{
+					qualifier: strings.TrimSuffix(targetMatches[1], "::"),
+					name:      name,
+					offset:    offset + strings.Index(part, target) + len(target) - len(name),
+				})
+			}
+			offset += len(part) + 1
+		}
+		return targets
+	}
+
+	var targets []constantTarget
+	rest := 0
+	for {
+		matches := constantPattern.FindStringSubmatchIndex(code[rest:])
+		if matches == nil {
+			break
+		}
+		// A comparison (A == b) or a match (A =~ b) assigns nothing
+		end := rest + matches[1]
+		if end < len(code) && strings.ContainsRune("=~>", rune(code[end])) {
+			break
+		}
+		targets = append(targets, constantTarget{
+			qualifier: strings.TrimSuffix(code[rest+matches[2]:rest+matches[3]], "::"),
+			name:      code[rest+matches[4] : rest+matches[5]],
+			offset:    rest + matches[4],
+		})
+		rest = end
+	}
+	return targets
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import "testing"
+
+func TestConstantTargets(t *testing.T) {
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"A = 0", []string{"A"}},
+		{"  A = B = C = 0", []string{"A", "B", "C"}},
+		{"X, Y = 1, 2", []string{"X", "Y"}},
+		{"MIN, limit, *REST = values", []string{"MIN", "REST"}},
+		{"self::TIMEOUT, Config::RETRIES = 5, 3", []string{"TIMEOUT", "RETRIES"}},
+		{"first, second = pair", nil},
+		{"A == b", nil},
+		{"foo(a, B = 1)", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, target := range constantTargets(test.code) {
+			got = append(got, target.name)
+			if test.code[target.offset:target.offset+len(target.name)] != target.name {
+				t.Errorf("constantTargets(%q): %s at offset %d, which holds %q", test.code, target.name,
+					target.offset, test.code[target.offset:])
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("constantTargets(%q) = %v, want %v", test.code, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("constantTargets(%q) = %v, want %v", test.code, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestChainedAndMultipleConstantAssignments(t *testing.T) {
+	entries := parseTestSource(t, `module Limits
+  LOW = MEDIUM = HIGH = 0
+  MIN, max, MAX = 1, 2, 3
+end
+`)
+	for _, fqn := range []string{"Limits::LOW", "Limits::MEDIUM", "Limits::HIGH", "Limits::MIN", "Limits::MAX"} {
+		if entry := findEntry(t, entries, fqn); entry.Type != SymbolConstant || entry.Parent != "Limits" {
+			t.Errorf("%s: type %d in %q, want a constant in Limits", fqn, entry.Type, entry.Parent)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Name == "max" {
+			t.Errorf("indexed the local max as %s", entry.FullyQualifiedName)
+		}
+	}
+	if high := findEntry(t, entries, "Limits::HIGH"); high.Line != 2 || high.Character != 17 {
+		t.Errorf("Limits::HIGH at %d:%d, want 2:17", high.Line, high.Character)
+	}
+}
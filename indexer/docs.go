@@ -0,0 +1,242 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/documents"
+)
+
+// DocComment is the comment block found directly above a definition,
+// split into free-text description and YARD tags
+type DocComment struct {
+	Description []string
+	Params      []YardTag
+	Return      *YardTag
+	Tags        []YardTag // any other tag (@raise, @example, @see, ...)
+}
+
+// YardTag represents a single YARD tag such as `@param name [Type] text`
+type YardTag struct {
+	Tag   string
+	Name  string
+	Types string
+	Text  string
+}
+
+var (
+	yardTagPattern      = regexp.MustCompile(`^@(\w+)\s*(.*)$`)
+	yardTypesPattern    = regexp.MustCompile(`^\[([^\]]*)\]\s*(.*)$`)
+	yardNamedTagPattern = regexp.MustCompile(`^([*&]{0,2}\w+[?!]?:?)\s*(.*)$`)
+)
+
+// Tags that take a parameter name in addition to types and text
+var yardNamedTags = map[string]bool{
+	"param":      true,
+	"option":     true,
+	"yieldparam": true,
+}
+
+// ReadDocComment reads the comment lines directly above the given 1-based line of a file.
+// Only the lines up to the definition are read, so this is cheap to call per hovered symbol.
+func ReadDocComment(filePath string, line int) []string {
+	if line <= 1 {
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var block []string
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		if lineNumber >= line {
+			break
+		}
+
+		text := scanner.Text()
+		if lineNumber == 1 {
+			text = strings.TrimPrefix(text, documents.UTF8BOM)
+		}
+
+		trimmed := strings.TrimSpace(text)
+		if strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "#!") {
+			block = append(block, stripCommentMarker(trimmed))
+		} else {
+			block = nil
+		}
+	}
+
+	return block
+}
+
+// ParseDocComment splits comment lines into a description and YARD tags.
+// Indented lines following a tag are treated as a continuation of that tag.
+func ParseDocComment(lines []string) *DocComment {
+	doc := &DocComment{}
+	var current *YardTag
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		switch current.Tag {
+		case "param":
+			doc.Params = append(doc.Params, *current)
+		case "return":
+			tag := *current
+			doc.Return = &tag
+		default:
+			doc.Tags = append(doc.Tags, *current)
+		}
+		current = nil
+	}
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if matches := yardTagPattern.FindStringSubmatch(trimmed); matches != nil {
+			flush()
+			current = parseYardTag(matches[1], matches[2])
+			continue
+		}
+
+		if current != nil {
+			if trimmed == "" && current.Tag != "example" {
+				flush()
+				continue
+			}
+			if current.Tag == "example" {
+				current.Text += "\n" + strings.TrimPrefix(line, "  ")
+			} else {
+				current.Text = strings.TrimSpace(current.Text + " " + trimmed)
+			}
+			continue
+		}
+
+		doc.Description = append(doc.Description, line)
+	}
+	flush()
+
+	// Trim blank lines around the description
+	for len(doc.Description) > 0 && strings.TrimSpace(doc.Description[0]) == "" {
+		doc.Description = doc.Description[1:]
+	}
+	for len(doc.Description) > 0 && strings.TrimSpace(doc.Description[len(doc.Description)-1]) == "" {
+		doc.Description = doc.Description[:len(doc.Description)-1]
+	}
+
+	return doc
+}
+
+// IsEmpty reports whether the comment has neither description nor tags
+func (d *DocComment) IsEmpty() bool {
+	return d == nil || (len(d.Description) == 0 && len(d.Params) == 0 && d.Return == nil && len(d.Tags) == 0)
+}
+
+// Summary returns the first line of the description, "" when there is none
+func (d *DocComment) Summary() string {
+	if d == nil || len(d.Description) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(d.Description[0])
+}
+
+// Signature returns the types documented by @param and @return tags as a
+// signature over the parameters of a def, false when no tag gives a type
+func (d *DocComment) Signature(params []string) (TypeSignature, bool) {
+	if d == nil {
+		return TypeSignature{}, false
+	}
+
+	types := make(map[string]string)
+	for _, tag := range d.Params {
+		if tag.Types != "" {
+			types[strings.Trim(tag.Name, "*&:")] = yardTypeUnion(tag.Types)
+		}
+	}
+	sig := TypeSignature{Source: "yard"}
+	if d.Return != nil {
+		sig.ReturnType = yardTypeUnion(d.Return.Types)
+	}
+	if len(types) == 0 && sig.ReturnType == "" {
+		return TypeSignature{}, false
+	}
+
+	for _, text := range params {
+		param := ParseParam(text)
+		sig.Params = append(sig.Params, TypedParam{Name: param.Name, Type: types[param.Name]})
+	}
+	return sig, true
+}
+
+// yardTypeUnion writes a YARD type list as a union, String | nil for [String, nil],
+// leaving the commas of Array<String, Integer> and Hash{Symbol => String} alone
+func yardTypeUnion(types string) string {
+	var alternatives []string
+	depth, start := 0, 0
+	for i := 0; i < len(types); i++ {
+		switch types[i] {
+		case '<', '(', '[', '{':
+			depth++
+		case '>', ')', ']', '}':
+			if i == 0 || types[i-1] != '=' { // the arrow of Hash{Symbol => String}
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, strings.TrimSpace(types[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	alternatives = append(alternatives, strings.TrimSpace(types[start:]))
+	return strings.Join(alternatives, " | ")
+}
+
+// parseYardTag parses the body of a tag. YARD accepts both
+// `@param name [Type] text` and `@param [Type] name text`.
+func parseYardTag(tag string, body string) *YardTag {
+	result := &YardTag{Tag: tag}
+
+	if tag == "example" {
+		result.Name = strings.TrimSpace(body)
+		return result
+	}
+
+	rest := strings.TrimSpace(body)
+	if matches := yardTypesPattern.FindStringSubmatch(rest); matches != nil {
+		result.Types = matches[1]
+		rest = matches[2]
+	}
+
+	if yardNamedTags[tag] {
+		if matches := yardNamedTagPattern.FindStringSubmatch(rest); matches != nil {
+			result.Name = matches[1]
+			rest = matches[2]
+		}
+		if result.Types == "" {
+			if matches := yardTypesPattern.FindStringSubmatch(rest); matches != nil {
+				result.Types = matches[1]
+				rest = matches[2]
+			}
+		}
+	}
+
+	result.Text = strings.TrimSpace(rest)
+	return result
+}
+
+// stripCommentMarker removes the leading `#` and a single following space
+func stripCommentMarker(trimmed string) string {
+	text := strings.TrimPrefix(trimmed, "#")
+	return strings.TrimPrefix(text, " ")
+}
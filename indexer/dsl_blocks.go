@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A block whose body runs in a class rather than where it is written:
+// included do, class_methods do, User.class_eval do, Config.instance_eval do
+var dslBlockPattern = regexp.MustCompile(`^\s*(?:((?:::)?[A-Z]\w*(?:::[A-Z]\w*)*)\.)?(included|prepended|class_methods|class_eval|class_exec|module_eval|module_exec|instance_eval|instance_exec)\b[^#]*\bdo\s*(\|[^|]*\|)?\s*$`)
+
+// dslBlock is where the methods defined in a DSL block go
+type dslBlock struct {
+	nesting   []string // namespace of the block body, nil for the enclosing one
+	singleton bool     // defs define class methods (class_methods, instance_eval)
+	included  bool     // runs in the classes including a concern (included, prepended)
+}
+
+// dslBlockOf recognizes a line of masked code opening a DSL block. Methods of
+// included and prepended blocks stay on the concern; class_eval and friends
+// define them on their receiver, taken as a top-level constant path.
+func dslBlockOf(code string) (dslBlock, bool) {
+	matches := dslBlockPattern.FindStringSubmatch(code)
+	if matches == nil {
+		return dslBlock{}, false
+	}
+
+	receiver, method := matches[1], matches[2]
+	var block dslBlock
+	if receiver != "" {
+		block.nesting = strings.Split(strings.TrimPrefix(receiver, "::"), "::")
+	}
+	switch method {
+	case "class_methods", "instance_eval", "instance_exec":
+		block.singleton = true
+	case "included", "prepended":
+		block.included = receiver == ""
+	}
+	return block, true
+}
+
+// inSingletonBlock reports whether a def at this point defines a class method
+// through an enclosing class_methods or instance_eval block
+func inSingletonBlock(frames []bodyFrame) bool {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].entry >= 0 {
+			return false
+		}
+		if frames[i].dsl {
+			return frames[i].singleton
+		}
+	}
+	return false
+}
+
+// inConcern reports whether the innermost class or module being defined extends
+// ActiveSupport::Concern
+func inConcern(frames []bodyFrame) bool {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].namespace {
+			return frames[i].concern
+		}
+	}
+	return false
+}
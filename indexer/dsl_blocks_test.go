@@ -0,0 +1,126 @@
+package indexer
+
+import "testing"
+
+func TestConcernBlocksKeepMethodsOnTheirClass(t *testing.T) {
+	entries := parseTestSource(t, `module Archivable
+  extend ActiveSupport::Concern
+
+  included do
+    scope :archived, -> { where.not(archived_at: nil) }
+    has_many :archive_entries
+
+    def archive_label
+      "archived"
+    end
+  end
+
+  class_methods do
+    def archive_all
+      update_all(archived_at: Time.current)
+    end
+  end
+
+  def archive!
+    update!(archived_at: Time.current)
+  end
+end
+
+User.class_eval do
+  def archivable?
+    true
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Archivable", "", "public", 22},
+		{"Archivable#archive_label", "Archivable", "public", 10},
+		{"Archivable.archive_all", "Archivable", "public", 16},
+		// The blocks' ends do not close the module early
+		{"Archivable#archive!", "Archivable", "public", 21},
+		{"User#archivable?", "User", "public", 27},
+	})
+	if scope := findEntry(t, entries, "Archivable.archived"); scope.Type != SymbolScope || scope.Parent != "Archivable" {
+		t.Errorf("archived: type %d in %q, want a scope of Archivable", scope.Type, scope.Parent)
+	}
+	if association := findEntry(t, entries, "Archivable#archive_entries"); association.Parent != "Archivable" {
+		t.Errorf("archive_entries in %q, want Archivable", association.Parent)
+	}
+}
+
+func TestDSLBlockOf(t *testing.T) {
+	tests := []struct {
+		code      string
+		ok        bool
+		nesting   []string
+		singleton bool
+	}{
+		{"  included do", true, nil, false},
+		{"  class_methods do", true, nil, true},
+		{"User.class_eval do", true, []string{"User"}, false},
+		{"::Admin::User.class_eval do |klass|", true, []string{"Admin", "User"}, false},
+		{"Config.instance_eval do", true, []string{"Config"}, true},
+		{"  included", false, nil, false},
+		{"  items.each do |item|", false, nil, false},
+	}
+	for _, test := range tests {
+		block, ok := dslBlockOf(test.code)
+		if ok != test.ok || block.singleton != test.singleton || len(block.nesting) != len(test.nesting) {
+			t.Errorf("dslBlockOf(%q) = %+v, %v; want %v, %v, %v", test.code, block, ok, test.nesting, test.singleton, test.ok)
+			continue
+		}
+		for i := range test.nesting {
+			if block.nesting[i] != test.nesting[i] {
+				t.Errorf("dslBlockOf(%q) nesting = %v, want %v", test.code, block.nesting, test.nesting)
+				break
+			}
+		}
+	}
+}
+
+func TestConcernIncludedBlocksAreMixedIn(t *testing.T) {
+	entries := parseTestSource(t, `module Archivable
+  extend ActiveSupport::Concern
+
+  included do
+    scope :archived, -> { where.not(archived_at: nil) }
+    belongs_to :archiver
+
+    def archive_label
+    end
+  end
+
+  class_methods do
+    def archive_all
+    end
+  end
+
+  def archive!
+  end
+end
+
+module Plain
+  included do
+    def hook
+    end
+  end
+end
+`)
+	tests := map[string]bool{
+		"Archivable.archived":      true,
+		"Archivable#archiver":      true,
+		"Archivable#archive_label": true,
+		"Archivable.archive_all":   false,
+		"Archivable#archive!":      false,
+		// Without extend ActiveSupport::Concern, included is not the concern's
+		"Plain#hook": false,
+	}
+	for fqn, want := range tests {
+		if got := findEntry(t, entries, fqn).MixedIn; got != want {
+			t.Errorf("%s: MixedIn = %v, want %v", fqn, got, want)
+		}
+	}
+	if all := findEntry(t, entries, "Archivable.archive_all"); all.Type != SymbolSingletonMethod {
+		t.Errorf("Archivable.archive_all: type %d, want a singleton method", all.Type)
+	}
+}
@@ -0,0 +1,57 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func TestShouldIndexChecksEveryAncestorDirectory(t *testing.T) {
+	idx := NewWithOptions("/workspace", log.New(io.Discard, "", 0), Options{
+		ExcludeDirs: []string{"fixtures", "spec/dummy", "!vendor"},
+	})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"app/models/user.rb", true},
+		// Default and configured names anywhere above the file
+		{"node_modules/pkg/lib/tasks/build.rb", false},
+		{"tmp/cache/bootsnap/compiled.rb", false},
+		{"spec/fixtures/files/sample.rb", false},
+		// Path suffixes match whole directories only
+		{"spec/dummy/app/models/user.rb", false},
+		{"engines/billing/spec/dummy/config/application.rb", false},
+		{"spec/dummy_app/models/user.rb", true},
+		// A re-enabled default
+		{"vendor/engines/billing/app/models/invoice.rb", true},
+	}
+	for _, test := range tests {
+		path := filepath.Join("/workspace", filepath.FromSlash(test.path))
+		if got := idx.ShouldIndex(path); got != test.want {
+			t.Errorf("ShouldIndex(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestUpdateFileSkipsExcludedDirectories(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"app/models/user.rb":               "class User\nend\n",
+		"spec/dummy/app/models/widget.rb":  "class Widget\nend\n",
+		"node_modules/gem/lib/template.rb": "class Template\nend\n",
+	}, Options{ExcludeDirs: []string{"spec/dummy"}})
+
+	for _, name := range []string{"spec/dummy/app/models/widget.rb", "node_modules/gem/lib/template.rb"} {
+		idx.UpdateFile(filepath.Join(root, filepath.FromSlash(name)))
+	}
+	for _, class := range []string{"Widget", "Template"} {
+		if entries := idx.Lookup(class); len(entries) > 0 {
+			t.Errorf("%s indexed from an excluded directory: %+v", class, entries)
+		}
+	}
+	if len(idx.Lookup("User")) != 1 {
+		t.Error("User not indexed")
+	}
+}
@@ -0,0 +1,45 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOversizedAndBinaryFilesAreSkipped(t *testing.T) {
+	// About 2MB of generated methods, over the default limit of 1MB
+	var generated strings.Builder
+	generated.WriteString("class Generated\n")
+	for generated.Len() < 2<<20 {
+		generated.WriteString("  def generated_method_with_a_long_name; end\n")
+	}
+	generated.WriteString("end\n")
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"lib/generated.rb":   generated.String(),
+		"lib/compiled.rb":    "class Compiled\x00\x01\x02\nend\n",
+		"app/models/user.rb": "class User\nend\n",
+	})
+	var logs bytes.Buffer
+	idx := NewWithOptions(root, log.New(&logs, "", 0), Options{})
+	idx.BuildIndex(context.Background())
+
+	for _, name := range []string{"lib/generated.rb", "lib/compiled.rb"} {
+		if symbols := idx.GetFileSymbols(filepath.Join(root, name)); len(symbols) != 0 {
+			t.Errorf("%s indexed %d symbols, want it skipped", name, len(symbols))
+		}
+	}
+	if entries := idx.Lookup("User"); len(entries) != 1 {
+		t.Errorf("Lookup(User) = %+v, want the regular file indexed", entries)
+	}
+	for _, reason := range []string{"exceeds the size limit", "looks like a binary file"} {
+		if !strings.Contains(logs.String(), reason) {
+			t.Errorf("log does not say a file %s:\n%s", reason, logs.String())
+		}
+	}
+
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FoldingSpan is a foldable run of lines, 1-based, found in source text rather
+// than in the indexed definitions
+type FoldingSpan struct {
+	Line    int
+	EndLine int
+	Heredoc bool // a heredoc from its opener to its terminator, else a bracketed literal
+}
+
+// heredocPattern matches a heredoc opener (<<~SQL, <<-EOS, <<'RAW')
+var heredocPattern = regexp.MustCompile("<<([~-]?)([\"'`]?)([A-Za-z_]\\w*)([\"'`]?)")
+
+// heredoc is an opened heredoc waiting for its terminator
+type heredoc struct {
+	line       int
+	terminator string
+	indented   bool // <<~ and <<- allow an indented terminator
+}
+
+// FoldingSpans finds the heredocs and the [ ] and { } literals spanning several
+// lines of Ruby source. Heredoc bodies are not code, so brackets in them are ignored.
+func FoldingSpans(source string) []FoldingSpan {
+	var spans []FoldingSpan
+	var pending []heredoc // heredocs opened on a line, their bodies follow in order
+
+	type bracket struct {
+		char byte
+		line int
+	}
+	var brackets []bracket
+
+	for i, line := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		if len(pending) > 0 {
+			current := pending[0]
+			text := line
+			if current.indented {
+				text = strings.TrimSpace(line)
+			}
+			if text == current.terminator {
+				spans = append(spans, FoldingSpan{Line: current.line, EndLine: lineNumber, Heredoc: true})
+				pending = pending[1:]
+			}
+			continue
+		}
+
+		code := maskStringsAndComments(line)
+		for _, loc := range heredocPattern.FindAllStringSubmatchIndex(line, -1) {
+			if !strings.HasPrefix(code[loc[0]:], "<<") || line[loc[4]:loc[5]] != line[loc[8]:loc[9]] {
+				continue
+			}
+			indented := loc[3] > loc[2]
+			terminator := line[loc[6]:loc[7]]
+			// A bare lowercase name is a shift (list <<item), not a heredoc
+			if !indented && loc[5] == loc[4] && strings.ToUpper(terminator) != terminator {
+				continue
+			}
+			pending = append(pending, heredoc{line: lineNumber, terminator: terminator, indented: indented})
+		}
+
+		for j := 0; j < len(code); j++ {
+			switch c := code[j]; c {
+			case '[', '{':
+				brackets = append(brackets, bracket{char: c, line: lineNumber})
+			case ']', '}':
+				open := byte('[')
+				if c == '}' {
+					open = '{'
+				}
+				if len(brackets) == 0 || brackets[len(brackets)-1].char != open {
+					continue
+				}
+				opened := brackets[len(brackets)-1]
+				brackets = brackets[:len(brackets)-1]
+				if lineNumber > opened.line {
+					spans = append(spans, FoldingSpan{Line: opened.line, EndLine: lineNumber})
+				}
+			}
+		}
+	}
+	return spans
+}
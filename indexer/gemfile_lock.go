@@ -0,0 +1,110 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A locked gem under a `specs:` section, e.g. "    activerecord (7.1.2)".
+// Dependencies of a gem are indented further and carry requirements instead.
+var gemSpecPattern = regexp.MustCompile(`^ {4}([\w.-]+) \(([^)]+)\)$`)
+
+// parseGemfileLock reads the locked version of every gem in a Gemfile.lock
+func parseGemfileLock(filePath string) map[string]string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	versions := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if matches := gemSpecPattern.FindStringSubmatch(scanner.Text()); matches != nil {
+			versions[matches[1]] = matches[2]
+		}
+	}
+	return versions
+}
+
+// loadGemfileLock records the gem versions locked by a workspace folder's Gemfile.lock
+func (idx *Index) loadGemfileLock(root string) {
+	versions := parseGemfileLock(filepath.Join(root, "Gemfile.lock"))
+	if len(versions) == 0 {
+		return
+	}
+
+	idx.mutex.Lock()
+	for name, version := range versions {
+		idx.gemVersions[name] = version
+	}
+	idx.mutex.Unlock()
+}
+
+// loadGemfileLocks records the gem versions locked by the Gemfile.lock of every
+// workspace folder, forgetting those of folders no longer indexed
+func (idx *Index) loadGemfileLocks() {
+	versions := make(map[string]string)
+	for _, root := range idx.Roots() {
+		for name, version := range parseGemfileLock(filepath.Join(root, "Gemfile.lock")) {
+			versions[name] = version
+		}
+	}
+
+	idx.mutex.Lock()
+	idx.gemVersions = versions
+	idx.mutex.Unlock()
+}
+
+// IndexGems re-reads the Gemfile.lock of every workspace folder and brings the
+// indexed gem sources in line with it, after a bundle install or update. Gems
+// live in versioned directories, so changed versions show up as new and
+// vanished files. It returns how many files were re-parsed and removed.
+func (idx *Index) IndexGems(ctx context.Context) (int, int) {
+	idx.loadGemfileLocks()
+	return idx.Refresh(ctx)
+}
+
+// GemVersion returns the locked version of a gem, "" when it is not in a Gemfile.lock
+func (idx *Index) GemVersion(name string) string {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return idx.gemVersions[name]
+}
+
+// gemOfPath returns the locked gem whose installation directory holds a file
+// (.../gems/activerecord-7.1.2/lib/...), "" for workspace code
+func (idx *Index) gemOfPath(filePath string) string {
+	segments := strings.Split(filepath.ToSlash(filePath), "/")
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	for i := len(segments) - 2; i > 0; i-- {
+		if segments[i-1] != "gems" {
+			continue
+		}
+		// Platform gems append the platform to the version (nokogiri-1.15.4-x86_64-linux)
+		for name, version := range idx.gemVersions {
+			if strings.HasPrefix(segments[i], name+"-"+version) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// tagGem marks entries parsed from an installed gem with the gem's name
+func (idx *Index) tagGem(filePath string, entries []SymbolEntry) {
+	gem := idx.gemOfPath(filePath)
+	if gem == "" {
+		return
+	}
+	for i := range entries {
+		entries[i].Gem = gem
+	}
+}
@@ -0,0 +1,130 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a pattern of a .gitignore file
+type ignoreRule struct {
+	pattern  string // slash-separated, relative to the directory of the file
+	negate   bool   // !pattern re-includes what an earlier pattern ignored
+	dirOnly  bool   // pattern/ only matches directories
+	anchored bool   // a slash before the end ties the pattern to the file's directory
+}
+
+// parseIgnoreFile reads the rules of a .gitignore file, nil when there is none
+func parseIgnoreFile(filePath string) []ignoreRule {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matches reports whether a rule matches a path relative to the directory of
+// its .gitignore file
+func (rule ignoreRule) matches(relPath string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		matched, _ := path.Match(rule.pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(rule.pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// ignoreRules returns the rules of the .gitignore file of a directory, read once
+func (idx *Index) ignoreRules(dir string) []ignoreRule {
+	idx.ignoreMutex.Lock()
+	defer idx.ignoreMutex.Unlock()
+
+	rules, read := idx.ignoreFiles[dir]
+	if !read {
+		rules = parseIgnoreFile(filepath.Join(dir, ".gitignore"))
+		idx.ignoreFiles[dir] = rules
+	}
+	return rules
+}
+
+// clearIgnoreRules forgets the .gitignore files read, so edits to them apply to
+// the next walk
+func (idx *Index) clearIgnoreRules() {
+	idx.ignoreMutex.Lock()
+	defer idx.ignoreMutex.Unlock()
+	idx.ignoreFiles = make(map[string][]ignoreRule)
+}
+
+// isGitignored reports whether the .gitignore files of a workspace folder ignore
+// a path. The files stack as directories nest: a file's patterns apply to its
+// own subtree, after those of the directories above it, and the last pattern
+// matching a path decides, so !pattern re-includes it. As with git, nothing
+// inside an ignored directory can be re-included.
+func (idx *Index) isGitignored(filePath string, isDir bool) bool {
+	if !idx.options.Gitignore {
+		return false
+	}
+	root := idx.RootOf(filePath)
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for depth := 1; depth <= len(segments); depth++ {
+		if idx.ignoredAt(root, segments[:depth], depth < len(segments) || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredAt applies the .gitignore files from a workspace folder down to the
+// directory holding a path, given as its segments under the folder
+func (idx *Index) ignoredAt(root string, segments []string, isDir bool) bool {
+	ignored := false
+	dir := root
+	for depth := 0; depth < len(segments); depth++ {
+		if depth > 0 {
+			dir = filepath.Join(dir, segments[depth-1])
+		}
+		relPath := strings.Join(segments[depth:], "/")
+		for _, rule := range idx.ignoreRules(dir) {
+			if rule.matches(relPath, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
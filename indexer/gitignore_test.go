@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseIgnoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".gitignore")
+	content := "# build output\n\n/tmp\nlog/\n*.log   \n!keep.log\n\\!bang.rb\n\\#hash.rb\ndb/*.sqlite3\n/\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ignoreRule{
+		{pattern: "tmp", anchored: true},
+		{pattern: "log", dirOnly: true},
+		{pattern: "*.log"},
+		{pattern: "keep.log", negate: true},
+		{pattern: "!bang.rb"},
+		{pattern: "#hash.rb"},
+		{pattern: "db/*.sqlite3", anchored: true},
+	}
+	rules := parseIgnoreFile(path)
+	if len(rules) != len(want) {
+		t.Fatalf("parseIgnoreFile = %+v, want %+v", rules, want)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+
+	if rules := parseIgnoreFile(filepath.Join(t.TempDir(), ".gitignore")); rules != nil {
+		t.Errorf("parseIgnoreFile of a missing file = %+v, want nil", rules)
+	}
+}
+
+func TestIgnoreRuleMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ignoreRule
+		relPath string
+		isDir   bool
+		want    bool
+	}{
+		{"basename at the top", ignoreRule{pattern: "*.log"}, "debug.log", false, true},
+		{"basename in a subdirectory", ignoreRule{pattern: "*.log"}, "log/debug.log", false, true},
+		{"basename not matching", ignoreRule{pattern: "*.log"}, "app/log.rb", false, false},
+		{"anchored at the top", ignoreRule{pattern: "tmp", anchored: true}, "tmp", true, true},
+		{"anchored not below the top", ignoreRule{pattern: "tmp", anchored: true}, "app/tmp", true, false},
+		{"anchored with a directory", ignoreRule{pattern: "db/*.sqlite3", anchored: true}, "db/development.sqlite3", false, true},
+		{"anchored with a directory elsewhere", ignoreRule{pattern: "db/*.sqlite3", anchored: true}, "test/db/test.sqlite3", false, false},
+		{"directory rule on a directory", ignoreRule{pattern: "log", dirOnly: true}, "log", true, true},
+		{"directory rule on a file", ignoreRule{pattern: "log", dirOnly: true}, "log", false, false},
+		{"negation matches like its pattern", ignoreRule{pattern: "keep.log", negate: true}, "log/keep.log", false, true},
+	}
+	for _, test := range tests {
+		if got := test.rule.matches(test.relPath, test.isDir); got != test.want {
+			t.Errorf("%s: %+v matches(%q, %v) = %v, want %v", test.name, test.rule, test.relPath, test.isDir, got, test.want)
+		}
+	}
+}
+
+func TestIsGitignored(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		".gitignore":                   "*.generated.rb\n!schema.generated.rb\n/build/\ncoverage/\ntmp\n",
+		"app/.gitignore":               "!*.generated.rb\n",
+		"app/models/user.rb":           "",
+		"app/models/user.generated.rb": "",
+		"lib/user.generated.rb":        "",
+		"lib/schema.generated.rb":      "",
+		"build/output.rb":              "",
+		"lib/build/task.rb":            "",
+		"coverage/.gitignore":          "!report.rb\n",
+		"coverage/report.rb":           "",
+		"lib/coverage.rb":              "",
+		"tmp/cache.rb":                 "",
+	})
+	idx := NewWithOptions(root, log.New(io.Discard, "", 0), Options{Gitignore: true})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app/models/user.rb", false, false},
+		// Basename pattern, and its negation
+		{"lib/user.generated.rb", false, true},
+		{"lib/schema.generated.rb", false, false},
+		// A nested .gitignore overrides the one above it within its subtree
+		{"app/models/user.generated.rb", false, false},
+		// Anchored directory rule: the top-level build only
+		{"build", true, true},
+		{"build/output.rb", false, true},
+		{"lib/build/task.rb", false, false},
+		// Directory-only rule: a file of that name is kept
+		{"coverage", true, true},
+		{"lib/coverage.rb", false, false},
+		// Nothing inside an ignored directory can be re-included
+		{"coverage/report.rb", false, true},
+		{"tmp/cache.rb", false, true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		if got := idx.isGitignored(path, test.isDir); got != test.want {
+			t.Errorf("isGitignored(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+
+	if NewWithOptions(root, log.New(io.Discard, "", 0), Options{}).isGitignored(filepath.Join(root, "tmp/cache.rb"), false) {
+		t.Error("isGitignored without the Gitignore option = true, want false")
+	}
+}
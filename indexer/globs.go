@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isExcludedFile reports whether a file matches one of the exclude globs
+func (idx *Index) isExcludedFile(filePath string) bool {
+	if len(idx.options.ExcludeGlobs) == 0 {
+		return false
+	}
+
+	rel, err := filepath.Rel(idx.RootOf(filePath), filePath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, pattern := range idx.options.ExcludeGlobs {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated relative path against a filepath.Match
+// pattern extended with "**" for any number of directories. A pattern without
+// a slash matches the file name in any directory.
+func matchGlob(pattern string, relPath string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every split of the remaining segments between ** and the rest of the pattern
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
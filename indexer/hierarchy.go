@@ -0,0 +1,213 @@
+package indexer
+
+import (
+	"sort"
+	"strings"
+)
+
+// TypeDefinition returns the definition standing for a class or module, the one
+// declaring its superclass when it is reopened
+func (idx *Index) TypeDefinition(fqn string) (SymbolEntry, bool) {
+	var first SymbolEntry
+	found := false
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.FullyQualifiedName != fqn || (entry.Type != SymbolClass && entry.Type != SymbolModule) {
+			continue
+		}
+		if entry.Type == SymbolClass && entry.Detail != "" {
+			return entry, true
+		}
+		if !found {
+			first, found = entry, true
+		}
+	}
+	return first, found
+}
+
+// MergedClass is the single logical view of a class or module whose bodies are
+// spread over several files or reopenings
+type MergedClass struct {
+	Definition SymbolEntry   // the body standing for it, as TypeDefinition picks it
+	Bodies     []SymbolEntry // every body defining or reopening it, sorted by file and line
+	Mixins     []string      // modules included or prepended across the bodies
+}
+
+// MergedClass aggregates the bodies of a class or module across files, false
+// when it is not indexed
+func (idx *Index) MergedClass(fqn string) (MergedClass, bool) {
+	definition, found := idx.TypeDefinition(fqn)
+	if !found {
+		return MergedClass{}, false
+	}
+	return MergedClass{Definition: definition, Bodies: idx.classBodies(fqn), Mixins: idx.Mixins(fqn)}, true
+}
+
+// classBodies returns the bodies of a class or module, ordered by file and line
+func (idx *Index) classBodies(fqn string) []SymbolEntry {
+	var bodies []SymbolEntry
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.FullyQualifiedName == fqn && (entry.Type == SymbolClass || entry.Type == SymbolModule) {
+			bodies = append(bodies, entry)
+		}
+	}
+	sort.Slice(bodies, func(i, j int) bool {
+		a, b := bodies[i], bodies[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.Line < b.Line
+	})
+	return bodies
+}
+
+// Mixins returns the resolved modules a class or module includes or prepends,
+// merged across every body reopening it, in the order they are mixed in: as
+// written, but from last to first within a list (include A, B mixes in B first)
+func (idx *Index) Mixins(fqn string) []string {
+	var mixins []string
+	seen := make(map[string]bool)
+	for _, entry := range idx.classBodies(fqn) {
+		for _, mixin := range entry.Mixins {
+			resolved := idx.ResolveConstantPath(mixin, fqn)
+			if !seen[resolved] {
+				seen[resolved] = true
+				mixins = append(mixins, resolved)
+			}
+		}
+	}
+	return mixins
+}
+
+// DelegateMissingTo returns the method a class forwards the methods it lacks to
+// through delegate_missing_to, in any body reopening it or inherited from a
+// superclass, "" when it forwards nothing
+func (idx *Index) DelegateMissingTo(fqn string) string {
+	for _, class := range append([]string{fqn}, idx.SuperclassChain(fqn)...) {
+		for _, entry := range idx.Lookup(class) {
+			if entry.FullyQualifiedName == class && entry.DelegatesTo != "" &&
+				(entry.Type == SymbolClass || entry.Type == SymbolModule) {
+				return entry.DelegatesTo
+			}
+		}
+	}
+	return ""
+}
+
+// ForwardedClass returns the class whose instances receive the methods a class
+// forwards through delegate_missing_to, "" when unknown: the model of an
+// association of that name, else the class the target is named after
+// (:user -> User), else for generic targets (:object, :model) the class a
+// decorator or presenter is named after (UserDecorator -> User).
+func (idx *Index) ForwardedClass(fqn string) string {
+	target := idx.DelegateMissingTo(fqn)
+	if target == "" {
+		return ""
+	}
+
+	owners := append([]string{fqn}, idx.SuperclassChain(fqn)...)
+	for _, entry := range idx.Lookup(target) {
+		if entry.Type != SymbolAssociation {
+			continue
+		}
+		for _, owner := range owners {
+			if entry.Parent == owner {
+				if class := idx.classInScope(idx.AssociationClassName(entry), owner); class != "" {
+					return class
+				}
+			}
+		}
+	}
+
+	if class := idx.classInScope(snakeToCamel(target), fqn); class != "" {
+		return class
+	}
+	name := classNameOnly(fqn)
+	for _, suffix := range []string{"Decorator", "Presenter"} {
+		if decorated, found := strings.CutSuffix(name, suffix); found && decorated != "" {
+			return idx.classInScope(decorated, fqn)
+		}
+	}
+	return ""
+}
+
+// classInScope resolves a constant written within a scope to the fully qualified
+// name of the class it refers to, "" when it is not an indexed class
+func (idx *Index) classInScope(path string, scope string) string {
+	for _, entry := range idx.LookupInScope(path, scope) {
+		if entry.Type == SymbolClass {
+			return entry.FullyQualifiedName
+		}
+	}
+	return ""
+}
+
+// AncestorsOf returns a class or module followed by what Ruby searches for its
+// methods after it, nearest first: the modules it mixes in, the last written
+// first and each followed by its own, then its superclass and that one's
+// ancestors. Prepended modules are searched as if included, since Mixins does
+// not tell them apart.
+func (idx *Index) AncestorsOf(fqn string) []string {
+	var ancestors []string
+	seen := make(map[string]bool)
+
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		ancestors = append(ancestors, name)
+		mixins := idx.Mixins(name)
+		for i := len(mixins) - 1; i >= 0; i-- {
+			add(mixins[i])
+		}
+	}
+	for _, class := range append([]string{fqn}, idx.SuperclassChain(fqn)...) {
+		add(class)
+	}
+	return ancestors
+}
+
+// Supertypes returns the direct supertypes of a class or module: its superclass
+// followed by the modules it mixes in
+func (idx *Index) Supertypes(fqn string) []string {
+	var supertypes []string
+	if superclass := idx.superclassOf(fqn); superclass != "" {
+		supertypes = append(supertypes, superclass)
+	}
+	return append(supertypes, idx.Mixins(fqn)...)
+}
+
+// Subtypes returns the classes inheriting from a class and the classes and
+// modules mixing in a module, sorted by name
+func (idx *Index) Subtypes(fqn string) []string {
+	idx.mutex.RLock()
+	var candidates []SymbolEntry
+	for _, entries := range idx.fileSymbols {
+		for _, entry := range entries {
+			if (entry.Type == SymbolClass && entry.Detail != "") || len(entry.Mixins) > 0 {
+				candidates = append(candidates, entry)
+			}
+		}
+	}
+	idx.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var subtypes []string
+	for _, entry := range candidates {
+		if seen[entry.FullyQualifiedName] || entry.FullyQualifiedName == fqn {
+			continue
+		}
+		matches := entry.Type == SymbolClass && entry.Detail != "" && idx.ResolveConstantPath(entry.Detail, entry.Parent) == fqn
+		for _, mixin := range entry.Mixins {
+			matches = matches || idx.ResolveConstantPath(mixin, entry.FullyQualifiedName) == fqn
+		}
+		if matches {
+			seen[entry.FullyQualifiedName] = true
+			subtypes = append(subtypes, entry.FullyQualifiedName)
+		}
+	}
+
+	sort.Strings(subtypes)
+	return subtypes
+}
@@ -0,0 +1,116 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// indexTestSources indexes sources (workspace-relative path -> source) in memory
+// and returns the index with every entry it holds
+func indexTestSources(sources map[string]string) (*Index, []SymbolEntry) {
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	paths := make(map[string]string, len(sources))
+	for name, source := range sources {
+		paths["/workspace/"+name] = source
+	}
+	idx.IndexSources(paths)
+
+	var entries []SymbolEntry
+	idx.AllSymbols(func(entry SymbolEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return idx, entries
+}
+
+func TestAncestorsOfOverridingClasses(t *testing.T) {
+	idx, entries := indexTestSources(map[string]string{
+		"app/models/user.rb":       "class User < ApplicationRecord\n  def full_name\n    \"#{first_name} #{last_name}\"\n  end\nend\n",
+		"app/models/admin_user.rb": "class AdminUser < User\n  def full_name\n    super + \" (admin)\"\n  end\nend\n",
+		"app/models/titled.rb":     "module Titled\n  def full_name\n    \"#{title} #{super}\"\n  end\nend\n",
+		"app/models/doctor.rb":     "class Doctor < User\n  include Titled\n\n  def full_name\n    super.strip\n  end\nend\n",
+	})
+
+	checkEntries(t, entries, []entrySpec{
+		{"AdminUser", "", "public", 5},
+		{"AdminUser#full_name", "AdminUser", "public", 4},
+		{"Doctor", "", "public", 7},
+		{"Doctor#full_name", "Doctor", "public", 6},
+		{"Titled#full_name", "Titled", "public", 4},
+	})
+
+	tests := []struct {
+		fqn  string
+		want []string
+	}{
+		{"AdminUser", []string{"AdminUser", "User", "ApplicationRecord"}},
+		// Mixed-in modules come before the superclass
+		{"Doctor", []string{"Doctor", "Titled", "User", "ApplicationRecord"}},
+	}
+	for _, test := range tests {
+		if got := idx.AncestorsOf(test.fqn); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("AncestorsOf(%s) = %v, want %v", test.fqn, got, test.want)
+		}
+	}
+}
+
+func TestForwardedClassOfDecorators(t *testing.T) {
+	idx, entries := indexTestSources(map[string]string{
+		"app/models/user.rb":               "class User < ApplicationRecord\n  has_many :posts\nend\n",
+		"app/models/post.rb":               "class Post < ApplicationRecord\nend\n",
+		"app/decorators/user_decorator.rb": "class UserDecorator\n  delegate_missing_to :user\n\n  attr_reader :user\n\n  def initialize(user)\n    @user = user\n  end\n\n  def display_name\n    full_name.upcase\n  end\nend\n",
+		"app/presenters/user_presenter.rb": "class UserPresenter\n  delegate_missing_to :object\nend\n",
+		"app/models/feed.rb":               "class Feed\n  belongs_to :latest, class_name: \"Post\"\n  delegate_missing_to :latest\nend\n",
+		"app/models/admin_decorator.rb":    "class AdminDecorator < UserDecorator\nend\n",
+	})
+
+	checkEntries(t, entries, []entrySpec{
+		{"UserDecorator", "", "public", 13},
+		{"UserDecorator#user", "UserDecorator", "public", 0},
+		{"UserDecorator#display_name", "UserDecorator", "public", 12},
+	})
+	if decorator := findEntry(t, entries, "UserDecorator"); decorator.DelegatesTo != "user" {
+		t.Errorf("UserDecorator forwards to %q, want user", decorator.DelegatesTo)
+	}
+
+	tests := []struct {
+		fqn  string
+		want string
+	}{
+		// The target named after a class
+		{"UserDecorator", "User"},
+		// A generic target, resolved from the presenter's name
+		{"UserPresenter", "User"},
+		// An association, resolved to its model
+		{"Feed", "Post"},
+		// Inherited from the superclass
+		{"AdminDecorator", "User"},
+		{"User", ""},
+	}
+	for _, test := range tests {
+		if got := idx.ForwardedClass(test.fqn); got != test.want {
+			t.Errorf("ForwardedClass(%s) = %q, want %q", test.fqn, got, test.want)
+		}
+	}
+}
+
+func TestIncludeSeveralModules(t *testing.T) {
+	idx, _ := indexTestSources(map[string]string{
+		"app/models/concerns.rb": "module Searchable\nend\n\nmodule Auditable\nend\n\nmodule Sluggable\nend\n",
+		"app/models/user.rb":     "class User < ApplicationRecord\n  include Searchable, Auditable\n  prepend ::Sluggable\n  extend ActiveSupport::Concern, Forwardable\nend\n",
+	})
+
+	if mixins := idx.Mixins("User"); !reflect.DeepEqual(mixins, []string{"Auditable", "Searchable", "Sluggable"}) {
+		t.Errorf("Mixins(User) = %v, want each included module, the last written first", mixins)
+	}
+	// Ruby searches the first module of the list first
+	want := []string{"User", "Sluggable", "Searchable", "Auditable", "ApplicationRecord"}
+	if ancestors := idx.AncestorsOf("User"); !reflect.DeepEqual(ancestors, want) {
+		t.Errorf("AncestorsOf(User) = %v, want %v", ancestors, want)
+	}
+	if subtypes := idx.Subtypes("Auditable"); !reflect.DeepEqual(subtypes, []string{"User"}) {
+		t.Errorf("Subtypes(Auditable) = %v, want [User]", subtypes)
+	}
+}
@@ -2,14 +2,23 @@ package indexer
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
+	"unicode/utf8"
+
+	"github.com/humberto/ruby-lsp-go/documents"
 )
 
 // SymbolType represents the kind of Ruby symbol
@@ -24,6 +33,9 @@ const (
 	SymbolScope
 	SymbolAssociation
 	SymbolAttrAccessor
+	SymbolInstanceVariable
+	SymbolRoute // Rails path/url helper synthesized from config/routes.rb
+	SymbolClassVar
 )
 
 // SymbolEntry represents a single indexed symbol
@@ -36,37 +48,225 @@ type SymbolEntry struct {
 	EndLine            int
 	Character          int
 	EndCharacter       int
-	Parent             string // enclosing class/module
-	Visibility         string // public, private, protected
-	Detail             string // extra info (e.g., superclass, association type)
+	Parent             string          // enclosing class/module
+	Visibility         string          // public, private, protected
+	Detail             string          // extra info (e.g., superclass, association type)
+	Params             []string        // method parameters as written in the def
+	Types              []TypeSignature // sorbet sig and YARD types preceding a method
+	Gem                string          // gem the definition was installed from, "" for workspace code
+	Summary            string          // first line of a method's doc comment
+	Mixins             []string        // modules a class or module body includes or prepends, as written
+	MixedIn            bool            // defined in a concern's included block, for the classes including it
+	DelegatesTo        string          // method a class forwards missing methods to (delegate_missing_to :user)
+}
+
+// Options configures what the indexer collects
+type Options struct {
+	TypeSignatures bool  // parse sorbet sigs and sig/**/*.rbs files
+	SchemaColumns  bool  // index db/schema.rb columns as model attributes
+	MaxSymbols     int   // symbols kept across the workspace, 0 for the default
+	MaxFileSymbols int   // files defining more symbols are skipped as generated, 0 for the default
+	MaxFileSize    int64 // larger files are skipped without parsing, 0 for the default
+	FollowSymlinks bool  // descend into symlinked directories, indexing files under their real paths
+	ClassVariables bool  // index @@class_variable assignments
+	Gitignore      bool  // skip what the .gitignore files of the workspace ignore
+
+	// Mode is when files are indexed: ModeEager (the default), ModeLazy or ModeOnSave
+	Mode string
+
+	// ExcludeDirs adds directories to skip, by name ("fixtures") or by path
+	// suffix ("spec/dummy"). A leading "!" re-enables a default ("!vendor").
+	ExcludeDirs []string
+
+	// RubyFiles lists the extensions (".rake") and file names ("Gemfile") holding
+	// Ruby source, nil for defaultRubyFiles
+	RubyFiles []string
+
+	// ExcludeGlobs skips files matching any pattern ("db/schema.rb", "**/*_pb.rb"),
+	// relative to the workspace root
+	ExcludeGlobs []string
+
+	// Irregulars adds irregular nouns, singular -> plural ("person": "people"), to
+	// the ones known by default when relating tables, associations and models
+	Irregulars map[string]string
+}
+
+// Extensions and extensionless file names indexed as Ruby by default
+var defaultRubyFiles = []string{
+	".rb", ".rake", ".ru", ".gemspec", ".jbuilder",
+	"Rakefile", "Gemfile", "Guardfile", "Capfile",
+}
+
+// Default symbol limits, generous enough that normal projects never reach them
+const (
+	defaultMaxSymbols     = 500000
+	defaultMaxFileSymbols = 20000
+	defaultMaxFileSize    = 1 << 20
+)
+
+// Bytes inspected when deciding whether a file is binary
+const binarySniffLength = 8000
+
+// maxSymbols returns the workspace-wide symbol limit
+func (o Options) maxSymbols() int {
+	if o.MaxSymbols > 0 {
+		return o.MaxSymbols
+	}
+	return defaultMaxSymbols
+}
+
+// maxFileSymbols returns the per-file symbol limit
+func (o Options) maxFileSymbols() int {
+	if o.MaxFileSymbols > 0 {
+		return o.MaxFileSymbols
+	}
+	return defaultMaxFileSymbols
+}
+
+// maxFileSize returns the size above which files are not parsed
+func (o Options) maxFileSize() int64 {
+	if o.MaxFileSize > 0 {
+		return o.MaxFileSize
+	}
+	return defaultMaxFileSize
+}
+
+// Stats describes how much of the symbol limits the index is using
+type Stats struct {
+	Files        int
+	Symbols      int
+	MaxSymbols   int
+	SkippedFiles int          // files left out for exceeding a limit
+	LimitReached bool         // the workspace-wide limit stopped indexing
+	Errors       []IndexError // files that could not be read or parsed, by path
+}
+
+// IndexError is a file or directory the index could not read, or a file whose
+// symbols were discarded as unreliable
+type IndexError struct {
+	Path string
+	Err  error
 }
 
 // Index is the main symbol index for the workspace
 type Index struct {
-	symbols       map[string][]SymbolEntry // name -> entries
-	fileSymbols   map[string][]SymbolEntry // filePath -> entries
-	mutex         sync.RWMutex
-	workspaceRoot string
-	logger        *log.Logger
-	ready         bool
+	symbols        map[string][]SymbolEntry       // name -> entries
+	fileSymbols    map[string][]SymbolEntry       // filePath -> entries
+	references     map[string][]ConstantReference // constant name -> mentions
+	fileRefs       map[string][]ConstantReference // filePath -> mentions
+	rbsSignatures  map[string][]rbsSignature      // method FQN -> RBS signatures
+	rbsFiles       map[string][]string            // .rbs filePath -> method FQNs it declares
+	migrations     map[string][]Migration         // table name -> statements creating or altering it
+	migrationFiles map[string][]string            // migration filePath -> tables it touches
+	gemVersions    map[string]string              // gem name -> version locked in Gemfile.lock
+	options        Options
+	symbolCount    int                  // entries across fileSymbols
+	skippedFiles   map[string]bool      // files left out by the symbol limits -> by the workspace-wide one
+	readErrors     map[string]error     // path -> why it could not be read
+	modTimes       map[string]time.Time // path -> modification time when last indexed
+	excludedDirs   map[string]bool      // directory names skipped by the walk
+	excludedPaths  []string             // directory path suffixes skipped by the walk
+	rubyExts       map[string]bool      // extensions indexed as Ruby
+	rubyNames      map[string]bool      // file names indexed as Ruby
+	indexedDirs    map[string]bool      // directories indexed on demand in ModeLazy
+	inflections    Inflections          // relates table and association names to models
+	limitReached   bool
+	ignoreFiles    map[string][]ignoreRule // directory -> rules of its .gitignore, with Gitignore
+	ignoreMutex    sync.Mutex
+	mutex          sync.RWMutex
+	workspaceRoots []string // workspace folders, indexed into one merged set of symbols
+	rootsMutex     sync.RWMutex
+	logger         *log.Logger
+	ready          bool
 }
 
+// The receiver a def may name before its method: self, a constant or an object
+// (def self.find, def Config.load, def obj.greet)
+const defReceiver = `(?:(?:self|(?:::)?[A-Z]\w*(?:::[A-Z]\w*)*|[a-z_]\w*)\.)?`
+
+// A character of a class, module or method name, which Ruby allows to be any
+// non-ASCII character besides a letter, digit or underscore (Café, naïve)
+const nameChar = `\w\x{80}-\x{10FFFF}`
+
 // Regex patterns for Ruby constructs
 var (
-	classPattern          = regexp.MustCompile(`^\s*class\s+([A-Z][\w:]*)\s*(?:<\s*([A-Z][\w:]*))?`)
-	modulePattern         = regexp.MustCompile(`^\s*module\s+([A-Z][\w:]*)`)
-	methodPattern         = regexp.MustCompile(`^\s*def\s+(self\.)?(\w+[!?=]?)`)
-	constantPattern       = regexp.MustCompile(`^\s*([A-Z][A-Z0-9_]*)\s*=`)
+	classPattern          = regexp.MustCompile(`^\s*class\s+([A-Z][` + nameChar + `:]*)\s*(?:<\s*([A-Z][\w:]*))?`)
+	modulePattern         = regexp.MustCompile(`^\s*module\s+([A-Z][` + nameChar + `:]*)`)
+	methodPattern         = regexp.MustCompile(`^\s*def\s+(?:(self)\.|((?:::)?[A-Z]\w*(?:::[A-Z]\w*)*)\.|([a-z_]\w*)\.)?([` + nameChar + `]+[!?=]?)`)
+	constantPattern       = regexp.MustCompile(`^\s*((?:(?:self|[A-Z]\w*)::)*)([A-Z][A-Z0-9_]*)\s*=`)
 	scopePattern          = regexp.MustCompile(`^\s*scope\s+:(\w+)`)
 	associationPattern    = regexp.MustCompile(`^\s*(belongs_to|has_many|has_one|has_and_belongs_to_many)\s+:(\w+)`)
-	attrPattern           = regexp.MustCompile(`^\s*(attr_accessor|attr_reader|attr_writer)\s+(.+)`)
-	symbolExtractPattern  = regexp.MustCompile(`:(\w+)`)
+	attrPattern           = regexp.MustCompile(`^\s*(attr_accessor|attr_reader|attr_writer)(?:\s+|\s*\()(.+)`)
 	endPattern            = regexp.MustCompile(`^\s*end\b`)
 	privatePattern        = regexp.MustCompile(`^\s*(private|protected|public)\s*$`)
-	includePattern        = regexp.MustCompile(`^\s*(include|extend|prepend)\s+([A-Z][\w:]*)`)
+	includePattern        = regexp.MustCompile(`^\s*(include|extend|prepend)\s+((?:::)?[A-Z][\w:]*(?:\s*,\s*(?:::)?[A-Z][\w:]*)*)`)
+	forwardMissingPattern = regexp.MustCompile(`^\s*delegate_missing_to\s*\(?\s*:(\w+)`)
+	dataDefinePattern     = regexp.MustCompile(`^\s*([A-Z]\w*)\s*=\s*Data\.define\b\s*(?:\(([^)]*)\)|((?:\s*:\w+\s*,?)+))?\s*(do\b)?`)
+	dataMemberPattern     = regexp.MustCompile(`:(\w+)|"(\w+)"|'(\w+)'|\b(\w+):`)
+	ivarAssignPattern     = variableAssignPattern("@")
+	cvarAssignPattern     = variableAssignPattern("@@")
+	singleLineDefPattern  = regexp.MustCompile(`^\s*def\s.*\bend\s*$`)
+	endlessDefPattern     = regexp.MustCompile(`^\s*def\s+` + defReceiver + `[\w!?]+(?:\([^)]*\)\s*|\s+)=(?:[^=~>]|$)`)
+)
+
+// variableAssignPattern matches the assignments, plain or compound (+=, ||=), of
+// the variables written with a sigil, capturing the variable in group 1. What
+// surrounds a match is checked by variableAssignments.
+func variableAssignPattern(sigil string) *regexp.Regexp {
+	return regexp.MustCompile(`(` + regexp.QuoteMeta(sigil) + `\w+)\s*(?:\|\||&&|[-+*/%])?=`)
+}
+
+// variableAssignments returns the byte ranges of the variables a line of code
+// assigns, every one of a chain (@a = @b = 0). The characters around a match are
+// not consumed, so the next variable of the chain can still be told apart from
+// the end of a longer name (@@a, b@a) or a comparison (==, =~, =>).
+func variableAssignments(pattern *regexp.Regexp, code string) [][2]int {
+	var names [][2]int
+	for _, loc := range pattern.FindAllStringSubmatchIndex(code, -1) {
+		if loc[0] > 0 && (code[loc[0]-1] == '@' || isIdentByte(code[loc[0]-1])) {
+			continue
+		}
+		if loc[1] < len(code) && strings.IndexByte("=~>", code[loc[1]]) >= 0 {
+			continue
+		}
+		names = append(names, [2]int{loc[2], loc[3]})
+	}
+	return names
+}
+
+// =begin/=end block comments, whose delimiters must start the line
+var (
+	blockCommentStartPattern = regexp.MustCompile(`^=begin(\s|$)`)
+	blockCommentEndPattern   = regexp.MustCompile(`^=end(\s|$)`)
 )
 
-// Directories to skip during indexing
+// bodyFrame is a definition or block whose body is still open while parsing
+type bodyFrame struct {
+	indent    int  // indentation of the opening line, matched against its end
+	entry     int  // index of the definition in the parsed entries, -1 for a block
+	namespace bool // class/module bodies also push onto the nesting stack
+	concern   bool // a module body that extends ActiveSupport::Concern
+
+	// DSL blocks (included do, User.class_eval do) restore the nesting and
+	// visibility they replaced when they end; class and module bodies restore
+	// the visibility of the body around them
+	dsl             bool
+	singleton       bool
+	savedNesting    []string
+	savedVisibility string
+
+	// A concern's included block marks what it defines, from firstEntry on, as mixed in
+	mixedIn    bool
+	firstEntry int
+}
+
+// closingEnd is where an end keyword closing a body was found
+type closingEnd struct {
+	line      int // 1-based
+	character int // just past the keyword
+}
+
+// Directories to skip during indexing unless re-enabled through Options.ExcludeDirs
 var skipDirs = map[string]bool{
 	"vendor":       true,
 	"node_modules": true,
@@ -79,120 +279,555 @@ var skipDirs = map[string]bool{
 	"storage":      true,
 }
 
-// New creates a new Index
+// New creates a new Index with default options
 func New(workspaceRoot string, logger *log.Logger) *Index {
+	return NewWithOptions(workspaceRoot, logger, Options{})
+}
+
+// NewWithOptions creates a new Index configured by options
+func NewWithOptions(workspaceRoot string, logger *log.Logger, options Options) *Index {
+	return NewForRoots([]string{workspaceRoot}, logger, options)
+}
+
+// NewForRoots creates a single Index covering several workspace folders.
+// Symbols of all folders are merged, so lookups search across every folder.
+func NewForRoots(workspaceRoots []string, logger *log.Logger, options Options) *Index {
+	excludedDirs := make(map[string]bool)
+	for name := range skipDirs {
+		excludedDirs[name] = true
+	}
+
+	var excludedPaths []string
+	for _, dir := range options.ExcludeDirs {
+		dir = strings.Trim(filepath.ToSlash(strings.TrimSpace(dir)), "/")
+		switch {
+		case strings.HasPrefix(dir, "!"):
+			delete(excludedDirs, strings.TrimPrefix(dir, "!"))
+		case strings.Contains(dir, "/"):
+			excludedPaths = append(excludedPaths, dir)
+		case dir != "":
+			excludedDirs[dir] = true
+		}
+	}
+
+	rubyFiles := options.RubyFiles
+	if len(rubyFiles) == 0 {
+		rubyFiles = defaultRubyFiles
+	}
+	rubyExts := make(map[string]bool)
+	rubyNames := make(map[string]bool)
+	for _, pattern := range rubyFiles {
+		if strings.HasPrefix(pattern, ".") {
+			rubyExts[pattern] = true
+		} else if pattern != "" {
+			rubyNames[pattern] = true
+		}
+	}
+
 	return &Index{
-		symbols:       make(map[string][]SymbolEntry),
-		fileSymbols:   make(map[string][]SymbolEntry),
-		workspaceRoot: workspaceRoot,
-		logger:        logger,
-		ready:         false,
+		symbols:        make(map[string][]SymbolEntry),
+		fileSymbols:    make(map[string][]SymbolEntry),
+		references:     make(map[string][]ConstantReference),
+		fileRefs:       make(map[string][]ConstantReference),
+		rbsSignatures:  make(map[string][]rbsSignature),
+		rbsFiles:       make(map[string][]string),
+		migrations:     make(map[string][]Migration),
+		migrationFiles: make(map[string][]string),
+		gemVersions:    make(map[string]string),
+		options:        options,
+		skippedFiles:   make(map[string]bool),
+		readErrors:     make(map[string]error),
+		modTimes:       make(map[string]time.Time),
+		excludedDirs:   excludedDirs,
+		excludedPaths:  excludedPaths,
+		rubyExts:       rubyExts,
+		rubyNames:      rubyNames,
+		indexedDirs:    make(map[string]bool),
+		inflections:    NewInflections(options.Irregulars),
+		ignoreFiles:    make(map[string][]ignoreRule),
+		workspaceRoots: workspaceRoots,
+		logger:         logger,
+		ready:          false,
 	}
 }
 
-// IsReady returns whether the index has finished building
+// IsReady returns whether the index has finished building. Outside ModeEager it
+// is ready from the start, and DirectoryIndexed tells what it covers so far.
 func (idx *Index) IsReady() bool {
 	idx.mutex.RLock()
 	defer idx.mutex.RUnlock()
 	return idx.ready
 }
 
-// BuildIndex scans the workspace and indexes all Ruby files
-func (idx *Index) BuildIndex() {
-	idx.logger.Printf("Starting workspace indexing: %s", idx.workspaceRoot)
+// BuildIndex scans every workspace folder and indexes all Ruby files. Outside
+// ModeEager nothing is walked: the index is ready at once and grows as files are
+// opened, looked up or saved. Cancelling the context stops the walk before the
+// next file, leaving the index not ready.
+func (idx *Index) BuildIndex(ctx context.Context) {
+	roots := idx.Roots()
+	if !idx.eager() {
+		for _, root := range roots {
+			idx.loadGemfileLock(root)
+		}
+		idx.mutex.Lock()
+		idx.ready = true
+		idx.mutex.Unlock()
+
+		idx.logger.Printf("Indexing on demand (%s): %s", idx.options.Mode, strings.Join(roots, ", "))
+		return
+	}
+	idx.logger.Printf("Starting workspace indexing: %s", strings.Join(roots, ", "))
+	idx.clearIgnoreRules()
+
+	fileCount := 0
+	symbolCount := 0
+
+	for _, root := range roots {
+		files, symbols := idx.indexRoot(ctx, root)
+		fileCount += files
+		symbolCount += symbols
+	}
+
+	if ctx.Err() != nil {
+		idx.logger.Printf("Indexing cancelled: %d files, %d symbols", fileCount, symbolCount)
+		return
+	}
 
+	idx.mutex.Lock()
+	idx.ready = true
+	idx.mutex.Unlock()
+
+	idx.logger.Printf("Indexing complete: %d files, %d symbols", fileCount, symbolCount)
+}
+
+// indexRoot walks a single workspace folder, returning the files and symbols it
+// indexed before it was done or the context was cancelled
+func (idx *Index) indexRoot(ctx context.Context, root string) (int, int) {
 	fileCount := 0
 	symbolCount := 0
 
-	err := filepath.Walk(idx.workspaceRoot, func(path string, info os.FileInfo, err error) error {
+	// Versions are known before the walk so gem sources can be tagged as they are parsed
+	idx.loadGemfileLock(root)
+
+	err := idx.walk(root, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return filepath.SkipAll
+		}
 		if err != nil {
-			return nil // skip errors
+			// Unreadable entries are skipped, but recorded so missing symbols can be explained
+			idx.recordIndexError(path, err)
+			return nil
 		}
 
-		// Skip ignored directories
+		// Skip ignored directories, and nested workspace folders walked on their own
 		if info.IsDir() {
-			if skipDirs[info.Name()] {
+			if path != root && (idx.isExcludedDir(path) || idx.isWorkspaceRoot(path)) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		// Only process .rb files
-		if filepath.Ext(path) != ".rb" {
-			return nil
+		// RBS signatures live alongside the Ruby sources under sig/
+		if idx.options.TypeSignatures {
+			if rel, err := filepath.Rel(root, path); err == nil && isRBSSignatureFile(rel) {
+				signatures := parseRBSFile(path)
+				idx.mutex.Lock()
+				idx.indexRBSFile(path, signatures)
+				idx.modTimes[path] = info.ModTime()
+				idx.mutex.Unlock()
+				return nil
+			}
 		}
 
-		entries := idx.ParseFile(path)
-		if len(entries) > 0 {
-			idx.mutex.Lock()
-			idx.fileSymbols[path] = entries
-			for _, entry := range entries {
-				idx.symbols[entry.Name] = append(idx.symbols[entry.Name], entry)
-				if entry.FullyQualifiedName != entry.Name {
-					idx.symbols[entry.FullyQualifiedName] = append(idx.symbols[entry.FullyQualifiedName], entry)
-				}
-			}
-			idx.mutex.Unlock()
+		// Only process Ruby files that are not excluded
+		if !idx.ShouldIndex(path) {
+			return nil
+		}
 
+		symbols, limitReached := idx.indexFile(path, info.ModTime())
+		if limitReached {
+			return filepath.SkipAll
+		}
+		if symbols > 0 {
 			fileCount++
-			symbolCount += len(entries)
+			symbolCount += symbols
 		}
 
 		return nil
 	})
 
 	if err != nil {
-		idx.logger.Printf("Error during indexing: %v", err)
+		idx.logger.Printf("Error during indexing %s: %v", root, err)
+	}
+
+	return fileCount, symbolCount
+}
+
+// indexFile parses a Ruby file found by a walk and stores its symbols, returning
+// how many were stored and whether the workspace-wide limit has been reached
+func (idx *Index) indexFile(path string, modTime time.Time) (int, bool) {
+	entries, refs := idx.parsePath(path)
+
+	var migrations []Migration
+	if isMigrationFile(path) {
+		migrations = parseMigrationFile(path)
 	}
 
 	idx.mutex.Lock()
-	idx.ready = true
-	idx.mutex.Unlock()
+	defer idx.mutex.Unlock()
 
-	idx.logger.Printf("Indexing complete: %d files, %d symbols", fileCount, symbolCount)
+	idx.modTimes[path] = modTime
+	if len(migrations) > 0 {
+		idx.indexMigrationFile(path, migrations)
+	}
+	if !idx.storeFileEntries(path, entries, refs) {
+		return 0, idx.limitReached
+	}
+	return len(entries), false
 }
 
-// ParseFile parses a single Ruby file and extracts symbol definitions
+// isExcludedDir reports whether the walk should skip a directory, by its name,
+// by a configured path suffix or because a .gitignore file ignores it
+func (idx *Index) isExcludedDir(path string) bool {
+	if idx.excludedDirs[filepath.Base(path)] || idx.isGitignored(path, true) {
+		return true
+	}
+
+	rel, err := filepath.Rel(idx.RootOf(path), path)
+	if err != nil {
+		return false
+	}
+	return idx.isExcludedPath(filepath.ToSlash(rel))
+}
+
+// isExcludedPath reports whether a directory, relative to its workspace folder
+// and slash-separated, ends in a configured path suffix
+func (idx *Index) isExcludedPath(rel string) bool {
+	for _, suffix := range idx.excludedPaths {
+		if rel == suffix || strings.HasSuffix(rel, "/"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// inExcludedDir reports whether any directory between a file and its workspace
+// folder is one the walk skips by name or path suffix, so files reached without
+// the walk (opened, saved, changed on disk) are held to the same exclusions.
+// Ignored directories are left to isGitignored, which checks every ancestor.
+func (idx *Index) inExcludedDir(path string) bool {
+	root := idx.RootOf(path)
+	if !isWithin(path, root) {
+		return false
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." {
+		return false
+	}
+
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for depth, segment := range segments {
+		if idx.excludedDirs[segment] || idx.isExcludedPath(strings.Join(segments[:depth+1], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRubyFile reports whether a file is indexed as Ruby source, by extension
+// (app.rb, tasks.rake) or by name (Rakefile, Gemfile)
+func (idx *Index) IsRubyFile(path string) bool {
+	return idx.rubyExts[filepath.Ext(path)] || idx.rubyNames[filepath.Base(path)]
+}
+
+// ShouldIndex reports whether a file is Ruby source not excluded by ExcludeGlobs,
+// by an excluded directory above it or, with Gitignore, by the .gitignore files
+// of the workspace
+func (idx *Index) ShouldIndex(path string) bool {
+	return idx.IsRubyFile(path) && !idx.isExcludedFile(path) && !idx.inExcludedDir(path) && !idx.isGitignored(path, false)
+}
+
+// ParseFile parses a single Ruby file and extracts symbol definitions, reading
+// it from disk for ParseSource
 func (idx *Index) ParseFile(filePath string) []SymbolEntry {
+	entries, _ := idx.parsePath(filePath)
+	return entries
+}
+
+// parsePath parses a Ruby file into its symbol definitions and constant references.
+// Oversized files and files that look binary (a NUL in the first bytes) yield nothing.
+func (idx *Index) parsePath(filePath string) ([]SymbolEntry, []ConstantReference) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil
+		// A file deleted since it was listed is simply gone, not unreadable
+		if os.IsNotExist(err) {
+			idx.clearIndexError(filePath)
+		} else {
+			idx.recordIndexError(filePath, err)
+		}
+		return nil, nil
 	}
 	defer file.Close()
 
+	if info, err := file.Stat(); err == nil && info.Size() > idx.options.maxFileSize() {
+		idx.logger.Printf("Skipping %s: %d bytes exceeds the size limit of %d", filePath, info.Size(), idx.options.maxFileSize())
+		return nil, nil
+	}
+
+	reader := bufio.NewReader(file)
+	if head, _ := reader.Peek(binarySniffLength); bytes.IndexByte(head, 0) >= 0 {
+		idx.logger.Printf("Skipping %s: looks like a binary file", filePath)
+		return nil, nil
+	}
+
+	// A read failure or an overlong line stops the parse part way through the file
+	source, err := io.ReadAll(reader)
+	entries, refs, scanErr := idx.parseSource(string(source), filePath)
+	if err == nil {
+		err = scanErr
+	}
+	if err != nil {
+		idx.recordIndexError(filePath, err)
+	} else {
+		idx.clearIndexError(filePath)
+	}
+
+	return entries, refs
+}
+
+// Limits past which the bodies of a file balance too poorly for its symbols to be
+// trusted, as when a template or badly broken source is parsed as Ruby
+const (
+	maxUnmatchedBodies = 20 // bodies left open at the end plus ends closing nothing
+	maxNestingDepth    = 32
+)
+
+// unbalancedError explains why the symbols of a file were discarded
+type unbalancedError struct {
+	unclosed int // bodies still open at the end of the file
+	stray    int // ends found with no body open
+	depth    int // deepest nesting of bodies
+}
+
+func (e unbalancedError) exceeded() bool {
+	return e.unclosed+e.stray > maxUnmatchedBodies || e.depth > maxNestingDepth
+}
+
+func (e unbalancedError) Error() string {
+	return fmt.Sprintf("bodies do not balance (%d left open, %d unmatched ends, nesting %d deep), symbols discarded", e.unclosed, e.stray, e.depth)
+}
+
+// parseScanner extracts symbol definitions and constant references from Ruby
+// source read line by line. Source whose bodies are too unbalanced to trust
+// yields nothing but an unbalancedError.
+func (idx *Index) parseScanner(scanner *bufio.Scanner, filePath string) ([]SymbolEntry, []ConstantReference, error) {
 	var entries []SymbolEntry
-	scanner := bufio.NewScanner(file)
+	var refs []ConstantReference
 
 	// Stack to track nesting (class/module hierarchy)
 	var nestingStack []string
-	var indentStack []int
+	var frames []bodyFrame // open class/module/method bodies, innermost last
 	currentVisibility := "public"
 	lineNumber := 0
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineNumber++
+	// Methods defined after a bare module_function are also module methods, and
+	// every public method of a module that extends itself is
+	moduleFunction := false
+	extendedSelf := make(map[string]bool)
+
+	// Sorbet sig being read, and the parsed sig awaiting its method
+	var sigLines *sigBuilder
+	var pendingSig *TypeSignature
+
+	inBlockComment := false
+
+	// Comment lines directly above the current line, for method summaries
+	var commentBlock []string
+
+	// attr_accessor, attr_reader or attr_writer whose list continues on the next line
+	pendingAttr := ""
+
+	// Ends indented deeper than the innermost open body, awaiting the next line
+	// to tell whether they close it
+	var pendingEnds []closingEnd
+
+	// How far the bodies stray from balancing: ends closing nothing, and the
+	// deepest nesting reached
+	strayEnds, maxDepth := 0, 0
+
+	// closeFrame pops the innermost open body at its end
+	closeFrame := func(end closingEnd) {
+		frame := frames[len(frames)-1]
+		frames = frames[:len(frames)-1]
+		if frame.entry < 0 {
+			if frame.dsl {
+				nestingStack = frame.savedNesting
+				currentVisibility = frame.savedVisibility
+			}
+			if frame.mixedIn {
+				for i := frame.firstEntry; i < len(entries); i++ {
+					entries[i].MixedIn = true
+				}
+			}
+			return
+		}
+
+		// Close the definition's range at its matching end
+		entries[frame.entry].EndLine = end.line
+		entries[frame.entry].EndCharacter = end.character
+
+		if frame.namespace {
+			nestingStack = nestingStack[:len(nestingStack)-1]
+			currentVisibility = frame.savedVisibility
+			moduleFunction = false
+		}
+	}
+
+	// closePendingEnds lets the pending ends close the bodies a line of code at
+	// indent leaves: a line no deeper than a body's opener is past its end, unless
+	// it continues the body (rescue, else, when)
+	closePendingEnds := func(indent int, code string) {
+		for len(pendingEnds) > 0 && !midBodyPattern.MatchString(code) && len(frames) > 0 && indent <= frames[len(frames)-1].indent {
+			closeFrame(pendingEnds[0])
+			pendingEnds = pendingEnds[1:]
+		}
+		pendingEnds = nil
+	}
+
+	// Statements following the first of a line joined with ";" (class Empty; end),
+	// each parsed in turn as if it stood alone at the indentation of its line
+	var statements []string
+	indent := 0
+	var indents statementIndents
+
+	for len(statements) > 0 || scanner.Scan() {
+		maxDepth = max(maxDepth, len(frames))
+
+		var line string
+		var docLines []string
+		if len(statements) > 0 {
+			line, statements = statements[0], statements[1:]
+		} else {
+			line = scanner.Text()
+			lineNumber++
+
+			// A BOM would hide a first-line class from the patterns and shift its columns
+			if lineNumber == 1 {
+				line = strings.TrimPrefix(line, documents.UTF8BOM)
+			}
+
+			// =begin/=end comments span every line up to the closing =end
+			if inBlockComment {
+				inBlockComment = !blockCommentEndPattern.MatchString(line)
+				continue
+			}
+			if blockCommentStartPattern.MatchString(line) {
+				inBlockComment = true
+				continue
+			}
+
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "#!") {
+				commentBlock = append(commentBlock, stripCommentMarker(trimmed))
+				continue
+			}
+			docLines = commentBlock
+			commentBlock = nil
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+
+			indent = indents.of(line, maskStringsAndComments(line))
+			if split := splitStatements(line); len(split) > 1 {
+				line, statements = split[0], split[1:]
+			}
+		}
+
+		// Constructs are matched against the code only, so a trailing comment or
+		// quoted text ("def not a method", "@x = 1") cannot define symbols
+		code := maskStringsAndComments(line)
+		isEnd := endPattern.MatchString(code)
+		if !isEnd && len(pendingEnds) > 0 {
+			closePendingEnds(indent, code)
+		}
 
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		if pendingAttr != "" {
+			arguments := attrArguments(line, code, 0)
+			entries = append(entries, attrEntries(pendingAttr, arguments, line, lineNumber, filePath, strings.Join(nestingStack, "::"), currentVisibility)...)
+			if !strings.HasSuffix(strings.TrimSpace(code), ",") {
+				pendingAttr = ""
+			}
 			continue
 		}
 
-		indent := countIndent(line)
+		if idx.options.TypeSignatures {
+			if sigLines == nil {
+				if matches := sigStartPattern.FindStringSubmatch(line); matches != nil {
+					sigLines = &sigBuilder{braces: matches[1] == "{", indent: indent}
+				}
+			}
+			if sigLines != nil {
+				refs = append(refs, scanConstantReferences(line, strings.Join(nestingStack, "::"), filePath, lineNumber)...)
+				if sigLines.add(line) {
+					sig := parseSorbetSig(sigLines.text.String())
+					pendingSig = &sig
+					sigLines = nil
+				}
+				// Comments above the sig document the method below it
+				commentBlock = docLines
+				continue
+			}
+			// A sig only describes the method defined right after it
+			if pendingSig != nil && !methodPattern.MatchString(line) {
+				pendingSig = nil
+			}
+		}
 
 		// Track end keywords to pop nesting
-		if endPattern.MatchString(line) {
-			if len(indentStack) > 0 && indent <= indentStack[len(indentStack)-1] {
-				nestingStack = nestingStack[:len(nestingStack)-1]
-				indentStack = indentStack[:len(indentStack)-1]
-				currentVisibility = "public"
+		if isEnd {
+			// A block indented deeper than this end was never closed, so it must
+			// not take the end of the definition around it
+			for len(frames) > 0 && frames[len(frames)-1].entry < 0 && indent < frames[len(frames)-1].indent {
+				frames = frames[:len(frames)-1]
+			}
+			end := closingEnd{line: lineNumber, character: utf8.RuneCountInString(line[:strings.Index(line, "end")]) + 3}
+			switch {
+			case len(frames) == 0:
+				strayEnds++
+			case indent > frames[len(frames)-1].indent:
+				// Misindented, or closing an opener the patterns do not know
+				pendingEnds = append(pendingEnds, end)
+			default:
+				pendingEnds = nil
+				closeFrame(end)
 			}
 			continue
 		}
 
+		// if/while/do bodies close with an end of their own, unlike modifiers (return if done)
+		if opensBlock(code) && !classPattern.MatchString(code) && !modulePattern.MatchString(code) &&
+			!methodPattern.MatchString(code) && !dataDefinePattern.MatchString(code) {
+			frame := bodyFrame{indent: indent, entry: -1}
+			if block, ok := dslBlockOf(code); ok {
+				frame.dsl = true
+				frame.singleton = block.singleton
+				frame.savedNesting = nestingStack
+				frame.savedVisibility = currentVisibility
+				if block.nesting != nil {
+					nestingStack = block.nesting
+				}
+				if block.included {
+					frame.mixedIn = inConcern(frames)
+					frame.firstEntry = len(entries)
+				}
+			}
+			frames = append(frames, frame)
+		}
+
 		// Track visibility modifiers
-		if matches := privatePattern.FindStringSubmatch(line); matches != nil {
+		if matches := privatePattern.FindStringSubmatch(code); matches != nil {
 			currentVisibility = matches[1]
+			moduleFunction = false
 			continue
 		}
 
@@ -201,8 +836,99 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 			parent = strings.Join(nestingStack, "::")
 		}
 
+		// module_function applies to the methods it names, or to those defined after it
+		if matches := moduleFunctionPattern.FindStringSubmatch(code); matches != nil && parent != "" {
+			names := symbolNames(matches[1])
+			if len(names) == 0 {
+				moduleFunction = true
+			} else {
+				markModuleFunctions(entries, parent, names)
+			}
+			continue
+		}
+		if extendSelfPattern.MatchString(code) && parent != "" {
+			extendedSelf[parent] = true
+			continue
+		}
+
+		refs = append(refs, scanConstantReferences(line, parent, filePath, lineNumber)...)
+
+		// Instance variable assignments (@balance = 0), recorded per enclosing class
+		for _, name := range variableAssignments(ivarAssignPattern, code) {
+			ivarName := line[name[0]:name[1]]
+			fqn := ivarName
+			if parent != "" {
+				fqn = parent + "#" + ivarName
+			}
+
+			entries = append(entries, SymbolEntry{
+				Name:               ivarName,
+				FullyQualifiedName: fqn,
+				Type:               SymbolInstanceVariable,
+				FilePath:           filePath,
+				Line:               lineNumber,
+				Character:          utf8.RuneCountInString(line[:name[0]]),
+				Parent:             parent,
+				Visibility:         "private",
+			})
+		}
+
+		// Class variable assignments (@@count = 0), recorded like instance variables
+		if idx.options.ClassVariables {
+			for _, name := range variableAssignments(cvarAssignPattern, code) {
+				cvarName := line[name[0]:name[1]]
+				fqn := cvarName
+				if parent != "" {
+					fqn = parent + "#" + cvarName
+				}
+
+				entries = append(entries, SymbolEntry{
+					Name:               cvarName,
+					FullyQualifiedName: fqn,
+					Type:               SymbolClassVar,
+					FilePath:           filePath,
+					Line:               lineNumber,
+					Character:          utf8.RuneCountInString(line[:name[0]]),
+					Parent:             parent,
+					Visibility:         "private",
+				})
+			}
+		}
+
+		// include/prepend add to the ancestors of the innermost class or module
+		if matches := includePattern.FindStringSubmatch(code); matches != nil {
+			modules := strings.Split(matches[2], ",")
+			for i := len(frames) - 1; i >= 0; i-- {
+				if !frames[i].namespace {
+					continue
+				}
+				// include A, B mixes in B first, then A, as Ruby does
+				for j := len(modules) - 1; j >= 0; j-- {
+					module := strings.TrimSpace(modules[j])
+					if matches[1] != "extend" {
+						entries[frames[i].entry].Mixins = append(entries[frames[i].entry].Mixins, module)
+					} else if strings.TrimPrefix(module, "::") == "ActiveSupport::Concern" {
+						frames[i].concern = true
+					}
+				}
+				break
+			}
+			continue
+		}
+
+		// delegate_missing_to forwards what the innermost class or module lacks
+		if matches := forwardMissingPattern.FindStringSubmatch(code); matches != nil {
+			for i := len(frames) - 1; i >= 0; i-- {
+				if frames[i].namespace {
+					entries[frames[i].entry].DelegatesTo = matches[1]
+					break
+				}
+			}
+			continue
+		}
+
 		// Class definition
-		if matches := classPattern.FindStringSubmatch(line); matches != nil {
+		if matches := classPattern.FindStringSubmatch(code); matches != nil {
 			className := matches[1]
 			superclass := matches[2]
 
@@ -224,13 +950,14 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 			})
 
 			nestingStack = append(nestingStack, classNameOnly(className))
-			indentStack = append(indentStack, indent)
+			frames = append(frames, bodyFrame{indent: indent, entry: len(entries) - 1, namespace: true, savedVisibility: currentVisibility})
 			currentVisibility = "public"
+			moduleFunction = false
 			continue
 		}
 
 		// Module definition
-		if matches := modulePattern.FindStringSubmatch(line); matches != nil {
+		if matches := modulePattern.FindStringSubmatch(code); matches != nil {
 			moduleName := matches[1]
 
 			fqn := moduleName
@@ -250,28 +977,51 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 			})
 
 			nestingStack = append(nestingStack, classNameOnly(moduleName))
-			indentStack = append(indentStack, indent)
+			frames = append(frames, bodyFrame{indent: indent, entry: len(entries) - 1, namespace: true, savedVisibility: currentVisibility})
 			currentVisibility = "public"
+			moduleFunction = false
 			continue
 		}
 
 		// Method definition
-		if matches := methodPattern.FindStringSubmatch(line); matches != nil {
-			isSingleton := matches[1] != ""
-			methodName := matches[2]
+		if matches := methodPattern.FindStringSubmatchIndex(code); matches != nil {
+			// A method defined on some object (def obj.greet) belongs to no class,
+			// but its body still closes with an end
+			if matches[6] >= 0 {
+				if !singleLineDefPattern.MatchString(code) && !endlessDefPattern.MatchString(code) {
+					frames = append(frames, bodyFrame{indent: indent, entry: -1})
+				}
+				continue
+			}
+
+			isSingleton := matches[2] >= 0 || matches[4] >= 0 || inSingletonBlock(frames)
+			methodName := line[matches[8]:matches[9]]
+			doc := ParseDocComment(docLines)
+
+			// def Config.load defines a class method of Config rather than of the
+			// class around it, unless that is Config itself
+			owner := parent
+			if matches[4] >= 0 {
+				if receiver := strings.TrimPrefix(line[matches[4]:matches[5]], "::"); receiver != parent && receiver != classNameOnly(parent) {
+					owner = receiver
+				}
+			}
 
 			symType := SymbolMethod
+			visibility := currentVisibility
 			if isSingleton {
 				symType = SymbolSingletonMethod
+				// private/protected sections don't apply to def self.foo
+				visibility = "public"
 			}
 
 			fqn := methodName
-			if parent != "" {
+			if owner != "" {
 				sep := "#"
 				if isSingleton {
 					sep = "."
 				}
-				fqn = parent + sep + methodName
+				fqn = owner + sep + methodName
 			}
 
 			entries = append(entries, SymbolEntry{
@@ -280,37 +1030,129 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 				Type:               symType,
 				FilePath:           filePath,
 				Line:               lineNumber,
-				Character:          strings.Index(line, "def") + 4,
-				Parent:             parent,
-				Visibility:         currentVisibility,
+				Character:          utf8.RuneCountInString(line[:matches[8]]),
+				Parent:             owner,
+				Visibility:         visibility,
+				Params:             parseDefParams(line, matches[9]),
+				Summary:            doc.Summary(),
 			})
+			if pendingSig != nil {
+				entries[len(entries)-1].Types = []TypeSignature{*pendingSig}
+				pendingSig = nil
+			}
+			if sig, ok := doc.Signature(entries[len(entries)-1].Params); ok {
+				entries[len(entries)-1].Types = append(entries[len(entries)-1].Types, sig)
+			}
+			if moduleFunction && !isSingleton && parent != "" {
+				entries[len(entries)-1].Visibility = "private"
+				entries[len(entries)-1].Detail = DetailModuleFunction
+			}
+
+			// One-liners (def foo; end) and endless methods (def foo = 1) have no body to close
+			if !singleLineDefPattern.MatchString(code) && !endlessDefPattern.MatchString(code) {
+				frames = append(frames, bodyFrame{indent: indent, entry: len(entries) - 1})
+			}
 			continue
 		}
 
-		// Constant assignment
-		if matches := constantPattern.FindStringSubmatch(line); matches != nil {
-			constName := matches[1]
+		// Data.define value class (Coord = Data.define(:lat, :lng))
+		if matches := dataDefinePattern.FindStringSubmatch(code); matches != nil {
+			className := matches[1]
 
-			fqn := constName
+			fqn := className
 			if parent != "" {
-				fqn = parent + "::" + constName
+				fqn = parent + "::" + className
 			}
 
+			classEntry := len(entries)
 			entries = append(entries, SymbolEntry{
-				Name:               constName,
+				Name:               className,
 				FullyQualifiedName: fqn,
-				Type:               SymbolConstant,
+				Type:               SymbolClass,
 				FilePath:           filePath,
 				Line:               lineNumber,
-				Character:          strings.Index(line, constName),
+				Character:          strings.Index(line, className),
 				Parent:             parent,
 				Visibility:         "public",
+				Detail:             "Data",
+			})
+
+			// Members are reader-only, including those given as keywords
+			for _, member := range dataMemberPattern.FindAllStringSubmatch(matches[2]+matches[3], -1) {
+				memberName := member[1] + member[2] + member[3] + member[4]
+				entries = append(entries, SymbolEntry{
+					Name:               memberName,
+					FullyQualifiedName: fqn + "#" + memberName,
+					Type:               SymbolAttrAccessor,
+					FilePath:           filePath,
+					Line:               lineNumber,
+					Character:          strings.Index(line, memberName),
+					Parent:             fqn,
+					Visibility:         "public",
+					Detail:             "data member",
+				})
+			}
+
+			// A trailing block reopens the data class for method definitions
+			if matches[4] != "" {
+				nestingStack = append(nestingStack, className)
+				frames = append(frames, bodyFrame{indent: indent, entry: classEntry, namespace: true, savedVisibility: currentVisibility})
+				currentVisibility = "public"
+			}
+			continue
+		}
+
+		// Constant aliasing another (User = Account), navigable to what it aliases
+		if matches := constantAliasPattern.FindStringSubmatchIndex(code); matches != nil {
+			namespace := constantNamespace(strings.TrimSuffix(code[matches[2]:matches[3]], "::"), parent)
+			name := code[matches[4]:matches[5]]
+
+			fqn := name
+			if namespace != "" {
+				fqn = namespace + "::" + name
+			}
+
+			entries = append(entries, SymbolEntry{
+				Name:               name,
+				FullyQualifiedName: fqn,
+				Type:               SymbolConstant,
+				FilePath:           filePath,
+				Line:               lineNumber,
+				Character:          utf8.RuneCountInString(line[:matches[4]]),
+				Parent:             namespace,
+				Visibility:         "public",
+				Detail:             aliasDetailPrefix + code[matches[6]:matches[7]],
 			})
 			continue
 		}
 
+		// Constant assignments, also into another namespace (Foo::BAR = 1, self::BAR = 1),
+		// chained (A = B = 0) or multiple (X, Y = 1, 2)
+		if targets := constantTargets(code); len(targets) > 0 {
+			for _, target := range targets {
+				namespace := constantNamespace(target.qualifier, parent)
+
+				fqn := target.name
+				if namespace != "" {
+					fqn = namespace + "::" + target.name
+				}
+
+				entries = append(entries, SymbolEntry{
+					Name:               target.name,
+					FullyQualifiedName: fqn,
+					Type:               SymbolConstant,
+					FilePath:           filePath,
+					Line:               lineNumber,
+					Character:          utf8.RuneCountInString(line[:target.offset]),
+					Parent:             namespace,
+					Visibility:         "public",
+				})
+			}
+			continue
+		}
+
 		// Scope definition
-		if matches := scopePattern.FindStringSubmatch(line); matches != nil {
+		if matches := scopePattern.FindStringSubmatch(code); matches != nil {
 			scopeName := matches[1]
 
 			entries = append(entries, SymbolEntry{
@@ -328,7 +1170,7 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 		}
 
 		// Associations (belongs_to, has_many, has_one)
-		if matches := associationPattern.FindStringSubmatch(line); matches != nil {
+		if matches := associationPattern.FindStringSubmatch(code); matches != nil {
 			assocType := matches[1]
 			assocName := matches[2]
 
@@ -341,35 +1183,50 @@ func (idx *Index) ParseFile(filePath string) []SymbolEntry {
 				Character:          strings.Index(line, ":"+assocName) + 1,
 				Parent:             parent,
 				Visibility:         "public",
-				Detail:             assocType,
+				Detail:             associationDetail(assocType, line),
 			})
 			continue
 		}
 
-		// Attr accessors
-		if matches := attrPattern.FindStringSubmatch(line); matches != nil {
-			attrType := matches[1]
-			attrList := matches[2]
-
-			for _, sym := range symbolExtractPattern.FindAllStringSubmatch(attrList, -1) {
-				attrName := sym[1]
-				entries = append(entries, SymbolEntry{
-					Name:               attrName,
-					FullyQualifiedName: parent + "#" + attrName,
-					Type:               SymbolAttrAccessor,
-					FilePath:           filePath,
-					Line:               lineNumber,
-					Character:          strings.Index(line, ":"+attrName) + 1,
-					Parent:             parent,
-					Visibility:         currentVisibility,
-					Detail:             attrType,
-				})
+		// Attr accessors, named by symbols or strings; a trailing comma continues the list
+		if matches := attrPattern.FindStringSubmatchIndex(code); matches != nil {
+			attrType := code[matches[2]:matches[3]]
+			arguments := attrArguments(line, code, matches[4])
+			entries = append(entries, attrEntries(attrType, arguments, line, lineNumber, filePath, parent, currentVisibility)...)
+			if strings.HasSuffix(strings.TrimSpace(code), ",") {
+				pendingAttr = attrType
 			}
 			continue
 		}
 	}
+	// Ends left pending at the end of the source close what is still open
+	closePendingEnds(-1, "")
 
-	return entries
+	// A scan stopped early leaves bodies open without the source being at fault
+	if balance := (unbalancedError{unclosed: len(frames), stray: strayEnds, depth: maxDepth}); balance.exceeded() && scanner.Err() == nil {
+		return nil, nil, balance
+	}
+
+	entries = append(entries, moduleFunctionCopies(entries, extendedSelf)...)
+
+	return entries, refs, nil
+}
+
+// constantNamespace returns the namespace a constant is assigned into: the
+// enclosing one for a bare name, a qualified one as written like class names,
+// with a leading self standing for the enclosing namespace
+func constantNamespace(qualifier string, parent string) string {
+	switch {
+	case qualifier == "", qualifier == "self":
+		return parent
+	case strings.HasPrefix(qualifier, "self::"):
+		qualifier = strings.TrimPrefix(qualifier, "self::")
+		if parent == "" {
+			return qualifier
+		}
+		return parent + "::" + qualifier
+	}
+	return qualifier
 }
 
 // Lookup finds symbols by exact name
@@ -383,24 +1240,44 @@ func (idx *Index) Lookup(name string) []SymbolEntry {
 	return nil
 }
 
-// PrefixSearch finds symbols whose name starts with the given prefix
-func (idx *Index) PrefixSearch(prefix string) []SymbolEntry {
+// PrefixSearch finds symbols whose name starts with the given prefix. Once ctx is
+// done the scan stops, returning the matches found so far.
+func (idx *Index) PrefixSearch(ctx context.Context, prefix string) []SymbolEntry {
 	idx.mutex.RLock()
 	defer idx.mutex.RUnlock()
 
 	var results []SymbolEntry
 	lowerPrefix := strings.ToLower(prefix)
 
+	scanned := 0
 	for name, entries := range idx.symbols {
+		if scanned++; scanned%searchCheckInterval == 0 && ctx.Err() != nil {
+			break
+		}
 		if strings.HasPrefix(strings.ToLower(name), lowerPrefix) {
 			results = append(results, entries...)
 		}
 	}
 
-	// Deduplicate by file+line
+	// Symbols are stored under both their name and FQN, so both keys may match
 	return deduplicateEntries(results)
 }
 
+// AllSymbols calls fn with every indexed symbol, each once, until fn returns
+// false. The index is read-locked throughout, so fn must not call back into it.
+func (idx *Index) AllSymbols(fn func(SymbolEntry) bool) {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	for _, entries := range idx.fileSymbols {
+		for _, entry := range entries {
+			if !fn(entry) {
+				return
+			}
+		}
+	}
+}
+
 // LookupByConvention resolves a word to file paths using Rails conventions
 func (idx *Index) LookupByConvention(word string) []SymbolEntry {
 	// First try exact lookup
@@ -411,62 +1288,74 @@ func (idx *Index) LookupByConvention(word string) []SymbolEntry {
 	// Convert CamelCase to snake_case for file lookup
 	snakeName := camelToSnake(word)
 
-	// Rails convention paths to try
-	conventionPaths := []string{
-		filepath.Join(idx.workspaceRoot, "app", "models", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "controllers", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "services", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "serializers", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "jobs", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "mailers", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "helpers", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "workers", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "policies", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "forms", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "decorators", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "validators", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "interactors", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "operations", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "lib", snakeName+".rb"),
-	}
-
-	// Concerns (search both model and controller concerns)
-	concernPaths := []string{
-		filepath.Join(idx.workspaceRoot, "app", "models", "concerns", snakeName+".rb"),
-		filepath.Join(idx.workspaceRoot, "app", "controllers", "concerns", snakeName+".rb"),
-	}
-
-	allPaths := append(conventionPaths, concernPaths...)
-
 	var results []SymbolEntry
-	for _, p := range allPaths {
-		if _, err := os.Stat(p); err == nil {
-			results = append(results, SymbolEntry{
-				Name:               word,
-				FullyQualifiedName: word,
-				Type:               SymbolClass,
-				FilePath:           p,
-				Line:               1,
-				Character:          0,
-			})
+	for _, root := range idx.Roots() {
+		// Rails convention paths to try
+		conventionPaths := []string{
+			filepath.Join(root, "app", "models", snakeName+".rb"),
+			filepath.Join(root, "app", "controllers", snakeName+".rb"),
+			filepath.Join(root, "app", "services", snakeName+".rb"),
+			filepath.Join(root, "app", "serializers", snakeName+".rb"),
+			filepath.Join(root, "app", "jobs", snakeName+".rb"),
+			filepath.Join(root, "app", "mailers", snakeName+".rb"),
+			filepath.Join(root, "app", "helpers", snakeName+".rb"),
+			filepath.Join(root, "app", "workers", snakeName+".rb"),
+			filepath.Join(root, "app", "policies", snakeName+".rb"),
+			filepath.Join(root, "app", "forms", snakeName+".rb"),
+			filepath.Join(root, "app", "decorators", snakeName+".rb"),
+			filepath.Join(root, "app", "validators", snakeName+".rb"),
+			filepath.Join(root, "app", "interactors", snakeName+".rb"),
+			filepath.Join(root, "app", "operations", snakeName+".rb"),
+			filepath.Join(root, "lib", snakeName+".rb"),
 		}
-	}
 
-	// Also try glob search for nested paths
-	if len(results) == 0 {
-		pattern := filepath.Join(idx.workspaceRoot, "app", "**", snakeName+".rb")
-		if matches, err := filepath.Glob(pattern); err == nil {
-			for _, m := range matches {
+		// Concerns (search both model and controller concerns)
+		concernPaths := []string{
+			filepath.Join(root, "app", "models", "concerns", snakeName+".rb"),
+			filepath.Join(root, "app", "controllers", "concerns", snakeName+".rb"),
+		}
+
+		allPaths := append(conventionPaths, concernPaths...)
+
+		for _, p := range allPaths {
+			if _, err := os.Stat(p); err == nil {
 				results = append(results, SymbolEntry{
 					Name:               word,
 					FullyQualifiedName: word,
 					Type:               SymbolClass,
-					FilePath:           m,
+					FilePath:           p,
 					Line:               1,
 					Character:          0,
 				})
 			}
 		}
+
+		// Also try glob search for nested paths
+		if len(results) == 0 {
+			pattern := filepath.Join(root, "app", "**", snakeName+".rb")
+			if matches, err := filepath.Glob(pattern); err == nil {
+				for _, m := range matches {
+					results = append(results, SymbolEntry{
+						Name:               word,
+						FullyQualifiedName: word,
+						Type:               SymbolClass,
+						FilePath:           m,
+						Line:               1,
+						Character:          0,
+					})
+				}
+			}
+		}
+	}
+
+	// On demand, the files found by convention are parsed for their real definitions
+	if idx.options.Mode == ModeLazy && len(results) > 0 {
+		for _, result := range results {
+			idx.IndexOnDemand(result.FilePath)
+		}
+		if entries := idx.Lookup(word); len(entries) > 0 {
+			return entries
+		}
 	}
 
 	return results
@@ -474,60 +1363,254 @@ func (idx *Index) LookupByConvention(word string) []SymbolEntry {
 
 // UpdateFile re-indexes a single file (incremental update)
 func (idx *Index) UpdateFile(filePath string) {
-	idx.mutex.Lock()
+	// Refresh compares against the modification time seen here
+	if info, err := os.Stat(filePath); err == nil {
+		idx.mutex.Lock()
+		idx.modTimes[filePath] = info.ModTime()
+		idx.mutex.Unlock()
+	}
 
-	// Remove old entries for this file
-	if oldEntries, ok := idx.fileSymbols[filePath]; ok {
-		for _, entry := range oldEntries {
-			if entries, exists := idx.symbols[entry.Name]; exists {
-				filtered := entries[:0]
-				for _, e := range entries {
-					if e.FilePath != filePath {
-						filtered = append(filtered, e)
-					}
-				}
-				if len(filtered) > 0 {
-					idx.symbols[entry.Name] = filtered
-				} else {
-					delete(idx.symbols, entry.Name)
-				}
-			}
-			if entry.FullyQualifiedName != entry.Name {
-				if entries, exists := idx.symbols[entry.FullyQualifiedName]; exists {
-					filtered := entries[:0]
-					for _, e := range entries {
-						if e.FilePath != filePath {
-							filtered = append(filtered, e)
-						}
-					}
-					if len(filtered) > 0 {
-						idx.symbols[entry.FullyQualifiedName] = filtered
-					} else {
-						delete(idx.symbols, entry.FullyQualifiedName)
-					}
-				}
-			}
+	if filepath.Ext(filePath) == ".rbs" {
+		if rel, err := filepath.Rel(idx.RootOf(filePath), filePath); err == nil && idx.options.TypeSignatures && isRBSSignatureFile(rel) {
+			signatures := parseRBSFile(filePath)
+			idx.mutex.Lock()
+			idx.indexRBSFile(filePath, signatures)
+			idx.mutex.Unlock()
+			idx.logger.Printf("Re-indexed signatures: %s (%d methods)", filePath, len(signatures))
 		}
-		delete(idx.fileSymbols, filePath)
+		return
+	}
+	if !idx.ShouldIndex(filePath) {
+		return
+	}
+
+	newEntries, refs := idx.parsePath(filePath)
+	idx.replaceFileEntries(filePath, newEntries, refs)
+	if isMigrationFile(filePath) {
+		migrations := parseMigrationFile(filePath)
+		idx.mutex.Lock()
+		idx.indexMigrationFile(filePath, migrations)
+		idx.mutex.Unlock()
 	}
 
+	idx.logger.Printf("Re-indexed file: %s (%d symbols)", filePath, len(newEntries))
+}
+
+// UpdateFileFromSource re-indexes a file from an in-memory buffer instead of
+// reading it from disk, so unsaved edits are reflected in the index. A buffer
+// too unbalanced to be trusted, as one is halfway through typing a body, keeps
+// the symbols indexed from its last good version.
+func (idx *Index) UpdateFileFromSource(filePath string, source string) {
+	newEntries, refs, err := idx.parseSource(source, filePath)
+	if err != nil {
+		idx.recordIndexError(filePath, err)
+		var unbalanced unbalancedError
+		if errors.As(err, &unbalanced) {
+			return
+		}
+	} else {
+		idx.clearIndexError(filePath)
+	}
+	idx.replaceFileEntries(filePath, newEntries, refs)
+	if isMigrationFile(filePath) {
+		migrations := parseMigrations(bufio.NewScanner(strings.NewReader(source)), filePath)
+		idx.mutex.Lock()
+		idx.indexMigrationFile(filePath, migrations)
+		idx.mutex.Unlock()
+	}
+
+	idx.logger.Printf("Re-indexed buffer: %s (%d symbols)", filePath, len(newEntries))
+}
+
+// IndexSources indexes files held in memory (file path -> source) in place of
+// walking the workspace folders, and marks the index ready
+func (idx *Index) IndexSources(sources map[string]string) {
+	for filePath, source := range sources {
+		idx.UpdateFileFromSource(filePath, source)
+	}
+
+	idx.mutex.Lock()
+	idx.ready = true
 	idx.mutex.Unlock()
+}
+
+// ParseSource extracts the symbol definitions of an in-memory buffer the way
+// ParseFile does for a file on disk, without touching the index
+func (idx *Index) ParseSource(source string, filePath string) []SymbolEntry {
+	entries, _, _ := idx.parseSource(source, filePath)
+	return entries
+}
+
+// parseSource parses Ruby source into its symbol definitions and constant
+// references. A scan stopped early by an overlong line returns what was parsed
+// before it along with the error; source too unbalanced to trust returns only
+// an unbalancedError.
+func (idx *Index) parseSource(source string, filePath string) ([]SymbolEntry, []ConstantReference, error) {
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	entries, refs, err := idx.parseScanner(scanner, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// config/routes.rb also defines the path and url helpers
+	if isRoutesFile(filePath) {
+		entries = append(entries, parseRoutes(bufio.NewScanner(strings.NewReader(source)), filePath, idx.inflections)...)
+	}
+	// db/schema.rb defines the column attributes of the models
+	if idx.options.SchemaColumns && isSchemaFile(filePath) {
+		entries = append(entries, parseSchema(bufio.NewScanner(strings.NewReader(source)), filePath, idx.inflections)...)
+	}
+	idx.tagGem(filePath, entries)
+
+	return entries, refs, scanner.Err()
+}
+
+// replaceFileEntries swaps the indexed symbols and references of a file
+func (idx *Index) replaceFileEntries(filePath string, newEntries []SymbolEntry, refs []ConstantReference) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.storeFileEntries(filePath, newEntries, refs)
+}
+
+// storeFileEntries replaces whatever is indexed for a file, so a file indexed twice
+// (an edit racing the initial walk) never leaves duplicates behind. It reports
+// whether the entries were admitted under the symbol limits. Callers hold the lock.
+func (idx *Index) storeFileEntries(filePath string, newEntries []SymbolEntry, refs []ConstantReference) bool {
+	admitted := idx.admitEntries(filePath, len(newEntries))
+	if !admitted {
+		newEntries, refs = nil, nil
+	}
+
+	idx.removeFileEntries(filePath)
+	idx.addReferences(filePath, refs)
 
-	// Re-parse the file
-	newEntries := idx.ParseFile(filePath)
 	if len(newEntries) > 0 {
-		idx.mutex.Lock()
 		idx.fileSymbols[filePath] = newEntries
+		idx.symbolCount += len(newEntries)
 		for _, entry := range newEntries {
 			idx.symbols[entry.Name] = append(idx.symbols[entry.Name], entry)
 			if entry.FullyQualifiedName != entry.Name {
 				idx.symbols[entry.FullyQualifiedName] = append(idx.symbols[entry.FullyQualifiedName], entry)
 			}
 		}
-		idx.mutex.Unlock()
 	}
+	return admitted
+}
 
-	idx.logger.Printf("Re-indexed file: %s (%d symbols)", filePath, len(newEntries))
+// removeFileEntries drops the symbols and references of a file from the name
+// and file maps. Callers hold the write lock.
+func (idx *Index) removeFileEntries(filePath string) {
+	idx.removeReferences(filePath)
+
+	oldEntries, ok := idx.fileSymbols[filePath]
+	if !ok {
+		return
+	}
+	for _, entry := range oldEntries {
+		idx.removeNamedEntries(entry.Name, filePath)
+		if entry.FullyQualifiedName != entry.Name {
+			idx.removeNamedEntries(entry.FullyQualifiedName, filePath)
+		}
+	}
+	delete(idx.fileSymbols, filePath)
+	idx.symbolCount -= len(oldEntries)
+}
+
+// removeNamedEntries drops the entries of a file indexed under a name. Callers
+// hold the write lock.
+func (idx *Index) removeNamedEntries(name string, filePath string) {
+	entries, exists := idx.symbols[name]
+	if !exists {
+		return
+	}
+	filtered := entries[:0]
+	for _, e := range entries {
+		if e.FilePath != filePath {
+			filtered = append(filtered, e)
+		}
+	}
+	if len(filtered) > 0 {
+		idx.symbols[name] = filtered
+	} else {
+		delete(idx.symbols, name)
+	}
+}
+
+// admitEntries reports whether a file's entries fit within the symbol limits,
+// counting the entries it already holds as freed. Callers hold the write lock.
+func (idx *Index) admitEntries(filePath string, count int) bool {
+	if limit := idx.options.maxFileSymbols(); count > limit {
+		if _, skipped := idx.skippedFiles[filePath]; !skipped {
+			idx.logger.Printf("Skipping %s: %d symbols exceeds the per-file limit of %d", filePath, count, limit)
+		}
+		idx.skippedFiles[filePath] = false
+		return false
+	}
+
+	if limit := idx.options.maxSymbols(); idx.symbolCount-len(idx.fileSymbols[filePath])+count > limit {
+		if !idx.limitReached {
+			idx.logger.Printf("Warning: symbol limit of %d reached, further symbols are not indexed", limit)
+		}
+		idx.limitReached = true
+		idx.skippedFiles[filePath] = true
+		return false
+	}
+
+	delete(idx.skippedFiles, filePath)
+	return true
+}
+
+// updateLimitReached recomputes whether the workspace-wide limit still keeps
+// files out, after skipped files were dropped. Callers hold the write lock.
+func (idx *Index) updateLimitReached() {
+	idx.limitReached = false
+	for _, byWorkspaceLimit := range idx.skippedFiles {
+		idx.limitReached = idx.limitReached || byWorkspaceLimit
+	}
+}
+
+// Stats returns the current size of the index against its limits
+func (idx *Index) Stats() Stats {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return Stats{
+		Files:        len(idx.fileSymbols),
+		Symbols:      idx.symbolCount,
+		MaxSymbols:   idx.options.maxSymbols(),
+		SkippedFiles: len(idx.skippedFiles),
+		LimitReached: idx.limitReached,
+		Errors:       idx.indexErrors(),
+	}
+}
+
+// recordIndexError remembers why a path could not be read and logs it
+func (idx *Index) recordIndexError(path string, err error) {
+	idx.logger.Printf("Warning: could not index %s: %v", path, err)
+
+	idx.mutex.Lock()
+	idx.readErrors[path] = err
+	idx.mutex.Unlock()
+}
+
+// clearIndexError forgets an earlier read failure once a path reads fine again
+func (idx *Index) clearIndexError(path string) {
+	idx.mutex.Lock()
+	delete(idx.readErrors, path)
+	idx.mutex.Unlock()
+}
+
+// indexErrors lists the recorded read failures by path. Callers hold the lock.
+func (idx *Index) indexErrors() []IndexError {
+	errors := make([]IndexError, 0, len(idx.readErrors))
+	for path, err := range idx.readErrors {
+		errors = append(errors, IndexError{Path: path, Err: err})
+	}
+	sort.Slice(errors, func(i, j int) bool {
+		return errors[i].Path < errors[j].Path
+	})
+	return errors
 }
 
 // GetFileSymbols returns all symbols for a specific file
@@ -541,37 +1624,140 @@ func (idx *Index) GetFileSymbols(filePath string) []SymbolEntry {
 	return nil
 }
 
-// GetWordAtPosition extracts the word/token at a given cursor position
-func GetWordAtPosition(source string, line int, character int) string {
-	lines := strings.Split(source, "\n")
-	if line < 0 || line >= len(lines) {
+// EnclosingScope returns the FQN of the innermost class/module whose body contains
+// a 1-based line of a file. Definitions whose end was never found extend to the end of the file.
+func (idx *Index) EnclosingScope(filePath string, line int) string {
+	var innermost *SymbolEntry
+	entries := idx.GetFileSymbols(filePath)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Type != SymbolClass && entry.Type != SymbolModule {
+			continue
+		}
+		if entry.Line <= line && (entry.EndLine == 0 || line <= entry.EndLine) && (innermost == nil || entry.Line >= innermost.Line) {
+			innermost = entry
+		}
+	}
+
+	if innermost == nil {
 		return ""
 	}
+	return innermost.FullyQualifiedName
+}
 
-	lineText := lines[line]
-	runes := []rune(lineText)
+// EnclosingDefinition returns the innermost method, class or module whose range
+// contains a 1-based line of a file
+func (idx *Index) EnclosingDefinition(filePath string, line int) (SymbolEntry, bool) {
+	var innermost *SymbolEntry
+	entries := idx.GetFileSymbols(filePath)
+	for i := range entries {
+		entry := &entries[i]
+		switch entry.Type {
+		case SymbolClass, SymbolModule, SymbolMethod, SymbolSingletonMethod:
+		default:
+			continue
+		}
+		endLine := entry.EndLine
+		if endLine < entry.Line {
+			endLine = entry.Line
+		}
+		// Strictly inner, so a method wins over its module_function copy listed later
+		if entry.Line <= line && line <= endLine && (innermost == nil || entry.Line > innermost.Line) {
+			innermost = entry
+		}
+	}
 
-	if character < 0 || character >= len(runes) {
-		return ""
+	if innermost == nil {
+		return SymbolEntry{}, false
 	}
+	return *innermost, true
+}
 
-	// Expand left
-	start := character
-	for start > 0 && isWordChar(runes[start-1]) {
-		start--
+// InstanceVariableAssignments returns every site assigning the instance variable
+// within the given class. Without a known class, assignments in all classes are returned.
+func (idx *Index) InstanceVariableAssignments(className string, name string) []SymbolEntry {
+	var all, scoped []SymbolEntry
+	for _, entry := range idx.Lookup(name) {
+		if entry.Type != SymbolInstanceVariable {
+			continue
+		}
+		all = append(all, entry)
+		if entry.Parent == className {
+			scoped = append(scoped, entry)
+		}
 	}
 
-	// Expand right
-	end := character
-	for end < len(runes) && isWordChar(runes[end]) {
-		end++
+	if len(scoped) > 0 {
+		return scoped
 	}
+	return all
+}
 
-	if start == end {
-		return ""
+// ClassVariableAssignments returns every site assigning the class variable within
+// the given class or the superclasses sharing it. Without a known class, or none
+// of them assigning it, assignments in all classes are returned.
+func (idx *Index) ClassVariableAssignments(className string, name string) []SymbolEntry {
+	classes := map[string]bool{className: true}
+	for _, superclass := range idx.SuperclassChain(className) {
+		classes[superclass] = true
+	}
+
+	var all, scoped []SymbolEntry
+	for _, entry := range idx.Lookup(name) {
+		if entry.Type != SymbolClassVar {
+			continue
+		}
+		all = append(all, entry)
+		if classes[entry.Parent] {
+			scoped = append(scoped, entry)
+		}
+	}
+
+	if len(scoped) > 0 {
+		return scoped
+	}
+	return all
+}
+
+// Upper bound on superclass hops, guarding against cycles through reopened classes
+const maxSuperclassDepth = 32
+
+// SuperclassChain returns the resolved superclasses of a class, nearest first
+// (ApplicationRecord, ActiveRecord::Base). The walk stops after the first
+// superclass that is not indexed, since its own parent is unknown.
+func (idx *Index) SuperclassChain(fqn string) []string {
+	var chain []string
+	seen := map[string]bool{fqn: true}
+
+	current := fqn
+	for len(chain) < maxSuperclassDepth {
+		superclass := idx.superclassOf(current)
+		if superclass == "" || seen[superclass] {
+			break
+		}
+		chain = append(chain, superclass)
+		seen[superclass] = true
+		current = superclass
+	}
+
+	return chain
+}
+
+// superclassOf returns the resolved superclass of an indexed class, from whichever
+// of its definitions declares one
+func (idx *Index) superclassOf(fqn string) string {
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.Type == SymbolClass && entry.FullyQualifiedName == fqn && entry.Detail != "" {
+			return idx.ResolveConstantPath(entry.Detail, entry.Parent)
+		}
 	}
+	return ""
+}
 
-	return string(runes[start:end])
+// GetWordAtPosition extracts the word/token at a given cursor position.
+// Constants are returned with their namespace (Foo::Bar), everything else as written.
+func GetWordAtPosition(source string, line int, character int) string {
+	return GetTokenAtPosition(source, line, character).Qualified()
 }
 
 // SymbolKindToLSP converts our SymbolType to an LSP SymbolKind integer
@@ -591,6 +1777,12 @@ func SymbolKindToLSP(t SymbolType) int {
 		return 7  // Property
 	case SymbolAttrAccessor:
 		return 7  // Property
+	case SymbolInstanceVariable:
+		return 8  // Field
+	case SymbolRoute:
+		return 12 // Function
+	case SymbolClassVar:
+		return 8  // Field
 	default:
 		return 1  // File
 	}
@@ -613,6 +1805,12 @@ func CompletionKindFromType(t SymbolType) int {
 		return 5  // Field
 	case SymbolAttrAccessor:
 		return 10 // Property
+	case SymbolInstanceVariable:
+		return 6  // Variable
+	case SymbolRoute:
+		return 3  // Function
+	case SymbolClassVar:
+		return 6  // Variable
 	default:
 		return 1  // Text
 	}
@@ -637,6 +1835,12 @@ func SymbolTypeString(t SymbolType) string {
 		return "association"
 	case SymbolAttrAccessor:
 		return "attribute"
+	case SymbolInstanceVariable:
+		return "instance variable"
+	case SymbolRoute:
+		return "route helper"
+	case SymbolClassVar:
+		return "class variable"
 	default:
 		return "symbol"
 	}
@@ -644,17 +1848,18 @@ func SymbolTypeString(t SymbolType) string {
 
 // --- Helper functions ---
 
-func isWordChar(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':' || r == '!' || r == '?' || r == '='
-}
+// Columns between tab stops when measuring indentation, as Ruby itself does
+// for its mismatched indentation warnings
+const tabWidth = 8
 
+// countIndent measures a line's indentation in columns, a tab advancing to the next tab stop
 func countIndent(line string) int {
 	count := 0
 	for _, ch := range line {
 		if ch == ' ' {
 			count++
 		} else if ch == '\t' {
-			count += 2
+			count += tabWidth - count%tabWidth
 		} else {
 			break
 		}
@@ -691,12 +1896,14 @@ func camelToSnake(s string) string {
 	return result.String()
 }
 
+// deduplicateEntries drops repeats of the same definition, identified by its file,
+// line and fully qualified name
 func deduplicateEntries(entries []SymbolEntry) []SymbolEntry {
 	seen := make(map[string]bool)
 	var result []SymbolEntry
 
 	for _, e := range entries {
-		key := fmt.Sprintf("%s:%d:%s", e.FilePath, e.Line, e.Name)
+		key := fmt.Sprintf("%s:%d:%s", e.FilePath, e.Line, e.FullyQualifiedName)
 		if !seen[key] {
 			seen[key] = true
 			result = append(result, e)
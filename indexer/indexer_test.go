@@ -0,0 +1,542 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// parseTestSource indexes source as the file app.rb of an empty workspace
+func parseTestSource(t *testing.T, source string) []SymbolEntry {
+	t.Helper()
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	return idx.ParseSource(source, "/workspace/app.rb")
+}
+
+// writeTestFiles writes files (path relative to root -> content) under root
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestIndex writes files to a temporary workspace and indexes it with options
+func newTestIndex(t *testing.T, files map[string]string, options Options) (*Index, string) {
+	t.Helper()
+	root := t.TempDir()
+	writeTestFiles(t, root, files)
+	idx := NewWithOptions(root, log.New(io.Discard, "", 0), options)
+	idx.BuildIndex(context.Background())
+	return idx, root
+}
+
+// findEntry returns the entry of a fully qualified name, failing the test when
+// there is none
+func findEntry(t *testing.T, entries []SymbolEntry, fqn string) SymbolEntry {
+	t.Helper()
+	for _, entry := range entries {
+		if entry.FullyQualifiedName == fqn {
+			return entry
+		}
+	}
+	t.Fatalf("no entry for %s among %d entries", fqn, len(entries))
+	return SymbolEntry{}
+}
+
+// entrySpec is what a test expects of an indexed entry
+type entrySpec struct {
+	fqn        string
+	parent     string
+	visibility string
+	endLine    int
+}
+
+// checkEntries verifies the Parent, Visibility and EndLine of entries
+func checkEntries(t *testing.T, entries []SymbolEntry, specs []entrySpec) {
+	t.Helper()
+	for _, spec := range specs {
+		entry := findEntry(t, entries, spec.fqn)
+		if entry.Parent != spec.parent || entry.Visibility != spec.visibility || entry.EndLine != spec.endLine {
+			t.Errorf("%s: Parent %q, Visibility %q, EndLine %d; want %q, %q, %d",
+				spec.fqn, entry.Parent, entry.Visibility, entry.EndLine, spec.parent, spec.visibility, spec.endLine)
+		}
+	}
+}
+
+func TestDataDefine(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		members []string
+		specs   []entrySpec
+	}{
+		{
+			name:    "parenthesized members",
+			source:  "Coord = Data.define(:lat, :lng)\n",
+			members: []string{"Coord#lat", "Coord#lng"},
+			specs:   []entrySpec{{"Coord", "", "public", 0}},
+		},
+		{
+			name:    "block without members",
+			source:  "Coord = Data.define do\n  def norm\n    0\n  end\nend\n",
+			members: nil,
+			specs:   []entrySpec{{"Coord", "", "public", 5}, {"Coord#norm", "Coord", "public", 4}},
+		},
+		{
+			name:    "parenthesized members and a block",
+			source:  "Coord = Data.define(:lat, :lng) do\n  def norm\n    Math.hypot(lat, lng)\n  end\nend\n",
+			members: []string{"Coord#lat", "Coord#lng"},
+			specs:   []entrySpec{{"Coord", "", "public", 5}, {"Coord#norm", "Coord", "public", 4}},
+		},
+		{
+			name:    "bare members and a block",
+			source:  "Coord = Data.define :lat, :lng do\n  def norm; 0; end\nend\n",
+			members: []string{"Coord#lat", "Coord#lng"},
+			specs:   []entrySpec{{"Coord", "", "public", 3}, {"Coord#norm", "Coord", "public", 2}},
+		},
+		{
+			name:    "keyword members",
+			source:  "Point = Data.define(x: Integer, y: Integer)\n",
+			members: []string{"Point#x", "Point#y"},
+			specs:   []entrySpec{{"Point", "", "public", 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := parseTestSource(t, test.source)
+			checkEntries(t, entries, test.specs)
+			for _, fqn := range test.members {
+				if member := findEntry(t, entries, fqn); member.Type != SymbolAttrAccessor || member.Detail != "data member" {
+					t.Errorf("%s = %+v, want a data member", fqn, member)
+				}
+			}
+		})
+	}
+}
+
+func TestDataDefineInStringsAndComments(t *testing.T) {
+	entries := parseTestSource(t, `# Point = Data.define(:x)
+class Geometry
+  # Vector = Data.define(:dx, :dy)
+  EXAMPLE = "Coord = Data.define(:lat, :lng)"
+  Size = Data.define(:width) # Area = Data.define(:w, :h)
+  Box = Data.define(:side, # :depth (added later)
+    :height)
+end
+`)
+	for _, entry := range entries {
+		switch entry.Name {
+		case "Point", "Vector", "Coord", "Area", "w", "h", "depth":
+			t.Errorf("indexed %s from inside a string or comment", entry.FullyQualifiedName)
+		}
+	}
+	findEntry(t, entries, "Geometry::Size#width")
+	findEntry(t, entries, "Geometry::Box")
+}
+
+func TestSiblingTopLevelClasses(t *testing.T) {
+	entries := parseTestSource(t, `class Invoice
+  def total
+    lines.sum(&:amount)
+  end
+end
+
+class Receipt
+  def printed?
+    printed_at.present?
+  end
+end
+
+class Refund
+  def amount
+    -invoice.total
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Invoice", "", "public", 5},
+		{"Invoice#total", "Invoice", "public", 4},
+		{"Receipt", "", "public", 11},
+		{"Receipt#printed?", "Receipt", "public", 10},
+		{"Refund", "", "public", 17},
+		{"Refund#amount", "Refund", "public", 16},
+	})
+}
+
+// An end indented deeper than its opener closes it once the next line shows the
+// body is over, rather than being ignored and leaving the body open
+func TestEndIndentedDeeperThanItsOpener(t *testing.T) {
+	entries := parseTestSource(t, `class Invoice
+  def total
+    lines.sum(&:amount)
+    end
+
+  def paid?
+    payments.any?
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Invoice", "", "public", 9},
+		{"Invoice#total", "Invoice", "public", 4},
+		{"Invoice#paid?", "Invoice", "public", 8},
+	})
+}
+
+// A nested class closing inside a private section leaves the methods after it
+// private, and its own methods start public
+func TestVisibilityRestoredAfterNestedClass(t *testing.T) {
+	entries := parseTestSource(t, `class ReportBuilder
+  def build
+    Row.new(header).tap do |row|
+      row.freeze
+    end
+  end
+
+  private
+
+  def header
+    "Report"
+  end
+
+  class Row
+    def initialize(text)
+      @text = text
+    end
+
+    protected
+
+    def text
+      @text
+    end
+  end
+
+  def footer
+    "End of report"
+  end
+
+  module Formatting
+    def bold(text)
+      "**#{text}**"
+    end
+  end
+
+  def summary
+    [header, footer].join
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"ReportBuilder", "", "public", 39},
+		{"ReportBuilder#build", "ReportBuilder", "public", 6},
+		{"ReportBuilder#header", "ReportBuilder", "private", 12},
+		{"ReportBuilder::Row", "ReportBuilder", "public", 24},
+		{"ReportBuilder::Row#initialize", "ReportBuilder::Row", "public", 17},
+		{"ReportBuilder::Row#text", "ReportBuilder::Row", "protected", 23},
+		{"ReportBuilder#footer", "ReportBuilder", "private", 28},
+		{"ReportBuilder::Formatting#bold", "ReportBuilder::Formatting", "public", 33},
+		{"ReportBuilder#summary", "ReportBuilder", "private", 38},
+	})
+}
+
+// Definitions opened and closed on one line with semicolons leave nothing open
+func TestOneLineDefinitionsWithSemicolons(t *testing.T) {
+	entries := parseTestSource(t, `class NotAuthorizedError < StandardError; end
+module Exportable; def export; to_json; end; end
+class Token; def to_s; "token;"; end; end
+
+class ExportJob
+  def perform(record); record.export; end
+  def retry?; "a; b"; end
+
+  def queue
+    "default; low"
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"NotAuthorizedError", "", "public", 1},
+		{"Exportable", "", "public", 2},
+		{"Exportable#export", "Exportable", "public", 2},
+		{"Token", "", "public", 3},
+		{"Token#to_s", "Token", "public", 3},
+		{"ExportJob", "", "public", 12},
+		{"ExportJob#perform", "ExportJob", "public", 6},
+		{"ExportJob#retry?", "ExportJob", "public", 7},
+		{"ExportJob#queue", "ExportJob", "public", 11},
+	})
+}
+
+// rescue, ensure and else neither open nor close a level, at method level or
+// within begin blocks
+func TestRescueInsideMethods(t *testing.T) {
+	entries := parseTestSource(t, `class PaymentGateway
+  def charge(amount)
+    begin
+      client.charge(amount)
+    rescue Timeout::Error => e
+      log(e)
+    else
+      record(amount)
+    ensure
+      client.close
+    end
+  end
+
+  def refund(amount)
+    client.refund(amount)
+  rescue StandardError
+    retry
+  ensure
+    client.close
+  end
+
+  def ping; client.ping; rescue; false; end
+
+  def status
+    case client.state
+    when :up then "up"
+    else "down"
+    end
+  rescue
+    "unknown"
+  end
+
+  private
+
+  def client
+    @client ||= Client.new
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"PaymentGateway", "", "public", 38},
+		{"PaymentGateway#charge", "PaymentGateway", "public", 12},
+		{"PaymentGateway#refund", "PaymentGateway", "public", 20},
+		{"PaymentGateway#ping", "PaymentGateway", "public", 22},
+		{"PaymentGateway#status", "PaymentGateway", "public", 31},
+		{"PaymentGateway#client", "PaymentGateway", "private", 37},
+	})
+}
+
+// Continuation lines of chains and conditions belong to their statement, so
+// blocks whose end lines up with the statement close where they should
+func TestContinuationLines(t *testing.T) {
+	entries := parseTestSource(t, `class ActivityFeed
+  RECENT = Activity
+    .where(visible: true)
+    .each_with_object({}) do |activity, feed|
+      feed[activity.id] = activity
+  end
+
+  def entries_for(user)
+    Activity
+      .where(user: user)
+      &.order(created_at: :desc)
+      .map do |activity|
+        activity.summary
+    end
+  end
+
+  def visible_to?(user)
+    user.active? &&
+      user.followers.any? do |follower|
+        follower.verified?
+    end
+  end
+
+  private
+
+  def cache_key
+    [self.class.name,
+     Activity.maximum(:updated_at)].join("/")
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"ActivityFeed", "", "public", 30},
+		{"ActivityFeed::RECENT", "ActivityFeed", "public", 0},
+		{"ActivityFeed#entries_for", "ActivityFeed", "public", 15},
+		{"ActivityFeed#visible_to?", "ActivityFeed", "public", 22},
+		{"ActivityFeed#cache_key", "ActivityFeed", "private", 29},
+	})
+}
+
+func TestCountIndent(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"class Foo", 0},
+		{"    def bar", 4},
+		{"\tdef bar", 8},
+		{"  \tdef bar", 8},
+		{"\t  end", 10},
+		{"\t\t", 16},
+	}
+	for _, test := range tests {
+		if got := countIndent(test.line); got != test.want {
+			t.Errorf("countIndent(%q) = %d, want %d", test.line, got, test.want)
+		}
+	}
+}
+
+// Tab-indented files, and files mixing tabs with spaces, nest like space-indented ones
+func TestTabIndentedNesting(t *testing.T) {
+	entries := parseTestSource(t, "module Billing\n\tclass Invoice\n\t\tdef total\n\t\t\tlines.sum\n\t\tend\n\n\t\tclass Line\n\t\t\tdef amount\n\t\t\tend\n\t\tend\n\tend\n\n    class Receipt\n\t\tdef print\n        end\n    end\nend\n")
+	checkEntries(t, entries, []entrySpec{
+		{"Billing", "", "public", 17},
+		{"Billing::Invoice", "Billing", "public", 11},
+		{"Billing::Invoice#total", "Billing::Invoice", "public", 5},
+		{"Billing::Invoice::Line", "Billing::Invoice", "public", 10},
+		{"Billing::Invoice::Line#amount", "Billing::Invoice::Line", "public", 9},
+		{"Billing::Receipt", "Billing", "public", 16},
+		{"Billing::Receipt#print", "Billing::Receipt", "public", 15},
+	})
+}
+
+// Every definition with a body records the line of its closing end
+func TestEndLinesOfDefinitions(t *testing.T) {
+	entries := parseTestSource(t, `module Shop
+  class Order
+    def total
+      lines.sum
+    end
+
+    def self.open
+      where(state: :open)
+    end
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Shop", "", "public", 11},
+		{"Shop::Order", "Shop", "public", 10},
+		{"Shop::Order#total", "Shop::Order", "public", 5},
+		{"Shop::Order.open", "Shop::Order", "public", 9},
+	})
+}
+
+func TestBlockCommentsAreNotIndexed(t *testing.T) {
+	entries := parseTestSource(t, `class Order
+=begin
+class Phantom
+  def ghost
+  end
+end
+=end
+  def total
+  end
+=begin note
+def haunted
+=end trailing text
+end
+`)
+	for _, entry := range entries {
+		switch entry.Name {
+		case "Phantom", "ghost", "haunted":
+			t.Errorf("indexed %s from inside a block comment", entry.FullyQualifiedName)
+		}
+	}
+	checkEntries(t, entries, []entrySpec{
+		{"Order", "", "public", 13},
+		{"Order#total", "Order", "public", 9},
+	})
+}
+
+func TestMethodSummariesFromLeadingComments(t *testing.T) {
+	entries := parseTestSource(t, `class Order
+  # Sums the price of every line item.
+  # Discounts are applied first.
+  #
+  # @return [Integer] cents
+  def total
+  end
+
+  # Unrelated note
+
+  def ship
+  end
+
+  def cancel
+  end
+end
+`)
+	tests := map[string]string{
+		"Order#total":  "Sums the price of every line item.",
+		"Order#ship":   "",
+		"Order#cancel": "",
+	}
+	for fqn, want := range tests {
+		if got := findEntry(t, entries, fqn).Summary; got != want {
+			t.Errorf("%s: Summary = %q, want %q", fqn, got, want)
+		}
+	}
+}
+
+func TestLookupOfPredicateBangAndSetterMethods(t *testing.T) {
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	idx.IndexSources(map[string]string{
+		"/workspace/app/models/account.rb": "class Account\n  def active?\n  end\n\n  def close!\n  end\n\n  def owner=(value)\n  end\nend\n",
+	})
+	for _, name := range []string{"active?", "close!", "owner=", "Account#active?", "Account#close!", "Account#owner="} {
+		if entries := idx.Lookup(name); len(entries) != 1 {
+			t.Errorf("Lookup(%q) = %d entries, want 1", name, len(entries))
+		}
+	}
+}
+
+func TestDefsWithReceivers(t *testing.T) {
+	entries := parseTestSource(t, `class Config
+  def self.load(path)
+  end
+
+  def Config.reload
+  end
+
+  def Settings.defaults
+  end
+
+  def Admin::Settings.flags
+  end
+
+  greeter = Object.new
+  def greeter.greet
+    "hi"
+  end
+
+  def path
+  end
+end
+`)
+	checkEntries(t, entries, []entrySpec{
+		{"Config", "", "public", 21},
+		{"Config.load", "Config", "public", 3},
+		// The receiver is the class around the def
+		{"Config.reload", "Config", "public", 6},
+		// Another constant owns the method
+		{"Settings.defaults", "Settings", "public", 9},
+		{"Admin::Settings.flags", "Admin::Settings", "public", 12},
+		// The object's def still closes with its end
+		{"Config#path", "Config", "public", 20},
+	})
+	for _, entry := range entries {
+		if entry.Name == "greet" {
+			t.Errorf("indexed a method defined on an object as %s", entry.FullyQualifiedName)
+		}
+	}
+	if flags := findEntry(t, entries, "Admin::Settings.flags"); flags.Type != SymbolSingletonMethod || flags.Character != 22 {
+		t.Errorf("Admin::Settings.flags: type %d at %d, want a singleton method named at 22", flags.Type, flags.Character)
+	}
+}
@@ -0,0 +1,120 @@
+package indexer
+
+import "strings"
+
+// Inflections turns the nouns naming tables, resources and associations into
+// their singular or plural, by the English rules Rails applies to most names and
+// a table of irregular nouns. Only the last word of a snake_case name changes
+// (line_items -> line_item, admin_people -> admin_person).
+type Inflections struct {
+	plurals   map[string]string // singular -> plural
+	singulars map[string]string // plural -> singular
+}
+
+// Nouns the regular rules get wrong, singular -> plural, known without
+// configuration: ActiveSupport's irregulars and the words its special rules cover
+var defaultIrregulars = map[string]string{
+	"person": "people",
+	"man":    "men",
+	"woman":  "women",
+	"child":  "children",
+	"sex":    "sexes",
+	"move":   "moves",
+	"zombie": "zombies",
+	"mouse":  "mice",
+	"ox":     "oxen",
+	"status": "statuses",
+	"alias":  "aliases",
+	"bus":    "buses",
+}
+
+// Nouns whose plural is the singular, as ActiveSupport has them
+var uncountableNouns = map[string]bool{
+	"equipment": true, "information": true, "rice": true, "money": true, "species": true,
+	"series": true, "fish": true, "sheep": true, "jeans": true, "police": true,
+}
+
+// NewInflections knows the default irregular nouns and the given ones, singular
+// -> plural, which take precedence
+func NewInflections(irregulars map[string]string) Inflections {
+	inflections := Inflections{
+		plurals:   make(map[string]string),
+		singulars: make(map[string]string),
+	}
+	for _, table := range []map[string]string{defaultIrregulars, irregulars} {
+		for singular, plural := range table {
+			singular, plural = strings.ToLower(singular), strings.ToLower(plural)
+			if singular != "" && plural != "" {
+				inflections.plurals[singular] = plural
+				inflections.singulars[plural] = singular
+			}
+		}
+	}
+	return inflections
+}
+
+// lastWord splits a snake_case name before its last word
+func lastWord(name string) (string, string) {
+	i := strings.LastIndex(name, "_")
+	return name[:i+1], name[i+1:]
+}
+
+// Singularize turns a plural name into its singular (users -> user,
+// categories -> category, addresses -> address, people -> person)
+func (in Inflections) Singularize(name string) string {
+	prefix, word := lastWord(name)
+	if uncountableNouns[word] {
+		return name
+	}
+	if singular, ok := in.singulars[word]; ok {
+		return prefix + singular
+	}
+	if _, ok := in.plurals[word]; ok {
+		return name
+	}
+
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "ss"):
+		return name
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// Pluralize turns a singular name into its plural (user -> users,
+// category -> categories, person -> people)
+func (in Inflections) Pluralize(name string) string {
+	prefix, word := lastWord(name)
+	if uncountableNouns[word] {
+		return name
+	}
+	if plural, ok := in.plurals[word]; ok {
+		return prefix + plural
+	}
+
+	switch {
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsAny(name[len(name)-2:len(name)-1], "aeiou"):
+		return strings.TrimSuffix(name, "y") + "ies"
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	}
+	return name + "s"
+}
+
+// ModelName returns the model class conventionally backed by a table
+// (order_items -> OrderItem, people -> Person), the inverse of TableName
+func (in Inflections) ModelName(table string) string {
+	return snakeToCamel(in.Singularize(table))
+}
+
+// TableName returns the conventional table of a model class (OrderItem ->
+// order_items, Person -> people). Explicit self.table_name assignments are not
+// recognized.
+func (in Inflections) TableName(className string) string {
+	return in.Pluralize(camelToSnake(classNameOnly(className)))
+}
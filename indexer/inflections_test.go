@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+func TestInflections(t *testing.T) {
+	inflections := NewInflections(map[string]string{"Cactus": "Cacti", "person": "folks"})
+
+	singulars := map[string]string{
+		"users":          "user",
+		"categories":     "category",
+		"addresses":      "address",
+		"boxes":          "box",
+		"line_items":     "line_item",
+		"children":       "child",
+		"admin_children": "admin_child",
+		"statuses":       "status",
+		"status":         "status",
+		"sheep":          "sheep",
+		// Configured irregulars, matched whatever their case, take precedence
+		"cacti": "cactus",
+		"folks": "person",
+	}
+	for plural, want := range singulars {
+		if got := inflections.Singularize(plural); got != want {
+			t.Errorf("Singularize(%q) = %q, want %q", plural, got, want)
+		}
+	}
+
+	plurals := map[string]string{
+		"user":      "users",
+		"category":  "categories",
+		"day":       "days",
+		"address":   "addresses",
+		"match":     "matches",
+		"line_item": "line_items",
+		"child":     "children",
+		"equipment": "equipment",
+		"cactus":    "cacti",
+		"person":    "folks",
+	}
+	for singular, want := range plurals {
+		if got := inflections.Pluralize(singular); got != want {
+			t.Errorf("Pluralize(%q) = %q, want %q", singular, got, want)
+		}
+	}
+
+	defaults := NewInflections(nil)
+	if got := defaults.ModelName("people"); got != "Person" {
+		t.Errorf("ModelName(people) = %q, want Person", got)
+	}
+	if got := defaults.ModelName("order_items"); got != "OrderItem" {
+		t.Errorf("ModelName(order_items) = %q, want OrderItem", got)
+	}
+	if got := defaults.TableName("Admin::Person"); got != "people" {
+		t.Errorf("TableName(Admin::Person) = %q, want people", got)
+	}
+}
+
+func TestAssociationClassNameUsesInflections(t *testing.T) {
+	src := "class Team < ApplicationRecord\n  has_many :people\n  has_many :cacti\n  belongs_to :captain, class_name: \"Person\"\nend\n"
+	idx := NewWithOptions("/workspace", log.New(io.Discard, "", 0), Options{Irregulars: map[string]string{"cactus": "cacti"}})
+	idx.IndexSources(map[string]string{"/workspace/app/models/team.rb": src})
+
+	tests := map[string]string{"people": "Person", "cacti": "Cactus", "captain": "Person"}
+	for name, want := range tests {
+		entry := findEntry(t, idx.Lookup(name), "Team#"+name)
+		if got := idx.AssociationClassName(entry); got != want {
+			t.Errorf("AssociationClassName(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Modes of indexing, chosen through Options.Mode
+const (
+	// ModeEager walks every workspace folder at startup
+	ModeEager = "eager"
+	// ModeLazy indexes the directory of each file opened, and the files found by
+	// LookupByConvention, as they are needed
+	ModeLazy = "lazy"
+	// ModeOnSave indexes files only as they are saved
+	ModeOnSave = "onSave"
+)
+
+// Mode returns when the index indexes files, ModeEager unless configured otherwise
+func (idx *Index) Mode() string {
+	if idx.options.Mode == ModeLazy || idx.options.Mode == ModeOnSave {
+		return idx.options.Mode
+	}
+	return ModeEager
+}
+
+// eager reports whether the index is built by walking the workspace
+func (idx *Index) eager() bool {
+	return idx.Mode() == ModeEager
+}
+
+// IndexOnDemand brings a file into a ModeLazy index along with the rest of its
+// directory, the first time the file is needed. Other modes index files on their
+// own schedule, so nothing is done.
+func (idx *Index) IndexOnDemand(filePath string) {
+	if idx.options.Mode != ModeLazy {
+		return
+	}
+	idx.IndexDirectory(filepath.Dir(filePath))
+}
+
+// IndexDirectory indexes the Ruby files directly inside a directory, once,
+// returning how many files were indexed. Subdirectories are left for when a file
+// in them is needed.
+func (idx *Index) IndexDirectory(dir string) int {
+	idx.mutex.Lock()
+	if idx.indexedDirs[dir] {
+		idx.mutex.Unlock()
+		return 0
+	}
+	idx.indexedDirs[dir] = true
+	idx.mutex.Unlock()
+
+	if idx.isExcludedDir(dir) {
+		return 0
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		idx.recordIndexError(dir, err)
+		return 0
+	}
+
+	fileCount := 0
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !idx.ShouldIndex(path) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			idx.recordIndexError(path, err)
+			continue
+		}
+		symbols, limitReached := idx.indexFile(path, info.ModTime())
+		if limitReached {
+			break
+		}
+		if symbols > 0 {
+			fileCount++
+		}
+	}
+
+	idx.logger.Printf("Indexed directory on demand: %s (%d files)", dir, fileCount)
+	return fileCount
+}
+
+// DirectoryIndexed reports whether the symbols of a directory are in the index:
+// always in ModeEager once it is ready, in ModeLazy once a file of the directory
+// has been needed
+func (idx *Index) DirectoryIndexed(dir string) bool {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if idx.eager() {
+		return idx.ready
+	}
+	return idx.indexedDirs[dir]
+}
+
+// Covers reports whether a file belongs to what the index keeps up to date: the
+// whole workspace in ModeEager, the directories indexed so far in ModeLazy and
+// the files saved so far in ModeOnSave
+func (idx *Index) Covers(path string) bool {
+	switch idx.options.Mode {
+	case ModeLazy:
+		return idx.DirectoryIndexed(filepath.Dir(path))
+	case ModeOnSave:
+		idx.mutex.RLock()
+		defer idx.mutex.RUnlock()
+		_, known := idx.modTimes[path]
+		return known
+	}
+	return true
+}
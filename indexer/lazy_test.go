@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+var lazyTestFiles = map[string]string{
+	"app/models/user.rb":                   "class User\n  def name; end\nend\n",
+	"app/models/account.rb":                "class Account\nend\n",
+	"app/models/concerns/trackable.rb":     "module Trackable\nend\n",
+	"app/controllers/orders_controller.rb": "# Handles orders\nclass OrdersController\n  def index; end\nend\n",
+}
+
+func TestModeDefaultsToEager(t *testing.T) {
+	for _, mode := range []string{"", "sometimes", ModeEager} {
+		idx, root := newTestIndex(t, lazyTestFiles, Options{Mode: mode})
+		if got := idx.Mode(); got != ModeEager {
+			t.Errorf("Mode() with %q = %q, want %q", mode, got, ModeEager)
+		}
+		if len(idx.Lookup("OrdersController")) == 0 {
+			t.Errorf("mode %q: OrdersController not indexed at startup", mode)
+		}
+		if !idx.Covers(filepath.Join(root, "app/models/user.rb")) {
+			t.Errorf("mode %q: Covers = false, want true for every file", mode)
+		}
+	}
+}
+
+func TestLazyModeIndexesDirectoriesOnDemand(t *testing.T) {
+	idx, root := newTestIndex(t, lazyTestFiles, Options{Mode: ModeLazy})
+	models := filepath.Join(root, "app", "models")
+
+	if !idx.IsReady() {
+		t.Fatal("IsReady() = false, want true at once in ModeLazy")
+	}
+	if len(idx.Lookup("User")) != 0 {
+		t.Fatal("User indexed before any file was needed")
+	}
+	if idx.DirectoryIndexed(models) || idx.Covers(filepath.Join(models, "user.rb")) {
+		t.Error("app/models reported indexed before any file was needed")
+	}
+
+	idx.IndexOnDemand(filepath.Join(models, "user.rb"))
+
+	// The whole directory comes in with the file, but not its subdirectories or siblings
+	for _, name := range []string{"User", "User#name", "Account"} {
+		if len(idx.Lookup(name)) == 0 {
+			t.Errorf("%s not indexed after opening app/models/user.rb", name)
+		}
+	}
+	for _, name := range []string{"Trackable", "OrdersController"} {
+		if len(idx.Lookup(name)) != 0 {
+			t.Errorf("%s indexed, want it left until a file of its directory is needed", name)
+		}
+	}
+	if !idx.DirectoryIndexed(models) || !idx.Covers(filepath.Join(models, "account.rb")) {
+		t.Error("app/models not reported indexed after opening one of its files")
+	}
+	if idx.Covers(filepath.Join(root, "app", "controllers", "orders_controller.rb")) {
+		t.Error("Covers(orders_controller.rb) = true, want false")
+	}
+
+	// A second open of the directory parses nothing again
+	if files := idx.IndexDirectory(models); files != 0 {
+		t.Errorf("IndexDirectory of an indexed directory = %d files, want 0", files)
+	}
+}
+
+func TestLazyModeLookupByConventionParsesTheFile(t *testing.T) {
+	idx, root := newTestIndex(t, lazyTestFiles, Options{Mode: ModeLazy})
+
+	entries := idx.LookupByConvention("OrdersController")
+	entry := findEntry(t, entries, "OrdersController")
+	if entry.Line != 2 {
+		t.Errorf("OrdersController line = %d, want 2 from the parsed file", entry.Line)
+	}
+	if len(idx.Lookup("OrdersController#index")) == 0 {
+		t.Error("OrdersController#index not indexed after the convention lookup")
+	}
+	if !idx.DirectoryIndexed(filepath.Join(root, "app", "controllers")) {
+		t.Error("app/controllers not reported indexed after the convention lookup")
+	}
+}
+
+func TestOnSaveModeIndexesSavedFiles(t *testing.T) {
+	idx, root := newTestIndex(t, lazyTestFiles, Options{Mode: ModeOnSave})
+	user := filepath.Join(root, "app", "models", "user.rb")
+
+	if !idx.IsReady() {
+		t.Fatal("IsReady() = false, want true at once in ModeOnSave")
+	}
+	idx.IndexOnDemand(user)
+	if len(idx.Lookup("User")) != 0 || idx.Covers(user) {
+		t.Fatal("User indexed on open, want it left until saved")
+	}
+
+	idx.UpdateFile(user)
+
+	if len(idx.Lookup("User#name")) == 0 {
+		t.Error("User#name not indexed after saving app/models/user.rb")
+	}
+	if len(idx.Lookup("Account")) != 0 {
+		t.Error("Account indexed, want only the saved file")
+	}
+	if !idx.Covers(user) {
+		t.Error("Covers(user.rb) = false after saving it, want true")
+	}
+}
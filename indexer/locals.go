@@ -0,0 +1,224 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Occurrence is where a name is written on a line, in UTF-16 columns
+type Occurrence struct {
+	Line         int // 1-based, like SymbolEntry
+	Character    int
+	EndCharacter int
+}
+
+// LocalOccurrences finds where a local variable name is written between two
+// 1-based lines of source: whole identifiers that are not calls on a receiver,
+// symbols, hash keys, or instance, class and global variables. Strings and
+// comments are skipped.
+func LocalOccurrences(source string, name string, startLine int, endLine int) []Occurrence {
+	var occurrences []Occurrence
+	for i, line := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		if lineNumber < startLine {
+			continue
+		}
+		if lineNumber > endLine {
+			break
+		}
+
+		code := maskStringsAndComments(line)
+		for offset := 0; ; {
+			index := strings.Index(code[offset:], name)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			end := start + len(name)
+			offset = end
+
+			if !isMethodMention(code, start, end, false) || receiverOf(code[:start]) != "" ||
+				(start > 0 && code[start-1] == ':') {
+				continue
+			}
+			occurrences = append(occurrences, Occurrence{
+				Line:         lineNumber,
+				Character:    UTF16Column(line, start),
+				EndCharacter: UTF16Column(line, end),
+			})
+		}
+	}
+	return occurrences
+}
+
+// Code before a local variable name that makes the name a new binding: a
+// parameter of the def, a block parameter, a rescued exception or a for loop variable
+var (
+	localParameterPattern = regexp.MustCompile(`^\s*def\s+` + defReceiver + `[\w!?=]+\s*(?:\(|\s)`)
+	blockParameterPattern = regexp.MustCompile(`(?:\bdo|\{)\s*\|[^|]*$`)
+	rescueBindingPattern  = regexp.MustCompile(`\brescue\b.*=>\s*$`)
+	forBindingPattern     = regexp.MustCompile(`^\s*for\s+[\w\s,*]*$`)
+)
+
+// Code around a local variable name that assigns it: plain (x = 1), operator
+// (x ||= 1, x += 1) or multiple assignment (a, b = pair)
+var (
+	localAssignmentPattern = regexp.MustCompile(`^\s*(?:=(?:[^=~>]|$)|(?:\|\||&&|<<|>>|\*\*|[-+*/%|&^])=)`)
+	multipleTargetsBefore  = regexp.MustCompile(`^[\w\s,*()]*$`)
+	multipleTargetsAfter   = regexp.MustCompile(`^\s*\)?\s*,[\w\s,*()]*=(?:[^=~>]|$)`)
+)
+
+// LocalDefinition finds where the local variable a name refers to at a 1-based
+// line and UTF-16 character was last bound, scanning from startLine, the line
+// of the enclosing def: the nearest assignment, parameter, block parameter,
+// rescued exception or for loop variable at or before the position. A block
+// parameter binds the name only until its block's end.
+func LocalDefinition(source string, name string, startLine int, line int, character int) (Occurrence, bool) {
+	lines := strings.Split(source, "\n")
+	var bodies []BodyRange
+	var definition Occurrence
+	found := false
+	for i, text := range lines {
+		lineNumber := i + 1
+		if lineNumber < startLine {
+			continue
+		}
+		if lineNumber > line {
+			break
+		}
+
+		code := maskStringsAndComments(text)
+		for offset := 0; ; {
+			index := strings.Index(code[offset:], name)
+			if index < 0 {
+				break
+			}
+			start := offset + index
+			end := start + len(name)
+			offset = end
+
+			column := UTF16Column(text, start)
+			if lineNumber == line && column > character {
+				break
+			}
+			if !isLocalBinding(code, start, end, lineNumber == startLine) {
+				continue
+			}
+			if opener := blockParameterPattern.FindStringIndex(code[:start]); opener != nil && lineNumber != startLine {
+				if code[opener[0]] == '{' {
+					if braceBlockEndLine(lines, i, opener[0]) < line {
+						continue
+					}
+				} else {
+					if bodies == nil {
+						bodies = BodyRanges(source)
+					}
+					if doBlockEndLine(bodies, lineNumber) < line {
+						continue
+					}
+				}
+			}
+			definition = Occurrence{Line: lineNumber, Character: column, EndCharacter: UTF16Column(text, end)}
+			found = true
+		}
+	}
+	return definition, found
+}
+
+// braceBlockEndLine returns the 1-based line of the brace closing the block
+// opened at column open of lines[index], the last line when it is not closed
+func braceBlockEndLine(lines []string, index int, open int) int {
+	depth := 0
+	for i := index; i < len(lines); i++ {
+		code := maskStringsAndComments(lines[i])
+		from := 0
+		if i == index {
+			from = open
+		}
+		for j := from; j < len(code); j++ {
+			switch code[j] {
+			case '{':
+				depth++
+			case '}':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	return len(lines)
+}
+
+// doBlockEndLine returns the line of the end closing the innermost body opened
+// on a 1-based line, the do block of a block parameter written there
+func doBlockEndLine(bodies []BodyRange, line int) int {
+	endLine := 0
+	for _, body := range bodies {
+		if body.Line == line && (endLine == 0 || body.EndLine < endLine) {
+			endLine = body.EndLine
+		}
+	}
+	if endLine == 0 {
+		return line
+	}
+	return endLine
+}
+
+// isLocalBinding reports whether code[start:end] is a whole local variable name
+// being bound rather than read
+func isLocalBinding(code string, start int, end int, defLine bool) bool {
+	if start > 0 {
+		if prev := code[start-1]; isIdentByte(prev) || prev == '@' || prev == '$' || prev == ':' || prev == '.' {
+			return false
+		}
+	}
+	if end < len(code) {
+		if next := code[end]; isIdentByte(next) || next == '?' || next == '!' {
+			return false
+		}
+	}
+
+	before, after := code[:start], code[end:]
+	switch {
+	case defLine:
+		// Keyword parameters (user:, user: nil) are written like hash keys
+		return isParameterName(before)
+	case strings.HasPrefix(after, ":") && !strings.HasPrefix(after, "::"):
+		return false
+	case blockParameterPattern.MatchString(before), rescueBindingPattern.MatchString(before), forBindingPattern.MatchString(before):
+		return true
+	case localAssignmentPattern.MatchString(after):
+		return true
+	}
+	return multipleTargetsBefore.MatchString(before) && multipleTargetsAfter.MatchString(after)
+}
+
+// isParameterName reports whether a name following the code before it on a def
+// line is one of the def's parameters: at the start of an entry of the parameter
+// list, after any splat or block sigil, and not within a default value
+// (def find(id, scope = user) binds id and scope, not user).
+func isParameterName(before string) bool {
+	list := localParameterPattern.FindStringIndex(before)
+	if list == nil {
+		return false
+	}
+
+	depth := 0
+	entryStart := true
+	for _, c := range before[list[1]:] {
+		switch {
+		case c == '(' || c == '[' || c == '{':
+			depth++
+			entryStart = false
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			entryStart = false
+		case c == ',' && depth == 0:
+			entryStart = true
+		case c == ' ' || c == '\t' || (entryStart && (c == '*' || c == '&')):
+		default:
+			entryStart = false
+		}
+	}
+	return depth == 0 && entryStart
+}
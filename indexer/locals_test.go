@@ -0,0 +1,73 @@
+package indexer
+
+import "testing"
+
+func TestLocalDefinition(t *testing.T) {
+	source := `def report(user, scope = account, *rest, &block)
+  total = 0
+  items.each do |item|
+    total += item.price
+  end
+  item || total
+  lines.map { |line| line.amount }
+  line
+  [1, 2].each { |n|
+    n
+  }
+  n
+  account
+  user
+end
+`
+	tests := []struct {
+		name      string
+		local     string
+		line      int
+		character int
+		want      Occurrence
+		found     bool
+	}{
+		{"parameter", "user", 14, 2, Occurrence{Line: 1, Character: 11, EndCharacter: 15}, true},
+		{"default value is not a parameter", "account", 13, 2, Occurrence{}, false},
+		{"assignment", "total", 6, 10, Occurrence{Line: 4, Character: 4, EndCharacter: 9}, true},
+		{"do block parameter within its block", "item", 4, 13, Occurrence{Line: 3, Character: 17, EndCharacter: 21}, true},
+		{"do block parameter after its end", "item", 6, 2, Occurrence{}, false},
+		{"brace block parameter after its brace", "line", 8, 2, Occurrence{}, false},
+		{"multi-line brace block parameter within its block", "n", 10, 4, Occurrence{Line: 9, Character: 17, EndCharacter: 18}, true},
+		{"multi-line brace block parameter after its brace", "n", 12, 2, Occurrence{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found := LocalDefinition(source, test.local, 1, test.line, test.character)
+			if found != test.found || got != test.want {
+				t.Errorf("LocalDefinition(%s, line %d) = %+v, %v; want %+v, %v", test.local, test.line, got, found, test.want, test.found)
+			}
+		})
+	}
+}
+
+func TestIsParameterName(t *testing.T) {
+	tests := []struct {
+		before string
+		want   bool
+	}{
+		{"def find(", true},
+		{"def find(id, ", true},
+		{"def find(id, *", true},
+		{"def find(id, **", true},
+		{"def find(id, &", true},
+		{"def find id, ", true},
+		{"def self.find(", true},
+		{"def find(id = ", false},
+		{"def find(id = fetch(1, ", false},
+		{"def find(id = fetch(1, 2), ", true},
+		{"def find(id) = ", false},
+		{"find(", false},
+	}
+	for _, test := range tests {
+		if got := isParameterName(test.before); got != test.want {
+			t.Errorf("isParameterName(%q) = %v, want %v", test.before, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// MethodCall is a name called from a method body. Without type information
+// it may just as well be a local variable sharing a method's name.
+type MethodCall struct {
+	Name         string
+	Receiver     string // receiver written before the name, "" for an implicit self call
+	Line         int    // 1-based, like SymbolEntry
+	Character    int    // UTF-16 column of the name, as LSP counts
+	EndCharacter int
+}
+
+var (
+	callNamePattern    = regexp.MustCompile(`[a-z_]\w*[?!]?`)
+	localAssignPattern = regexp.MustCompile(`^\s*(?:\|\||&&|[-+*/%])?=(?:[^=~>]|$)`)
+)
+
+// MethodCalls scans the body of a method for the names it calls, in order.
+// The source of an open buffer takes precedence over the file on disk when given.
+func MethodCalls(method SymbolEntry, source string) []MethodCall {
+	var scanner *bufio.Scanner
+	if source != "" {
+		scanner = bufio.NewScanner(strings.NewReader(source))
+	} else {
+		file, err := os.Open(method.FilePath)
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		scanner = bufio.NewScanner(file)
+	}
+
+	endLine := method.EndLine
+	if endLine < method.Line {
+		endLine = method.Line
+	}
+
+	var calls []MethodCall
+	for lineNumber := 1; scanner.Scan() && lineNumber <= endLine; lineNumber++ {
+		if lineNumber < method.Line {
+			continue
+		}
+		line := scanner.Text()
+		code := maskStringsAndComments(line)
+
+		for _, loc := range callNamePattern.FindAllStringIndex(code, -1) {
+			start, end := loc[0], loc[1]
+			if !isMethodMention(code, start, end, false) || defPrefixPattern.MatchString(code[:start]) {
+				continue
+			}
+			// An assignment makes a local variable (total = 0), not a call
+			if receiverOf(code[:start]) == "" && localAssignPattern.MatchString(code[end:]) {
+				continue
+			}
+			calls = append(calls, MethodCall{
+				Name:         code[start:end],
+				Receiver:     receiverOf(code[:start]),
+				Line:         lineNumber,
+				Character:    UTF16Column(line, start),
+				EndCharacter: UTF16Column(line, end),
+			})
+		}
+	}
+	return calls
+}
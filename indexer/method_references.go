@@ -0,0 +1,190 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MethodReference is a single mention of a method name in source: its definition,
+// a call, or a symbol naming it in alias, delegate, define_method and the like
+type MethodReference struct {
+	FilePath     string
+	Line         int // 1-based, like SymbolEntry
+	Character    int // UTF-16 column of the name, as LSP counts
+	EndCharacter int
+	Receiver     string // receiver written before the name (user, Order, self), "" for none
+	Definition   bool   // the def of a method with this name
+}
+
+// The text before a method name being defined (def foo, def self.foo, def Config.load)
+var defPrefixPattern = regexp.MustCompile(`(?:^|[^\w])def\s+` + defReceiver + `$`)
+
+// IsDefinitionPrefix reports whether the code before a method name is the def
+// defining it (def, def self., def Config.)
+func IsDefinitionPrefix(before string) bool {
+	return defPrefixPattern.MatchString(before)
+}
+
+// Calls that take method names as symbols (alias_method :new, :old; delegate :name, to: :user;
+// before_save :normalize)
+var methodSymbolCallPattern = regexp.MustCompile(`\b(alias_method|alias|delegate|define_method|send|public_send|__send__|method|instance_method|respond_to\?|private|protected|public|module_function|private_class_method|(?:skip_)?(?:before|after|around)_\w+|validate|helper_method)\b`)
+
+// MethodReferences scans the indexed files for mentions of a method name, sorted by
+// file and position. Matching is by name only, so same-named methods of unrelated
+// classes are conflated; Receiver lets callers narrow the results when they know the class.
+// Sources of open buffers are passed by file path and take precedence over the disk.
+func (idx *Index) MethodReferences(name string, sources map[string]string) []MethodReference {
+	var results []MethodReference
+	for _, filePath := range idx.IndexedFiles() {
+		if source, ok := sources[filePath]; ok {
+			results = append(results, scanMethodReferences(bufio.NewScanner(strings.NewReader(source)), name, filePath)...)
+			continue
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			continue
+		}
+		results = append(results, scanMethodReferences(bufio.NewScanner(file), name, filePath)...)
+		file.Close()
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+	return results
+}
+
+// IndexedFiles returns every file holding symbols or constant references
+func (idx *Index) IndexedFiles() []string {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	var files []string
+	for filePath := range idx.fileSymbols {
+		seen[filePath] = true
+		files = append(files, filePath)
+	}
+	for filePath := range idx.fileRefs {
+		if !seen[filePath] {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
+
+// scanMethodReferences finds the mentions of a method name in Ruby source,
+// ignoring string literals and comments. Within a method binding the name as a
+// local variable (a parameter, name = ...), its bare mentions are the variable's.
+func scanMethodReferences(scanner *bufio.Scanner, name string, filePath string) []MethodReference {
+	var refs []MethodReference
+	lineNumber := 0
+	local := false
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		defLine := methodPattern.MatchString(line)
+		if defLine {
+			local = false
+		}
+		if !strings.Contains(line, name) {
+			continue
+		}
+
+		code := maskStringsAndComments(line)
+		symbolsNameMethods := methodSymbolCallPattern.MatchString(code)
+
+		for offset := 0; ; {
+			i := strings.Index(code[offset:], name)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			end := start + len(name)
+			offset = end
+
+			if !isMethodMention(code, start, end, symbolsNameMethods) {
+				continue
+			}
+			bare := receiverOf(code[:start]) == "" && (start == 0 || code[start-1] != ':')
+			if bare && (local || isLocalBinding(code, start, end, defLine)) {
+				local = true
+				continue
+			}
+			refs = append(refs, MethodReference{
+				FilePath:     filePath,
+				Line:         lineNumber,
+				Character:    UTF16Column(line, start),
+				EndCharacter: UTF16Column(line, end),
+				Receiver:     receiverOf(code[:start]),
+				Definition:   defPrefixPattern.MatchString(code[:start]),
+			})
+		}
+	}
+	return refs
+}
+
+// receiverOf returns the receiver of a call whose name follows the given text
+// (user for "user.", Admin::Order for "Admin::Order&."), "" when there is none
+func receiverOf(before string) string {
+	switch {
+	case strings.HasSuffix(before, "&."):
+		before = strings.TrimSuffix(before, "&.")
+	case strings.HasSuffix(before, ".") && !strings.HasSuffix(before, ".."):
+		before = strings.TrimSuffix(before, ".")
+	default:
+		return ""
+	}
+
+	start := len(before)
+	for start > 0 && (isIdentByte(before[start-1]) || before[start-1] == ':' || before[start-1] == '@') {
+		start--
+	}
+	return strings.TrimLeft(before[start:], ":")
+}
+
+// isMethodMention reports whether code[start:end] is a whole method name rather than
+// part of another identifier, a variable sigil, a hash key or an unrelated symbol
+func isMethodMention(code string, start int, end int, symbolsNameMethods bool) bool {
+	if end < len(code) {
+		next := code[end]
+		if isIdentByte(next) {
+			return false
+		}
+		// foo? and foo! are different methods from foo
+		if (next == '?' || next == '!') && code[end-1] != '?' && code[end-1] != '!' {
+			return false
+		}
+		// Hash key or keyword argument (foo: 1)
+		if next == ':' && (end+1 >= len(code) || code[end+1] != ':') {
+			return false
+		}
+	}
+
+	if start == 0 {
+		return true
+	}
+	switch prev := code[start-1]; {
+	case isIdentByte(prev), prev == '@', prev == '$':
+		return false
+	case prev == ':':
+		// &:foo is a method reference; ::foo is a call; other symbols only name
+		// methods when passed to alias_method, delegate, define_method and the like
+		if start >= 2 && (code[start-2] == '&' || code[start-2] == ':') {
+			return true
+		}
+		return symbolsNameMethods
+	}
+	return true
+}
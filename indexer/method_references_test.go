@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestScanMethodReferencesSkipsLocals(t *testing.T) {
+	source := `class User
+  def name
+    "#{first} #{last}"
+  end
+
+  def label
+    name = "guest" if anonymous?
+    name.upcase
+  end
+
+  def greet(name)
+    "Hello #{name}"
+  end
+
+  def title
+    name.titleize
+  end
+
+  def owner_name
+    owner.name
+  end
+
+  delegate :name, to: :profile
+end
+`
+	refs := scanMethodReferences(bufio.NewScanner(strings.NewReader(source)), "name", "user.rb")
+
+	var lines []int
+	for _, ref := range refs {
+		lines = append(lines, ref.Line)
+	}
+	want := []int{2, 16, 20, 23}
+	if len(lines) != len(want) {
+		t.Fatalf("references on lines %v, want %v", lines, want)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Fatalf("references on lines %v, want %v", lines, want)
+		}
+	}
+	if !refs[0].Definition || refs[2].Receiver != "owner" {
+		t.Errorf("refs = %+v, want the def first and owner.name with its receiver", refs)
+	}
+}
+
+func TestIsDefinitionPrefix(t *testing.T) {
+	tests := []struct {
+		before string
+		want   bool
+	}{
+		{"  def ", true},
+		{"  def self.", true},
+		{"  def Config.", true},
+		{"  undef ", false},
+		{"  user.", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := IsDefinitionPrefix(test.before); got != test.want {
+			t.Errorf("IsDefinitionPrefix(%q) = %v, want %v", test.before, got, test.want)
+		}
+	}
+}
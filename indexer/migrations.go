@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Migration is a statement in a db/migrate file that creates or alters a table
+type Migration struct {
+	Table     string
+	Action    string // create_table, add_column, ...
+	FilePath  string
+	Line      int
+	Character int
+}
+
+// Schema statements naming the table they act on as their first argument
+var migrationStatementPattern = regexp.MustCompile(`^\s*(create_table|change_table|drop_table|rename_table|add_column|remove_column|rename_column|change_column|change_column_default|change_column_null|add_index|remove_index|add_reference|remove_reference|add_belongs_to|add_timestamps|remove_timestamps)\s*\(?\s*(?::(\w+)|["'](\w+)["'])`)
+
+// isMigrationFile reports whether a file is a Rails migration (db/migrate/*.rb)
+func isMigrationFile(filePath string) bool {
+	dir := filepath.Dir(filePath)
+	return filepath.Ext(filePath) == ".rb" && filepath.Base(dir) == "migrate" && filepath.Base(filepath.Dir(dir)) == "db"
+}
+
+// parseMigrations returns the table statements of a migration
+func parseMigrations(scanner *bufio.Scanner, filePath string) []Migration {
+	var migrations []Migration
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		matches := migrationStatementPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		table := matches[2]
+		if table == "" {
+			table = matches[3]
+		}
+		migrations = append(migrations, Migration{
+			Table:     table,
+			Action:    matches[1],
+			FilePath:  filePath,
+			Line:      lineNumber,
+			Character: UTF16Column(line, len(line)-len(strings.TrimLeft(line, " \t"))),
+		})
+	}
+	return migrations
+}
+
+// parseMigrationFile reads the table statements of a migration on disk
+func parseMigrationFile(filePath string) []Migration {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	return parseMigrations(bufio.NewScanner(file), filePath)
+}
+
+// indexMigrationFile replaces the migrations contributed by a file. Callers hold the write lock.
+func (idx *Index) indexMigrationFile(filePath string, migrations []Migration) {
+	for _, table := range idx.migrationFiles[filePath] {
+		var kept []Migration
+		for _, migration := range idx.migrations[table] {
+			if migration.FilePath != filePath {
+				kept = append(kept, migration)
+			}
+		}
+		if len(kept) > 0 {
+			idx.migrations[table] = kept
+		} else {
+			delete(idx.migrations, table)
+		}
+	}
+	delete(idx.migrationFiles, filePath)
+
+	seen := make(map[string]bool)
+	for _, migration := range migrations {
+		idx.migrations[migration.Table] = append(idx.migrations[migration.Table], migration)
+		if !seen[migration.Table] {
+			seen[migration.Table] = true
+			idx.migrationFiles[filePath] = append(idx.migrationFiles[filePath], migration.Table)
+		}
+	}
+}
+
+// Migrations returns the migration statements touching the table of a model class,
+// oldest first. Migration files are named by timestamp, so file order is history order.
+func (idx *Index) Migrations(className string) []Migration {
+	idx.mutex.RLock()
+	migrations := append([]Migration(nil), idx.migrations[idx.inflections.TableName(className)]...)
+	idx.mutex.RUnlock()
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		a, b := migrations[i], migrations[j]
+		if a.FilePath != b.FilePath {
+			return filepath.Base(a.FilePath) < filepath.Base(b.FilePath)
+		}
+		return a.Line < b.Line
+	})
+	return migrations
+}
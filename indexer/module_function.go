@@ -0,0 +1,67 @@
+package indexer
+
+import "regexp"
+
+// Details of methods callable both on a module and on the instances including it
+const (
+	DetailModuleFunction = "module_function"
+	DetailExtendSelf     = "extend self"
+)
+
+var (
+	moduleFunctionPattern = regexp.MustCompile(`^\s*module_function\b(.*)`)
+	extendSelfPattern     = regexp.MustCompile(`^\s*extend\s+self\s*$`)
+)
+
+// IsModuleFunction reports whether a method is also callable on its module
+func IsModuleFunction(entry SymbolEntry) bool {
+	return entry.Detail == DetailModuleFunction || entry.Detail == DetailExtendSelf
+}
+
+// moduleFunctionCopy returns the module-level twin of an instance method made
+// callable on its module by module_function or extend self
+func moduleFunctionCopy(entry SymbolEntry, detail string) SymbolEntry {
+	entry.Type = SymbolSingletonMethod
+	entry.FullyQualifiedName = entry.Parent + "." + entry.Name
+	entry.Visibility = "public"
+	entry.Detail = detail
+	return entry
+}
+
+// markModuleFunctions flags the named instance methods already defined in a
+// module (module_function :helper). Like module_function itself, it turns the
+// instance methods private.
+func markModuleFunctions(entries []SymbolEntry, parent string, names []string) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	for i := range entries {
+		if entries[i].Type == SymbolMethod && entries[i].Parent == parent && wanted[entries[i].Name] {
+			entries[i].Visibility = "private"
+			entries[i].Detail = DetailModuleFunction
+		}
+	}
+}
+
+// moduleFunctionCopies returns the module-level copies of the methods flagged
+// by module_function and of the public instance methods of modules that extend
+// themselves, wherever in the body they are defined. Copies are made once the
+// file is parsed so they carry the method's full range.
+func moduleFunctionCopies(entries []SymbolEntry, extendedSelf map[string]bool) []SymbolEntry {
+	var copies []SymbolEntry
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Type != SymbolMethod {
+			continue
+		}
+		if entry.Detail != DetailModuleFunction && extendedSelf[entry.Parent] && entry.Visibility == "public" {
+			entry.Detail = DetailExtendSelf
+		}
+		if IsModuleFunction(*entry) {
+			copies = append(copies, moduleFunctionCopy(*entry, entry.Detail))
+		}
+	}
+	return copies
+}
@@ -0,0 +1,60 @@
+package indexer
+
+import "testing"
+
+func TestModuleFunctionMethodsAreIndexedBothWays(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		both   []string // methods callable on the module and its includers
+		only   []string // instance methods that stay as they are
+		detail string
+	}{
+		{
+			name:   "bare module_function",
+			source: "module Formatting\n  def plain\n  end\n\n  module_function\n\n  def money(amount)\n  end\n\n  def percent(ratio)\n  end\nend\n",
+			both:   []string{"money", "percent"},
+			only:   []string{"plain"},
+			detail: DetailModuleFunction,
+		},
+		{
+			name:   "module_function with names",
+			source: "module Formatting\n  def money(amount)\n  end\n\n  def plain\n  end\n\n  module_function :money\nend\n",
+			both:   []string{"money"},
+			only:   []string{"plain"},
+			detail: DetailModuleFunction,
+		},
+		{
+			name:   "extend self",
+			source: "module Formatting\n  extend self\n\n  def money(amount)\n  end\n\n  private\n\n  def plain\n  end\nend\n",
+			both:   []string{"money"},
+			only:   []string{"plain"},
+			detail: DetailExtendSelf,
+		},
+	}
+	for _, test := range tests {
+		entries := parseTestSource(t, test.source)
+		for _, name := range test.both {
+			method := findEntry(t, entries, "Formatting#"+name)
+			singleton := findEntry(t, entries, "Formatting."+name)
+			if method.Detail != test.detail || singleton.Detail != test.detail || singleton.Type != SymbolSingletonMethod {
+				t.Errorf("%s: %s is type %d (%q) and type %d (%q), want both %q", test.name, name,
+					method.Type, method.Detail, singleton.Type, singleton.Detail, test.detail)
+			}
+			if singleton.Line != method.Line || singleton.EndLine != method.EndLine || singleton.Visibility != "public" {
+				t.Errorf("%s: Formatting.%s spans %d-%d (%s), want the public twin of lines %d-%d", test.name, name,
+					singleton.Line, singleton.EndLine, singleton.Visibility, method.Line, method.EndLine)
+			}
+		}
+		for _, name := range test.only {
+			for _, entry := range entries {
+				if entry.FullyQualifiedName == "Formatting."+name {
+					t.Errorf("%s: %s is callable on the module, want it an instance method only", test.name, name)
+				}
+			}
+			if IsModuleFunction(findEntry(t, entries, "Formatting#"+name)) {
+				t.Errorf("%s: Formatting#%s is marked as a module function", test.name, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The parameter list of a def written without parentheses (def call a, b = 1)
+var bareParamsPattern = regexp.MustCompile(`^\s+([\w*&].*)$`)
+
+// parseDefParams returns the parameters of a def line as written ("a", "b = 1",
+// "*rest", "key:", "&block"), given the offset just past the method name.
+// Parameter lists continued on following lines are not read.
+func parseDefParams(line string, nameEnd int) []string {
+	rest := line[nameEnd:]
+
+	if strings.HasPrefix(rest, "(") {
+		args, ok := balancedArguments(rest, 0)
+		if !ok {
+			return nil
+		}
+		return splitTopLevel(args)
+	}
+
+	matches := bareParamsPattern.FindStringSubmatch(rest)
+	if matches == nil {
+		return nil
+	}
+	list := matches[1]
+	if i := strings.IndexAny(list, ";#"); i >= 0 {
+		list = list[:i]
+	}
+	return splitTopLevel(list)
+}
+
+// ParamKind distinguishes the kinds of parameter a Ruby method accepts
+type ParamKind int
+
+const (
+	ParamRequired        ParamKind = iota // a
+	ParamOptional                         // b = 1
+	ParamRest                             // *args
+	ParamKeyword                          // key:
+	ParamOptionalKeyword                  // key: 1
+	ParamKeywordRest                      // **opts
+	ParamBlock                            // &block
+	ParamForward                          // ...
+)
+
+// Param is a single method parameter
+type Param struct {
+	Name    string
+	Kind    ParamKind
+	Default string // default value of an optional parameter
+}
+
+// ParseParam classifies a parameter as written in a def
+func ParseParam(text string) Param {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "...":
+		return Param{Name: text, Kind: ParamForward}
+	case strings.HasPrefix(text, "**"):
+		return Param{Name: strings.TrimPrefix(text, "**"), Kind: ParamKeywordRest}
+	case strings.HasPrefix(text, "*"):
+		return Param{Name: strings.TrimPrefix(text, "*"), Kind: ParamRest}
+	case strings.HasPrefix(text, "&"):
+		return Param{Name: strings.TrimPrefix(text, "&"), Kind: ParamBlock}
+	}
+
+	// Whichever of ":" and "=" comes first tells keywords from defaults ("opts = {a: 1}")
+	colon, equals := strings.Index(text, ":"), strings.Index(text, "=")
+	if colon > 0 && (equals < 0 || colon < equals) {
+		if value := strings.TrimSpace(text[colon+1:]); value != "" {
+			return Param{Name: text[:colon], Kind: ParamOptionalKeyword, Default: value}
+		}
+		return Param{Name: text[:colon], Kind: ParamKeyword}
+	}
+	if equals > 0 {
+		return Param{Name: strings.TrimSpace(text[:equals]), Kind: ParamOptional, Default: strings.TrimSpace(text[equals+1:])}
+	}
+	return Param{Name: text, Kind: ParamRequired}
+}
+
+// Format renders the parameter the way it is written in a def
+func (p Param) Format() string {
+	switch p.Kind {
+	case ParamOptional:
+		return p.Name + " = " + p.Default
+	case ParamRest:
+		return "*" + p.Name
+	case ParamKeyword:
+		return p.Name + ":"
+	case ParamOptionalKeyword:
+		return p.Name + ": " + p.Default
+	case ParamKeywordRest:
+		return "**" + p.Name
+	case ParamBlock:
+		return "&" + p.Name
+	}
+	return p.Name
+}
+
+// Parameters returns the classified parameters of a method entry
+func Parameters(entry SymbolEntry) []Param {
+	params := make([]Param, 0, len(entry.Params))
+	for _, text := range entry.Params {
+		params = append(params, ParseParam(text))
+	}
+	return params
+}
+
+// FormatSignature renders a method as name(a, b = 1, *c, d:, **e, &f)
+func FormatSignature(entry SymbolEntry) string {
+	params := Parameters(entry)
+	formatted := make([]string, 0, len(params))
+	for _, param := range params {
+		formatted = append(formatted, param.Format())
+	}
+	return entry.Name + "(" + strings.Join(formatted, ", ") + ")"
+}
+
+// Arity returns the method's arity as Ruby's Method#arity reports it: the number
+// of required arguments, or -(required + 1) when optional arguments are accepted.
+// Keywords count as one more argument, required when any keyword is.
+func Arity(entry SymbolEntry) int {
+	required := 0
+	optional := false
+	keywords, requiredKeyword := false, false
+
+	for _, param := range Parameters(entry) {
+		switch param.Kind {
+		case ParamRequired:
+			required++
+		case ParamOptional, ParamRest, ParamForward:
+			optional = true
+		case ParamKeyword:
+			keywords, requiredKeyword = true, true
+		case ParamOptionalKeyword, ParamKeywordRest:
+			keywords = keywords || param.Name != "nil"
+		}
+	}
+
+	if requiredKeyword {
+		required++
+	} else if keywords {
+		optional = true
+	}
+	if optional {
+		return -(required + 1)
+	}
+	return required
+}
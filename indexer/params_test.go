@@ -0,0 +1,123 @@
+package indexer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		text string
+		want Param
+	}{
+		{"a", Param{Name: "a", Kind: ParamRequired}},
+		{"b = 1", Param{Name: "b", Kind: ParamOptional, Default: "1"}},
+		{"opts = {a: 1}", Param{Name: "opts", Kind: ParamOptional, Default: "{a: 1}"}},
+		{"*c", Param{Name: "c", Kind: ParamRest}},
+		{"d:", Param{Name: "d", Kind: ParamKeyword}},
+		{"d: 2", Param{Name: "d", Kind: ParamOptionalKeyword, Default: "2"}},
+		{"**e", Param{Name: "e", Kind: ParamKeywordRest}},
+		{"&f", Param{Name: "f", Kind: ParamBlock}},
+		{"...", Param{Name: "...", Kind: ParamForward}},
+	}
+	for _, test := range tests {
+		if got := ParseParam(test.text); got != test.want {
+			t.Errorf("ParseParam(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFormatSignatureAndArity(t *testing.T) {
+	entries := parseTestSource(t, `class Report
+  def m(a, b = 1, *c, d:, **e, &f)
+  end
+
+  def none
+  end
+
+  def pair(a, b)
+  end
+
+  def optional(a, b = nil)
+  end
+
+  def options(a, key: 1)
+  end
+
+  def forward(...)
+  end
+end
+`)
+
+	tests := []struct {
+		fqn       string
+		signature string
+		arity     int
+	}{
+		{"Report#m", "m(a, b = 1, *c, d:, **e, &f)", -3},
+		{"Report#none", "none()", 0},
+		{"Report#pair", "pair(a, b)", 2},
+		{"Report#optional", "optional(a, b = nil)", -2},
+		{"Report#options", "options(a, key: 1)", -2},
+		{"Report#forward", "forward(...)", -1},
+	}
+	for _, test := range tests {
+		entry := findEntry(t, entries, test.fqn)
+		if signature := FormatSignature(entry); signature != test.signature {
+			t.Errorf("FormatSignature(%s) = %q, want %q", test.fqn, signature, test.signature)
+		}
+		if arity := Arity(entry); arity != test.arity {
+			t.Errorf("Arity(%s) = %d, want %d", test.fqn, arity, test.arity)
+		}
+	}
+
+	kinds := make([]ParamKind, 0, 6)
+	for _, param := range Parameters(findEntry(t, entries, "Report#m")) {
+		kinds = append(kinds, param.Kind)
+	}
+	want := []ParamKind{ParamRequired, ParamOptional, ParamRest, ParamKeyword, ParamKeywordRest, ParamBlock}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("parameter kinds of m = %v, want %v", kinds, want)
+	}
+}
+
+func TestYardTagsGiveATypeSignature(t *testing.T) {
+	entries := parseTestSource(t, `class Order
+  # Charges the order.
+  #
+  # @param amount [Integer] in cents
+  # @param options [Hash{Symbol => String}, nil]
+  # @return [Receipt, nil] nil when declined
+  def charge(amount, options = nil)
+  end
+
+  # @return [Array<String, Integer>]
+  def lines
+  end
+
+  # Plain prose, no types
+  def cancel
+  end
+end
+`)
+	tests := []struct {
+		fqn  string
+		want *TypeSignature
+	}{
+		{"Order#charge", &TypeSignature{Source: "yard", ReturnType: "Receipt | nil", Params: []TypedParam{
+			{Name: "amount", Type: "Integer"},
+			{Name: "options", Type: "Hash{Symbol => String} | nil"},
+		}}},
+		{"Order#lines", &TypeSignature{Source: "yard", ReturnType: "Array<String, Integer>"}},
+		{"Order#cancel", nil},
+	}
+	for _, test := range tests {
+		types := findEntry(t, entries, test.fqn).Types
+		switch {
+		case test.want == nil && len(types) != 0:
+			t.Errorf("%s: Types = %+v, want none", test.fqn, types)
+		case test.want != nil && (len(types) != 1 || !reflect.DeepEqual(types[0], *test.want)):
+			t.Errorf("%s: Types = %+v, want %+v", test.fqn, types, *test.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ConstantReference is a single mention of a constant in source. A path such as
+// Admin::Order yields one reference per segment, so renaming Order only touches
+// the Order part.
+type ConstantReference struct {
+	Name         string // the referenced segment (Order)
+	Path         string // path as written up to and including Name (Admin::Order, ::Order)
+	Scope        string // lexical nesting at the mention, used for resolution
+	FilePath     string
+	Line         int // 1-based, like SymbolEntry
+	Character    int // UTF-16 column of Name, as LSP counts
+	EndCharacter int
+}
+
+// Constant paths: Foo, Foo::Bar, ::Foo
+var constantPathPattern = regexp.MustCompile(`(?:::)?[A-Z]\w*(?:::[A-Z]\w*)*`)
+
+// scanConstantReferences returns every constant mentioned on a line of code,
+// ignoring string literals and comments
+func scanConstantReferences(line string, scope string, filePath string, lineNumber int) []ConstantReference {
+	code := maskStringsAndComments(line)
+
+	var refs []ConstantReference
+	for _, loc := range constantPathPattern.FindAllStringIndex(code, -1) {
+		start, end := loc[0], loc[1]
+		absolute := strings.HasPrefix(code[start:end], "::")
+
+		if start > 0 {
+			prev := code[start-1]
+			// Part of a longer identifier, a method call (foo.Bar), a variable or a symbol (:Foo)
+			if isIdentByte(prev) || prev == '.' || prev == '@' || prev == '$' || (prev == ':' && !absolute) {
+				continue
+			}
+		}
+		// Keyword-style hash key (Foo: 1)
+		if end < len(code) && code[end] == ':' && (end+1 >= len(code) || code[end+1] != ':') {
+			continue
+		}
+
+		path := ""
+		if absolute {
+			path = "::"
+		}
+		offset := start
+		if absolute {
+			offset += 2
+		}
+		for i, segment := range strings.Split(strings.TrimPrefix(code[start:end], "::"), "::") {
+			if i > 0 {
+				path += "::"
+			}
+			path += segment
+
+			refs = append(refs, ConstantReference{
+				Name:         segment,
+				Path:         path,
+				Scope:        scope,
+				FilePath:     filePath,
+				Line:         lineNumber,
+				Character:    UTF16Column(line, offset),
+				EndCharacter: UTF16Column(line, offset+len(segment)),
+			})
+			offset += len(segment) + 2
+		}
+	}
+
+	return refs
+}
+
+// maskStringsAndComments blanks out string literal contents and trailing comments,
+// keeping byte offsets intact
+func maskStringsAndComments(line string) string {
+	masked := []byte(line)
+	var quote byte
+	for i := 0; i < len(masked); i++ {
+		c := masked[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(masked) {
+				masked[i] = ' '
+				i++
+				masked[i] = ' '
+				continue
+			}
+			if c == quote {
+				quote = 0
+				continue
+			}
+			masked[i] = ' '
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '#':
+			for j := i; j < len(masked); j++ {
+				masked[j] = ' '
+			}
+			return string(masked)
+		}
+	}
+	return string(masked)
+}
+
+// UTF16Column converts a byte offset into a line to the UTF-16 column LSP clients expect
+func UTF16Column(line string, byteOffset int) int {
+	column := 0
+	for _, r := range line[:byteOffset] {
+		if r >= 0x10000 {
+			column += 2
+		} else {
+			column++
+		}
+	}
+	return column
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= utf8.RuneSelf
+}
+
+// ResolveConstantPath resolves a constant path as written within a lexical scope
+// to the fully qualified name of an indexed class, module or constant.
+// Like Ruby, the innermost enclosing namespace wins. Paths that cannot be resolved
+// are returned unchanged.
+func (idx *Index) ResolveConstantPath(path string, scope string) string {
+	if strings.HasPrefix(path, "::") {
+		return strings.TrimPrefix(path, "::")
+	}
+
+	for namespace := scope; namespace != ""; namespace = parentNamespace(namespace) {
+		if candidate := namespace + "::" + path; idx.isConstantDefined(candidate) {
+			return candidate
+		}
+	}
+	if idx.isConstantDefined(path) {
+		return path
+	}
+
+	// A qualified path whose head is not indexed (a gem's namespace, a vendored
+	// prefix) still refers to its longest suffix defined at the top level
+	// (Vendor::Billing::Gateway -> Billing::Gateway, Admin::Order -> Order)
+	for suffix := path; strings.Contains(suffix, "::"); {
+		suffix = suffix[strings.Index(suffix, "::")+2:]
+		if idx.isConstantDefined(suffix) {
+			return suffix
+		}
+	}
+
+	return path
+}
+
+// LookupInScope finds the definitions a constant path refers to when written
+// within the given lexical scope, e.g. User inside module Admin finds Admin::User
+// rather than a top-level User. It returns nil when nothing resolves.
+func (idx *Index) LookupInScope(path string, scope string) []SymbolEntry {
+	fqn := idx.ResolveConstantPath(path, scope)
+
+	var results []SymbolEntry
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.FullyQualifiedName != fqn {
+			continue
+		}
+		switch entry.Type {
+		case SymbolClass, SymbolModule, SymbolConstant:
+			results = append(results, entry)
+		}
+	}
+	return results
+}
+
+// Names that may stand for a model class (user, line_items, Admin::User), as
+// opposed to predicates, bang and setter methods or variables with a sigil
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z_]\w*(?:::[A-Z]\w*)*$`)
+
+// LookupScoped resolves a name written within the given namespaces, outermost
+// first (["Admin", "Reports"]), trying in turn:
+//   - a constant path through the enclosing namespaces, innermost first, then the top level
+//   - every definition of the name, whatever its namespace
+//   - the class the name stands for by Rails naming, as written or singularized
+//     (user -> User, comments -> Comment, people -> Person)
+//   - the files Rails conventions place that class in
+//
+// The first step finding anything decides the result.
+func (idx *Index) LookupScoped(name string, nesting []string) []SymbolEntry {
+	if strings.HasPrefix(name, "::") || (len(name) > 0 && name[0] >= 'A' && name[0] <= 'Z') {
+		if entries := idx.LookupInScope(name, strings.Join(nesting, "::")); len(entries) > 0 {
+			return entries
+		}
+		name = strings.TrimPrefix(name, "::")
+	}
+	if entries := idx.Lookup(name); len(entries) > 0 {
+		return entries
+	}
+	if !modelNamePattern.MatchString(name) {
+		return nil
+	}
+
+	model := name
+	if !strings.Contains(name, "::") {
+		model = snakeToCamel(name)
+		if singular := idx.inflections.ModelName(name); singular != model {
+			if entries := idx.Lookup(model); len(entries) > 0 {
+				return entries
+			}
+			model = singular
+		}
+	}
+	if model != name {
+		if entries := idx.Lookup(model); len(entries) > 0 {
+			return entries
+		}
+	}
+	return idx.LookupByConvention(model)
+}
+
+// isConstantDefined reports whether a class, module or constant is indexed under fqn
+func (idx *Index) isConstantDefined(fqn string) bool {
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.FullyQualifiedName != fqn {
+			continue
+		}
+		switch entry.Type {
+		case SymbolClass, SymbolModule, SymbolConstant:
+			return true
+		}
+	}
+	return false
+}
+
+// ConstantReferences returns every mention of the constant with the given
+// fully qualified name, including the sites defining it
+func (idx *Index) ConstantReferences(fqn string) []ConstantReference {
+	idx.mutex.RLock()
+	candidates := append([]ConstantReference(nil), idx.references[classNameOnly(fqn)]...)
+	idx.mutex.RUnlock()
+
+	resolved := make(map[string]string) // path + scope -> fqn
+	var results []ConstantReference
+	for _, ref := range candidates {
+		key := ref.Path + "\x00" + ref.Scope
+		target, ok := resolved[key]
+		if !ok {
+			target = idx.ResolveConstantPath(ref.Path, ref.Scope)
+			resolved[key] = target
+		}
+		if target == fqn {
+			results = append(results, ref)
+		}
+	}
+
+	return results
+}
+
+// addReferences records the constant references of a file. Callers hold the write lock.
+func (idx *Index) addReferences(filePath string, refs []ConstantReference) {
+	if len(refs) == 0 {
+		return
+	}
+	idx.fileRefs[filePath] = refs
+	for _, ref := range refs {
+		idx.references[ref.Name] = append(idx.references[ref.Name], ref)
+	}
+}
+
+// removeReferences forgets the constant references of a file. Callers hold the write lock.
+func (idx *Index) removeReferences(filePath string) {
+	oldRefs, ok := idx.fileRefs[filePath]
+	if !ok {
+		return
+	}
+
+	purged := make(map[string]bool)
+	for _, old := range oldRefs {
+		if purged[old.Name] {
+			continue
+		}
+		purged[old.Name] = true
+
+		var kept []ConstantReference
+		for _, ref := range idx.references[old.Name] {
+			if ref.FilePath != filePath {
+				kept = append(kept, ref)
+			}
+		}
+		if len(kept) > 0 {
+			idx.references[old.Name] = kept
+		} else {
+			delete(idx.references, old.Name)
+		}
+	}
+	delete(idx.fileRefs, filePath)
+}
+
+// parentNamespace drops the last segment of a namespace (A::B::C -> A::B)
+func parentNamespace(namespace string) string {
+	if i := strings.LastIndex(namespace, "::"); i >= 0 {
+		return namespace[:i]
+	}
+	return ""
+}
@@ -0,0 +1,192 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestReferencesFollowFileUpdates(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"app/models/invoice.rb": "class Invoice\n  def total\n  end\nend\n",
+		"app/jobs/billing_job.rb": `class BillingJob
+  def perform
+    Invoice.new.total
+    Invoice.overdue.each(&:remind)
+  end
+end
+`,
+	}, Options{})
+	job := filepath.Join(root, "app/jobs/billing_job.rb")
+
+	lines := func() []int {
+		var lines []int
+		for _, ref := range idx.ConstantReferences("Invoice") {
+			if ref.FilePath == job {
+				lines = append(lines, ref.Line)
+			}
+		}
+		return lines
+	}
+	if got := lines(); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Fatalf("Invoice referenced from the job on lines %v, want [3 4]", got)
+	}
+	if calls := idx.MethodReferences("total", nil); len(calls) != 2 {
+		t.Fatalf("MethodReferences(total) = %+v, want the def and the call", calls)
+	}
+
+	// The edit removes the call site on line 3
+	edited := "class BillingJob\n  def perform\n    Invoice.overdue.each(&:remind)\n  end\nend\n"
+	if err := os.WriteFile(job, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	idx.UpdateFile(job)
+
+	if got := lines(); len(got) != 1 || got[0] != 3 {
+		t.Errorf("after the edit, Invoice referenced from the job on lines %v, want [3]", got)
+	}
+	if calls := idx.MethodReferences("total", nil); len(calls) != 1 || !calls[0].Definition {
+		t.Errorf("after the edit, MethodReferences(total) = %+v, want the def alone", calls)
+	}
+
+	idx.RemoveFile(job)
+	if got := lines(); len(got) != 0 {
+		t.Errorf("after removing the job, Invoice referenced from it on lines %v", got)
+	}
+}
+
+// Deeply namespaced constants resolve by their full path, and through their
+// longest indexed suffix when written behind an unindexed prefix
+func TestResolveQualifiedConstantPaths(t *testing.T) {
+	idx, entries := indexTestSources(map[string]string{
+		"app/models/billing.rb": `module Billing
+  module Gateways
+    class Stripe
+      API_VERSION = "2024-06-20"
+    end
+  end
+end
+`,
+		"app/models/order.rb": "class Order\nend\n",
+	})
+	checkEntries(t, entries, []entrySpec{
+		{"Billing", "", "public", 7},
+		{"Billing::Gateways", "Billing", "public", 6},
+		{"Billing::Gateways::Stripe", "Billing::Gateways", "public", 5},
+		{"Billing::Gateways::Stripe::API_VERSION", "Billing::Gateways::Stripe", "public", 0},
+	})
+
+	tests := []struct {
+		path  string
+		scope string
+		want  string
+	}{
+		{"Billing::Gateways::Stripe::API_VERSION", "Invoice", "Billing::Gateways::Stripe::API_VERSION"},
+		{"Gateways::Stripe", "Billing", "Billing::Gateways::Stripe"},
+		{"Vendor::Billing::Gateways::Stripe", "Invoice", "Billing::Gateways::Stripe"},
+		{"Admin::Order", "", "Order"},
+		{"ActiveRecord::Base", "", "ActiveRecord::Base"},
+	}
+	for _, test := range tests {
+		if got := idx.ResolveConstantPath(test.path, test.scope); got != test.want {
+			t.Errorf("ResolveConstantPath(%s, %q) = %q, want %q", test.path, test.scope, got, test.want)
+		}
+	}
+}
+
+func TestMaskStringsAndComments(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`puts "class #{name}"`, `puts "             "`},
+		{`log 'def not a method'`, `log '                '`},
+		{`@cache = {} # @stale = nil`, `@cache = {}               `},
+		{`say "a \" quote" # gone`, `say "          "       `},
+		{"run `ls end`", "run `      `"},
+	}
+	for _, test := range tests {
+		got := maskStringsAndComments(test.line)
+		if got != test.want {
+			t.Errorf("maskStringsAndComments(%q) = %q, want %q", test.line, got, test.want)
+		}
+		if len(got) != len(test.line) {
+			t.Errorf("maskStringsAndComments(%q) changed the length to %d", test.line, len(got))
+		}
+	}
+}
+
+func TestStringsAndCommentsDoNotDefineSymbols(t *testing.T) {
+	entries := parseTestSource(t, `class Report
+  def title # the end
+    @cache = {} # @stale = nil
+    log "@secret = 1"
+    puts "class #{name}"
+  end
+
+  private # helpers below
+
+  def helper
+  end
+end
+`)
+	for _, entry := range entries {
+		switch entry.Name {
+		case "@stale", "@secret":
+			t.Errorf("indexed %s from inside a string or comment", entry.FullyQualifiedName)
+		}
+	}
+	findEntry(t, entries, "Report#@cache")
+	checkEntries(t, entries, []entrySpec{
+		// "end" in a comment no longer makes the def a one-liner without a body
+		{"Report", "", "public", 12},
+		{"Report#title", "Report", "public", 6},
+		// a commented visibility modifier still applies
+		{"Report#helper", "Report", "private", 11},
+	})
+}
+
+func TestLookupScopedWalksTheNestingInnermostFirst(t *testing.T) {
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	idx.IndexSources(map[string]string{
+		"/workspace/app/models/report.rb":        "class Report\nend\n",
+		"/workspace/app/models/admin/report.rb":  "module Admin\n  class Report\n  end\nend\n",
+		"/workspace/app/models/admin/reports.rb": "module Admin\n  module Reports\n    class Report\n    end\n  end\nend\n",
+		"/workspace/app/models/comment.rb":       "class Comment\n  def total\n  end\nend\n",
+		"/workspace/app/models/person.rb":        "class Person\nend\n",
+		"/workspace/app/models/admin/invoice.rb": "module Admin\n  class Invoice\n    def total\n    end\n  end\nend\n",
+	})
+
+	tests := []struct {
+		name    string
+		nesting []string
+		want    []string
+	}{
+		{"Report", []string{"Admin", "Reports"}, []string{"Admin::Reports::Report"}},
+		{"Report", []string{"Admin"}, []string{"Admin::Report"}},
+		{"Report", []string{"Billing"}, []string{"Report"}},
+		{"Report", nil, []string{"Report"}},
+		{"::Report", []string{"Admin", "Reports"}, []string{"Report"}},
+		{"Reports::Report", []string{"Admin"}, []string{"Admin::Reports::Report"}},
+		// Names that are not constants match wherever they are defined
+		{"total", []string{"Admin"}, []string{"Admin::Invoice#total", "Comment#total"}},
+		// Rails naming, singularized
+		{"comments", nil, []string{"Comment"}},
+		{"people", nil, []string{"Person"}},
+		{"missing", nil, nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, entry := range idx.LookupScoped(test.name, test.nesting) {
+			got = append(got, entry.FullyQualifiedName)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("LookupScoped(%q, %v) = %v, want %v", test.name, test.nesting, got, test.want)
+		}
+	}
+}
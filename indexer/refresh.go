@@ -0,0 +1,121 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Refresh brings the index up to date with the workspace without a full rebuild:
+// files whose modification time changed since they were indexed, and new files,
+// are re-parsed, and files that disappeared are removed. Outside ModeEager only
+// the files the index already covers are considered. It returns how many files
+// were re-parsed and how many removed; once the context is cancelled it stops
+// before the next file and removes nothing.
+func (idx *Index) Refresh(ctx context.Context) (int, int) {
+	present := make(map[string]bool)
+	var changed []string
+	idx.clearIgnoreRules()
+
+	for _, root := range idx.Roots() {
+		idx.walk(root, func(path string, info os.FileInfo, err error) error {
+			if ctx.Err() != nil {
+				return filepath.SkipAll
+			}
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if path != root && (idx.isExcludedDir(path) || idx.isWorkspaceRoot(path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !idx.isIndexable(root, path) || !idx.Covers(path) {
+				return nil
+			}
+
+			present[path] = true
+			idx.mutex.RLock()
+			indexed, known := idx.modTimes[path]
+			idx.mutex.RUnlock()
+			if !known || !indexed.Equal(info.ModTime()) {
+				changed = append(changed, path)
+			}
+			return nil
+		})
+	}
+
+	updated := 0
+	for _, path := range changed {
+		if ctx.Err() != nil {
+			// A partial walk cannot tell which files vanished
+			idx.logger.Printf("Refresh cancelled: %d files re-parsed", updated)
+			return updated, 0
+		}
+		idx.UpdateFile(path)
+		updated++
+	}
+
+	var vanished []string
+	idx.mutex.RLock()
+	for path := range idx.modTimes {
+		if !present[path] {
+			vanished = append(vanished, path)
+		}
+	}
+	idx.mutex.RUnlock()
+
+	for _, path := range vanished {
+		idx.RemoveFile(path)
+	}
+
+	idx.logger.Printf("Refreshed index: %d files re-parsed, %d removed", len(changed), len(vanished))
+	return len(changed), len(vanished)
+}
+
+// RemoveFile drops everything indexed from a deleted file. A deleted directory
+// drops every file under it, as clients report a single deletion for a folder.
+func (idx *Index) RemoveFile(filePath string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	_, indexed := idx.fileSymbols[filePath]
+	_, walked := idx.modTimes[filePath]
+	idx.purgeFile(filePath)
+	if indexed || walked {
+		return
+	}
+	for path := range idx.fileSymbols {
+		if isWithin(path, filePath) {
+			idx.purgeFile(path)
+		}
+	}
+	for path := range idx.modTimes {
+		if isWithin(path, filePath) {
+			idx.purgeFile(path)
+		}
+	}
+}
+
+// purgeFile forgets a file: its symbols, references, signatures, migrations and
+// bookkeeping. Callers hold the write lock.
+func (idx *Index) purgeFile(filePath string) {
+	idx.removeFileEntries(filePath)
+	idx.indexRBSFile(filePath, nil)
+	idx.indexMigrationFile(filePath, nil)
+	delete(idx.skippedFiles, filePath)
+	delete(idx.readErrors, filePath)
+	delete(idx.modTimes, filePath)
+}
+
+// isIndexable reports whether the walk of a workspace folder indexes a file,
+// as Ruby source or as an RBS signature file
+func (idx *Index) isIndexable(root string, path string) bool {
+	if idx.options.TypeSignatures {
+		if rel, err := filepath.Rel(root, path); err == nil && isRBSSignatureFile(rel) {
+			return true
+		}
+	}
+	return idx.ShouldIndex(path)
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRefreshReparsesOnlyChangedFiles(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"app/models/order.rb":   "class Order\nend\n",
+		"app/models/invoice.rb": "class Invoice\nend\n",
+		"app/models/refund.rb":  "class Refund\nend\n",
+	}, Options{})
+
+	if updated, removed := idx.Refresh(context.Background()); updated != 0 || removed != 0 {
+		t.Fatalf("Refresh of an unchanged workspace = %d re-parsed, %d removed; want none", updated, removed)
+	}
+
+	order := filepath.Join(root, "app/models/order.rb")
+	if err := os.WriteFile(order, []byte("class Order\n  def total\n  end\nend\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(order, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if updated, removed := idx.Refresh(context.Background()); updated != 1 || removed != 0 {
+		t.Errorf("Refresh after touching order.rb = %d re-parsed, %d removed; want 1 and 0", updated, removed)
+	}
+	if len(idx.Lookup("Order#total")) != 1 {
+		t.Error("Order#total is not indexed after Refresh re-parsed order.rb")
+	}
+
+	if err := os.Remove(filepath.Join(root, "app/models/refund.rb")); err != nil {
+		t.Fatal(err)
+	}
+	if updated, removed := idx.Refresh(context.Background()); updated != 0 || removed != 1 {
+		t.Errorf("Refresh after deleting refund.rb = %d re-parsed, %d removed; want 0 and 1", updated, removed)
+	}
+	if len(idx.Lookup("Refund")) != 0 || len(idx.Lookup("Invoice")) != 1 {
+		t.Error("Refresh did not drop only the deleted file's symbols")
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"app/models/order.rb":       "class Order\n  def total\n  end\nend\n",
+		"app/models/invoice.rb":     "class Invoice\n  def total\n    Order.new\n  end\nend\n",
+		"app/services/billing/a.rb": "module Billing\n  class Charge\n  end\nend\n",
+		"app/services/billing/b.rb": "module Billing\n  class Refund\n  end\nend\n",
+		"app/services/checkout.rb":  "class Checkout\nend\n",
+	}, Options{})
+	before := idx.Stats()
+
+	idx.RemoveFile(filepath.Join(root, "app/models/invoice.rb"))
+
+	for _, name := range []string{"Invoice", "Invoice#total"} {
+		if entries := idx.Lookup(name); len(entries) != 0 {
+			t.Errorf("Lookup(%s) = %+v after removing invoice.rb, want nothing", name, entries)
+		}
+	}
+	// Entries of the same name from other files are kept
+	totals := idx.Lookup("total")
+	if len(totals) != 1 || totals[0].FullyQualifiedName != "Order#total" {
+		t.Errorf("Lookup(total) = %+v, want Order#total only", totals)
+	}
+	if refs := idx.ConstantReferences("Order"); len(refs) != 1 {
+		t.Errorf("references to Order = %+v, want only its definition", refs)
+	}
+	if stats := idx.Stats(); stats.Files != before.Files-1 || stats.Symbols != before.Symbols-2 {
+		t.Errorf("Stats after removing invoice.rb = %d files, %d symbols; want %d and %d",
+			stats.Files, stats.Symbols, before.Files-1, before.Symbols-2)
+	}
+
+	// A deleted directory drops every file under it, and nothing beside it
+	idx.RemoveFile(filepath.Join(root, "app/services/billing"))
+	for _, name := range []string{"Billing", "Billing::Charge", "Billing::Refund"} {
+		if entries := idx.Lookup(name); len(entries) != 0 {
+			t.Errorf("Lookup(%s) = %+v after removing app/services/billing, want nothing", name, entries)
+		}
+	}
+	if len(idx.Lookup("Checkout")) != 1 {
+		t.Error("Checkout removed along with app/services/billing")
+	}
+}
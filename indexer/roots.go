@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// Roots returns the workspace folders covered by the index
+func (idx *Index) Roots() []string {
+	idx.rootsMutex.RLock()
+	defer idx.rootsMutex.RUnlock()
+	return append([]string(nil), idx.workspaceRoots...)
+}
+
+// RootOf returns the workspace folder containing a path, the innermost one when
+// folders are nested. Paths outside every folder belong to the first.
+func (idx *Index) RootOf(path string) string {
+	roots := idx.Roots()
+
+	best := ""
+	for _, root := range roots {
+		if isWithin(path, root) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" && len(roots) > 0 {
+		return roots[0]
+	}
+	return best
+}
+
+// isWorkspaceRoot reports whether a directory is one of the workspace folders
+func (idx *Index) isWorkspaceRoot(path string) bool {
+	for _, root := range idx.Roots() {
+		if filepath.Clean(root) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRoot indexes a workspace folder added during the session. A folder nested
+// in one already indexed only needs to be recorded, and folders nested in the
+// new one are skipped by its walk since they are indexed already. Outside
+// ModeEager the folder is recorded and its files indexed on demand. The walk
+// stops early when the context is cancelled.
+func (idx *Index) AddRoot(ctx context.Context, root string) {
+	covered := false
+	idx.rootsMutex.Lock()
+	for _, existing := range idx.workspaceRoots {
+		if existing == root {
+			idx.rootsMutex.Unlock()
+			return
+		}
+		covered = covered || isWithin(root, existing)
+	}
+	idx.workspaceRoots = append(idx.workspaceRoots, root)
+	idx.rootsMutex.Unlock()
+
+	if covered {
+		return
+	}
+	if !idx.eager() {
+		idx.loadGemfileLock(root)
+		return
+	}
+
+	files, symbols := idx.indexRoot(ctx, root)
+	idx.logger.Printf("Indexed workspace folder %s: %d files, %d symbols", root, files, symbols)
+}
+
+// RemoveRoot drops a workspace folder and every file no remaining folder covers
+func (idx *Index) RemoveRoot(root string) {
+	idx.rootsMutex.Lock()
+	kept := idx.workspaceRoots[:0]
+	for _, existing := range idx.workspaceRoots {
+		if existing != root {
+			kept = append(kept, existing)
+		}
+	}
+	idx.workspaceRoots = kept
+	idx.rootsMutex.Unlock()
+
+	removed := idx.removeFilesUnder(root)
+	idx.logger.Printf("Removed workspace folder %s: %d files dropped", root, removed)
+}
+
+// removeFilesUnder drops the symbols, references and signatures of files under a
+// directory that no remaining workspace folder covers, returning how many were
+// dropped. Gem versions only the directory's Gemfile.lock locked are forgotten.
+func (idx *Index) removeFilesUnder(dir string) int {
+	idx.loadGemfileLocks()
+	roots := idx.Roots()
+	orphaned := func(path string) bool {
+		if !isWithin(path, dir) {
+			return false
+		}
+		for _, root := range roots {
+			if isWithin(path, root) {
+				return false
+			}
+		}
+		return true
+	}
+
+	idx.mutex.RLock()
+	files := make(map[string]bool)
+	for path := range idx.fileSymbols {
+		files[path] = orphaned(path)
+	}
+	for path := range idx.fileRefs {
+		files[path] = orphaned(path)
+	}
+	var signatureFiles []string
+	for path := range idx.rbsFiles {
+		if orphaned(path) {
+			signatureFiles = append(signatureFiles, path)
+		}
+	}
+	var migrationFiles []string
+	for path := range idx.migrationFiles {
+		if orphaned(path) {
+			migrationFiles = append(migrationFiles, path)
+		}
+	}
+	idx.mutex.RUnlock()
+
+	removed := 0
+	for path, drop := range files {
+		if drop {
+			idx.replaceFileEntries(path, nil, nil)
+			removed++
+		}
+	}
+
+	idx.mutex.Lock()
+	for _, path := range signatureFiles {
+		idx.indexRBSFile(path, nil)
+	}
+	for _, path := range migrationFiles {
+		idx.indexMigrationFile(path, nil)
+	}
+	for path := range idx.skippedFiles {
+		if orphaned(path) {
+			delete(idx.skippedFiles, path)
+		}
+	}
+	idx.updateLimitReached()
+	for path := range idx.modTimes {
+		if orphaned(path) {
+			delete(idx.modTimes, path)
+		}
+	}
+	for path := range idx.readErrors {
+		if orphaned(path) {
+			delete(idx.readErrors, path)
+		}
+	}
+	for dir := range idx.indexedDirs {
+		if orphaned(dir) {
+			delete(idx.indexedDirs, dir)
+		}
+	}
+	idx.mutex.Unlock()
+
+	return removed
+}
+
+// isWithin reports whether path is dir or lies beneath it
+func isWithin(path string, dir string) bool {
+	dir = strings.TrimSuffix(dir, string(filepath.Separator))
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
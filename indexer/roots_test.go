@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"testing"
+)
+
+func TestAddThenRemoveRoot(t *testing.T) {
+	app := t.TempDir()
+	writeTestFiles(t, app, map[string]string{
+		"app/models/user.rb": "class User\n  def name\n  end\nend\n",
+	})
+	engine := t.TempDir()
+	engineFiles := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		engineFiles[fmt.Sprintf("lib/engine/part_%d.rb", i)] = fmt.Sprintf("class Part%d\n  def a\n  end\n\n  def b\n  end\nend\n", i)
+	}
+	writeTestFiles(t, engine, engineFiles)
+
+	idx := NewWithOptions(app, log.New(io.Discard, "", 0), Options{MaxSymbols: 8})
+	idx.BuildIndex(context.Background())
+	before := idx.Stats()
+	if before.Files != 1 || before.Symbols != 2 || before.SkippedFiles != 0 || before.LimitReached {
+		t.Fatalf("Stats() of the app = %+v, want its one file and two symbols", before)
+	}
+
+	// The engine's 15 symbols do not fit under the limit: the walk stops at the
+	// first file over it
+	idx.AddRoot(context.Background(), engine)
+	added := idx.Stats()
+	if added.Files != 3 || added.Symbols != 8 || added.SkippedFiles != 1 || !added.LimitReached {
+		t.Errorf("Stats() with the engine = %+v, want two of its files indexed and the next skipped", added)
+	}
+
+	idx.RemoveRoot(engine)
+	if after := idx.Stats(); after.Files != before.Files || after.Symbols != before.Symbols || after.SkippedFiles != 0 || after.LimitReached {
+		t.Errorf("Stats() after removing the engine = %+v, want %+v", after, before)
+	}
+	if roots := idx.Roots(); len(roots) != 1 || roots[0] != app {
+		t.Errorf("Roots() = %v, want the app alone", roots)
+	}
+}
+
+func TestRemoveRootForgetsItsGemVersions(t *testing.T) {
+	app := t.TempDir()
+	writeTestFiles(t, app, map[string]string{
+		"Gemfile.lock": "GEM\n  specs:\n    rails (7.1.2)\n    puma (6.4.0)\n",
+	})
+	engine := t.TempDir()
+	writeTestFiles(t, engine, map[string]string{
+		"Gemfile.lock": "GEM\n  specs:\n    rails (7.1.2)\n    sidekiq (7.2.0)\n",
+	})
+
+	idx := NewWithOptions(app, log.New(io.Discard, "", 0), Options{})
+	idx.BuildIndex(context.Background())
+	idx.AddRoot(context.Background(), engine)
+	if version := idx.GemVersion("sidekiq"); version != "7.2.0" {
+		t.Fatalf("GemVersion(sidekiq) with the engine = %q, want 7.2.0", version)
+	}
+
+	idx.RemoveRoot(engine)
+	for gem, want := range map[string]string{"sidekiq": "", "rails": "7.1.2", "puma": "6.4.0"} {
+		if version := idx.GemVersion(gem); version != want {
+			t.Errorf("GemVersion(%s) after removing the engine = %q, want %q", gem, version, want)
+		}
+	}
+}
+
+func TestRemoveRootForgetsItsIndexErrors(t *testing.T) {
+	app := t.TempDir()
+	writeTestFiles(t, app, map[string]string{"app/models/user.rb": "class User\nend\n"})
+	engine := t.TempDir()
+	writeTestFiles(t, engine, map[string]string{"lib/broken.rb": malformedSource})
+
+	idx := NewWithOptions(app, log.New(io.Discard, "", 0), Options{})
+	idx.BuildIndex(context.Background())
+	idx.AddRoot(context.Background(), engine)
+	if errors := idx.Stats().Errors; len(errors) != 1 {
+		t.Fatalf("Stats().Errors with the engine = %+v, want its malformed file", errors)
+	}
+
+	idx.RemoveRoot(engine)
+	if errors := idx.Stats().Errors; len(errors) != 0 {
+		t.Errorf("Stats().Errors after removing the engine = %+v, want none", errors)
+	}
+}
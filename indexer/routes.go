@@ -0,0 +1,206 @@
+package indexer
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Rails routing DSL
+var (
+	routeResourcesPattern = regexp.MustCompile(`^\s*(resources|resource)\s+(.*)$`)
+	routeVerbPattern      = regexp.MustCompile(`^\s*(get|post|put|patch|delete|match)\s*\(?\s*(?:["']([^"']*)["']|:(\w+))`)
+	routeRootPattern      = regexp.MustCompile(`^\s*root\b`)
+	routeNamespacePattern = regexp.MustCompile(`^\s*namespace\s*\(?\s*:(\w+)`)
+	routeScopePattern     = regexp.MustCompile(`^\s*scope\b`)
+	routeNestingPattern   = regexp.MustCompile(`^\s*(member|collection)\b`)
+	routeAsPattern        = regexp.MustCompile(`(?:\bas:|:as\s*=>)\s*[:"']?(\w+)`)
+	routeOnlyPattern      = regexp.MustCompile(`(?:\bonly:|:only\s*=>)\s*(%[iIwW]\[[^\]]*\]|\[[^\]]*\]|:\w+)`)
+	routeExceptPattern    = regexp.MustCompile(`(?:\bexcept:|:except\s*=>)\s*(%[iIwW]\[[^\]]*\]|\[[^\]]*\]|:\w+)`)
+	routeBlockPattern     = regexp.MustCompile(`\bdo\s*(?:\|[^|]*\|)?\s*$`)
+	routeSymbolPattern    = regexp.MustCompile(`^:(\w+)$`)
+)
+
+// routeFrame is an open do...end block of the routes file and what it
+// contributes to the names of the routes inside it
+type routeFrame struct {
+	indent   int
+	prefix   string // prefix for nested helpers (admin_, user_)
+	singular string // helper name of the enclosing resource (admin_user)
+	plural   string // plural helper name of the enclosing resources (admin_users)
+	nesting  string // "member" or "collection" inside those blocks
+}
+
+// isRoutesFile reports whether a file is a Rails routes file (config/routes.rb)
+func isRoutesFile(filePath string) bool {
+	return filepath.Base(filePath) == "routes.rb" && filepath.Base(filepath.Dir(filePath)) == "config"
+}
+
+// parseRoutes synthesizes the path and url helpers (user_path, edit_user_url, ...)
+// of the routes defined in a routes file, each located at the line defining it
+func parseRoutes(scanner *bufio.Scanner, filePath string, inflections Inflections) []SymbolEntry {
+	var entries []SymbolEntry
+	frames := []routeFrame{{indent: -1}}
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		line := stripRouteComment(text)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := countIndent(line)
+
+		if endPattern.MatchString(line) {
+			if len(frames) > 1 && indent <= frames[len(frames)-1].indent {
+				frames = frames[:len(frames)-1]
+			}
+			continue
+		}
+
+		current := frames[len(frames)-1]
+		block := current
+		block.indent = indent
+		block.nesting = ""
+
+		add := func(name string) {
+			for _, suffix := range []string{"_path", "_url"} {
+				entries = append(entries, SymbolEntry{
+					Name:               name + suffix,
+					FullyQualifiedName: name + suffix,
+					Type:               SymbolRoute,
+					FilePath:           filePath,
+					Line:               lineNumber,
+					Character:          indent,
+					EndCharacter:       len([]rune(strings.TrimRight(text, " \t"))),
+					Detail:             trimmed,
+				})
+			}
+		}
+
+		switch {
+		case routeResourcesPattern.MatchString(line):
+			matches := routeResourcesPattern.FindStringSubmatch(line)
+			singularResource := matches[1] == "resource"
+			actions := routeActions(line)
+
+			for _, name := range routeResourceNames(matches[2]) {
+				if as := routeAsPattern.FindStringSubmatch(line); as != nil {
+					name = as[1]
+				}
+				plural := current.prefix + name
+				singular := plural
+				if !singularResource {
+					singular = current.prefix + inflections.Singularize(name)
+				}
+
+				if !singularResource && (actions["index"] || actions["create"]) {
+					add(plural)
+				}
+				if actions["new"] {
+					add("new_" + singular)
+				}
+				if actions["edit"] {
+					add("edit_" + singular)
+				}
+				if actions["show"] || actions["update"] || actions["destroy"] || (singularResource && actions["create"]) {
+					add(singular)
+				}
+
+				block.prefix = singular + "_"
+				block.singular = singular
+				block.plural = plural
+			}
+
+		case routeNamespacePattern.MatchString(line):
+			block.prefix = current.prefix + routeNamespacePattern.FindStringSubmatch(line)[1] + "_"
+
+		case routeScopePattern.MatchString(line):
+			if as := routeAsPattern.FindStringSubmatch(line); as != nil {
+				block.prefix = current.prefix + as[1] + "_"
+			}
+
+		case routeNestingPattern.MatchString(line):
+			block.nesting = routeNestingPattern.FindStringSubmatch(line)[1]
+
+		case routeRootPattern.MatchString(line):
+			add(current.prefix + "root")
+
+		case routeVerbPattern.MatchString(line):
+			matches := routeVerbPattern.FindStringSubmatch(line)
+			name := matches[3]
+			if as := routeAsPattern.FindStringSubmatch(line); as != nil {
+				name = as[1]
+			} else if name == "" && !strings.ContainsAny(matches[2], ":*(") {
+				name = strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(strings.Trim(matches[2], "/"))
+			}
+			if name == "" {
+				break
+			}
+
+			// Member and collection actions precede the resource (preview_user, search_users)
+			switch current.nesting {
+			case "member":
+				add(name + "_" + current.singular)
+			case "collection":
+				add(name + "_" + current.plural)
+			default:
+				add(current.prefix + name)
+			}
+		}
+
+		if routeBlockPattern.MatchString(line) {
+			frames = append(frames, block)
+		}
+	}
+
+	return entries
+}
+
+// stripRouteComment drops a trailing comment, keeping the strings routes are written with
+func stripRouteComment(line string) string {
+	if masked := maskStringsAndComments(line); strings.Contains(line, "#") {
+		if i := strings.LastIndexFunc(masked, func(r rune) bool { return r != ' ' }); i+1 < len(line) {
+			return line[:i+1]
+		}
+	}
+	return line
+}
+
+// routeResourceNames returns the resource names given to resources/resource,
+// which come before any option (resources :users, :posts, only: [:index])
+func routeResourceNames(args string) []string {
+	var names []string
+	for _, arg := range splitTopLevel(strings.TrimSuffix(strings.TrimSpace(routeBlockPattern.ReplaceAllString(args, "")), ")")) {
+		arg = strings.TrimPrefix(strings.TrimSpace(arg), "(")
+		matches := routeSymbolPattern.FindStringSubmatch(arg)
+		if matches == nil {
+			break
+		}
+		names = append(names, matches[1])
+	}
+	return names
+}
+
+// routeActions returns the actions a resources line routes, honoring only: and except:
+func routeActions(line string) map[string]bool {
+	actions := map[string]bool{
+		"index": true, "show": true, "new": true, "create": true,
+		"edit": true, "update": true, "destroy": true,
+	}
+	if only := routeOnlyPattern.FindStringSubmatch(line); only != nil {
+		actions = make(map[string]bool)
+		for _, action := range symbolNames(only[1]) {
+			actions[action] = true
+		}
+	}
+	if except := routeExceptPattern.FindStringSubmatch(line); except != nil {
+		for _, action := range symbolNames(except[1]) {
+			delete(actions, action)
+		}
+	}
+	return actions
+}
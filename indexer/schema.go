@@ -0,0 +1,129 @@
+package indexer
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// db/schema.rb tables and their columns
+var (
+	schemaTablePattern  = regexp.MustCompile(`^\s*create_table\s+["'](\w+)["']`)
+	schemaColumnPattern = regexp.MustCompile(`^\s*t\.(\w+)\s+["'](\w+)["']`)
+)
+
+// Column definitions that are not columns of their own
+var schemaNonColumns = map[string]bool{
+	"index":            true,
+	"check_constraint": true,
+}
+
+// columnDetailPrefix marks the Detail of attribute entries that come from a schema column
+const columnDetailPrefix = "column:"
+
+// isSchemaFile reports whether a file is the Rails schema dump (db/schema.rb)
+func isSchemaFile(filePath string) bool {
+	return filepath.Base(filePath) == "schema.rb" && filepath.Base(filepath.Dir(filePath)) == "db"
+}
+
+// parseSchema turns the columns of each table in db/schema.rb into attribute
+// entries of the model conventionally backed by the table (users -> User)
+func parseSchema(scanner *bufio.Scanner, filePath string, inflections Inflections) []SymbolEntry {
+	var entries []SymbolEntry
+	model := ""
+	tableIndent := 0
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		if matches := schemaTablePattern.FindStringSubmatch(line); matches != nil {
+			model = inflections.ModelName(matches[1])
+			tableIndent = countIndent(line)
+			continue
+		}
+		if model == "" {
+			continue
+		}
+		if endPattern.MatchString(line) && countIndent(line) <= tableIndent {
+			model = ""
+			continue
+		}
+
+		column := func(name string, columnType string, character int) {
+			entries = append(entries, SymbolEntry{
+				Name:               name,
+				FullyQualifiedName: model + "#" + name,
+				Type:               SymbolAttrAccessor,
+				FilePath:           filePath,
+				Line:               lineNumber,
+				Character:          character,
+				Parent:             model,
+				Visibility:         "public",
+				Detail:             columnDetailPrefix + columnType,
+			})
+		}
+
+		// t.timestamps adds both timestamp columns
+		if strings.HasPrefix(strings.TrimSpace(line), "t.timestamps") {
+			character := strings.Index(line, "timestamps")
+			column("created_at", "datetime", character)
+			column("updated_at", "datetime", character)
+			continue
+		}
+
+		matches := schemaColumnPattern.FindStringSubmatch(line)
+		if matches == nil || schemaNonColumns[matches[1]] {
+			continue
+		}
+		name, columnType := matches[2], matches[1]
+		if columnType == "references" || columnType == "belongs_to" {
+			name, columnType = name+"_id", "bigint"
+		}
+		column(name, columnType, strings.Index(line, matches[2]))
+	}
+
+	return entries
+}
+
+// ColumnType returns the SQL type of an attribute indexed from a schema column
+func ColumnType(entry SymbolEntry) (string, bool) {
+	if entry.Type != SymbolAttrAccessor || !strings.HasPrefix(entry.Detail, columnDetailPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(entry.Detail, columnDetailPrefix), true
+}
+
+// Columns returns the schema columns of a model class in table order
+func (idx *Index) Columns(className string) []SymbolEntry {
+	model := classNameOnly(className)
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	var columns []SymbolEntry
+	for filePath, entries := range idx.fileSymbols {
+		if !isSchemaFile(filePath) {
+			continue
+		}
+		for _, entry := range entries {
+			if _, ok := ColumnType(entry); ok && entry.Parent == model {
+				columns = append(columns, entry)
+			}
+		}
+	}
+	return columns
+}
+
+// snakeToCamel turns a snake_case name into a class name (line_item -> LineItem)
+func snakeToCamel(name string) string {
+	var camel strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			camel.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return camel.String()
+}
@@ -0,0 +1,322 @@
+package indexer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TypeSignature is a method's parameter and return types as declared by one source
+type TypeSignature struct {
+	Source     string // "sorbet", "rbs" or "yard"
+	Params     []TypedParam
+	ReturnType string
+}
+
+// TypedParam is a single declared parameter type
+type TypedParam struct {
+	Name string
+	Type string
+}
+
+// Sorbet sig blocks and RBS declarations
+var (
+	sigStartPattern   = regexp.MustCompile(`^\s*sig\s*(\{|do\b)`)
+	sigParamsPattern  = regexp.MustCompile(`\bparams\s*\(`)
+	sigReturnsPattern = regexp.MustCompile(`\breturns\s*\(`)
+	sigVoidPattern    = regexp.MustCompile(`\bvoid\b`)
+	rbsClassPattern   = regexp.MustCompile(`^\s*(class|module|interface)\s+([A-Z][\w:]*|_\w+)`)
+	rbsMethodPattern  = regexp.MustCompile(`^\s*def\s+(self\??\.)?([^\s:]+)\s*:\s*(.*)$`)
+	rbsEndPattern     = regexp.MustCompile(`^\s*end\b`)
+)
+
+// sigBuilder accumulates the text of a sorbet sig spanning one or more lines
+type sigBuilder struct {
+	text   strings.Builder
+	braces bool // sig { ... } rather than sig do ... end
+	depth  int
+	indent int
+}
+
+// add appends a line of the sig and reports whether the sig is complete
+func (b *sigBuilder) add(line string) bool {
+	b.text.WriteString(line)
+	b.text.WriteString("\n")
+
+	if b.braces {
+		b.depth += strings.Count(line, "{") - strings.Count(line, "}")
+		return b.depth <= 0
+	}
+	return rbsEndPattern.MatchString(line) && countIndent(line) <= b.indent
+}
+
+// parseSorbetSig extracts the params(...) and returns(...)/void parts of a sig
+func parseSorbetSig(text string) TypeSignature {
+	sig := TypeSignature{Source: "sorbet"}
+
+	if args, ok := callArguments(text, sigParamsPattern); ok {
+		for _, arg := range splitTopLevel(args) {
+			name, typ, found := strings.Cut(arg, ":")
+			if !found {
+				continue
+			}
+			sig.Params = append(sig.Params, TypedParam{
+				Name: strings.TrimSpace(name),
+				Type: strings.TrimSpace(typ),
+			})
+		}
+	}
+
+	if ret, ok := callArguments(text, sigReturnsPattern); ok {
+		sig.ReturnType = strings.TrimSpace(ret)
+	} else if sigVoidPattern.MatchString(text) {
+		sig.ReturnType = "void"
+	}
+
+	return sig
+}
+
+// callArguments returns the text between the parentheses of the first call
+// matched by pattern, which must end at the opening parenthesis
+func callArguments(text string, pattern *regexp.Regexp) (string, bool) {
+	loc := pattern.FindStringIndex(text)
+	if loc == nil {
+		return "", false
+	}
+	return balancedArguments(text, loc[1]-1)
+}
+
+// balancedArguments returns the text between the parenthesis at open and its match
+func balancedArguments(text string, open int) (string, bool) {
+	depth := 0
+	for i := open; i < len(text); i++ {
+		switch text[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return text[open+1 : i], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitTopLevel splits a comma-separated list, ignoring commas nested in brackets
+func splitTopLevel(list string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(list[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// parseRBSFile reads the method signatures declared in an .rbs file, keyed by
+// the FQN of the Ruby method they describe (Foo#bar, Foo.baz)
+func parseRBSFile(filePath string) map[string][]TypeSignature {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	signatures := make(map[string][]TypeSignature)
+	var nesting []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if matches := rbsClassPattern.FindStringSubmatch(line); matches != nil {
+			nesting = append(nesting, matches[2])
+			continue
+		}
+		if rbsEndPattern.MatchString(line) {
+			if len(nesting) > 0 {
+				nesting = nesting[:len(nesting)-1]
+			}
+			continue
+		}
+
+		matches := rbsMethodPattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		sep := "#"
+		if matches[1] != "" {
+			sep = "."
+		}
+		fqn := matches[2]
+		if len(nesting) > 0 {
+			fqn = strings.Join(nesting, "::") + sep + matches[2]
+		}
+
+		signatures[fqn] = append(signatures[fqn], parseRBSMethodType(matches[3]))
+	}
+
+	return signatures
+}
+
+// parseRBSMethodType parses an RBS method type such as
+// (Integer x, ?String y, key: Symbol) { () -> void } -> String.
+// Only the first overload is used.
+func parseRBSMethodType(methodType string) TypeSignature {
+	sig := TypeSignature{Source: "rbs"}
+
+	overload := methodType
+	if parts := splitTopLevelOn(methodType, '|'); len(parts) > 0 {
+		overload = parts[0]
+	}
+	overload = strings.TrimSpace(overload)
+
+	if strings.HasPrefix(overload, "(") {
+		if args, ok := balancedArguments(overload, 0); ok {
+			for _, arg := range splitTopLevel(args) {
+				sig.Params = append(sig.Params, parseRBSParam(arg))
+			}
+		}
+	}
+
+	if i := strings.LastIndex(overload, "->"); i >= 0 {
+		sig.ReturnType = strings.TrimSpace(overload[i+2:])
+	}
+
+	return sig
+}
+
+// parseRBSParam parses a single RBS parameter (Integer x, ?key: String, *String rest)
+func parseRBSParam(param string) TypedParam {
+	param = strings.TrimPrefix(strings.TrimSpace(param), "?")
+
+	// Keyword parameters: key: Type
+	if name, typ, found := strings.Cut(param, ":"); found && !strings.Contains(name, " ") && !strings.HasPrefix(typ, ":") {
+		return TypedParam{Name: strings.TrimSpace(name), Type: strings.TrimSpace(typ)}
+	}
+
+	// Positional parameters: Type name, where the name is optional
+	fields := strings.Fields(param)
+	if len(fields) > 1 {
+		last := fields[len(fields)-1]
+		if last != "" && (last[0] == '_' || (last[0] >= 'a' && last[0] <= 'z')) {
+			return TypedParam{Name: last, Type: strings.Join(fields[:len(fields)-1], " ")}
+		}
+	}
+	return TypedParam{Type: param}
+}
+
+// splitTopLevelOn splits text on sep outside of brackets
+func splitTopLevelOn(text string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// indexRBSFile replaces the RBS signatures contributed by a file. Callers hold the write lock.
+func (idx *Index) indexRBSFile(filePath string, signatures map[string][]TypeSignature) {
+	for _, fqn := range idx.rbsFiles[filePath] {
+		var kept []rbsSignature
+		for _, sig := range idx.rbsSignatures[fqn] {
+			if sig.file != filePath {
+				kept = append(kept, sig)
+			}
+		}
+		if len(kept) > 0 {
+			idx.rbsSignatures[fqn] = kept
+		} else {
+			delete(idx.rbsSignatures, fqn)
+		}
+	}
+	delete(idx.rbsFiles, filePath)
+
+	for fqn, sigs := range signatures {
+		for _, sig := range sigs {
+			idx.rbsSignatures[fqn] = append(idx.rbsSignatures[fqn], rbsSignature{TypeSignature: sig, file: filePath})
+		}
+		idx.rbsFiles[filePath] = append(idx.rbsFiles[filePath], fqn)
+	}
+}
+
+// rbsSignature is an RBS signature along with the file declaring it
+type rbsSignature struct {
+	TypeSignature
+	file string
+}
+
+// isRBSSignatureFile reports whether a workspace-relative path is an .rbs file under sig/
+func isRBSSignatureFile(relPath string) bool {
+	return filepath.Ext(relPath) == ".rbs" && strings.HasPrefix(filepath.ToSlash(relPath), "sig/")
+}
+
+// TypeSignatures returns the declared types of a method, those written with the
+// def (a sorbet sig, YARD tags) first, then RBS
+func (idx *Index) TypeSignatures(entry SymbolEntry) []TypeSignature {
+	signatures := append([]TypeSignature(nil), entry.Types...)
+
+	idx.mutex.RLock()
+	for _, sig := range idx.rbsSignatures[entry.FullyQualifiedName] {
+		signatures = append(signatures, sig.TypeSignature)
+	}
+	idx.mutex.RUnlock()
+
+	return signatures
+}
+
+// Format renders the signature as name(param: Type, ...) -> ReturnType
+func (sig TypeSignature) Format(name string) string {
+	params := make([]string, 0, len(sig.Params))
+	for _, param := range sig.Params {
+		params = append(params, param.Format())
+	}
+
+	formatted := name + "(" + strings.Join(params, ", ") + ")"
+	if sig.ReturnType != "" {
+		formatted += " -> " + sig.ReturnType
+	}
+	return formatted
+}
+
+// Format renders the parameter as name: Type, or whichever of the two is known
+func (param TypedParam) Format() string {
+	switch {
+	case param.Name == "":
+		return param.Type
+	case param.Type == "":
+		return param.Name
+	}
+	return param.Name + ": " + param.Type
+}
@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// A do block opened in the middle of a statement (items.each do |item| total += item),
+// up to its parameters
+var inlineDoPattern = regexp.MustCompile(`\bdo\b\s*(?:\|[^|]*\|)?`)
+
+// Lines of code continuing the statement above them: a method chain (.where(...),
+// &.name), a condition (&& ready?, || fallback) or the rest of a list (, :b)
+var leadingContinuationPattern = regexp.MustCompile(`^\s*(?:&?\.[^.]|&&|\|\||\+|,)`)
+
+// Code ending in an operator, a comma or a backslash continues on the next line
+var trailingContinuationPattern = regexp.MustCompile(`(?:[-+*,.\\]|&&|\|\||[^=!<>]=)\s*$`)
+
+// splitStatements splits a line at the semicolons separating its statements
+// (module M; def x; end; end), outside string literals and comments. A do block
+// opened within a statement is split after its parameters too, so the block is
+// seen to open before the end closing it. Every statement but the first has what
+// precedes it blanked out, keeping its columns those of the line. A line holding
+// a single statement is returned as is.
+func splitStatements(line string) []string {
+	code := maskStringsAndComments(line)
+	if !strings.Contains(code, ";") {
+		return []string{line}
+	}
+
+	var bounds []int
+	start := 0
+	for i := 0; i <= len(code); i++ {
+		if i < len(code) && code[i] != ';' {
+			continue
+		}
+		if loc := inlineDoPattern.FindStringIndex(code[start:i]); loc != nil && strings.TrimSpace(code[start+loc[1]:i]) != "" {
+			bounds = append(bounds, start+loc[1])
+		}
+		bounds = append(bounds, i)
+		start = i + 1
+	}
+
+	var statements []string
+	start = 0
+	for _, end := range bounds {
+		if strings.TrimSpace(code[start:end]) != "" {
+			statements = append(statements, strings.Repeat(" ", utf8.RuneCountInString(line[:start]))+line[start:end])
+		}
+		start = end
+		if start < len(line) && line[start] == ';' {
+			start++
+		}
+	}
+	return statements
+}
+
+// statementIndents measures lines of code at the indentation of the statement
+// they belong to. A line continuing a statement (.map do |user|, && other) takes
+// the indentation of the line starting it, so a block opened on it closes with an
+// end aligned with the statement instead of being taken for a deeper body.
+type statementIndents struct {
+	indent    int  // indentation of the line starting the current statement
+	continued bool // the last line of code ended with an operator or comma
+}
+
+// of returns the indentation line, masked to code, is matched at. Blank lines and
+// comments neither start nor continue a statement.
+func (s *statementIndents) of(line string, code string) int {
+	if strings.TrimSpace(code) == "" {
+		return countIndent(line)
+	}
+	if !s.continued && !leadingContinuationPattern.MatchString(code) {
+		s.indent = countIndent(line)
+	}
+	s.continued = trailingContinuationPattern.MatchString(code)
+	return s.indent
+}
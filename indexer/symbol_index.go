@@ -0,0 +1,71 @@
+package indexer
+
+import "context"
+
+// SymbolIndex is everything the language server asks of a workspace index.
+// *Index, which parses Ruby line by line, is the default implementation; another
+// backend (a full parser, a database shared between editors) can stand in for
+// it without the handlers changing. References are found through
+// ConstantReferences for constants and MethodReferences for method names.
+type SymbolIndex interface {
+	// Building and keeping up with the workspace
+	BuildIndex(ctx context.Context)
+	IsReady() bool
+	Mode() string
+	Stats() Stats
+	ShouldIndex(path string) bool
+	Covers(path string) bool
+	IndexOnDemand(filePath string)
+	UpdateFile(filePath string)
+	UpdateFileFromSource(filePath string, source string)
+	RemoveFile(filePath string)
+	IndexGems(ctx context.Context) (int, int)
+
+	// Workspace folders
+	Roots() []string
+	RootOf(path string) string
+	AddRoot(ctx context.Context, root string)
+	RemoveRoot(root string)
+
+	// Finding definitions
+	Lookup(name string) []SymbolEntry
+	AllSymbols(fn func(SymbolEntry) bool)
+	PrefixSearch(ctx context.Context, prefix string) []SymbolEntry
+	SearchSymbols(ctx context.Context, query string, limit int, keep func(SymbolEntry) bool) []SymbolEntry
+	LookupByConvention(word string) []SymbolEntry
+	LookupInScope(path string, scope string) []SymbolEntry
+	LookupScoped(name string, nesting []string) []SymbolEntry
+	ResolveConstantPath(path string, scope string) string
+	ResolveAlias(entry SymbolEntry) []SymbolEntry
+	GetFileSymbols(filePath string) []SymbolEntry
+	ParseSource(source string, filePath string) []SymbolEntry
+	EnclosingScope(filePath string, line int) string
+	EnclosingDefinition(filePath string, line int) (SymbolEntry, bool)
+
+	// Class hierarchy
+	TypeDefinition(fqn string) (SymbolEntry, bool)
+	SuperclassChain(fqn string) []string
+	AncestorsOf(fqn string) []string
+	MergedClass(fqn string) (MergedClass, bool)
+	ForwardedClass(fqn string) string
+	Supertypes(fqn string) []string
+	Subtypes(fqn string) []string
+	Mixins(fqn string) []string
+
+	// What definitions tell beyond their names
+	AssociationClassName(entry SymbolEntry) string
+	AssociationTarget(entry SymbolEntry) []SymbolEntry
+	Columns(className string) []SymbolEntry
+	Migrations(className string) []Migration
+	InstanceVariableAssignments(className string, name string) []SymbolEntry
+	ClassVariableAssignments(className string, name string) []SymbolEntry
+	TypeSignatures(entry SymbolEntry) []TypeSignature
+	GemVersion(name string) string
+
+	// Where definitions are used
+	ConstantReferences(fqn string) []ConstantReference
+	MethodReferences(name string, sources map[string]string) []MethodReference
+}
+
+// Index must keep providing everything the server relies on
+var _ SymbolIndex = (*Index)(nil)
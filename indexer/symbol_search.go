@@ -0,0 +1,184 @@
+package indexer
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores of the ways a query can match a symbol name, best first
+const (
+	matchExact          = 100
+	matchPrefix         = 80
+	matchInitials       = 70 // every word initial in order (AR -> ApplicationRecord)
+	matchLeadInitials   = 60 // the initials of the leading words (uS -> UserServiceSpec)
+	matchSparseInitials = 50 // initials of some of the words, in order (UC -> UsersApiController)
+	matchSubstring      = 30
+)
+
+// Names a search scans between checks of its context, so a cancelled or timed
+// out search stops promptly without checking on every name
+const searchCheckInterval = 256
+
+// SearchSymbols finds the symbols matching a workspace symbol query, best matches
+// first. Names match by prefix, by word initials across CamelCase and snake_case
+// boundaries (fbn -> find_by_name), or by substring. A query containing "::" is
+// matched against fully qualified names. Only entries keep accepts are returned,
+// all of them when keep is nil. At most limit entries are returned, all of them
+// when limit is 0; the best limit are kept in a bounded heap as the scan goes
+// rather than ranking every match. Once ctx is done the scan stops, ranking the
+// matches found so far.
+func (idx *Index) SearchSymbols(ctx context.Context, query string, limit int, keep func(SymbolEntry) bool) []SymbolEntry {
+	qualified := strings.Contains(query, "::")
+
+	idx.mutex.RLock()
+	matches := &scoredHeap{}
+	scanned := 0
+scan:
+	for _, entries := range idx.fileSymbols {
+		for _, entry := range entries {
+			if scanned++; scanned%searchCheckInterval == 0 && ctx.Err() != nil {
+				break scan
+			}
+			// Instance and class variables are assignment sites, not workspace symbols
+			if entry.Type == SymbolInstanceVariable || entry.Type == SymbolClassVar {
+				continue
+			}
+			name := entry.Name
+			if qualified {
+				name = entry.FullyQualifiedName
+			}
+			score := SymbolMatchScore(query, name)
+			if score == 0 || (keep != nil && !keep(entry)) {
+				continue
+			}
+			match := scoredEntry{entry: entry, score: score}
+			switch {
+			case limit == 0 || matches.Len() < limit:
+				heap.Push(matches, match)
+			case match.betterThan((*matches)[0]):
+				(*matches)[0] = match
+				heap.Fix(matches, 0)
+			}
+		}
+	}
+	idx.mutex.RUnlock()
+
+	sorted := *matches
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].betterThan(sorted[j])
+	})
+
+	results := make([]SymbolEntry, 0, len(sorted))
+	for _, match := range sorted {
+		results = append(results, match.entry)
+	}
+	return results
+}
+
+// scoredEntry is a search match with its SymbolMatchScore
+type scoredEntry struct {
+	entry SymbolEntry
+	score int
+}
+
+// betterThan orders matches by score, then shorter names, then by name, file and
+// line so equal scores rank the same on every search
+func (a scoredEntry) betterThan(b scoredEntry) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if len(a.entry.Name) != len(b.entry.Name) {
+		return len(a.entry.Name) < len(b.entry.Name)
+	}
+	if a.entry.FullyQualifiedName != b.entry.FullyQualifiedName {
+		return a.entry.FullyQualifiedName < b.entry.FullyQualifiedName
+	}
+	if a.entry.FilePath != b.entry.FilePath {
+		return a.entry.FilePath < b.entry.FilePath
+	}
+	return a.entry.Line < b.entry.Line
+}
+
+// scoredHeap is a heap of matches with the worst on top, so a search keeping
+// the best few replaces it when a better match turns up
+type scoredHeap []scoredEntry
+
+func (h scoredHeap) Len() int            { return len(h) }
+func (h scoredHeap) Less(i, j int) bool  { return h[j].betterThan(h[i]) }
+func (h scoredHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *scoredHeap) Push(x interface{}) { *h = append(*h, x.(scoredEntry)) }
+func (h *scoredHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// SymbolMatchScore rates how well a query matches a symbol name, 0 for no match.
+// Case is ignored; word starts are found from the name's own casing.
+func SymbolMatchScore(query string, name string) int {
+	if query == "" {
+		return 0
+	}
+
+	lowerQuery, lowerName := strings.ToLower(query), strings.ToLower(name)
+	switch {
+	case lowerQuery == lowerName:
+		return matchExact
+	case strings.HasPrefix(lowerName, lowerQuery):
+		return matchPrefix
+	}
+
+	initials := strings.ToLower(wordInitials(name))
+	switch {
+	case len(lowerQuery) < 2 || initials == "":
+		// a single letter is just a prefix, and symbols like == have no words
+	case lowerQuery == initials:
+		return matchInitials
+	case strings.HasPrefix(initials, lowerQuery):
+		return matchLeadInitials
+	case lowerQuery[0] == initials[0] && isSubsequence(lowerQuery, initials):
+		return matchSparseInitials
+	}
+	if strings.Contains(lowerName, lowerQuery) {
+		return matchSubstring
+	}
+	return 0
+}
+
+// wordInitials returns the first letter of every word of a name, splitting at
+// underscores, namespace separators and CamelCase humps (HTTPClient -> HC)
+func wordInitials(name string) string {
+	var initials strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if r == '_' || r == ':' || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			continue
+		}
+
+		start := i == 0 || runes[i-1] == '_' || runes[i-1] == ':'
+		if !start && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			start = unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower)
+		}
+		if start {
+			initials.WriteRune(r)
+		}
+	}
+	return initials.String()
+}
+
+// isSubsequence reports whether every byte of sub appears in s, in order
+func isSubsequence(sub string, s string) bool {
+	i := 0
+	for j := 0; j < len(s) && i < len(sub); j++ {
+		if s[j] == sub[i] {
+			i++
+		}
+	}
+	return i == len(sub)
+}
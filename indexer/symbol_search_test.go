@@ -0,0 +1,232 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchSymbolsKeepsTheBestWithinTheLimit(t *testing.T) {
+	idx, _ := newTestIndex(t, map[string]string{
+		"app/models/order.rb":         "class Order\n  def order_total\n  end\n\n  def reorder\n  end\nend\n",
+		"app/models/order_item.rb":    "class OrderItem\n  def ordered_at\n  end\nend\n",
+		"app/services/ordering.rb":    "module Ordering\n  def self.disorder\n  end\nend\n",
+		"app/models/border_patrol.rb": "class BorderPatrol\nend\n",
+	}, Options{})
+
+	all := idx.SearchSymbols(context.Background(), "order", 0, nil)
+	if len(all) < 6 {
+		t.Fatalf("SearchSymbols(order) = %d entries, want every match", len(all))
+	}
+	if all[0].FullyQualifiedName != "Order" {
+		t.Errorf("best match = %s, want the exact match Order", all[0].FullyQualifiedName)
+	}
+
+	for limit := 1; limit <= len(all); limit++ {
+		limited := idx.SearchSymbols(context.Background(), "order", limit, nil)
+		if len(limited) != limit {
+			t.Fatalf("SearchSymbols(order, %d) = %d entries", limit, len(limited))
+		}
+		for i := range limited {
+			if limited[i].FullyQualifiedName != all[i].FullyQualifiedName || limited[i].FilePath != all[i].FilePath {
+				t.Errorf("SearchSymbols(order, %d)[%d] = %s, want %s", limit, i, limited[i].FullyQualifiedName, all[i].FullyQualifiedName)
+			}
+		}
+	}
+
+	methods := idx.SearchSymbols(context.Background(), "order", 2, func(entry SymbolEntry) bool {
+		return entry.Type == SymbolMethod
+	})
+	if len(methods) != 2 || methods[0].Name != "ordered_at" || methods[1].Name != "order_total" {
+		t.Errorf("SearchSymbols(order, 2, methods) = %+v, want the prefix matches ordered_at then order_total", methods)
+	}
+}
+
+// largeTestIndex indexes files classes of methods methods each, all named alike
+// so every query scans and matches most of the index
+func largeTestIndex(files, methods int) *Index {
+	sources := make(map[string]string, files)
+	for i := 0; i < files; i++ {
+		var source strings.Builder
+		fmt.Fprintf(&source, "class Report%d\n", i)
+		for j := 0; j < methods; j++ {
+			fmt.Fprintf(&source, "  def report_line_%d\n  end\n\n", j)
+		}
+		source.WriteString("end\n")
+		sources[fmt.Sprintf("/workspace/app/reports/report_%d.rb", i)] = source.String()
+	}
+	idx := New("/workspace", log.New(io.Discard, "", 0))
+	idx.IndexSources(sources)
+	return idx
+}
+
+func TestSearchesStopPromptlyOnceCancelled(t *testing.T) {
+	idx := largeTestIndex(100, 50)
+	all := idx.SearchSymbols(context.Background(), "report", 0, nil)
+	if len(all) < 5000 {
+		t.Fatalf("SearchSymbols(report) = %d entries, want the whole index", len(all))
+	}
+
+	// Cancelled mid-scan: the scan ends at its next check of the context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	accepted := 0
+	partial := idx.SearchSymbols(ctx, "report", 0, func(SymbolEntry) bool {
+		if accepted++; accepted == 1000 {
+			cancel()
+		}
+		return true
+	})
+	if len(partial) < 1000 || len(partial) > 1000+searchCheckInterval {
+		t.Errorf("SearchSymbols cancelled after 1000 matches = %d entries, want it to stop within %d names", len(partial), searchCheckInterval)
+	}
+
+	full := idx.PrefixSearch(context.Background(), "report")
+	if prefixed := idx.PrefixSearch(ctx, "report"); len(prefixed) > len(full)/2 {
+		t.Errorf("PrefixSearch with a cancelled context = %d of %d entries, want it to stop at its first check", len(prefixed), len(full))
+	}
+}
+
+func BenchmarkSearchSymbols(b *testing.B) {
+	idx := largeTestIndex(200, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.SearchSymbols(context.Background(), "rl", 50, nil)
+	}
+}
+
+func BenchmarkPrefixSearch(b *testing.B) {
+	idx := largeTestIndex(200, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.PrefixSearch(context.Background(), "report_line_1")
+	}
+}
+
+func TestReindexingAFileKeepsCountsStable(t *testing.T) {
+	idx, root := newTestIndex(t, map[string]string{
+		"app/models/order.rb": "class Order\n  def order_total\n  end\n\n  def reorder\n  end\nend\n",
+	}, Options{})
+	path := filepath.Join(root, "app/models/order.rb")
+
+	before := idx.Stats().Symbols
+	prefixed := len(idx.PrefixSearch(context.Background(), "order"))
+	if prefixed != 3 {
+		// order_total by its name, Order and its methods by their FQN
+		t.Fatalf("PrefixSearch(order) = %d entries, want the 3 symbols of Order once each", prefixed)
+	}
+
+	for i := 0; i < 2; i++ {
+		idx.UpdateFile(path)
+		idx.UpdateFileFromSource(path, "class Order\n  def order_total\n  end\n\n  def reorder\n  end\nend\n")
+	}
+	if after := idx.Stats().Symbols; after != before {
+		t.Errorf("Stats().Symbols after re-indexing = %d, want %d", after, before)
+	}
+	if got := len(idx.PrefixSearch(context.Background(), "order")); got != prefixed {
+		t.Errorf("PrefixSearch(order) after re-indexing = %d entries, want %d", got, prefixed)
+	}
+	if got := len(idx.Lookup("Order#order_total")); got != 1 {
+		t.Errorf("Lookup(Order#order_total) after re-indexing = %d entries, want 1", got)
+	}
+}
+
+func TestSymbolMatchScore(t *testing.T) {
+	tests := []struct {
+		query string
+		name  string
+		want  int
+	}{
+		{"order", "Order", matchExact},
+		{"Appl", "ApplicationRecord", matchPrefix},
+		{"AR", "ApplicationRecord", matchInitials},
+		{"pS", "PaymentService", matchInitials},
+		{"fbn", "find_by_name", matchInitials},
+		{"HC", "HTTPClient", matchInitials},
+		{"pS", "PaymentServiceSpec", matchLeadInitials},
+		// initials that spell a prefix are matched as one
+		{"uS", "UserService", matchPrefix},
+		{"UC", "UsersApiController", matchSparseInitials},
+		{"record", "ApplicationRecord", matchSubstring},
+		{"AR", "PaymentService", 0},
+		{"", "Order", 0},
+	}
+	for _, test := range tests {
+		if got := SymbolMatchScore(test.query, test.name); got != test.want {
+			t.Errorf("SymbolMatchScore(%q, %q) = %d, want %d", test.query, test.name, got, test.want)
+		}
+	}
+}
+
+func TestSearchSymbolsRanksInitialsMatches(t *testing.T) {
+	idx, _ := newTestIndex(t, map[string]string{
+		"app/models/application_record.rb": "class ApplicationRecord\nend\n",
+		"app/models/audit_record_spec.rb":  "class AuditRecordSpec\nend\n",
+		"app/models/payable_report.rb":     "class AccountsPayableReport\nend\n",
+		"app/models/user.rb":               "class User\n  def self.find_by_nickname_or_email\n  end\n\n  def self.find_by_name\n  end\nend\n",
+		"app/services/payment_service.rb":  "class PaymentService\nend\n",
+		"app/services/payment_spec.rb":     "class PaymentServiceSpec\nend\n",
+	}, Options{})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"AR", []string{"ApplicationRecord", "AuditRecordSpec", "AccountsPayableReport"}},
+		{"pS", []string{"PaymentService", "PaymentServiceSpec"}},
+		{"fbn", []string{"User.find_by_name", "User.find_by_nickname_or_email"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, entry := range idx.SearchSymbols(context.Background(), test.query, 0, nil) {
+			got = append(got, entry.FullyQualifiedName)
+		}
+		if len(got) < len(test.want) {
+			t.Errorf("SearchSymbols(%q) = %v, want %v first", test.query, got, test.want)
+			continue
+		}
+		for i, fqn := range test.want {
+			if got[i] != fqn {
+				t.Errorf("SearchSymbols(%q) = %v, want %v first", test.query, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestAllSymbolsVisitsEachSymbolOnce(t *testing.T) {
+	idx, _ := newTestIndex(t, map[string]string{
+		"app/models/order.rb":   "class Order < ApplicationRecord\n  has_many :line_items\n  scope :paid, -> { where(paid: true) }\n\n  def total\n  end\n\n  private\n\n  def recalculate\n  end\nend\n",
+		"app/models/invoice.rb": "module Billing\n  class Invoice\n    STATUSES = %w[open paid].freeze\n\n    def total\n    end\n  end\nend\n",
+		// A reopening adds entries of a name already indexed
+		"app/models/order_extensions.rb": "class Order\n  def ship\n  end\nend\n",
+	}, Options{})
+
+	count := 0
+	seen := make(map[string]bool)
+	idx.AllSymbols(func(entry SymbolEntry) bool {
+		count++
+		key := fmt.Sprintf("%s:%d:%s", entry.FilePath, entry.Line, entry.FullyQualifiedName)
+		if seen[key] {
+			t.Errorf("%s visited twice", key)
+		}
+		seen[key] = true
+		return true
+	})
+	if stats := idx.Stats(); count != stats.Symbols || count == 0 {
+		t.Errorf("AllSymbols visited %d symbols, Stats counts %d", count, stats.Symbols)
+	}
+
+	visited := 0
+	idx.AllSymbols(func(SymbolEntry) bool {
+		visited++
+		return visited < 3
+	})
+	if visited != 3 {
+		t.Errorf("AllSymbols called fn %d times after it returned false on the 3rd, want 3", visited)
+	}
+}
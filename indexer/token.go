@@ -0,0 +1,166 @@
+package indexer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TokenKind classifies the identifier found under the cursor
+type TokenKind int
+
+const (
+	TokenNone             TokenKind = iota
+	TokenIdentifier                 // local variable or method name (foo, valid?, save!)
+	TokenConstant                   // class, module or constant (Foo, HTTP_TIMEOUT)
+	TokenSymbol                     // symbol literal (:foo)
+	TokenInstanceVariable           // @foo
+	TokenClassVariable              // @@foo
+	TokenGlobalVariable             // $foo
+)
+
+// Token is the identifier under the cursor along with its kind and exact range.
+// StartCharacter and EndCharacter are rune columns on Line and cover Text.
+type Token struct {
+	Text           string
+	Kind           TokenKind
+	Sigil          string // leading :, @, @@ or $ included in Text
+	Namespace      string // constant path before Text (Foo for the Bar in Foo::Bar)
+	Line           int
+	StartCharacter int
+	EndCharacter   int
+}
+
+// Qualified returns the token text prefixed with its constant namespace, if any
+func (t Token) Qualified() string {
+	if t.Namespace == "" {
+		return t.Text
+	}
+	return t.Namespace + "::" + t.Text
+}
+
+// Name returns the token text without its sigil (user for :user or @user)
+func (t Token) Name() string {
+	return strings.TrimPrefix(t.Text, t.Sigil)
+}
+
+// GetTokenAtPosition returns the single identifier under the cursor. A cursor placed
+// immediately after an identifier (as while typing) resolves to that identifier.
+func GetTokenAtPosition(source string, line int, character int) Token {
+	lines := strings.Split(source, "\n")
+	if line < 0 || line >= len(lines) {
+		return Token{}
+	}
+
+	runes := []rune(strings.TrimSuffix(lines[line], "\r"))
+	if character < 0 || character > len(runes) {
+		return Token{}
+	}
+
+	pos := character
+	if pos == len(runes) || !isIdentChar(runes[pos]) {
+		switch {
+		case pos < len(runes) && isSigil(runes[pos]) && pos+1 < len(runes) && (isIdentChar(runes[pos+1]) || runes[pos+1] == '@'):
+			// Cursor on a sigil: move onto the identifier it prefixes
+			pos++
+			if runes[pos] == '@' {
+				pos++
+			}
+			if pos >= len(runes) || !isIdentChar(runes[pos]) {
+				return Token{}
+			}
+		case pos > 0 && isIdentChar(runes[pos-1]):
+			pos--
+		case pos > 0 && (runes[pos-1] == '?' || runes[pos-1] == '!') && pos > 1 && isIdentChar(runes[pos-2]):
+			pos -= 2
+		default:
+			return Token{}
+		}
+	}
+
+	start := pos
+	for start > 0 && isIdentChar(runes[start-1]) {
+		start--
+	}
+	end := pos
+	for end < len(runes) && isIdentChar(runes[end]) {
+		end++
+	}
+
+	// Identifiers cannot start with a digit
+	if unicode.IsDigit(runes[start]) {
+		return Token{}
+	}
+
+	token := Token{Kind: TokenIdentifier, Line: line}
+	nameStart := start
+
+	// Sigils before the identifier
+	switch {
+	case start >= 2 && runes[start-1] == '@' && runes[start-2] == '@':
+		token.Kind = TokenClassVariable
+		start -= 2
+	case start >= 1 && runes[start-1] == '@':
+		token.Kind = TokenInstanceVariable
+		start--
+	case start >= 1 && runes[start-1] == '$':
+		token.Kind = TokenGlobalVariable
+		start--
+	case start >= 1 && runes[start-1] == ':' && (start < 2 || runes[start-2] != ':'):
+		token.Kind = TokenSymbol
+		start--
+	case unicode.IsUpper(runes[start]):
+		token.Kind = TokenConstant
+	}
+
+	// Predicate and bang suffixes belong to method names and symbols
+	if token.Kind == TokenIdentifier || token.Kind == TokenSymbol {
+		if end < len(runes) && (runes[end] == '?' || runes[end] == '!') && !(end+1 < len(runes) && runes[end+1] == '=') {
+			end++
+		} else if end < len(runes) && runes[end] == '=' && isSetterDefinition(runes, start, end) {
+			end++
+		}
+	}
+
+	// Constant path leading up to this segment (Foo::Bar::Baz)
+	if token.Kind == TokenConstant {
+		var segments []string
+		i := start
+		for i >= 2 && runes[i-1] == ':' && runes[i-2] == ':' {
+			j := i - 2
+			k := j
+			for k > 0 && isIdentChar(runes[k-1]) {
+				k--
+			}
+			if k == j || !unicode.IsUpper(runes[k]) {
+				break
+			}
+			segments = append([]string{string(runes[k:j])}, segments...)
+			i = k
+		}
+		token.Namespace = strings.Join(segments, "::")
+	}
+
+	token.Text = string(runes[start:end])
+	token.Sigil = string(runes[start:nameStart])
+	token.StartCharacter = start
+	token.EndCharacter = end
+	return token
+}
+
+// isSetterDefinition reports whether the identifier is the name of a `def name=` setter
+func isSetterDefinition(runes []rune, start int, end int) bool {
+	if end+1 < len(runes) && (runes[end+1] == '=' || runes[end+1] == '~' || runes[end+1] == '>') {
+		return false
+	}
+	before := strings.TrimSpace(string(runes[:start]))
+	before = strings.TrimSuffix(before, "self.")
+	return strings.HasSuffix(strings.TrimSpace(before), "def")
+}
+
+func isIdentChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isSigil(r rune) bool {
+	return r == '@' || r == '$' || r == ':'
+}
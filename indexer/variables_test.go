@@ -0,0 +1,102 @@
+package indexer
+
+import (
+	"io"
+	"log"
+	"reflect"
+	"testing"
+)
+
+// Legacy service sharing state through class variables
+const legacyCounterSource = `class LegacyCounter
+  @@count = 0
+  @@registry ||= {}
+
+  def self.track(name)
+    @@count += 1
+    @@registry[name] = @@count
+  end
+
+  def self.reset!
+    @@count = 0
+    @@registry = {}
+  end
+end
+`
+
+func TestClassVariableAssignments(t *testing.T) {
+	idx := NewWithOptions("/workspace", log.New(io.Discard, "", 0), Options{ClassVariables: true})
+	entries := idx.ParseSource(legacyCounterSource, "/workspace/app.rb")
+
+	checkEntries(t, entries, []entrySpec{
+		{"LegacyCounter", "", "public", 14},
+		{"LegacyCounter.track", "LegacyCounter", "public", 8},
+		{"LegacyCounter.reset!", "LegacyCounter", "public", 13},
+		{"LegacyCounter#@@count", "LegacyCounter", "private", 0},
+		{"LegacyCounter#@@registry", "LegacyCounter", "private", 0},
+	})
+
+	// Reads (@@registry[name], = @@count) are not assignments
+	var lines []int
+	for _, entry := range entries {
+		if entry.Type == SymbolClassVar {
+			lines = append(lines, entry.Line)
+		}
+	}
+	if want := []int{2, 3, 6, 11, 12}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("class variable assignments on lines %v, want %v", lines, want)
+	}
+
+	for _, entry := range parseTestSource(t, legacyCounterSource) {
+		if entry.Type == SymbolClassVar {
+			t.Errorf("%s indexed without the ClassVariables option", entry.FullyQualifiedName)
+		}
+	}
+}
+
+func TestInstanceVariablesAreNotClassVariables(t *testing.T) {
+	entries := parseTestSource(t, "class Counter\n  def initialize\n    @@total = 0\n    @count = 1\n  end\nend\n")
+	for _, entry := range entries {
+		if entry.Type == SymbolInstanceVariable && entry.Name != "@count" {
+			t.Errorf("instance variable %s indexed, want only @count", entry.Name)
+		}
+	}
+	checkEntries(t, entries, []entrySpec{{"Counter#@count", "Counter", "private", 0}})
+}
+
+func TestInstanceVariableAssignments(t *testing.T) {
+	tests := []struct {
+		code string
+		want []string
+	}{
+		{"@balance = 0", []string{"@balance"}},
+		{"@a = @b = 1", []string{"@a", "@b"}},
+		{"@a=@b||=@c += 1", []string{"@a", "@b", "@c"}},
+		{"@total ||= items.sum", []string{"@total"}},
+		{"ready = @state == :ready", nil},
+		{"@name =~ /admin/", nil},
+		{"{ @key => 1 }", nil},
+		{"@@count = 0", nil},
+		{"value = @cache[key] = fetch(key)", nil},
+	}
+	for _, test := range tests {
+		var names []string
+		for _, name := range variableAssignments(ivarAssignPattern, test.code) {
+			names = append(names, test.code[name[0]:name[1]])
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("variableAssignments(%q) = %v, want %v", test.code, names, test.want)
+		}
+	}
+}
+
+func TestChainedAssignmentsAreIndexed(t *testing.T) {
+	entries := parseTestSource(t, "class Account\n  def initialize\n    @balance = @opening = 0\n  end\nend\n")
+	checkEntries(t, entries, []entrySpec{
+		{"Account#@balance", "Account", "private", 0},
+		{"Account#@opening", "Account", "private", 0},
+	})
+	if opening := findEntry(t, entries, "Account#@opening"); opening.Line != 3 || opening.Character != 15 {
+		t.Errorf("Account#@opening at %d:%d, want 3:15", opening.Line, opening.Character)
+	}
+}
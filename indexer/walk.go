@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// walk visits the files and directories under a workspace folder like
+// filepath.Walk. With FollowSymlinks, symlinked directories and files are
+// visited too, under their real paths so they dedupe against the files they
+// point at. Every real directory is visited once, which ends symlink cycles.
+func (idx *Index) walk(root string, fn filepath.WalkFunc) error {
+	if !idx.options.FollowSymlinks {
+		return filepath.Walk(root, fn)
+	}
+
+	visited := make(map[string]bool)
+	pending := []string{root}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		stopped := false
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fn(path, info, err)
+			}
+
+			if info.Mode()&os.ModeSymlink != 0 {
+				realPath, evalErr := filepath.EvalSymlinks(path)
+				if evalErr != nil {
+					// Dangling links are not worth an index error
+					return nil
+				}
+				target, statErr := os.Stat(realPath)
+				if statErr != nil {
+					return fn(path, info, statErr)
+				}
+				if target.IsDir() {
+					pending = append(pending, realPath)
+					return nil
+				}
+				path, info = realPath, target
+			}
+
+			var realPath string
+			if info.IsDir() {
+				realPath, err = filepath.EvalSymlinks(path)
+				if err != nil {
+					return fn(path, info, err)
+				}
+				if visited[realPath] {
+					return filepath.SkipDir
+				}
+			}
+
+			result := fn(path, info, nil)
+			if result == filepath.SkipAll {
+				stopped = true
+			} else if result == nil && info.IsDir() {
+				visited[realPath] = true
+			}
+			return result
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollowSymlinksIndexesRealPathsAndEndsCycles(t *testing.T) {
+	shared := t.TempDir()
+	writeTestFiles(t, shared, map[string]string{"money.rb": "class Money\nend\n"})
+	sharedReal, err := filepath.EvalSymlinks(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"app/models/order.rb": "class Order\nend\n"})
+	// lib/shared points outside the workspace, app/models/loop back up at app
+	if err := os.MkdirAll(filepath.Join(root, "lib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(shared, filepath.Join(root, "lib", "shared")); err != nil {
+		t.Skipf("symlinks are not supported here: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "app"), filepath.Join(root, "app", "models", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewWithOptions(root, log.New(io.Discard, "", 0), Options{FollowSymlinks: true})
+	idx.BuildIndex(context.Background())
+
+	money := idx.Lookup("Money")
+	if len(money) != 1 || money[0].FilePath != filepath.Join(sharedReal, "money.rb") {
+		t.Errorf("Lookup(Money) = %+v, want one entry under the real path %s", money, sharedReal)
+	}
+	if orders := idx.Lookup("Order"); len(orders) != 1 {
+		t.Errorf("Lookup(Order) = %d entries, want 1 despite the loop back to app", len(orders))
+	}
+
+	idx = NewWithOptions(root, log.New(io.Discard, "", 0), Options{})
+	idx.BuildIndex(context.Background())
+	if money := idx.Lookup("Money"); len(money) != 0 {
+		t.Errorf("Lookup(Money) without FollowSymlinks = %+v, want nothing", money)
+	}
+}
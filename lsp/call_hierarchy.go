@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// HandlePrepareCallHierarchy handles textDocument/prepareCallHierarchy request,
+// offering the methods named at the cursor: the one defined there, or the one a
+// call reaches when its receiver's class can be told, or every method of that
+// name. A call on a constant, or on self without a receiver, reaches the
+// definition nearest in the class's ancestors, so methods of concerns and base
+// classes are found. The ancestors are only as accurate as the index: a module
+// prepended is searched as if included, and modules extended and methods defined
+// by metaprogramming are not seen, so a nearer definition may be missed. When no
+// ancestor defines the name, every method of that name is offered.
+func (s *Server) HandlePrepareCallHierarchy(params interface{}) interface{} {
+	s.Logger.Println("Processing prepare call hierarchy request")
+
+	name, ok := s.methodAtPosition(params)
+	if !ok {
+		return nil
+	}
+	idx := s.Indexer
+	uri, pos := extractTextDocumentPosition(params)
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+
+	methods := filterEntries(idx.LookupScoped(name, nestingOf(scope)), func(entry indexer.SymbolEntry) bool {
+		return entry.Type == indexer.SymbolMethod || entry.Type == indexer.SymbolSingletonMethod
+	})
+	methods = collapseModuleFunctions(methods)
+
+	if defined := filterEntries(methods, func(entry indexer.SymbolEntry) bool {
+		return entry.FilePath == uriToFilePath(uri) && entry.Line == pos.Line+1
+	}); len(defined) > 0 {
+		methods = defined
+	} else if owner := s.callReceiverClassAtPosition(params, scope); owner != "" {
+		if nearest := nearestAncestorDefinitions(idx, methods, owner); len(nearest) > 0 {
+			methods = nearest
+		}
+	}
+
+	var items []interface{}
+	for _, entry := range methods {
+		items = append(items, hierarchyItem(entry))
+	}
+	return items
+}
+
+// callReceiverClassAtPosition returns the class of the object a method call
+// under the cursor is sent to: the class of a constant receiver, the enclosing
+// class for a call without a receiver, "" when it cannot be told
+func (s *Server) callReceiverClassAtPosition(params interface{}, scope string) string {
+	if owner := s.methodOwnerAtPosition(params); owner != "" {
+		return owner
+	}
+
+	uri, pos := extractTextDocumentPosition(params)
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return ""
+	}
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if receiverBefore(doc.Source, pos.Line, token.StartCharacter) != "" {
+		return ""
+	}
+	return scope
+}
+
+// nearestAncestorDefinitions keeps the methods defined by the first of a
+// class's ancestors defining any of them, the one Ruby would call
+func nearestAncestorDefinitions(idx indexer.SymbolIndex, methods []indexer.SymbolEntry, class string) []indexer.SymbolEntry {
+	for _, ancestor := range idx.AncestorsOf(class) {
+		if defined := filterEntries(methods, func(entry indexer.SymbolEntry) bool {
+			return entry.Parent == ancestor
+		}); len(defined) > 0 {
+			return defined
+		}
+	}
+	return nil
+}
+
+// HandleIncomingCalls handles callHierarchy/incomingCalls request. Calls are found
+// by name like references, so a method sharing its name with one of an unrelated
+// class can gain callers that call the other; calls through a constant receiver
+// of the wrong class are dropped. Each caller is the method (or class body) around
+// the call sites.
+func (s *Server) HandleIncomingCalls(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing incoming calls request")
+
+	target, ok := s.callHierarchyTarget(params)
+	if !ok {
+		return []interface{}{}
+	}
+	idx := s.Indexer
+
+	var callers []indexer.SymbolEntry
+	fromRanges := make(map[string][]interface{})
+	for i, ref := range idx.MethodReferences(target.Name, s.openSources()) {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
+		}
+		if ref.Definition || (target.Parent != "" && !s.referenceMatchesClass(ref, target.Parent)) {
+			continue
+		}
+		caller, ok := idx.EnclosingDefinition(ref.FilePath, ref.Line)
+		if !ok {
+			continue
+		}
+
+		key := callHierarchyKey(caller)
+		if _, seen := fromRanges[key]; !seen {
+			callers = append(callers, caller)
+		}
+		fromRanges[key] = append(fromRanges[key], lineRange(ref.Line, ref.Character, ref.EndCharacter))
+	}
+
+	calls := []interface{}{}
+	for _, caller := range callers {
+		calls = append(calls, map[string]interface{}{
+			"from":       hierarchyItem(caller),
+			"fromRanges": fromRanges[callHierarchyKey(caller)],
+		})
+	}
+	return calls
+}
+
+// HandleOutgoingCalls handles callHierarchy/outgoingCalls request, resolving the
+// names called in the method's body to indexed methods. Without types, an implicit
+// self call resolves within the method's class hierarchy when it defines the name,
+// and a call on any other receiver than a constant reaches every method of the name.
+func (s *Server) HandleOutgoingCalls(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing outgoing calls request")
+
+	target, ok := s.callHierarchyTarget(params)
+	if !ok {
+		return []interface{}{}
+	}
+	idx := s.Indexer
+	source := s.openSources()[target.FilePath]
+
+	var callees []indexer.SymbolEntry
+	fromRanges := make(map[string][]interface{})
+	for i, call := range indexer.MethodCalls(target, source) {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
+		}
+		for _, callee := range s.resolveCall(idx, call, target.Parent) {
+			key := callHierarchyKey(callee)
+			if _, seen := fromRanges[key]; !seen {
+				callees = append(callees, callee)
+			}
+			fromRanges[key] = append(fromRanges[key], lineRange(call.Line, call.Character, call.EndCharacter))
+		}
+	}
+
+	calls := []interface{}{}
+	for _, callee := range callees {
+		calls = append(calls, map[string]interface{}{
+			"to":         hierarchyItem(callee),
+			"fromRanges": fromRanges[callHierarchyKey(callee)],
+		})
+	}
+	return calls
+}
+
+// resolveCall returns the indexed methods a call made from a class may reach
+func (s *Server) resolveCall(idx indexer.SymbolIndex, call indexer.MethodCall, class string) []indexer.SymbolEntry {
+	methods := collapseModuleFunctions(filterEntries(idx.Lookup(call.Name), func(entry indexer.SymbolEntry) bool {
+		return entry.Type == indexer.SymbolMethod || entry.Type == indexer.SymbolSingletonMethod
+	}))
+
+	owner := ""
+	switch {
+	case call.Receiver == "" || call.Receiver == "self":
+		owner = class
+	case isCapitalized(call.Receiver):
+		owner = idx.ResolveConstantPath(call.Receiver, class)
+	}
+	if owner != "" {
+		if members := filterEntries(methods, func(entry indexer.SymbolEntry) bool {
+			return isMemberOf(idx, entry, owner)
+		}); len(members) > 0 {
+			return members
+		}
+	}
+	return methods
+}
+
+// callHierarchyTarget finds the indexed definition of the item a call hierarchy
+// request is about
+func (s *Server) callHierarchyTarget(params interface{}) (indexer.SymbolEntry, bool) {
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return indexer.SymbolEntry{}, false
+	}
+
+	paramMap, ok := params.(map[string]interface{})
+	if !ok {
+		return indexer.SymbolEntry{}, false
+	}
+	item, ok := paramMap["item"].(map[string]interface{})
+	if !ok {
+		return indexer.SymbolEntry{}, false
+	}
+	name, _ := item["name"].(string)
+	uri, _ := item["uri"].(string)
+	line := -1
+	if selection, ok := item["selectionRange"].(map[string]interface{}); ok {
+		if start, ok := selection["start"].(map[string]interface{}); ok {
+			if startLine, ok := start["line"].(float64); ok {
+				line = int(startLine) + 1
+			}
+		}
+	}
+
+	for _, entry := range idx.GetFileSymbols(uriToFilePath(uri)) {
+		if entry.Name == name && entry.Line == line {
+			return entry, true
+		}
+	}
+	return indexer.SymbolEntry{}, false
+}
+
+// hierarchyItem builds an LSP CallHierarchyItem or TypeHierarchyItem for a definition
+func hierarchyItem(entry indexer.SymbolEntry) map[string]interface{} {
+	endLine := entry.EndLine
+	if endLine < entry.Line {
+		endLine = entry.Line
+	}
+	return map[string]interface{}{
+		"name":   entry.Name,
+		"kind":   indexer.SymbolKindToLSP(entry.Type),
+		"detail": entry.FullyQualifiedName,
+		"uri":    store.PathToURI(entry.FilePath),
+		"range": map[string]interface{}{
+			"start": map[string]interface{}{"line": entry.Line - 1, "character": 0},
+			"end":   map[string]interface{}{"line": endLine - 1, "character": entry.EndCharacter},
+		},
+		"selectionRange": lineRange(entry.Line, entry.Character, nameEndCharacter(entry)),
+	}
+}
+
+// callHierarchyKey identifies a definition when grouping call sites
+func callHierarchyKey(entry indexer.SymbolEntry) string {
+	return fmt.Sprintf("%s:%d:%s", entry.FilePath, entry.Line, entry.FullyQualifiedName)
+}
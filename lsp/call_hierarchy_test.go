@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Order#checkout calls total and charge; charge calls total and Payment.capture
+var callGraphFixture = map[string]string{
+	"app/models/order.rb":   "class Order\n  def checkout\n    total\n    charge\n  end\n\n  def total\n    items.sum\n  end\n\n  def charge\n    Payment.capture(total)\n  end\nend\n",
+	"app/models/payment.rb": "class Payment\n  def self.capture(amount)\n  end\nend\n",
+}
+
+type testCallHierarchyCall struct {
+	From       map[string]interface{} `json:"from"`
+	To         map[string]interface{} `json:"to"`
+	FromRanges []testRange            `json:"fromRanges"`
+}
+
+// prepareCallHierarchyItem returns the call hierarchy item of the method at a position
+func prepareCallHierarchyItem(t *testing.T, s *Server, name string, line, character int) map[string]interface{} {
+	t.Helper()
+	var items []map[string]interface{}
+	decode(t, s.HandlePrepareCallHierarchy(positionParams(name, line, character)), &items)
+	if len(items) != 1 {
+		t.Fatalf("prepareCallHierarchy at %s:%d:%d = %+v, want one item", name, line, character, items)
+	}
+	return items[0]
+}
+
+func TestIncomingCallsGroupCallSitesByCaller(t *testing.T) {
+	s := NewTestServer(callGraphFixture)
+	item := prepareCallHierarchyItem(t, s, "app/models/order.rb", 6, 7)
+
+	var calls []testCallHierarchyCall
+	decode(t, s.HandleIncomingCalls(1, map[string]interface{}{"item": item}), &calls)
+	got := make(map[string][]int)
+	for _, call := range calls {
+		for _, r := range call.FromRanges {
+			got[call.From["detail"].(string)] = append(got[call.From["detail"].(string)], r.Start.Line)
+		}
+	}
+	if want := map[string][]int{"Order#checkout": {2}, "Order#charge": {11}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("incoming calls of total = %v, want %v", got, want)
+	}
+}
+
+func TestOutgoingCallsResolveCalledMethods(t *testing.T) {
+	s := NewTestServer(callGraphFixture)
+
+	tests := []struct {
+		line int
+		want []string
+	}{
+		{1, []string{"Order#total", "Order#charge"}},
+		{10, []string{"Payment.capture", "Order#total"}},
+		{6, nil},
+	}
+	for _, test := range tests {
+		item := prepareCallHierarchyItem(t, s, "app/models/order.rb", test.line, 7)
+		var calls []testCallHierarchyCall
+		decode(t, s.HandleOutgoingCalls(1, map[string]interface{}{"item": item}), &calls)
+		var got []string
+		for _, call := range calls {
+			got = append(got, call.To["detail"].(string))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("outgoing calls of %s = %v, want %v", item["detail"], got, test.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package lsp
+
+import "testing"
+
+func TestCancelRequestKeysByRawID(t *testing.T) {
+	s := NewTestServer(nil)
+	for _, id := range []interface{}{"completion-1", "completion-2", 7, "7"} {
+		s.BeginRequest(id)
+	}
+
+	s.HandleCancelRequest(map[string]interface{}{"id": "completion-1"})
+	s.HandleCancelRequest(map[string]interface{}{"id": float64(7)})
+
+	tests := []struct {
+		id   interface{}
+		want bool
+	}{
+		{"completion-1", true},
+		{"completion-2", false},
+		// Numbers decoded from JSON are the IDs passed in-process as ints
+		{7, true},
+		{float64(7), true},
+		{"7", false},
+	}
+	for _, test := range tests {
+		if got := s.isCancelled(test.id); got != test.want {
+			t.Errorf("isCancelled(%#v) = %v, want %v", test.id, got, test.want)
+		}
+	}
+
+	// Cancelling one string ID ends that request's scans only
+	ctx, release := s.requestContext("completion-2")
+	defer release()
+	s.HandleCancelRequest(map[string]interface{}{"id": "completion-3"})
+	if ctx.Err() != nil {
+		t.Errorf("requestContext(completion-2) ended by cancelling another request: %v", ctx.Err())
+	}
+	s.HandleCancelRequest(map[string]interface{}{"id": "completion-2"})
+	if ctx.Err() == nil {
+		t.Error("requestContext(completion-2) still running after its cancellation")
+	}
+}
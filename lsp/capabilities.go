@@ -0,0 +1,74 @@
+package lsp
+
+// providerGate ties a server capability to the client capability declaring
+// support for it, and to the enabledFeatures name users turn it off with
+type providerGate struct {
+	section string // textDocument or workspace
+	client  string // client capability within the section
+	feature string // "" when it cannot be turned off
+}
+
+// Gates of the providers advertised at initialization, by server capability
+var providerGates = map[string]providerGate{
+	"completionProvider":         {"textDocument", "completion", "completion"},
+	"signatureHelpProvider":      {"textDocument", "signatureHelp", "signatureHelp"},
+	"hoverProvider":              {"textDocument", "hover", "hover"},
+	"callHierarchyProvider":      {"textDocument", "callHierarchy", "callHierarchy"},
+	"typeHierarchyProvider":      {"textDocument", "typeHierarchy", "typeHierarchy"},
+	"selectionRangeProvider":     {"textDocument", "selectionRange", "selectionRanges"},
+	"linkedEditingRangeProvider": {"textDocument", "linkedEditingRange", "linkedEditing"},
+	"monikerProvider":            {"textDocument", "moniker", "moniker"},
+	"definitionProvider":         {"textDocument", "definition", "definition"},
+	"typeDefinitionProvider":     {"textDocument", "typeDefinition", "typeDefinition"},
+	"codeLensProvider":           {"textDocument", "codeLens", "codeLens"},
+	"documentSymbolProvider":     {"textDocument", "documentSymbol", "documentSymbols"},
+	"workspaceSymbolProvider":    {"workspace", "symbol", "workspaceSymbol"},
+	"documentFormattingProvider": {"textDocument", "formatting", "formatting"},
+	"documentHighlightProvider":  {"textDocument", "documentHighlight", "documentHighlights"},
+	"documentLinkProvider":       {"textDocument", "documentLink", "documentLink"},
+	"codeActionProvider":         {"textDocument", "codeAction", "codeActions"},
+	"executeCommandProvider":     {"workspace", "executeCommand", ""},
+	"foldingRangeProvider":       {"textDocument", "foldingRange", "foldingRanges"},
+	"renameProvider":             {"textDocument", "rename", "rename"},
+	"referencesProvider":         {"textDocument", "references", "references"},
+	"workspace":                  {"workspace", "workspaceFolders", ""},
+}
+
+// gateProviders removes from the server capabilities the providers the client
+// did not declare support for and those turned off through enabledFeatures. A
+// client leaving out a whole section (textDocument, workspace) says nothing about
+// what it supports, so the providers of that section are kept.
+func (s *Server) gateProviders(capabilities map[string]interface{}) {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	for provider, gate := range providerGates {
+		if section, declared := s.GlobalState.ClientCapabilities[gate.section].(map[string]interface{}); declared {
+			if supported, ok := section[gate.client]; !ok || supported == false {
+				delete(capabilities, provider)
+				continue
+			}
+		}
+		if enabled, configured := s.GlobalState.EnabledFeatures[gate.feature]; gate.feature != "" && configured && !enabled {
+			delete(capabilities, provider)
+		}
+	}
+}
+
+// clientCapability returns the client capability found under a path of keys
+// (textDocument, completion, completionItem, labelDetailsSupport), nil when the
+// client did not declare it
+func (s *Server) clientCapability(keys ...string) interface{} {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	var value interface{} = s.GlobalState.ClientCapabilities
+	for _, key := range keys {
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = section[key]
+	}
+	return value
+}
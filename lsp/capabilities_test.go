@@ -0,0 +1,72 @@
+package lsp
+
+import "testing"
+
+func TestInitializeAdvertisesOnlySupportedProviders(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  map[string]interface{}
+		absent  []string
+		present []string
+	}{
+		{
+			name: "client omitting hover",
+			params: map[string]interface{}{
+				"capabilities": map[string]interface{}{
+					"textDocument": map[string]interface{}{
+						"completion": map[string]interface{}{},
+						"definition": map[string]interface{}{},
+					},
+				},
+			},
+			absent:  []string{"hoverProvider", "renameProvider"},
+			present: []string{"completionProvider", "definitionProvider", "workspaceSymbolProvider"},
+		},
+		{
+			name:    "client declaring no capabilities",
+			params:  map[string]interface{}{},
+			present: []string{"hoverProvider", "completionProvider", "workspaceSymbolProvider"},
+		},
+		{
+			name: "features turned off by the user",
+			params: map[string]interface{}{
+				"initializationOptions": map[string]interface{}{
+					"enabledFeatures": map[string]interface{}{"hover": false, "workspaceSymbol": false, "definition": true},
+				},
+			},
+			absent:  []string{"hoverProvider", "workspaceSymbolProvider"},
+			present: []string{"definitionProvider", "completionProvider"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewTestServer(nil)
+			result := s.HandleInitialize(test.params).(map[string]interface{})
+			capabilities := result["capabilities"].(map[string]interface{})
+			for _, provider := range test.absent {
+				if _, ok := capabilities[provider]; ok {
+					t.Errorf("%s advertised, want it absent", provider)
+				}
+			}
+			for _, provider := range test.present {
+				if _, ok := capabilities[provider]; !ok {
+					t.Errorf("%s not advertised", provider)
+				}
+			}
+			if _, ok := capabilities["textDocumentSync"]; !ok {
+				t.Error("textDocumentSync not advertised, want it whatever the client declares")
+			}
+		})
+	}
+}
+
+func TestInitializeStoresClientCapabilities(t *testing.T) {
+	s := NewTestServer(nil)
+	textDocument := map[string]interface{}{"hover": map[string]interface{}{}}
+	s.HandleInitialize(map[string]interface{}{
+		"capabilities": map[string]interface{}{"textDocument": textDocument},
+	})
+	if _, ok := s.GlobalState.ClientCapabilities["textDocument"]; !ok {
+		t.Errorf("ClientCapabilities = %v, want the textDocument section of the client", s.GlobalState.ClientCapabilities)
+	}
+}
@@ -0,0 +1,341 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/documents"
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// A require_relative at the top of a file
+var requireRelativePattern = regexp.MustCompile(`^require_relative\s+["']([^"']+)["']`)
+
+// A magic comment such as `# frozen_string_literal: true` or `# -*- coding: utf-8 -*-`
+var magicCommentPattern = regexp.MustCompile(`^#\s*(?:-\*-.*?)?\b(frozen_string_literal|encoding|coding|warn_indent|warn_past_scope|shareable_constant_value)\s*:`)
+
+// HandleCodeAction handles textDocument/codeAction request
+func (s *Server) HandleCodeAction(params interface{}) interface{} {
+	s.Logger.Println("Processing code action request")
+
+	actions := []interface{}{}
+
+	uri := extractTextDocumentURI(params)
+	if uri == "" {
+		return actions
+	}
+
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return actions
+	}
+
+	if !hasMagicComment(doc.Source, "frozen_string_literal") {
+		line := magicCommentInsertLine(doc.Source)
+		position := map[string]interface{}{"line": line, "character": 0}
+		actions = append(actions, map[string]interface{}{
+			"title": "Add frozen_string_literal magic comment",
+			"kind":  "quickfix",
+			"edit": map[string]interface{}{
+				"changes": map[string]interface{}{
+					uri: []interface{}{
+						map[string]interface{}{
+							"range":   map[string]interface{}{"start": position, "end": position},
+							"newText": "# frozen_string_literal: true\n",
+						},
+					},
+				},
+			},
+		})
+	}
+
+	if action, ok := s.createMethodAction(uri, doc.Source, codeActionStart(params)); ok {
+		actions = append(actions, action)
+	}
+	actions = append(actions, s.requireRelativeActions(uri, doc.Source, codeActionStart(params))...)
+
+	return actions
+}
+
+// codeActionStart returns the start of the range a code action request is for
+func codeActionStart(params interface{}) documents.Position {
+	var pos documents.Position
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if rangeMap, ok := paramMap["range"].(map[string]interface{}); ok {
+			if start, ok := rangeMap["start"].(map[string]interface{}); ok {
+				line, _ := start["line"].(float64)
+				character, _ := start["character"].(float64)
+				pos = documents.Position{Line: int(line), Character: int(character)}
+			}
+		}
+	}
+	return pos
+}
+
+// createMethodAction offers to define a method called at the cursor that no
+// indexed definition answers to. Only calls on self are considered, written with
+// parentheses or an explicit self receiver, so local variables are never taken
+// for calls. The stub goes before the end of the enclosing class or module and
+// takes one positional parameter per argument of the call. Within a singleton
+// method self is the class, so the stub defines a singleton method too.
+func (s *Server) createMethodAction(uri string, source string, pos documents.Position) (map[string]interface{}, bool) {
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return nil, false
+	}
+
+	token := indexer.GetTokenAtPosition(source, pos.Line, pos.Character)
+	if token.Kind != indexer.TokenIdentifier || !methodNamePattern.MatchString(token.Text) {
+		return nil, false
+	}
+	for _, entry := range idx.Lookup(token.Text) {
+		switch entry.Type {
+		case indexer.SymbolMethod, indexer.SymbolSingletonMethod, indexer.SymbolAttrAccessor,
+			indexer.SymbolAssociation, indexer.SymbolScope, indexer.SymbolRoute:
+			return nil, false
+		}
+	}
+
+	lines := strings.Split(source, "\n")
+	runes := []rune(lines[pos.Line])
+	if token.EndCharacter > len(runes) {
+		return nil, false
+	}
+	receiver := receiverBefore(source, pos.Line, token.StartCharacter)
+	args, called := callArgumentCount(string(runes[token.EndCharacter:]))
+	if (receiver != "" && receiver != "self") || (receiver == "" && !called) {
+		return nil, false
+	}
+
+	// The innermost class or module around the call, which must be closed to insert into
+	filePath := uriToFilePath(uri)
+	var owner indexer.SymbolEntry
+	for _, entry := range idx.GetFileSymbols(filePath) {
+		if (entry.Type == indexer.SymbolClass || entry.Type == indexer.SymbolModule) &&
+			entry.Line <= pos.Line+1 && pos.Line+1 <= entry.EndLine && entry.Line > owner.Line {
+			owner = entry
+		}
+	}
+	if owner.EndLine == 0 || owner.EndLine > len(lines) {
+		return nil, false
+	}
+
+	ownerLine := lines[owner.Line-1]
+	indent := ownerLine[:len(ownerLine)-len(strings.TrimLeft(ownerLine, " \t"))] + "  "
+
+	signature := token.Text
+	if caller, ok := idx.EnclosingDefinition(filePath, pos.Line+1); ok && caller.Type == indexer.SymbolSingletonMethod {
+		signature = "self." + signature
+	}
+	if args > 0 {
+		params := make([]string, args)
+		for i := range params {
+			params[i] = fmt.Sprintf("arg%d", i+1)
+		}
+		signature += "(" + strings.Join(params, ", ") + ")"
+	}
+	stub := fmt.Sprintf("\n%sdef %s\n%send\n", indent, signature, indent)
+
+	position := map[string]interface{}{"line": owner.EndLine - 1, "character": 0}
+	return map[string]interface{}{
+		"title": fmt.Sprintf("Create method `%s`", token.Text),
+		"kind":  "refactor",
+		"edit": map[string]interface{}{
+			"changes": map[string]interface{}{
+				uri: []interface{}{
+					map[string]interface{}{
+						"range":   map[string]interface{}{"start": position, "end": position},
+						"newText": stub,
+					},
+				},
+			},
+		},
+	}, true
+}
+
+// requireRelativeActions offers to require_relative the file defining the constant
+// at the cursor when it is defined in other workspace files only, one action per
+// file when there are several. Gem constants are loaded by Bundler, not by path.
+func (s *Server) requireRelativeActions(uri string, source string, pos documents.Position) []interface{} {
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return nil
+	}
+
+	token := indexer.GetTokenAtPosition(source, pos.Line, pos.Character)
+	if token.Kind != indexer.TokenConstant {
+		return nil
+	}
+	filePath := uriToFilePath(uri)
+	entries := idx.LookupInScope(token.Qualified(), idx.EnclosingScope(filePath, pos.Line+1))
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.FilePath == filePath {
+			return nil
+		}
+		if entry.Gem != "" || seen[entry.FilePath] {
+			continue
+		}
+		seen[entry.FilePath] = true
+
+		rel, err := filepath.Rel(filepath.Dir(filePath), entry.FilePath)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, strings.TrimSuffix(filepath.ToSlash(rel), ".rb"))
+	}
+
+	requires := topRequires(source)
+	var actions []interface{}
+	for _, path := range paths {
+		if _, required := requires[path]; required {
+			return nil
+		}
+		line, text := requireInsertion(source, requires, path)
+		position := map[string]interface{}{"line": line, "character": 0}
+		actions = append(actions, map[string]interface{}{
+			"title": fmt.Sprintf("Add require_relative \"%s\"", path),
+			"kind":  "quickfix",
+			"edit": map[string]interface{}{
+				"changes": map[string]interface{}{
+					uri: []interface{}{
+						map[string]interface{}{
+							"range":   map[string]interface{}{"start": position, "end": position},
+							"newText": text,
+						},
+					},
+				},
+			},
+		})
+	}
+	return actions
+}
+
+// topRequires returns the paths of the require_relative lines heading a file,
+// before its first line of other code, by their 0-based line
+func topRequires(source string) map[string]int {
+	requires := make(map[string]int)
+	for i, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if matches := requireRelativePattern.FindStringSubmatch(trimmed); matches != nil {
+			requires[matches[1]] = i
+			continue
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "require ") {
+			break
+		}
+	}
+	return requires
+}
+
+// requireInsertion returns where a require_relative of path goes and the text to
+// insert: in alphabetical order among the existing ones, or else after the magic
+// comments, set apart from the code by a blank line
+func requireInsertion(source string, requires map[string]int, path string) (int, string) {
+	text := fmt.Sprintf("require_relative \"%s\"\n", path)
+
+	if len(requires) > 0 {
+		line, last := -1, -1
+		for required, requireLine := range requires {
+			if required > path && (line < 0 || requireLine < line) {
+				line = requireLine
+			}
+			if requireLine > last {
+				last = requireLine
+			}
+		}
+		if line < 0 {
+			line = last + 1
+		}
+		return line, text
+	}
+
+	lines := strings.Split(source, "\n")
+	line := magicCommentInsertLine(source)
+	if line > 0 && line < len(lines) && strings.TrimSpace(lines[line]) == "" {
+		line++
+	}
+	if line < len(lines) && strings.TrimSpace(lines[line]) != "" {
+		text += "\n"
+	}
+	return line, text
+}
+
+// callArgumentCount counts the arguments of a parenthesized call given the text
+// after the method name, skipping nested brackets and string literals. It
+// reports false when the name is not followed by an argument list.
+func callArgumentCount(after string) (int, bool) {
+	if !strings.HasPrefix(after, "(") {
+		return 0, false
+	}
+
+	depth := 0
+	args := 0
+	var quote rune
+	for _, c := range after {
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		// The first character inside the parentheses starts the first argument
+		if depth == 1 && args == 0 && c != ' ' && c != '\t' && c != ')' {
+			args = 1
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return args, true
+			}
+		case ',':
+			if depth == 1 {
+				args++
+			}
+		}
+	}
+	// An argument list running onto later lines counts what is on this one
+	return args, true
+}
+
+// magicCommentInsertLine returns the 0-based line where a new magic comment goes:
+// after a shebang and any magic comments already at the top of the file, since
+// Ruby only honors them before the first line of code
+func magicCommentInsertLine(source string) int {
+	lines := strings.Split(source, "\n")
+
+	line := 0
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+		line = 1
+	}
+	for line < len(lines) && magicCommentPattern.MatchString(strings.TrimSpace(lines[line])) {
+		line++
+	}
+	return line
+}
+
+// hasMagicComment reports whether the leading comments of a file set the named magic comment
+func hasMagicComment(source string, name string) bool {
+	for i, line := range strings.Split(source, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if i == 0 && strings.HasPrefix(trimmed, "#!") {
+			continue
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return false
+		}
+		if matches := magicCommentPattern.FindStringSubmatch(trimmed); matches != nil && matches[1] == name {
+			return true
+		}
+	}
+	return false
+}
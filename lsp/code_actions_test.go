@@ -0,0 +1,58 @@
+package lsp
+
+import "testing"
+
+// codeActionParams asks for the code actions of a cursor position in a test server file
+func codeActionParams(name string, line, character int) map[string]interface{} {
+	params := documentParams(name)
+	position := map[string]interface{}{"line": float64(line), "character": float64(character)}
+	params["range"] = map[string]interface{}{"start": position, "end": position}
+	return params
+}
+
+func TestCreateMethodStub(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/services/importer.rb": `class Importer
+  def run(rows)
+    normalize(rows, strict: true)
+  end
+
+  def self.call(path)
+    self.load_rows
+  end
+end
+`,
+	})
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      string
+	}{
+		{"instance method called with arguments", 2, 6, "\n  def normalize(arg1, arg2)\n  end\n"},
+		// self is the class within a singleton method
+		{"called from a singleton method", 6, 10, "\n  def self.load_rows\n  end\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actions []struct {
+				Title string            `json:"title"`
+				Edit  testWorkspaceEdit `json:"edit"`
+			}
+			decode(t, s.HandleCodeAction(codeActionParams("app/services/importer.rb", test.line, test.character)), &actions)
+
+			for _, action := range actions {
+				edits := action.Edit.Changes[testFileURI("app/services/importer.rb")]
+				if len(edits) != 1 || edits[0].NewText != test.want {
+					continue
+				}
+				if start := edits[0].Range.Start; start.Line != 8 || start.Character != 0 {
+					t.Errorf("stub inserted at %d:%d, want before the end of the class at 8:0", start.Line, start.Character)
+				}
+				return
+			}
+			t.Errorf("code actions = %+v, want a stub %q", actions, test.want)
+		})
+	}
+}
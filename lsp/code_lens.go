@@ -0,0 +1,49 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// HandleCodeLens handles textDocument/codeLens request. Model classes get a lens
+// listing the migrations of their table.
+func (s *Server) HandleCodeLens(params interface{}) interface{} {
+	s.Logger.Println("Processing code lens request")
+
+	lenses := []interface{}{}
+
+	idx := s.Indexer
+	uri := extractTextDocumentURI(params)
+	if idx == nil || !idx.IsReady() || uri == "" {
+		return lenses
+	}
+
+	for _, entry := range idx.GetFileSymbols(uriToFilePath(uri)) {
+		if entry.Type != indexer.SymbolClass {
+			continue
+		}
+		migrations := idx.Migrations(entry.FullyQualifiedName)
+		if len(migrations) == 0 {
+			continue
+		}
+
+		title := fmt.Sprintf("%d migrations", len(migrations))
+		if len(migrations) == 1 {
+			title = "1 migration"
+		}
+		position := map[string]interface{}{"line": entry.Line - 1, "character": entry.Character}
+
+		// editor.action.showReferences is the peek command VS Code and most clients provide
+		lenses = append(lenses, map[string]interface{}{
+			"range": map[string]interface{}{"start": position, "end": position},
+			"command": map[string]interface{}{
+				"title":     title,
+				"command":   "editor.action.showReferences",
+				"arguments": []interface{}{uri, position, migrationLocations(migrations)},
+			},
+		})
+	}
+
+	return lenses
+}
@@ -0,0 +1,62 @@
+package lsp
+
+// Commands run through workspace/executeCommand
+const (
+	commandIndexStats     = "rubyLsp.indexStats"
+	commandToggleTestFile = "rubyLsp.toggleTestFile"
+)
+
+// HandleExecuteCommand handles workspace/executeCommand request
+func (s *Server) HandleExecuteCommand(params interface{}) interface{} {
+	command := ""
+	var arguments []interface{}
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		command, _ = paramMap["command"].(string)
+		arguments, _ = paramMap["arguments"].([]interface{})
+	}
+	s.Logger.Printf("Processing execute command request: %s", command)
+
+	switch command {
+	case commandIndexStats:
+		return s.indexStats()
+	case commandToggleTestFile:
+		// The client opens the returned URI; null when there is no counterpart
+		if len(arguments) == 0 {
+			return nil
+		}
+		uri, _ := arguments[0].(string)
+		if counterpart := s.toggleTestFile(uri); counterpart != "" {
+			return map[string]interface{}{"uri": counterpart}
+		}
+	}
+	return nil
+}
+
+// indexStats reports the size of the index and the files it could not read
+func (s *Server) indexStats() interface{} {
+	idx := s.Indexer
+	if idx == nil {
+		return nil
+	}
+
+	stats := idx.Stats()
+	errors := make([]interface{}, 0, len(stats.Errors))
+	for _, indexError := range stats.Errors {
+		errors = append(errors, map[string]interface{}{
+			"path":  indexError.Path,
+			"error": indexError.Err.Error(),
+		})
+	}
+
+	return map[string]interface{}{
+		"ready":        idx.IsReady(),
+		"mode":         idx.Mode(),
+		"files":        stats.Files,
+		"symbols":      stats.Symbols,
+		"maxSymbols":   stats.MaxSymbols,
+		"skippedFiles": stats.SkippedFiles,
+		"limitReached": stats.LimitReached,
+		"failedFiles":  len(stats.Errors),
+		"errors":       errors,
+	}
+}
@@ -0,0 +1,527 @@
+package lsp
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/documents"
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// LSP CompletionTriggerKind values
+const (
+	completionTriggerInvoked       = 1
+	completionTriggerCharacter     = 2
+	completionTriggerForIncomplete = 3
+)
+
+// LSP CompletionItemKind values not derived from an index symbol type
+const (
+	completionKindText    = 1  // words of the current buffer
+	completionKindField   = 5  // database columns
+	completionKindModule  = 9  // gems named by require
+	completionKindKeyword = 14 // language keywords
+	completionKindFile    = 17 // files named by require and require_relative
+	completionKindFolder  = 19 // directories on the way to them
+)
+
+// Words of the current buffer offered per completion, so large files stay cheap
+const maxBufferWords = 50
+
+// Identifiers written in a buffer, with the ? or ! of predicate and bang methods
+var bufferWordPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*[?!]?`)
+
+// Ruby keywords offered while typing outside method-call and constant contexts
+var rubyKeywords = []string{
+	"__ENCODING__", "__FILE__", "__LINE__", "__method__", "alias", "and", "begin", "break",
+	"case", "class", "def", "defined?", "do", "else", "elsif", "end", "ensure", "extend",
+	"false", "for", "if", "in", "include", "module", "next", "nil", "not", "or", "prepend",
+	"private", "protected", "public", "raise", "redo", "require", "require_relative",
+	"rescue", "retry", "return", "self", "super", "then", "true", "undef", "unless",
+	"until", "when", "while", "yield",
+}
+
+// completionMode selects which candidates a completion request offers
+type completionMode int
+
+const (
+	completionSymbols           completionMode = iota // plain typing: prefix search over every symbol
+	completionMethods                                 // after "." on a receiver
+	completionInstanceVariables                       // after "@"
+	completionClassVariables                          // after "@@"
+	completionNamespace                               // after "::", members of the namespace
+	completionRequirePath                             // inside the string of a require, require_relative or load
+	completionNone                                    // nothing to offer, e.g. a lone ":" starting a symbol
+)
+
+// completionContext describes what the user is completing at the cursor
+type completionContext struct {
+	mode             completionMode
+	triggerKind      int
+	triggerCharacter string
+	prefix           string // partially typed name before the cursor (includes @ or @@ for variables, the whole path in a require)
+	qualifier        string // receiver before "." or namespace before "::", or the require method
+	receiverClass    string // class the receiver was resolved to, "" when unknown
+	forwardedClass   string // class the member class forwards missing methods to, "" for none
+
+	// Done when the request is cancelled or runs out of time, stopping index scans
+	search context.Context
+
+	// With require-aware completion, whether a file is required by the current
+	// one or shares its Rails subtree; nil otherwise
+	reachable func(path string) bool
+}
+
+// memberClass returns the class whose members complete the name: the receiver's,
+// or the enclosing class's when there is no receiver
+func (ctx completionContext) memberClass(scope string) string {
+	if ctx.receiverClass == "" && ctx.qualifier == "" {
+		return scope
+	}
+	return ctx.receiverClass
+}
+
+// The start of a method body, bounding the search for receiver assignments
+var methodStartPattern = regexp.MustCompile(`^\s*def\b`)
+
+// parseCompletionContext reads the completion context from params and the text
+// before the cursor. A trigger character decides the mode directly; when typing
+// continues after it (Invoked/Incomplete), the mode is inferred from the line.
+func parseCompletionContext(params interface{}, source string, pos documents.Position) completionContext {
+	ctx := completionContext{triggerKind: completionTriggerInvoked, search: context.Background()}
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if context, ok := paramMap["context"].(map[string]interface{}); ok {
+			if kind, ok := context["triggerKind"].(float64); ok {
+				ctx.triggerKind = int(kind)
+			}
+			ctx.triggerCharacter, _ = context["triggerCharacter"].(string)
+		}
+	}
+
+	lines := strings.Split(source, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		ctx.mode = completionNone
+		return ctx
+	}
+	runes := []rune(strings.TrimSuffix(lines[pos.Line], "\r"))
+	if pos.Character < len(runes) {
+		runes = runes[:pos.Character]
+	}
+	before := string(runes)
+
+	// Paths are completed whatever the trigger, even "." in "./" or "../"
+	if matches := requirePrefixPattern.FindStringSubmatch(before); matches != nil {
+		ctx.mode = completionRequirePath
+		ctx.qualifier = matches[1]
+		ctx.prefix = matches[2]
+		return ctx
+	}
+
+	// The partially typed name ends at the cursor, possibly with the ? or ! of a
+	// predicate or bang method (valid?, save!)
+	start := len(before)
+	if start > 1 && (before[start-1] == '?' || before[start-1] == '!') && isCompletionWordByte(before[start-2]) {
+		start--
+	}
+	for start > 0 && isCompletionWordByte(before[start-1]) {
+		start--
+	}
+	ctx.prefix = before[start:]
+	rest := before[:start]
+
+	if ctx.triggerKind == completionTriggerCharacter {
+		switch ctx.triggerCharacter {
+		case ".":
+			ctx.mode = completionMethods
+			ctx.qualifier = trailingExpression(strings.TrimSuffix(rest, "."), false)
+		case "@":
+			ctx.mode = completionInstanceVariables
+			ctx.prefix = "@" + ctx.prefix
+			if strings.HasSuffix(rest, "@@") {
+				ctx.mode = completionClassVariables
+				ctx.prefix = "@" + ctx.prefix
+			}
+		case ":":
+			// A single colon starts a symbol literal; only "::" lists namespace members
+			ctx.mode = completionNone
+			if strings.HasSuffix(rest, "::") {
+				ctx.mode = completionNamespace
+				ctx.qualifier = trailingExpression(strings.TrimSuffix(rest, "::"), true)
+			}
+		default:
+			ctx.mode = completionSymbols
+		}
+	} else {
+		ctx.mode = inferCompletionMode(rest)
+		switch ctx.mode {
+		case completionInstanceVariables:
+			ctx.prefix = "@" + ctx.prefix
+		case completionClassVariables:
+			ctx.prefix = "@@" + ctx.prefix
+		case completionNamespace:
+			ctx.qualifier = trailingExpression(strings.TrimSuffix(rest, "::"), true)
+		case completionMethods:
+			ctx.qualifier = trailingExpression(strings.TrimSuffix(rest, "."), false)
+		}
+	}
+
+	// Namespaces need a constant before "::"
+	if ctx.mode == completionNamespace && !isCapitalized(classNameOnlyOf(ctx.qualifier)) {
+		ctx.mode = completionNone
+	}
+
+	return ctx
+}
+
+// inferCompletionMode determines the mode from the text preceding the typed name,
+// for requests made while typing past a trigger character
+func inferCompletionMode(rest string) completionMode {
+	switch {
+	case strings.HasSuffix(rest, "@@"):
+		return completionClassVariables
+	case strings.HasSuffix(rest, "@"):
+		return completionInstanceVariables
+	case strings.HasSuffix(rest, "::"):
+		return completionNamespace
+	case strings.HasSuffix(rest, ".") && !strings.HasSuffix(rest, ".."):
+		return completionMethods
+	case strings.HasSuffix(rest, ":"):
+		return completionNone
+	}
+	return completionSymbols
+}
+
+// trailingExpression returns the receiver or constant path ending at the end of text
+func trailingExpression(text string, constantPath bool) string {
+	start := len(text)
+	for start > 0 {
+		c := text[start-1]
+		if isCompletionWordByte(c) || (!constantPath && (c == '@' || c == '?' || c == '!')) {
+			start--
+			continue
+		}
+		if constantPath && c == ':' && start >= 2 && text[start-2] == ':' {
+			start -= 2
+			continue
+		}
+		break
+	}
+	return text[start:]
+}
+
+func isCompletionWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// classNameOnlyOf returns the last segment of a constant path
+func classNameOnlyOf(path string) string {
+	if i := strings.LastIndex(path, "::"); i >= 0 {
+		return path[i+2:]
+	}
+	return path
+}
+
+// resolveReceiverClass guesses the class of a receiver written on a line:
+// a constant is itself, self is the enclosing class, and a variable takes the class
+// of its latest `receiver = Model...` assignment in the current method, falling back
+// to the Rails naming convention (user -> User)
+func resolveReceiverClass(idx indexer.SymbolIndex, source string, line int, receiver string, scope string) string {
+	switch {
+	case receiver == "":
+		return ""
+	case receiver == "self":
+		return scope
+	case isCapitalized(receiver):
+		return scopedConstant(idx, receiver, scope)
+	}
+
+	assignment, err := regexp.Compile(`(?:^|[^\w@])` + regexp.QuoteMeta(receiver) + `\s*=\s*(?:::)?([A-Z][\w:]*)`)
+	if err != nil {
+		return ""
+	}
+
+	lines := strings.Split(source, "\n")
+	if line >= len(lines) {
+		line = len(lines) - 1
+	}
+	for i := line; i >= 0; i-- {
+		if matches := assignment.FindStringSubmatch(lines[i]); matches != nil {
+			if class := scopedConstant(idx, matches[1], scope); class != "" {
+				return class
+			}
+		}
+		if methodStartPattern.MatchString(lines[i]) {
+			break
+		}
+	}
+
+	return scopedConstant(idx, capitalize(strings.TrimLeft(receiver, "@")), scope)
+}
+
+// scopedConstant resolves a constant written within a scope to the fully
+// qualified name of the class, module or constant it refers to, "" if none
+func scopedConstant(idx indexer.SymbolIndex, name string, scope string) string {
+	for _, entry := range idx.LookupScoped(name, nestingOf(scope)) {
+		switch entry.Type {
+		case indexer.SymbolClass, indexer.SymbolModule, indexer.SymbolConstant:
+			return entry.FullyQualifiedName
+		}
+	}
+	return ""
+}
+
+// isMemberOf reports whether an entry is defined in a class, one of its superclasses
+// or a module any of them mixes in, so the members of a model include its concerns'
+func isMemberOf(idx indexer.SymbolIndex, entry indexer.SymbolEntry, class string) bool {
+	if class == "" {
+		return false
+	}
+	for _, ancestor := range append([]string{class}, idx.SuperclassChain(class)...) {
+		if entry.Parent == ancestor {
+			return true
+		}
+		for _, mixin := range idx.Mixins(ancestor) {
+			if entry.Parent == mixin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwardedMethods narrows same-named methods to those of the class a receiver
+// forwards missing methods to (delegate_missing_to), when the receiver's own
+// class does not define the method. Otherwise the methods are kept as they are.
+func forwardedMethods(idx indexer.SymbolIndex, methods []indexer.SymbolEntry, source string, line int, receiver string, scope string) []indexer.SymbolEntry {
+	if receiver == "" {
+		receiver = "self"
+	}
+	class := resolveReceiverClass(idx, source, line, receiver, scope)
+	if class == "" {
+		return methods
+	}
+	for _, entry := range methods {
+		if isMemberOf(idx, entry, class) {
+			return methods
+		}
+	}
+
+	forwarded := idx.ForwardedClass(class)
+	if members := filterEntries(methods, func(entry indexer.SymbolEntry) bool {
+		return isMemberOf(idx, entry, forwarded)
+	}); len(members) > 0 {
+		return members
+	}
+	return methods
+}
+
+// HandleCompletionResolve handles completionItem/resolve request, adding the
+// full doc comment of the item's definition, which is too slow to read for
+// every item of a completion list
+func (s *Server) HandleCompletionResolve(params interface{}) interface{} {
+	item, ok := params.(map[string]interface{})
+	if !ok {
+		return params
+	}
+	data, ok := item["data"].(map[string]interface{})
+	if !ok {
+		return item
+	}
+	filePath, _ := data["filePath"].(string)
+	line, _ := data["line"].(float64)
+	if filePath == "" {
+		return item
+	}
+
+	if comment := indexer.ParseDocComment(indexer.ReadDocComment(filePath, int(line))); !comment.IsEmpty() {
+		item["documentation"] = map[string]interface{}{
+			"kind":  "markdown",
+			"value": formatDocComment(comment),
+		}
+	}
+	return item
+}
+
+// completionRank orders candidates by proximity to the cursor: members of the receiver's
+// class, or of the enclosing class when there is no receiver, and of the class it
+// forwards missing methods to rank 0; symbols defined in the same file rank 1;
+// everything else ranks 2, or 3 when require-aware completion finds the file
+// unreachable from the current one
+func completionRank(idx indexer.SymbolIndex, entry indexer.SymbolEntry, ctx completionContext, scope string, filePath string) int {
+	switch {
+	case isMemberOf(idx, entry, ctx.memberClass(scope)) || isMemberOf(idx, entry, ctx.forwardedClass):
+		return 0
+	case entry.FilePath == filePath:
+		return 1
+	case ctx.reachable != nil && !ctx.reachable(entry.FilePath):
+		return 3
+	}
+	return 2
+}
+
+// rankedEntry is a completion candidate with its completionRank
+type rankedEntry struct {
+	entry indexer.SymbolEntry
+	rank  int
+}
+
+// completionRanks is the number of completionRank values
+const completionRanks = 4
+
+// rankCandidates orders candidates by completionRank, keeping their order within
+// a rank, and keeps the best-ranked of each label. At most limit are returned:
+// once limit labels rank 0 no later candidate can displace them, so the rest are
+// neither ranked nor collected.
+func rankCandidates(idx indexer.SymbolIndex, entries []indexer.SymbolEntry, ctx completionContext, scope string, filePath string, limit int) []rankedEntry {
+	var buckets [completionRanks][]rankedEntry
+	bestRank := make(map[string]int)
+	for _, entry := range entries {
+		if len(buckets[0]) >= limit {
+			break
+		}
+		rank := completionRank(idx, entry, ctx, scope, filePath)
+		if best, seen := bestRank[entry.Name]; seen && best <= rank {
+			continue
+		}
+		bestRank[entry.Name] = rank
+		buckets[rank] = append(buckets[rank], rankedEntry{entry: entry, rank: rank})
+	}
+
+	var ranked []rankedEntry
+	for _, bucket := range buckets {
+		for _, candidate := range bucket {
+			if len(ranked) >= limit {
+				return ranked
+			}
+			// A label found again at a better rank is listed there instead
+			if bestRank[candidate.entry.Name] == candidate.rank {
+				ranked = append(ranked, candidate)
+			}
+		}
+	}
+	return ranked
+}
+
+// completionCandidates returns the index entries offered for a completion context
+func completionCandidates(idx indexer.SymbolIndex, ctx completionContext, scope string) []indexer.SymbolEntry {
+	switch ctx.mode {
+	case completionMethods:
+		// Private methods are only offered on self, protected ones within their class
+		site := newCallSite(idx, ctx.qualifier, scope)
+		candidates := filterEntries(namePrefixSearch(ctx.search, idx, ctx.prefix), func(entry indexer.SymbolEntry) bool {
+			switch entry.Type {
+			case indexer.SymbolMethod, indexer.SymbolSingletonMethod, indexer.SymbolScope,
+				indexer.SymbolAssociation, indexer.SymbolAttrAccessor:
+				return site.canCall(entry)
+			}
+			return false
+		})
+		return candidates
+	case completionInstanceVariables:
+		return filterEntries(namePrefixSearch(ctx.search, idx, ctx.prefix), func(entry indexer.SymbolEntry) bool {
+			return entry.Type == indexer.SymbolInstanceVariable && (scope == "" || entry.Parent == scope)
+		})
+	case completionClassVariables:
+		// Class variables are shared along the class hierarchy
+		return filterEntries(namePrefixSearch(ctx.search, idx, ctx.prefix), func(entry indexer.SymbolEntry) bool {
+			return entry.Type == indexer.SymbolClassVar && (scope == "" || isMemberOf(idx, entry, scope))
+		})
+	case completionNamespace:
+		// Members are matched by fully qualified name, so those defined with a
+		// compact path (class Admin::Audit) are listed under their namespace too,
+		// labelled with the name that follows "::"
+		namespace := idx.ResolveConstantPath(ctx.qualifier, scope)
+		var members []indexer.SymbolEntry
+		for _, entry := range idx.PrefixSearch(ctx.search, namespace+"::"+ctx.prefix) {
+			switch entry.Type {
+			case indexer.SymbolClass, indexer.SymbolModule, indexer.SymbolConstant:
+			default:
+				continue
+			}
+			name, found := strings.CutPrefix(entry.FullyQualifiedName, namespace+"::")
+			if !found || strings.Contains(name, "::") || !strings.HasPrefix(strings.ToLower(name), strings.ToLower(ctx.prefix)) {
+				continue
+			}
+			entry.Name = name
+			entry.Parent = namespace
+			members = append(members, entry)
+		}
+		return members
+	case completionSymbols:
+		// Single characters match too much of the workspace to be useful
+		if len(ctx.prefix) < 2 {
+			return nil
+		}
+		// A bare identifier calls on implicit self, reaching the current class's private methods
+		return newCallSite(idx, "", scope).filterCallable(idx.PrefixSearch(ctx.search, ctx.prefix))
+	}
+	return nil
+}
+
+// keywordCandidates returns the keywords matching the typed prefix. Keywords are
+// only offered for plain lowercase typing, never after "." or in a constant.
+func keywordCandidates(ctx completionContext) []string {
+	if ctx.mode != completionSymbols || ctx.prefix == "" || isCapitalized(ctx.prefix) {
+		return nil
+	}
+
+	var keywords []string
+	for _, keyword := range rubyKeywords {
+		if strings.HasPrefix(keyword, ctx.prefix) && keyword != ctx.prefix {
+			keywords = append(keywords, keyword)
+		}
+	}
+	return keywords
+}
+
+// bufferWordCandidates returns the identifiers written in the current buffer that
+// start with the typed prefix, in order of first appearance, so names typed
+// since the file was last indexed are offered too. Like indexed symbols they need
+// two characters of prefix, and the scan stops after maxBufferWords matches.
+func bufferWordCandidates(ctx completionContext, source string) []string {
+	if ctx.mode != completionSymbols || len(ctx.prefix) < 2 {
+		return nil
+	}
+
+	lowerPrefix := strings.ToLower(ctx.prefix)
+	seen := make(map[string]bool)
+	var words []string
+	for _, line := range strings.Split(source, "\n") {
+		for _, loc := range bufferWordPattern.FindAllStringIndex(line, -1) {
+			// Instance, class and global variables have completions of their own
+			if loc[0] > 0 && (line[loc[0]-1] == '@' || line[loc[0]-1] == '$') {
+				continue
+			}
+			word := line[loc[0]:loc[1]]
+			if seen[word] || word == ctx.prefix || !strings.HasPrefix(strings.ToLower(word), lowerPrefix) {
+				continue
+			}
+			seen[word] = true
+			words = append(words, word)
+			if len(words) >= maxBufferWords {
+				return words
+			}
+		}
+	}
+	return words
+}
+
+// namePrefixSearch finds symbols whose own name (not namespace) starts with prefix
+func namePrefixSearch(search context.Context, idx indexer.SymbolIndex, prefix string) []indexer.SymbolEntry {
+	lowerPrefix := strings.ToLower(prefix)
+	return filterEntries(idx.PrefixSearch(search, prefix), func(entry indexer.SymbolEntry) bool {
+		return strings.HasPrefix(strings.ToLower(entry.Name), lowerPrefix)
+	})
+}
+
+// filterEntries keeps the entries matching keep
+func filterEntries(entries []indexer.SymbolEntry, keep func(indexer.SymbolEntry) bool) []indexer.SymbolEntry {
+	var kept []indexer.SymbolEntry
+	for _, entry := range entries {
+		if keep(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
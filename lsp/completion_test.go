@@ -0,0 +1,378 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+type testCompletionList struct {
+	IsIncomplete bool `json:"isIncomplete"`
+	Items        []struct {
+		Label    string `json:"label"`
+		Kind     int    `json:"kind"`
+		SortText string `json:"sortText"`
+	} `json:"items"`
+}
+
+func TestCompletionCapsRankedCandidates(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb":   "class Order\n  def ship_now\n  end\n\n  def ship_later\n  end\n\n  def total\n    sh\n  end\nend\n",
+		"app/models/invoice.rb": "class Invoice\n  def ship_now\n  end\n\n  def ship_to\n  end\n\n  def shipping_label\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	tests := []struct {
+		limit      int
+		labels     []string
+		incomplete bool
+	}{
+		// Members of the enclosing class fill a small cap before anything else
+		{limit: 2, labels: []string{"ship_later", "ship_now"}, incomplete: true},
+		// A label defined by several classes is listed once, at its best rank
+		{limit: 10, labels: []string{"ship_later", "ship_now", "ship_to", "shipping_label"}, incomplete: false},
+	}
+	for _, test := range tests {
+		s.GlobalState.CompletionLimit = test.limit
+
+		var list testCompletionList
+		decode(t, s.HandleCompletion(1, positionParams("app/models/order.rb", 8, 6)), &list)
+		if list.IsIncomplete != test.incomplete {
+			t.Errorf("limit %d: isIncomplete = %v, want %v", test.limit, list.IsIncomplete, test.incomplete)
+		}
+		labels := make(map[string]string)
+		for _, item := range list.Items {
+			labels[item.Label] = item.SortText
+		}
+		if len(list.Items) != len(test.labels) {
+			t.Errorf("limit %d: items = %+v, want %v", test.limit, list.Items, test.labels)
+		}
+		for _, label := range test.labels {
+			if _, ok := labels[label]; !ok {
+				t.Errorf("limit %d: %s missing from %+v", test.limit, label, list.Items)
+			}
+		}
+		if sortText := labels["ship_now"]; sortText != "0ship_now" {
+			t.Errorf("limit %d: ship_now sortText = %q, want the enclosing class's rank", test.limit, sortText)
+		}
+	}
+}
+
+func TestCompletionListsClassVariablesAlongTheHierarchy(t *testing.T) {
+	files := map[string]string{
+		"app/services/legacy_counter.rb": "class LegacyCounter\n  @@count = 0\n  @@registry ||= {}\nend\n",
+		"app/services/page_counter.rb":   "class PageCounter < LegacyCounter\n  def self.bump\n    @@\n  end\nend\n",
+		"app/services/other.rb":          "class Other\n  @@cache = {}\nend\n",
+	}
+	s := newTestServerWithOptions(files, indexer.Options{ClassVariables: true})
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, positionParams("app/services/page_counter.rb", 2, 6)), &list)
+	var labels []string
+	for _, item := range list.Items {
+		labels = append(labels, item.Label)
+	}
+	sort.Strings(labels)
+	if want := []string{"@@count", "@@registry"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("completion after @@ = %v, want %v", labels, want)
+	}
+}
+
+func TestCompletionListsSchemaColumnsOfModels(t *testing.T) {
+	s := newTestServerWithOptions(map[string]string{
+		"db/schema.rb": `ActiveRecord::Schema[7.1].define(version: 2024_01_01_000000) do
+  create_table "users", force: :cascade do |t|
+    t.string "email", null: false
+    t.datetime "created_at", null: false
+    t.index ["email"], name: "index_users_on_email", unique: true
+  end
+end
+`,
+		"app/models/user.rb":                  "class User < ApplicationRecord\nend\n",
+		"app/controllers/users_controller.rb": "class UsersController < ApplicationController\n  def show\n    user = User.find(params[:id])\n    user.\n  end\nend\n",
+	}, indexer.Options{SchemaColumns: true})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	var list struct {
+		Items []struct {
+			Label      string `json:"label"`
+			Kind       int    `json:"kind"`
+			Detail     string `json:"detail"`
+			InsertText string `json:"insertText"`
+		} `json:"items"`
+	}
+	decode(t, s.HandleCompletion(1, positionParams("app/controllers/users_controller.rb", 3, 9)), &list)
+
+	columns := map[string]string{"email": "string column in User", "created_at": "datetime column in User"}
+	for _, item := range list.Items {
+		if item.Label == "index" {
+			t.Errorf("t.index listed as a column: %+v", item)
+		}
+		detail, ok := columns[item.Label]
+		if !ok {
+			continue
+		}
+		if item.Kind != completionKindField || item.Detail != detail {
+			t.Errorf("%s = kind %d, detail %q; want a field detailed %q", item.Label, item.Kind, item.Detail, detail)
+		}
+		if item.InsertText != "" && item.InsertText != item.Label {
+			t.Errorf("%s inserts %q, want just the name", item.Label, item.InsertText)
+		}
+		delete(columns, item.Label)
+	}
+	if len(columns) > 0 {
+		t.Errorf("columns %v missing from %+v", columns, list.Items)
+	}
+}
+
+func TestCompletionShowsSummariesAndResolvesDocumentation(t *testing.T) {
+	source := "class Order\n  # Sums the price of every line item.\n  # Discounts are applied first.\n  def total_price\n  end\n\n  def ship\n    tot\n  end\nend\n"
+	s := NewTestServer(map[string]string{"app/models/order.rb": source})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	var list struct {
+		Items []struct {
+			Label  string                 `json:"label"`
+			Detail string                 `json:"detail"`
+			Data   map[string]interface{} `json:"data"`
+		} `json:"items"`
+	}
+	decode(t, s.HandleCompletion(1, positionParams("app/models/order.rb", 7, 7)), &list)
+	if len(list.Items) != 1 || list.Items[0].Label != "total_price" {
+		t.Fatalf("items = %+v, want total_price", list.Items)
+	}
+	item := list.Items[0]
+	if !strings.HasSuffix(item.Detail, " — Sums the price of every line item.") {
+		t.Errorf("detail = %q, want the first line of the doc comment", item.Detail)
+	}
+
+	// The full comment is read from disk when the item is resolved
+	root := writeWorkspace(t, map[string]string{"app/models/order.rb": source})
+	item.Data["filePath"] = filepath.Join(root, "app/models/order.rb")
+	var resolved struct {
+		Documentation struct {
+			Kind  string `json:"kind"`
+			Value string `json:"value"`
+		} `json:"documentation"`
+	}
+	decode(t, s.HandleCompletionResolve(map[string]interface{}{"label": item.Label, "data": item.Data}), &resolved)
+	if want := "Sums the price of every line item.\nDiscounts are applied first."; resolved.Documentation.Value != want {
+		t.Errorf("resolved documentation = %q, want %q", resolved.Documentation.Value, want)
+	}
+}
+
+func TestCompletionOffersPredicateAndBangMethods(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/account.rb": "class Account\n  def active?\n  end\n\n  def activate!\n  end\n\n  def run\n    acti\n    active?\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	tests := []struct {
+		line      int
+		character int
+		want      []string
+	}{
+		{8, 8, []string{"activate!", "active?"}},
+		// The ? typed so far is part of the name
+		{9, 11, []string{"active?"}},
+	}
+	for _, test := range tests {
+		var list testCompletionList
+		decode(t, s.HandleCompletion(1, positionParams("app/models/account.rb", test.line, test.character)), &list)
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		sort.Strings(labels)
+		if !reflect.DeepEqual(labels, test.want) {
+			t.Errorf("completion at %d:%d = %v, want %v", test.line, test.character, labels, test.want)
+		}
+	}
+}
+
+func TestCompletionListsNamespaceMembersAfterScopeResolution(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/admin.rb":                 "module Admin\n  ROLES = %w[owner].freeze\n\n  class User\n  end\n\n  module Reports\n    class Sales\n    end\n\n    LIMIT = 10\n  end\nend\n",
+		"app/models/admin/audit.rb":           "class Admin::Audit\nend\n",
+		"app/models/admin/reports/exports.rb": "module Admin::Reports::Exports\nend\n",
+		"app/services/dashboard.rb":           "class Dashboard\n  def run\n    Admin::\n    Admin::Reports::\n    Admin::Reports::S\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	tests := []struct {
+		line      int
+		character int
+		want      []string
+	}{
+		{2, 11, []string{"Audit", "ROLES", "Reports", "User"}},
+		{3, 20, []string{"Exports", "LIMIT", "Sales"}},
+		{4, 21, []string{"Sales"}},
+	}
+	for _, test := range tests {
+		var list testCompletionList
+		decode(t, s.HandleCompletion(1, positionParams("app/services/dashboard.rb", test.line, test.character)), &list)
+		var labels []string
+		for _, item := range list.Items {
+			labels = append(labels, item.Label)
+		}
+		sort.Strings(labels)
+		if !reflect.DeepEqual(labels, test.want) {
+			t.Errorf("completion at %d:%d = %v, want %v", test.line, test.character, labels, test.want)
+		}
+	}
+}
+
+func TestCompletionOffersMethodsOfIncludedConcerns(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/concerns/archivable.rb": "module Archivable\n  extend ActiveSupport::Concern\n\n  included do\n    def archive_label\n    end\n  end\n\n  def archive!\n  end\nend\n",
+		"app/models/post.rb":                "class Post < ApplicationRecord\n  include Archivable\n\n  def publish\n    arch\n  end\nend\n",
+		"app/models/comment.rb":             "class Comment < ApplicationRecord\n  def archive_thread\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, positionParams("app/models/post.rb", 4, 8)), &list)
+	ranks := make(map[string]byte)
+	for _, item := range list.Items {
+		ranks[item.Label] = item.SortText[0]
+	}
+	// The concern's methods are members of Post, ranked with its own
+	if ranks["archive!"] == 0 || ranks["archive_label"] == 0 || ranks["archive!"] != ranks["archive_label"] {
+		t.Fatalf("items = %+v, want both methods of Archivable", list.Items)
+	}
+	if thread := ranks["archive_thread"]; thread <= ranks["archive!"] {
+		t.Errorf("Comment#archive_thread ranked %c, want it after Post's members at %c", thread, ranks["archive!"])
+	}
+}
+
+func TestCompletionOffersWordsOfTheBuffer(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb": "class Order\n  def total_price\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+
+	// Typed since the file was indexed: a local, a new method, an ivar and a repeat of an indexed name
+	edited := "class Order\n  def total_price\n  end\n\n  def totals?\n    total_discount = @total_cache\n    total_price - total_discount\n    tot\n  end\nend\n"
+	s.Store.Set(testFileURI("app/models/order.rb"), edited, 2, "ruby")
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, positionParams("app/models/order.rb", 7, 7)), &list)
+
+	type item struct {
+		kind     int
+		sortText string
+	}
+	items := make(map[string]item)
+	for _, got := range list.Items {
+		if _, dup := items[got.Label]; dup {
+			t.Errorf("%s offered twice", got.Label)
+		}
+		items[got.Label] = item{got.Kind, got.SortText}
+	}
+	for _, word := range []string{"totals?", "total_discount"} {
+		if got := items[word]; got.kind != completionKindText || !strings.HasPrefix(got.sortText, "4") {
+			t.Errorf("%s = %+v, want a buffer word ranked below indexed symbols", word, got)
+		}
+	}
+	if got := items["total_price"]; got.kind == completionKindText {
+		t.Errorf("total_price offered as a buffer word, want its indexed symbol")
+	}
+	for _, word := range []string{"total_cache", "tot"} {
+		if _, ok := items[word]; ok {
+			t.Errorf("%s offered, want instance variables and the prefix itself left out", word)
+		}
+	}
+
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+	decode(t, s.HandleCompletion(1, positionParams("app/models/order.rb", 7, 7)), &list)
+	for _, got := range list.Items {
+		if got.Kind == completionKindText {
+			t.Errorf("%s offered with bufferWordCompletion disabled", got.Label)
+		}
+	}
+}
+
+func TestBufferWordCandidatesAreCapped(t *testing.T) {
+	var source strings.Builder
+	for i := 0; i < 2*maxBufferWords; i++ {
+		fmt.Fprintf(&source, "word_%d = %d\n", i, i)
+	}
+	words := bufferWordCandidates(completionContext{mode: completionSymbols, prefix: "wo"}, source.String())
+	if len(words) != maxBufferWords || words[0] != "word_0" {
+		t.Errorf("bufferWordCandidates = %d words starting %v, want the first %d", len(words), words[:1], maxBufferWords)
+	}
+}
+
+func TestCompletionShowsParametersAndDefiningFile(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb":    "class Order\n  def ship_to(address, carrier: nil)\n  end\nend\n",
+		"app/models/invoice.rb":  "class Invoice\n  def ship_from(warehouse)\n  end\nend\n",
+		"app/services/report.rb": "class Report\n  def run\n    sh\n  end\nend\n",
+	})
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	type labelDetails struct {
+		Detail      string `json:"detail"`
+		Description string `json:"description"`
+	}
+	type item struct {
+		Label        string        `json:"label"`
+		Detail       string        `json:"detail"`
+		LabelDetails *labelDetails `json:"labelDetails"`
+	}
+	files := map[string]string{"ship_to": "app/models/order.rb", "ship_from": "app/models/invoice.rb"}
+	complete := func() []item {
+		var list struct {
+			Items []item `json:"items"`
+		}
+		decode(t, s.HandleCompletion(1, positionParams("app/services/report.rb", 2, 6)), &list)
+		if len(list.Items) != len(files) {
+			t.Fatalf("completion items = %+v, want ship_to and ship_from", list.Items)
+		}
+		return list.Items
+	}
+
+	// Off by default
+	for _, got := range complete() {
+		if strings.Contains(got.Detail, files[got.Label]) || got.LabelDetails != nil {
+			t.Errorf("%s: detail %q, label details %+v, want neither to show the file", got.Label, got.Detail, got.LabelDetails)
+		}
+	}
+
+	// Without label details support the path goes in detail
+	s.GlobalState.CompletionPaths = true
+	for _, got := range complete() {
+		if !strings.HasSuffix(got.Detail, " ("+files[got.Label]+")") {
+			t.Errorf("%s: detail = %q, want the relative path at its end", got.Label, got.Detail)
+		}
+	}
+
+	s.GlobalState.ClientCapabilities = map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"completion": map[string]interface{}{
+				"completionItem": map[string]interface{}{"labelDetailsSupport": true},
+			},
+		},
+	}
+	params := map[string]string{"ship_to": "(address, carrier: nil)", "ship_from": "(warehouse)"}
+	for _, got := range complete() {
+		if strings.Contains(got.Detail, files[got.Label]) {
+			t.Errorf("%s: detail = %q, want the path in label details only", got.Label, got.Detail)
+		}
+		if want := (labelDetails{params[got.Label], files[got.Label]}); got.LabelDetails == nil || *got.LabelDetails != want {
+			t.Errorf("%s: label details = %+v, want %+v", got.Label, got.LabelDetails, want)
+		}
+	}
+}
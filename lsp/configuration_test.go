@@ -0,0 +1,34 @@
+package lsp
+
+import "testing"
+
+func TestDidChangeConfigurationSwitchesTheFormatter(t *testing.T) {
+	s := newToolsTestServer(t, ".rubocop.yml")
+	if backend := s.FormatterBackend(); backend != "rubocop" {
+		t.Fatalf("FormatterBackend() = %q, want rubocop detected from .rubocop.yml", backend)
+	}
+
+	s.HandleDidChangeConfiguration(map[string]interface{}{
+		"settings": map[string]interface{}{
+			"rubyLspGo": map[string]interface{}{
+				"formatter":       "syntax_tree",
+				"testLibrary":     "rspec",
+				"enabledFeatures": map[string]interface{}{"hover": false},
+			},
+		},
+	})
+	if backend := s.FormatterBackend(); backend != "syntax_tree" {
+		t.Errorf("FormatterBackend() after the change = %q, want syntax_tree", backend)
+	}
+	if s.GlobalState.TestLibrary != "rspec" || s.GlobalState.EnabledFeatures["hover"] {
+		t.Errorf("test library %q, hover enabled %v; want rspec and hover disabled", s.GlobalState.TestLibrary, s.GlobalState.EnabledFeatures["hover"])
+	}
+
+	// Flat settings apply too, and "auto" detects the backend again
+	s.HandleDidChangeConfiguration(map[string]interface{}{
+		"settings": map[string]interface{}{"formatter": "auto"},
+	})
+	if backend := s.FormatterBackend(); backend != "rubocop" {
+		t.Errorf("FormatterBackend() back on auto = %q, want rubocop", backend)
+	}
+}
@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// DebugEnabled reports whether the client turned on developer requests with the
+// debug initialization option
+func (s *Server) DebugEnabled() bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	return s.GlobalState.Debug
+}
+
+// HandleDebugAst handles the $/rubyLsp/debugAst request, whose params name a
+// document as textDocument/documentSymbol does. It returns what the server
+// extracted from the document: its parsed AST and the symbols the indexer finds
+// in it, parsed from the open buffer when there is one so unsaved edits show up.
+// Meant for diagnosing parse issues, not for editors.
+func (s *Server) HandleDebugAst(params interface{}) interface{} {
+	s.Logger.Println("Processing debugAst request")
+
+	uri := extractTextDocumentURI(params)
+	if uri == "" {
+		return nil
+	}
+	filePath := uriToFilePath(uri)
+	idx := s.Indexer
+
+	result := map[string]interface{}{"uri": uri}
+	var symbols []indexer.SymbolEntry
+	if doc, exists := s.Store.Get(uri); exists {
+		ast, err := doc.RubyDocument().Parse()
+		if err != nil {
+			result["error"] = err.Error()
+		} else {
+			result["ast"] = ast
+		}
+		if idx != nil {
+			symbols = idx.ParseSource(doc.Source, filePath)
+		}
+	} else if idx != nil {
+		symbols = idx.GetFileSymbols(filePath)
+	}
+	if symbols == nil {
+		symbols = []indexer.SymbolEntry{}
+	}
+	result["symbols"] = symbols
+	return result
+}
+
+// HandleDebugFileSymbols handles the $/rubyLsp/fileSymbols request, whose params
+// name a file by path or by uri. It returns every field of the entries the index
+// holds for the file, as stored rather than reparsed, and an empty list for a
+// file the index does not cover. Meant for checking why a symbol is not found.
+func (s *Server) HandleDebugFileSymbols(params interface{}) interface{} {
+	s.Logger.Println("Processing fileSymbols request")
+
+	filePath := ""
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if path, ok := paramMap["path"].(string); ok {
+			filePath = path
+		} else if uri, ok := paramMap["uri"].(string); ok {
+			filePath = uriToFilePath(uri)
+		}
+		if strings.HasPrefix(filePath, "file://") {
+			filePath = uriToFilePath(filePath)
+		}
+	}
+
+	symbols := []indexer.SymbolEntry{}
+	if idx := s.Indexer; idx != nil && filePath != "" {
+		if entries := idx.GetFileSymbols(filePath); len(entries) > 0 {
+			symbols = entries
+		}
+	}
+	return symbols
+}
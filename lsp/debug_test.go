@@ -0,0 +1,65 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+func TestDebugFileSymbolsDumpsIndexEntries(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb": "class Order < ApplicationRecord\n  def total(tax, discount: 0)\n  end\n\n  private\n\n  def recalculate\n  end\nend\n",
+	})
+	path := testFilePath("app/models/order.rb")
+
+	want := []struct {
+		fqn        string
+		symbolType indexer.SymbolType
+		line       int
+		parent     string
+		visibility string
+		detail     string
+		params     []string
+	}{
+		{"Order", indexer.SymbolClass, 1, "", "public", "ApplicationRecord", nil},
+		{"Order#total", indexer.SymbolMethod, 2, "Order", "public", "", []string{"tax", "discount: 0"}},
+		{"Order#recalculate", indexer.SymbolMethod, 7, "Order", "private", "", nil},
+	}
+
+	for _, params := range []map[string]interface{}{{"path": path}, {"uri": testFileURI("app/models/order.rb")}} {
+		var symbols []indexer.SymbolEntry
+		decode(t, s.HandleDebugFileSymbols(params), &symbols)
+		if len(symbols) != len(want) {
+			t.Fatalf("%v: dumped %+v, want %d entries", params, symbols, len(want))
+		}
+		for i, expected := range want {
+			got := symbols[i]
+			if got.FullyQualifiedName != expected.fqn || got.Type != expected.symbolType || got.Line != expected.line ||
+				got.Parent != expected.parent || got.Visibility != expected.visibility || got.Detail != expected.detail ||
+				!reflect.DeepEqual(got.Params, expected.params) || got.FilePath != path {
+				t.Errorf("%v: entry %d = %+v, want %+v", params, i, got, expected)
+			}
+		}
+	}
+
+	// Unindexed files, and params naming none, get an empty list rather than an error
+	for _, params := range []interface{}{map[string]interface{}{"path": testFilePath("app/models/missing.rb")}, nil} {
+		result := s.HandleDebugFileSymbols(params)
+		if symbols, ok := result.([]indexer.SymbolEntry); !ok || symbols == nil || len(symbols) != 0 {
+			t.Errorf("fileSymbols of %v = %#v, want an empty list", params, result)
+		}
+	}
+}
+
+func TestDebugRequestsNeedTheDebugOption(t *testing.T) {
+	s := NewTestServer(nil)
+	s.HandleInitialize(map[string]interface{}{})
+	if s.DebugEnabled() {
+		t.Error("DebugEnabled() = true without the debug option")
+	}
+	s.HandleInitialize(map[string]interface{}{"initializationOptions": map[string]interface{}{"debug": true}})
+	if !s.DebugEnabled() {
+		t.Error("DebugEnabled() = false with the debug option")
+	}
+}
@@ -0,0 +1,36 @@
+package lsp
+
+import "testing"
+
+// Decorator exposing the whole API of the user it wraps
+var decoratorFixture = map[string]string{
+	"app/models/user.rb":               "class User < ApplicationRecord\n  def full_name\n    \"#{first_name} #{last_name}\"\n  end\nend\n",
+	"app/models/company.rb":            "class Company < ApplicationRecord\n  def full_name\n    legal_name\n  end\n\n  def fuller_address\n  end\nend\n",
+	"app/decorators/user_decorator.rb": "class UserDecorator\n  delegate_missing_to :user\n\n  attr_reader :user\n\n  def initialize(user)\n    @user = user\n  end\n\n  def display_name\n    full_name.upcase\n  end\nend\n",
+}
+
+func TestDefinitionFallsBackToTheForwardedClass(t *testing.T) {
+	s := NewTestServer(decoratorFixture)
+
+	var locations []testLocation
+	decode(t, s.HandleDefinition(1, positionParams("app/decorators/user_decorator.rb", 10, 6)), &locations)
+	if len(locations) != 1 || locations[0].URI != testFileURI("app/models/user.rb") || locations[0].Range.Start.Line != 1 {
+		t.Errorf("definitions of full_name = %+v, want User#full_name only", locations)
+	}
+}
+
+func TestCompletionRanksForwardedMembersFirst(t *testing.T) {
+	s := NewTestServer(decoratorFixture)
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, positionParams("app/decorators/user_decorator.rb", 10, 8)), &list)
+	sortTexts := make(map[string]string)
+	for _, item := range list.Items {
+		sortTexts[item.Label] = item.SortText
+	}
+	if sortTexts["full_name"] == "" || sortTexts["fuller_address"] == "" || sortTexts["full_name"][0] >= sortTexts["fuller_address"][0] {
+		t.Errorf("completion = %+v, want full_name of the forwarded User ranked before Company#fuller_address", list.Items)
+	}
+}
@@ -0,0 +1,189 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// A controller whose locals share their names with the User model
+var localShadowingFixture = map[string]string{
+	"app/models/user.rb": "class User < ApplicationRecord\nend\n",
+	"app/controllers/users_controller.rb": `class UsersController < ApplicationController
+  def show
+    user = User.find(params[:id])
+    render json: user
+  end
+
+  def notify_all
+    users.each { |user| deliver(user) }
+    user
+  end
+
+  def lookup(id, fallback = user)
+    fallback
+  end
+end
+`,
+}
+
+func TestDefinitionPrefersLocalsOverSameNamedModels(t *testing.T) {
+	s := NewTestServer(localShadowingFixture)
+	controller := "app/controllers/users_controller.rb"
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		wantURI   string
+		wantLine  int
+	}{
+		{"local assigned earlier", 3, 17, controller, 2},
+		{"block parameter within its block", 7, 32, controller, 7},
+		// Once the block is closed, user is no longer its parameter
+		{"after the block", 8, 4, "app/models/user.rb", 0},
+		{"default value of a parameter", 11, 29, "app/models/user.rb", 0},
+		{"parameter", 12, 4, controller, 11},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var locations []testLocation
+			decode(t, s.HandleDefinition(1, positionParams(controller, test.line, test.character)), &locations)
+			if len(locations) == 0 {
+				t.Fatalf("no definition at %d:%d", test.line, test.character)
+			}
+			if got := locations[0]; got.URI != testFileURI(test.wantURI) || got.Range.Start.Line != test.wantLine {
+				t.Errorf("definition = %s:%d, want %s:%d", got.URI, got.Range.Start.Line, test.wantURI, test.wantLine)
+			}
+		})
+	}
+}
+
+func TestDefinitionOfQualifiedConstants(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/billing.rb": "module Billing\n  module Gateways\n    class Stripe\n      API_VERSION = \"2024-06-20\"\n    end\n  end\nend\n",
+		"app/models/invoice.rb": "class Invoice\n  def gateway_version\n    Billing::Gateways::Stripe::API_VERSION\n  end\n\n  def vendored_gateway\n    Vendor::Billing::Gateways::Stripe\n  end\nend\n",
+	})
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		wantLine  int
+	}{
+		{"full path", 2, 35, 3},
+		{"namespace within the path", 2, 15, 1},
+		{"behind an unindexed prefix", 6, 32, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var locations []testLocation
+			decode(t, s.HandleDefinition(1, positionParams("app/models/invoice.rb", test.line, test.character)), &locations)
+			if len(locations) != 1 {
+				t.Fatalf("definitions = %+v, want one", locations)
+			}
+			if got := locations[0]; got.URI != testFileURI("app/models/billing.rb") || got.Range.Start.Line != test.wantLine {
+				t.Errorf("definition = %s:%d, want app/models/billing.rb:%d", got.URI, got.Range.Start.Line, test.wantLine)
+			}
+		})
+	}
+}
+
+func TestDefinitionOfPredicateBangAndSetterMethods(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/account.rb":  "class Account\n  def active?\n  end\n\n  def close!\n  end\n\n  def owner\n  end\n\n  def owner=(value)\n  end\nend\n",
+		"app/services/closer.rb": "class Closer\n  def run(account)\n    account.close! if account.active?\n    account.owner = nil\n    account.owner\n  end\nend\n",
+	})
+	closer := "app/services/closer.rb"
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		wantLine  int
+	}{
+		{"bang method", 2, 14, 4},
+		{"predicate method", 2, 32, 1},
+		{"setter through an assignment", 3, 14, 10},
+		{"reader", 4, 14, 7},
+	}
+	for _, test := range tests {
+		var locations []testLocation
+		decode(t, s.HandleDefinition(1, positionParams(closer, test.line, test.character)), &locations)
+		if len(locations) != 1 || locations[0].Range.Start.Line != test.wantLine {
+			t.Errorf("%s: definition = %+v, want app/models/account.rb:%d", test.name, locations, test.wantLine)
+		}
+	}
+}
+
+func TestDefinitionAndHoverOfConstantAliases(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/account.rb":      "class Account\nend\n",
+		"lib/billing.rb":             "module Billing\n  module Gateways\n    class Stripe\n    end\n  end\nend\n",
+		"config/aliases.rb":          "User = Account\nGateway = Billing::Gateways::Stripe\n",
+		"app/services/onboarding.rb": "class Onboarding\n  def run\n    User.new\n    Gateway.new\n  end\nend\n",
+	})
+	onboarding := "app/services/onboarding.rb"
+
+	tests := []struct {
+		line     int
+		wantURI  string
+		wantLine int
+	}{
+		{2, "app/models/account.rb", 0},
+		{3, "lib/billing.rb", 2},
+	}
+	for _, test := range tests {
+		var locations []testLocation
+		decode(t, s.HandleDefinition(1, positionParams(onboarding, test.line, 5)), &locations)
+		if len(locations) != 1 || locations[0].URI != testFileURI(test.wantURI) || locations[0].Range.Start.Line != test.wantLine {
+			t.Errorf("definition at line %d = %+v, want %s:%d", test.line, locations, test.wantURI, test.wantLine)
+		}
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("config/aliases.rb", 1, 2)), &hover)
+	if want := "**Alias of:** `Billing::Gateways::Stripe`"; !strings.Contains(hover.Contents.Value, want) {
+		t.Errorf("hover of Gateway missing %q:\n%s", want, hover.Contents.Value)
+	}
+}
+
+func TestDefinitionOfIrregularAssociations(t *testing.T) {
+	files := map[string]string{
+		"app/models/team.rb":   "class Team < ApplicationRecord\n  has_many :people\n  has_many :cacti\n\n  def roster\n    people.map(&:name)\n  end\nend\n",
+		"app/models/person.rb": "class Person < ApplicationRecord\nend\n",
+		"app/models/cactus.rb": "class Cactus < ApplicationRecord\nend\n",
+	}
+	s := newTestServerWithOptions(files, indexer.Options{Irregulars: map[string]string{"cactus": "cacti"}})
+
+	tests := []struct {
+		name      string
+		line      int
+		character int
+		want      string
+	}{
+		{"default irregular", 1, 14, "app/models/person.rb"},
+		{"configured irregular", 2, 14, "app/models/cactus.rb"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var locations []testLocation
+			decode(t, s.HandleDefinition(1, positionParams("app/models/team.rb", test.line, test.character)), &locations)
+			if len(locations) != 1 || locations[0].URI != testFileURI(test.want) || locations[0].Range.Start.Line != 0 {
+				t.Errorf("definition = %+v, want %s:0", locations, test.want)
+			}
+		})
+	}
+
+	// Called in a method, the association's type definition is its model
+	var locations []testLocation
+	decode(t, s.HandleTypeDefinition(positionParams("app/models/team.rb", 5, 6)), &locations)
+	if len(locations) != 1 || locations[0].URI != testFileURI("app/models/person.rb") {
+		t.Errorf("type definition of people = %+v, want app/models/person.rb", locations)
+	}
+}
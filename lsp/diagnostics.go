@@ -0,0 +1,186 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// LSP DiagnosticSeverity values
+const (
+	diagnosticSeverityError       = 1
+	diagnosticSeverityWarning     = 2
+	diagnosticSeverityInformation = 3
+)
+
+// publishStructureDiagnostics reports the clear nesting imbalances of an open
+// Ruby document (a class left without its end, an end closing nothing), so an
+// editor without a Ruby binary still flags broken structure. It publishes an
+// empty list once the document is balanced again, clearing earlier findings.
+func (s *Server) publishStructureDiagnostics(uri string) {
+	s.publishDiagnostics(uri, nil)
+}
+
+// checkWithTools reports, next to the structure diagnostics, what ruby -wc and,
+// when it formats the workspace, rubocop find in an open Ruby document. The
+// tools run in the background on open and save; each is skipped when it cannot
+// run. The findings are dropped if the document changed meanwhile, and the next
+// change replaces them until the document is saved again.
+func (s *Server) checkWithTools(uri string) {
+	if !s.featureEnabled("diagnostics") {
+		return
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists || doc.LanguageID != "ruby" {
+		return
+	}
+	runRuby := s.toolAvailable("ruby")
+	runRubocop := s.FormatterBackend() == "rubocop" && s.toolUsable("rubocop")
+	if !runRuby && !runRubocop {
+		return
+	}
+
+	source, version, filePath := doc.Source, doc.Version, uriToFilePath(uri)
+	s.RunInBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, toolTimeout)
+		defer cancel()
+
+		var found []interface{}
+		if runRuby {
+			cmd := s.toolCommand(ctx, "ruby", "-wc", "-")
+			cmd.Stdin = strings.NewReader(source)
+			// Syntax errors exit non-zero; what ruby reports is on stderr either way
+			output, _ := cmd.CombinedOutput()
+			found = append(found, rubySyntaxDiagnostics(string(output))...)
+		}
+		if runRubocop {
+			cmd := s.toolCommand(ctx, "rubocop", "--format", "json", "--stdin", filePath)
+			cmd.Stdin = strings.NewReader(source)
+			// Offenses exit non-zero too
+			output, _ := cmd.Output()
+			found = append(found, rubocopDiagnostics(output)...)
+		}
+
+		if current, exists := s.Store.Get(uri); exists && current.Version == version {
+			s.publishDiagnostics(uri, found)
+		}
+	})
+}
+
+// publishDiagnostics publishes the structure diagnostics of an open Ruby document
+// along with extra ones found by external tools
+func (s *Server) publishDiagnostics(uri string, extra []interface{}) {
+	if !s.featureEnabled("diagnostics") {
+		return
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists || doc.LanguageID != "ruby" {
+		return
+	}
+
+	diagnostics := []interface{}{}
+	for _, warning := range indexer.StructureWarnings(doc.Source) {
+		diagnostics = append(diagnostics, map[string]interface{}{
+			"range":    lineRange(warning.Line, warning.Character, warning.EndCharacter),
+			"severity": diagnosticSeverityInformation,
+			"source":   "ruby-lsp-go",
+			"message":  warning.Message,
+		})
+	}
+	diagnostics = append(diagnostics, extra...)
+	s.SendNotification("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"version":     doc.Version,
+		"diagnostics": diagnostics,
+	})
+}
+
+// A finding of ruby -wc on its standard input: "-:3: warning: ..." or "-:7: syntax error, ..."
+var rubyCheckPattern = regexp.MustCompile(`(?m)(?:^|\s)-:(\d+): (warning: )?(.+)$`)
+
+// rubySyntaxDiagnostics converts the output of ruby -wc into diagnostics, one per
+// reported line, spanning the line's start since ruby names no column
+func rubySyntaxDiagnostics(output string) []interface{} {
+	var diagnostics []interface{}
+	for _, match := range rubyCheckPattern.FindAllStringSubmatch(output, -1) {
+		line, err := strconv.Atoi(match[1])
+		if err != nil || line < 1 {
+			continue
+		}
+		severity := diagnosticSeverityError
+		if match[2] != "" {
+			severity = diagnosticSeverityWarning
+		}
+		diagnostics = append(diagnostics, map[string]interface{}{
+			"range":    lineRange(line, 0, 0),
+			"severity": severity,
+			"source":   "ruby",
+			"message":  match[3],
+		})
+	}
+	return diagnostics
+}
+
+// rubocopReport is the part of rubocop's JSON formatter output read for diagnostics
+type rubocopReport struct {
+	Files []struct {
+		Offenses []struct {
+			Severity string `json:"severity"`
+			Message  string `json:"message"`
+			CopName  string `json:"cop_name"`
+			Location struct {
+				StartLine   int `json:"start_line"`
+				StartColumn int `json:"start_column"`
+				LastLine    int `json:"last_line"`
+				LastColumn  int `json:"last_column"`
+			} `json:"location"`
+		} `json:"offenses"`
+	} `json:"files"`
+}
+
+// rubocopDiagnostics converts rubocop's JSON report into diagnostics, nil when
+// the output is not a report
+func rubocopDiagnostics(output []byte) []interface{} {
+	var report rubocopReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil
+	}
+
+	var diagnostics []interface{}
+	for _, file := range report.Files {
+		for _, offense := range file.Offenses {
+			severity := diagnosticSeverityWarning
+			switch offense.Severity {
+			case "error", "fatal":
+				severity = diagnosticSeverityError
+			case "info", "refactor", "convention":
+				severity = diagnosticSeverityInformation
+			}
+			location := offense.Location
+			// rubocop's lines and columns are 1-based, its last column inclusive
+			diagnostics = append(diagnostics, map[string]interface{}{
+				"range": map[string]interface{}{
+					"start": map[string]interface{}{"line": location.StartLine - 1, "character": location.StartColumn - 1},
+					"end":   map[string]interface{}{"line": location.LastLine - 1, "character": location.LastColumn},
+				},
+				"severity": severity,
+				"source":   "rubocop",
+				"code":     offense.CopName,
+				"message":  offense.Message,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// clearDiagnostics withdraws the diagnostics published for a closed document
+func (s *Server) clearDiagnostics(uri string) {
+	s.SendNotification("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": []interface{}{},
+	})
+}
@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// Rails render calls naming a template: render "shared/header", render partial: "items/item"
+var (
+	renderStringPattern  = regexp.MustCompile(`\brender\s*\(?\s*["']([\w/.-]+)["']`)
+	renderPartialPattern = regexp.MustCompile(`(?:\bpartial:|:partial\s*=>)\s*["']([\w/.-]+)["']`)
+	renderCallPattern    = regexp.MustCompile(`\brender\b`)
+)
+
+// HandleDocumentLink handles textDocument/documentLink request.
+// Render calls link to the partial or template they render, when the file exists.
+func (s *Server) HandleDocumentLink(params interface{}) interface{} {
+	s.Logger.Println("Processing document link request")
+
+	links := []interface{}{}
+
+	uri := extractTextDocumentURI(params)
+	if !strings.HasPrefix(uri, "file://") {
+		return links
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return links
+	}
+
+	filePath := uriToFilePath(uri)
+	root := s.GlobalState.WorkspacePath
+	if idx := s.Indexer; idx != nil {
+		root = idx.RootOf(filePath)
+	}
+	viewsDir := filepath.Join(root, "app", "views")
+	currentDir := currentViewDirectory(viewsDir, filePath)
+
+	for lineNumber, line := range strings.Split(doc.Source, "\n") {
+		if !renderCallPattern.MatchString(line) {
+			continue
+		}
+
+		// The explicit partial: option always names a partial; a bare string names a
+		// partial in views and a template in controllers, so both are tried
+		var matches [][]int
+		partialOnly := false
+		if matches = renderPartialPattern.FindAllStringSubmatchIndex(line, -1); matches != nil {
+			partialOnly = true
+		} else {
+			matches = renderStringPattern.FindAllStringSubmatchIndex(line, -1)
+		}
+
+		for _, match := range matches {
+			start, end := match[2], match[3]
+			target := resolveRenderTarget(viewsDir, currentDir, line[start:end], partialOnly)
+			if target == "" {
+				continue
+			}
+			links = append(links, map[string]interface{}{
+				"range":  lineRange(lineNumber+1, indexer.UTF16Column(line, start), indexer.UTF16Column(line, end)),
+				"target": store.PathToURI(target),
+			})
+		}
+	}
+
+	return links
+}
+
+// currentViewDirectory returns the view directory names without a slash resolve
+// against: the file's own directory for a view, app/views/<controller> for a controller
+func currentViewDirectory(viewsDir string, filePath string) string {
+	if rel, err := filepath.Rel(viewsDir, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Dir(filePath)
+	}
+
+	controllersDir := filepath.Join(filepath.Dir(viewsDir), "controllers")
+	if rel, err := filepath.Rel(controllersDir, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join(viewsDir, strings.TrimSuffix(rel, "_controller.rb"))
+	}
+	return viewsDir
+}
+
+// resolveRenderTarget finds the file a render call names, preferring the
+// underscore-prefixed partial and, unless partialOnly, falling back to a template.
+// It returns "" when nothing exists.
+func resolveRenderTarget(viewsDir string, currentDir string, name string, partialOnly bool) string {
+	dir := currentDir
+	if strings.Contains(name, "/") {
+		dir = filepath.Join(viewsDir, filepath.Dir(name))
+	}
+	base := filepath.Base(name)
+
+	candidates := []string{"_" + base}
+	if !partialOnly {
+		candidates = append(candidates, base)
+	}
+	for _, candidate := range candidates {
+		// The name carries no format or handler (.html.erb, .json.jbuilder) unless written out
+		if info, err := os.Stat(filepath.Join(dir, candidate)); err == nil && !info.IsDir() {
+			return filepath.Join(dir, candidate)
+		}
+		matches, _ := filepath.Glob(filepath.Join(dir, candidate+".*"))
+		sort.Strings(matches)
+		if len(matches) > 0 {
+			return matches[0]
+		}
+	}
+	return ""
+}
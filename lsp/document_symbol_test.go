@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// largeSource returns a file of about 5000 lines: classes of many methods with
+// bodies of several lines each
+func largeSource() string {
+	var source strings.Builder
+	for class := 0; class < 5; class++ {
+		fmt.Fprintf(&source, "class Report%d\n", class)
+		for method := 0; method < 110; method++ {
+			fmt.Fprintf(&source, "  def section_%d(rows)\n", method)
+			for line := 0; line < 7; line++ {
+				fmt.Fprintf(&source, "    rows = rows.map { |row| row * %d }\n", line)
+			}
+			source.WriteString("  end\n\n")
+		}
+		source.WriteString("end\n\n")
+	}
+	return source.String()
+}
+
+func TestDocumentSymbolsCacheAnUnindexedFile(t *testing.T) {
+	s := NewTestServer(map[string]string{"app/reports/report.rb": largeSource()})
+	path := testFilePath("app/reports/report.rb")
+	idx := s.Indexer
+	idx.RemoveFile(path)
+
+	symbols, ok := s.HandleDocumentSymbol(documentParams("app/reports/report.rb")).([]interface{})
+	if !ok || len(symbols) != 5 {
+		t.Fatalf("document symbols = %d top-level entries, want the 5 classes", len(symbols))
+	}
+	if cached := idx.GetFileSymbols(path); len(cached) != 5*111 {
+		t.Errorf("index holds %d entries of the file after the request, want its %d classes and methods", len(cached), 5*111)
+	}
+}
+
+func BenchmarkDocumentSymbol(b *testing.B) {
+	source := largeSource()
+	s := NewTestServer(map[string]string{"app/reports/report.rb": source})
+	params := documentParams("app/reports/report.rb")
+
+	b.Run("indexed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			s.HandleDocumentSymbol(params)
+		}
+	})
+	// What every request cost before the entries were read from the index
+	b.Run("parsed", func(b *testing.B) {
+		idx := s.Indexer
+		for i := 0; i < b.N; i++ {
+			idx.ParseSource(source, testFilePath("app/reports/report.rb"))
+		}
+	})
+}
+
+// testDocumentSymbol is the shape of a hierarchical document symbol
+type testDocumentSymbol struct {
+	Name           string               `json:"name"`
+	Range          testRange            `json:"range"`
+	SelectionRange testRange            `json:"selectionRange"`
+	Children       []testDocumentSymbol `json:"children"`
+}
+
+func TestDocumentSymbolsSpanTheirBodies(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb": "module Shop\n  class Order\n    def total\n      lines.sum\n    end\n\n    def paid?\n    end\n  end\nend\n",
+	})
+
+	var symbols []testDocumentSymbol
+	decode(t, s.HandleDocumentSymbol(documentParams("app/models/order.rb")), &symbols)
+	if len(symbols) != 1 || len(symbols[0].Children) != 1 || len(symbols[0].Children[0].Children) != 2 {
+		t.Fatalf("document symbols = %+v, want Shop > Order > total, paid?", symbols)
+	}
+
+	tests := []struct {
+		symbol    testDocumentSymbol
+		startLine int
+		endLine   int
+	}{
+		{symbols[0], 0, 9},
+		{symbols[0].Children[0], 1, 8},
+		{symbols[0].Children[0].Children[0], 2, 4},
+		{symbols[0].Children[0].Children[1], 6, 7},
+	}
+	for _, test := range tests {
+		if test.symbol.Range.Start.Line != test.startLine || test.symbol.Range.End.Line != test.endLine {
+			t.Errorf("%s spans lines %d-%d, want %d-%d through its end", test.symbol.Name,
+				test.symbol.Range.Start.Line, test.symbol.Range.End.Line, test.startLine, test.endLine)
+		}
+		if selection := test.symbol.SelectionRange; selection.Start.Line != test.startLine || selection.End.Line != test.startLine {
+			t.Errorf("%s selection range %+v, want its name on line %d", test.symbol.Name, selection, test.startLine)
+		}
+	}
+}
+
+func TestSymbolRangesMeasureMultibyteNamesInUTF16(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/cafe.rb":  "class Café\n  def greet_😀\n  end\nend\n",
+		"app/models/order.rb": "class Order\n  def run\n    Café.new.greet_😀\n  end\nend\n",
+	})
+
+	var symbols []testDocumentSymbol
+	decode(t, s.HandleDocumentSymbol(documentParams("app/models/cafe.rb")), &symbols)
+	if len(symbols) != 1 || len(symbols[0].Children) != 1 {
+		t.Fatalf("document symbols = %+v, want Café and its method", symbols)
+	}
+	// é is one UTF-16 code unit though two bytes, 😀 two code units though four bytes
+	if end := symbols[0].SelectionRange.End.Character; end != 10 {
+		t.Errorf("Café selection ends at %d, want 10", end)
+	}
+	if end := symbols[0].Children[0].SelectionRange.End.Character; end != 14 {
+		t.Errorf("greet_😀 selection ends at %d, want 14", end)
+	}
+
+	var locations []testLocation
+	decode(t, s.HandleDefinition(1, positionParams("app/models/order.rb", 2, 5)), &locations)
+	if len(locations) != 1 || locations[0].Range.Start.Character != 6 || locations[0].Range.End.Character != 10 {
+		t.Errorf("definition of Café = %+v, want characters 6-10", locations)
+	}
+
+	var found []struct {
+		Name     string       `json:"name"`
+		Location testLocation `json:"location"`
+	}
+	decode(t, s.HandleWorkspaceSymbol(1, map[string]interface{}{"query": "greet_"}), &found)
+	if len(found) != 1 || found[0].Location.Range.End.Character != 14 {
+		t.Errorf("workspace symbols = %+v, want greet_😀 ending at 14", found)
+	}
+}
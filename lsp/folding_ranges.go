@@ -0,0 +1,57 @@
+package lsp
+
+import "github.com/humberto/ruby-lsp-go/indexer"
+
+// HandleFoldingRange handles textDocument/foldingRange request. Class, module and
+// method bodies fold from their indexed ranges, keeping the end line visible, as
+// do multi-line array and hash literals; heredocs fold through their terminator.
+// A heredoc inside a method folds on its own, nested in the method's range.
+func (s *Server) HandleFoldingRange(params interface{}) interface{} {
+	s.Logger.Println("Processing folding range request")
+
+	ranges := []interface{}{}
+	uri := extractTextDocumentURI(params)
+	if uri == "" {
+		return ranges
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return ranges
+	}
+
+	seen := make(map[[2]int]bool)
+	addRange := func(startLine int, endLine int, kind string) {
+		if endLine <= startLine || seen[[2]int{startLine, endLine}] {
+			return
+		}
+		seen[[2]int{startLine, endLine}] = true
+
+		foldingRange := map[string]interface{}{
+			"startLine": startLine,
+			"endLine":   endLine,
+		}
+		if kind != "" {
+			foldingRange["kind"] = kind
+		}
+		ranges = append(ranges, foldingRange)
+	}
+
+	if idx := s.Indexer; idx != nil {
+		for _, entry := range idx.GetFileSymbols(uriToFilePath(uri)) {
+			switch entry.Type {
+			case indexer.SymbolClass, indexer.SymbolModule, indexer.SymbolMethod, indexer.SymbolSingletonMethod:
+				// LSP lines are 0-indexed, and the fold stops short of the end
+				addRange(entry.Line-1, entry.EndLine-2, "")
+			}
+		}
+	}
+
+	for _, span := range indexer.FoldingSpans(doc.Source) {
+		if span.Heredoc {
+			addRange(span.Line-1, span.EndLine-1, "region")
+		} else {
+			addRange(span.Line-1, span.EndLine-2, "")
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,59 @@
+package lsp
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFoldingRangesOfHeredocsAndLiterals(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/report.rb": `class Report
+  COLUMNS = [
+    :id,
+    :total,
+  ]
+
+  def rows
+    connection.select_all(<<~SQL)
+      SELECT id, total
+      FROM orders
+      WHERE data = '{"open": ['
+    SQL
+  end
+
+  def options
+    { limit: 10, offset: 0 }
+  end
+end
+`,
+	})
+
+	var ranges []struct {
+		StartLine int    `json:"startLine"`
+		EndLine   int    `json:"endLine"`
+		Kind      string `json:"kind"`
+	}
+	decode(t, s.HandleFoldingRange(documentParams("app/models/report.rb")), &ranges)
+	var got [][3]interface{}
+	for _, r := range ranges {
+		got = append(got, [3]interface{}{r.StartLine, r.EndLine, r.Kind})
+	}
+	sort.Slice(got, func(i, j int) bool {
+		if got[i][0] != got[j][0] {
+			return got[i][0].(int) < got[j][0].(int)
+		}
+		return got[i][1].(int) < got[j][1].(int)
+	})
+
+	want := [][3]interface{}{
+		{0, 16, ""},       // the class, keeping its end visible
+		{1, 3, ""},        // the array literal
+		{6, 11, ""},       // rows
+		{7, 11, "region"}, // the heredoc through its terminator, nested in rows
+		{14, 15, ""},      // options; its one-line hash does not fold
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("folding ranges = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package lsp
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// Workspace folder the files of a test server live in
+const testWorkspace = "/workspace"
+
+// NewTestServer returns a server for calling handlers in-process: a real store,
+// an index built from files (workspace-relative path -> source) and ready, and
+// logging discarded. Nothing is read from disk: every file is open in the store,
+// as if the client were editing it, so handlers reading sources find it there.
+// Outgoing messages are dropped, so handlers that notify the client never block.
+func NewTestServer(files map[string]string) *Server {
+	logger := log.New(io.Discard, "", 0)
+
+	globalState := &GlobalState{
+		WorkspaceURI:       store.PathToURI(testWorkspace),
+		WorkspacePath:      testWorkspace,
+		WorkspaceFolders:   []string{testWorkspace},
+		Formatter:          "auto",
+		TestLibrary:        "minitest",
+		ClientCapabilities: make(map[string]interface{}),
+		EnabledFeatures:    make(map[string]bool),
+		ReindexDebounce:    defaultReindexDebounce,
+	}
+
+	sources := make(map[string]string, len(files))
+	for name, source := range files {
+		sources[testFilePath(name)] = source
+	}
+	idx := indexer.NewForRoots(globalState.WorkspaceFolders, logger, globalState.IndexOptions)
+	idx.IndexSources(sources)
+
+	server := &Server{
+		GlobalState:       globalState,
+		Store:             store.New(globalState),
+		Indexer:           idx,
+		IncomingQueue:     make(chan Message, 100),
+		OutgoingQueue:     make(chan interface{}, 100),
+		CancelledRequests: make(map[string]bool),
+		Logger:            logger,
+	}
+	for filePath, source := range sources {
+		server.Store.Set(store.PathToURI(filePath), source, 1, "ruby")
+	}
+	go func(queue chan interface{}) {
+		for range queue {
+		}
+	}(server.OutgoingQueue)
+	return server
+}
+
+// testFilePath returns the path of a test server file named relative to its workspace
+func testFilePath(name string) string {
+	return filepath.Join(testWorkspace, filepath.FromSlash(name))
+}
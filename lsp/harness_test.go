@@ -0,0 +1,23 @@
+package lsp
+
+import "testing"
+
+func TestNewTestServerIndexesFilesInMemory(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/user.rb":                  "class User\n  def full_name\n  end\nend\n",
+		"app/controllers/users_controller.rb": "class UsersController\n  def show\n    User.find(1)\n  end\nend\n",
+	})
+
+	if !s.Indexer.IsReady() {
+		t.Fatal("index not ready")
+	}
+	if stats := s.Indexer.Stats(); stats.Files != 2 || len(stats.Errors) != 0 {
+		t.Fatalf("stats = %+v, want 2 files and no errors", stats)
+	}
+
+	var locations []testLocation
+	decode(t, s.HandleDefinition(1, positionParams("app/controllers/users_controller.rb", 2, 5)), &locations)
+	if len(locations) != 1 || locations[0].URI != testFileURI("app/models/user.rb") || locations[0].Range.Start.Line != 0 {
+		t.Fatalf("definition of User = %+v, want app/models/user.rb line 0", locations)
+	}
+}
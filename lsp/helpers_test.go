@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// Shapes of LSP results, decoded from what handlers return
+type testPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type testRange struct {
+	Start testPosition `json:"start"`
+	End   testPosition `json:"end"`
+}
+
+type testLocation struct {
+	URI   string    `json:"uri"`
+	Range testRange `json:"range"`
+}
+
+type testTextEdit struct {
+	Range   testRange `json:"range"`
+	NewText string    `json:"newText"`
+}
+
+type testWorkspaceEdit struct {
+	Changes map[string][]testTextEdit `json:"changes"`
+}
+
+// testFileURI returns the URI of a test server file named relative to its workspace
+func testFileURI(name string) string {
+	return store.PathToURI(testFilePath(name))
+}
+
+// documentParams names a test server file the way textDocument requests do
+func documentParams(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testFileURI(name)},
+	}
+}
+
+// positionParams names a position in a test server file, its numbers float64
+// as decoded from JSON
+func positionParams(name string, line, character int) map[string]interface{} {
+	params := documentParams(name)
+	params["position"] = map[string]interface{}{"line": float64(line), "character": float64(character)}
+	return params
+}
+
+// decode converts a handler result to a typed value through its JSON encoding
+func decode(t *testing.T, result interface{}, target interface{}) {
+	t.Helper()
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("encoding %#v: %v", result, err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+}
+
+// jsonParams converts JSON text to params as the message loop decodes them
+func jsonParams(t *testing.T, text string) interface{} {
+	t.Helper()
+	var params interface{}
+	if err := json.Unmarshal([]byte(text), &params); err != nil {
+		t.Fatalf("decoding params %s: %v", text, err)
+	}
+	return params
+}
+
+// writeWorkspace writes files (path relative to the workspace -> content) to a
+// temporary directory on disk, for features reading files the store does not hold
+func writeWorkspace(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// newTestServerWithOptions is NewTestServer with its index built with options
+func newTestServerWithOptions(files map[string]string, options indexer.Options) *Server {
+	s := NewTestServer(files)
+	s.GlobalState.IndexOptions = options
+
+	sources := make(map[string]string, len(files))
+	for name, source := range files {
+		sources[testFilePath(name)] = source
+	}
+	idx := indexer.NewForRoots(s.GlobalState.WorkspaceFolders, s.Logger, options)
+	idx.IndexSources(sources)
+	s.Indexer = idx
+	return s
+}
@@ -0,0 +1,215 @@
+package lsp
+
+import (
+	"context"
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// User is declared in its model and reopened by a concern-like file elsewhere
+var reopenedClassFixture = map[string]string{
+	"app/models/user.rb":                  "class User < ApplicationRecord\n  include Searchable\n\n  def full_name\n    \"#{first_name} #{last_name}\"\n  end\nend\n",
+	"app/models/user/admin_extensions.rb": "class User\n  include Auditable\n\n  def admin?\n    role == \"admin\"\n  end\nend\n",
+	"app/controllers/users_controller.rb": "class UsersController < ApplicationController\n  def show\n    @user = User.find(params[:id])\n  end\nend\n",
+}
+
+func TestHoverMergesClassReopenedAcrossFiles(t *testing.T) {
+	s := NewTestServer(reopenedClassFixture)
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("app/controllers/users_controller.rb", 2, 14)), &hover)
+	value := hover.Contents.Value
+
+	if n := strings.Count(value, "class User"); n != 1 {
+		t.Errorf("hover describes User %d times, want once:\n%s", n, value)
+	}
+	for _, want := range []string{
+		"**Defined in:** `app/models/user.rb:1`, `app/models/user/admin_extensions.rb:1`",
+		"**Includes:** `Searchable`, `Auditable`",
+	} {
+		if !strings.Contains(value, want) {
+			t.Errorf("hover missing %q:\n%s", want, value)
+		}
+	}
+}
+
+func TestHoverNotesModuleFunctionsAreCallableBothWays(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"lib/formatting.rb":                    "module Formatting\n  module_function\n\n  def money(amount)\n  end\nend\n",
+		"app/controllers/orders_controller.rb": "class OrdersController\n  def show\n    Formatting.money(10)\n  end\nend\n",
+	})
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("app/controllers/orders_controller.rb", 2, 17)), &hover)
+	value := hover.Contents.Value
+
+	if want := "**Callable as:** `Formatting.money` and as an instance method (module_function)"; !strings.Contains(value, want) {
+		t.Errorf("hover missing %q:\n%s", want, value)
+	}
+	if n := strings.Count(value, "**Defined in:**"); n != 1 {
+		t.Errorf("hover describes money %d times, want once:\n%s", n, value)
+	}
+}
+
+func TestHoverShowsMethodSourceWhenEnabled(t *testing.T) {
+	var source strings.Builder
+	source.WriteString("class Order\n  def total\n    items.sum(&:price)\n  end\n\n  def render\n")
+	for i := 0; i < 20; i++ {
+		source.WriteString("    line\n")
+	}
+	source.WriteString("  end\n\n  def print\n    total\n    render\n  end\nend\n")
+	root := writeWorkspace(t, map[string]string{"app/models/order.rb": source.String()})
+	s := NewTestServer(nil)
+	idx := indexer.New(root, log.New(io.Discard, "", 0))
+	idx.BuildIndex(context.Background())
+	s.Indexer = idx
+	uri := store.PathToURI(filepath.Join(root, "app/models/order.rb"))
+	s.Store.Set(uri, source.String(), 1, "ruby")
+
+	hoverAt := func(line, character int) string {
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		decode(t, s.HandleHover(map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": float64(line), "character": float64(character)},
+		}), &hover)
+		return hover.Contents.Value
+	}
+
+	snippet := "```ruby\ndef total\n  items.sum(&:price)\nend\n```"
+	if value := hoverAt(29, 6); strings.Contains(value, snippet) {
+		t.Errorf("hover shows the source without showSource:\n%s", value)
+	}
+
+	s.GlobalState.HoverShowSource = true
+	if value := hoverAt(29, 6); !strings.Contains(value, snippet) {
+		t.Errorf("hover missing the source of total:\n%s", value)
+	}
+	value := hoverAt(30, 6)
+	if n := strings.Count(value, "\n  line"); n != maxHoverSourceLines-1 {
+		t.Errorf("hover shows %d lines of render's body, want %d:\n%s", n, maxHoverSourceLines-1, value)
+	}
+	if !strings.Contains(value, "\n# …\n```") {
+		t.Errorf("hover does not mark render's source as cut short:\n%s", value)
+	}
+}
+
+func TestHoverOfAssociationsLinksToTheirModel(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/post.rb":    "class Post < ApplicationRecord\n  has_many :comments\n  belongs_to :author, class_name: \"User\"\n  has_one :cover_image\nend\n",
+		"app/models/comment.rb": "class Comment < ApplicationRecord\nend\n",
+		"app/models/user.rb":    "class User < ApplicationRecord\nend\n",
+	})
+
+	tests := []struct {
+		line int
+		want string
+	}{
+		{1, "**Model:** [`Comment`](" + testFileURI("app/models/comment.rb") + "#L1)"},
+		{2, "**Model:** [`User`](" + testFileURI("app/models/user.rb") + "#L1)"},
+		// Not indexed, so named without a link
+		{3, "**Model:** `CoverImage`"},
+	}
+	for _, test := range tests {
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		decode(t, s.HandleHover(positionParams("app/models/post.rb", test.line, 15)), &hover)
+		if !strings.Contains(hover.Contents.Value, test.want) {
+			t.Errorf("hover on line %d missing %q:\n%s", test.line, test.want, hover.Contents.Value)
+		}
+	}
+}
+
+func TestHoverOrdersSignaturesByPreferredTypeSource(t *testing.T) {
+	source := `class Order
+  extend T::Sig
+
+  # @param amount [Integer]
+  # @return [Receipt]
+  sig { params(amount: Integer).returns(T.nilable(Receipt)) }
+  def charge(amount)
+  end
+end
+`
+	root := writeWorkspace(t, map[string]string{
+		"app/models/order.rb": source,
+		"sig/order.rbs":       "class Order\n  def charge: (Integer amount) -> Receipt?\nend\n",
+	})
+	s := NewTestServer(nil)
+	idx := indexer.NewWithOptions(root, log.New(io.Discard, "", 0), indexer.Options{TypeSignatures: true})
+	idx.BuildIndex(context.Background())
+	s.Indexer = idx
+	uri := store.PathToURI(filepath.Join(root, "app/models/order.rb"))
+	s.Store.Set(uri, source, 1, "ruby")
+
+	signatureSources := func() []string {
+		var hover struct {
+			Contents struct {
+				Value string `json:"value"`
+			} `json:"contents"`
+		}
+		decode(t, s.HandleHover(map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": float64(6), "character": float64(7)},
+		}), &hover)
+		var sources []string
+		for _, line := range strings.Split(hover.Contents.Value, "\n") {
+			if rest, ok := strings.CutPrefix(line, "**Signature ("); ok {
+				sources = append(sources, rest[:strings.Index(rest, ")")])
+			}
+		}
+		return sources
+	}
+
+	tests := []struct {
+		prefer string
+		want   []string
+	}{
+		{"", []string{"sorbet", "rbs", "yard"}},
+		{"auto", []string{"sorbet", "rbs", "yard"}},
+		{"yard", []string{"yard", "sorbet", "rbs"}},
+		{"rbs", []string{"rbs", "sorbet", "yard"}},
+		{"sorbet", []string{"sorbet", "rbs", "yard"}},
+	}
+	for _, test := range tests {
+		s.GlobalState.HoverPreferType = test.prefer
+		if got := signatureSources(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("preferType %q: signatures from %v, want %v", test.prefer, got, test.want)
+		}
+	}
+}
+
+func TestInitializeReadsHoverPreferType(t *testing.T) {
+	for preferType, want := range map[string]string{"yard": "yard", "rbs": "rbs", "typescript": "auto"} {
+		s := NewTestServer(nil)
+		s.HandleInitialize(map[string]interface{}{
+			"initializationOptions": map[string]interface{}{
+				"hover": map[string]interface{}{"preferType": preferType},
+			},
+		})
+		if got := s.hoverPreferType(); got != want {
+			t.Errorf("hoverPreferType() after preferType %q = %q, want %q", preferType, got, want)
+		}
+	}
+}
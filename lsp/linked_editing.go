@@ -0,0 +1,91 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// Names a linked edit may turn a local variable into
+const localVariableWordPattern = `[a-z_][A-Za-z0-9_]*`
+
+// A valid name for a local variable
+var localVariableNamePattern = regexp.MustCompile(`^` + localVariableWordPattern + `$`)
+
+// HandleLinkedEditingRange handles textDocument/linkedEditingRange request. A local
+// variable or parameter under the cursor is linked with its other uses in the
+// enclosing method, and nowhere else, so methods sharing the name are untouched.
+func (s *Server) HandleLinkedEditingRange(params interface{}) interface{} {
+	s.Logger.Println("Processing linked editing range request")
+
+	uri, pos := extractTextDocumentPosition(params)
+	if uri == "" {
+		return nil
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return nil
+	}
+
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if token.Kind != indexer.TokenIdentifier || !localVariableNamePattern.MatchString(token.Text) {
+		return nil
+	}
+	if receiverBefore(doc.Source, pos.Line, token.StartCharacter) != "" {
+		return nil
+	}
+
+	method, ok := enclosingMethodBody(doc.Source, pos.Line+1)
+	if !ok {
+		return nil
+	}
+
+	occurrences := indexer.LocalOccurrences(doc.Source, token.Text, method.Line, method.EndLine)
+	var ranges []interface{}
+	atCursor := false
+	for _, occurrence := range occurrences {
+		ranges = append(ranges, lineRange(occurrence.Line, occurrence.Character, occurrence.EndCharacter))
+		atCursor = atCursor || (occurrence.Line == pos.Line+1 && occurrence.Character == token.StartCharacter)
+	}
+	// A symbol or hash key under the cursor is not the variable
+	if !atCursor || len(ranges) < 2 {
+		return nil
+	}
+	return map[string]interface{}{
+		"ranges":      ranges,
+		"wordPattern": localVariableWordPattern,
+	}
+}
+
+// enclosingMethodBody returns the innermost method body around a 1-based line
+// of source, the scope of the local variables used on it
+func enclosingMethodBody(source string, line int) (indexer.BodyRange, bool) {
+	lines := strings.Split(source, "\n")
+	var method *indexer.BodyRange
+	for _, body := range indexer.BodyRanges(source) {
+		if body.Line <= line && line <= body.EndLine && methodStartPattern.MatchString(lines[body.Line-1]) &&
+			(method == nil || body.Line > method.Line) {
+			body := body
+			method = &body
+		}
+	}
+	if method == nil {
+		return indexer.BodyRange{}, false
+	}
+	return *method, true
+}
+
+// localDefinition finds where the local variable under the cursor was last bound
+// in the enclosing method. Names called on a receiver are not local variables.
+func localDefinition(source string, token indexer.Token, line int) (indexer.Occurrence, bool) {
+	if token.Kind != indexer.TokenIdentifier || !localVariableNamePattern.MatchString(token.Text) ||
+		receiverBefore(source, line, token.StartCharacter) != "" {
+		return indexer.Occurrence{}, false
+	}
+	method, ok := enclosingMethodBody(source, line+1)
+	if !ok {
+		return indexer.Occurrence{}, false
+	}
+	return indexer.LocalDefinition(source, token.Text, method.Line, line+1, token.StartCharacter)
+}
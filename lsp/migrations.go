@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"fmt"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// HandleTypeDefinition handles textDocument/typeDefinition request.
+// On a model class it lists the migrations creating and altering the model's table;
+// on an association, named where it is declared or called, it goes to the model
+// the association holds.
+func (s *Server) HandleTypeDefinition(params interface{}) interface{} {
+	s.Logger.Println("Processing type definition request")
+
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return []interface{}{}
+	}
+
+	uri, pos := extractTextDocumentPosition(params)
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return []interface{}{}
+	}
+
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+	if token.Kind == indexer.TokenIdentifier || token.Kind == indexer.TokenSymbol {
+		return associationModelLocations(idx, token.Name(), scope)
+	}
+	if token.Kind != indexer.TokenConstant {
+		return []interface{}{}
+	}
+	class := idx.ResolveConstantPath(token.Qualified(), scope)
+
+	return migrationLocations(idx.Migrations(class))
+}
+
+// associationModelLocations locates the models held by the associations of a
+// name, those of the enclosing class when it declares one
+func associationModelLocations(idx indexer.SymbolIndex, name string, scope string) []interface{} {
+	associations := filterEntries(idx.Lookup(name), func(entry indexer.SymbolEntry) bool {
+		return entry.Type == indexer.SymbolAssociation
+	})
+	if members := filterEntries(associations, func(entry indexer.SymbolEntry) bool {
+		return isMemberOf(idx, entry, scope)
+	}); len(members) > 0 {
+		associations = members
+	}
+
+	locations := []interface{}{}
+	seen := make(map[string]bool)
+	for _, association := range associations {
+		for _, model := range idx.AssociationTarget(association) {
+			key := fmt.Sprintf("%s:%d", model.FilePath, model.Line)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			locations = append(locations, map[string]interface{}{
+				"uri":   store.PathToURI(model.FilePath),
+				"range": lineRange(model.Line, model.Character, nameEndCharacter(model)),
+			})
+		}
+	}
+	return locations
+}
+
+// migrationLocations converts migration statements to LSP locations
+func migrationLocations(migrations []indexer.Migration) []interface{} {
+	locations := []interface{}{}
+	for _, migration := range migrations {
+		locations = append(locations, map[string]interface{}{
+			"uri":   store.PathToURI(migration.FilePath),
+			"range": lineRange(migration.Line, migration.Character, migration.Character+len(migration.Action)),
+		})
+	}
+	return locations
+}
@@ -0,0 +1,67 @@
+package lsp
+
+import "github.com/humberto/ruby-lsp-go/indexer"
+
+// Scheme of the monikers this server hands out
+const monikerScheme = "ruby-lsp-go"
+
+// HandleMoniker handles textDocument/moniker request. The constant or method under
+// the cursor is identified by its fully qualified name (ruby::Admin::User#save),
+// which stays the same across checkouts, as an export where it is defined and an
+// import where it is referenced. A method call whose receiver cannot be told gets
+// a moniker for every method of that name.
+func (s *Server) HandleMoniker(params interface{}) interface{} {
+	s.Logger.Println("Processing moniker request")
+
+	idx := s.Indexer
+	if idx == nil {
+		return nil
+	}
+	uri, pos := extractTextDocumentPosition(params)
+	filePath := uriToFilePath(uri)
+
+	var entries []indexer.SymbolEntry
+	if fqn, ok := s.constantAtPosition(params); ok {
+		entries = filterEntries(idx.Lookup(fqn), func(entry indexer.SymbolEntry) bool {
+			return entry.FullyQualifiedName == fqn
+		})
+	} else if name, ok := s.methodAtPosition(params); ok {
+		entries = filterEntries(idx.Lookup(name), func(entry indexer.SymbolEntry) bool {
+			return entry.Type == indexer.SymbolMethod || entry.Type == indexer.SymbolSingletonMethod
+		})
+		if owner := s.methodOwnerAtPosition(params); owner != "" {
+			if members := filterEntries(entries, func(entry indexer.SymbolEntry) bool {
+				return isMemberOf(idx, entry, owner)
+			}); len(members) > 0 {
+				entries = members
+			}
+		}
+	}
+
+	// The cursor is on a definition when one of them is defined on its line
+	kind := "import"
+	for _, entry := range entries {
+		if entry.FilePath == filePath && entry.Line == pos.Line+1 {
+			entries = []indexer.SymbolEntry{entry}
+			kind = "export"
+			break
+		}
+	}
+
+	monikers := []interface{}{}
+	seen := make(map[string]bool)
+	for _, entry := range collapseModuleFunctions(entries) {
+		identifier := "ruby::" + entry.FullyQualifiedName
+		if seen[identifier] {
+			continue
+		}
+		seen[identifier] = true
+		monikers = append(monikers, map[string]interface{}{
+			"scheme":     monikerScheme,
+			"identifier": identifier,
+			"unique":     "scheme",
+			"kind":       kind,
+		})
+	}
+	return monikers
+}
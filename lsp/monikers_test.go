@@ -0,0 +1,39 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonikersOfNestedMethodsAndConstants(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/admin/user.rb":            "module Admin\n  class User\n    def save\n    end\n  end\nend\n",
+		"app/controllers/users_controller.rb": "class UsersController\n  def update\n    Admin::User.new.save\n  end\nend\n",
+	})
+
+	type moniker struct {
+		Scheme     string `json:"scheme"`
+		Identifier string `json:"identifier"`
+		Unique     string `json:"unique"`
+		Kind       string `json:"kind"`
+	}
+	tests := []struct {
+		name      string
+		file      string
+		line      int
+		character int
+		want      []moniker
+	}{
+		{"method definition", "app/models/admin/user.rb", 2, 9, []moniker{{monikerScheme, "ruby::Admin::User#save", "scheme", "export"}}},
+		{"class definition", "app/models/admin/user.rb", 1, 9, []moniker{{monikerScheme, "ruby::Admin::User", "scheme", "export"}}},
+		{"method call", "app/controllers/users_controller.rb", 2, 21, []moniker{{monikerScheme, "ruby::Admin::User#save", "scheme", "import"}}},
+		{"constant reference", "app/controllers/users_controller.rb", 2, 12, []moniker{{monikerScheme, "ruby::Admin::User", "scheme", "import"}}},
+	}
+	for _, test := range tests {
+		var got []moniker
+		decode(t, s.HandleMoniker(positionParams(test.file, test.line, test.character)), &got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: monikers = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
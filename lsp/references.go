@@ -0,0 +1,353 @@
+package lsp
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// A valid name for a class, module or constant
+var constantNamePattern = regexp.MustCompile(`^[A-Z]\w*$`)
+
+// A valid name for a method (save, valid?, destroy!)
+var methodNamePattern = regexp.MustCompile(`^[a-z_]\w*[?!]?$`)
+
+// HandleReferences handles textDocument/references request.
+// Constants (Foo, Admin::Order, HTTP_TIMEOUT) resolve through the reference index,
+// so a same-named local variable or method is never reported.
+// Methods are matched by name, see methodLocations.
+func (s *Server) HandleReferences(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing references request")
+
+	includeDeclaration := true
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if context, ok := paramMap["context"].(map[string]interface{}); ok {
+			if include, ok := context["includeDeclaration"].(bool); ok {
+				includeDeclaration = include
+			}
+		}
+	}
+
+	if s.isCancelled(id) {
+		return []interface{}{}
+	}
+	if fqn, ok := s.constantAtPosition(params); ok {
+		return s.constantLocations(id, fqn, includeDeclaration)
+	}
+	if name, ok := s.methodAtPosition(params); ok {
+		return s.methodLocations(id, params, name, includeDeclaration)
+	}
+	return []interface{}{}
+}
+
+// constantLocations lists the references to a constant
+func (s *Server) constantLocations(id interface{}, fqn string, includeDeclaration bool) interface{} {
+	idx := s.Indexer
+
+	// Lines defining the constant, keyed by file
+	declarations := make(map[string]map[int]bool)
+	for _, entry := range idx.Lookup(fqn) {
+		if entry.FullyQualifiedName != fqn {
+			continue
+		}
+		if declarations[entry.FilePath] == nil {
+			declarations[entry.FilePath] = make(map[int]bool)
+		}
+		declarations[entry.FilePath][entry.Line] = true
+	}
+
+	locations := []interface{}{}
+	for i, ref := range idx.ConstantReferences(fqn) {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
+		}
+		if !includeDeclaration && declarations[ref.FilePath][ref.Line] {
+			continue
+		}
+		locations = append(locations, map[string]interface{}{
+			"uri":   store.PathToURI(ref.FilePath),
+			"range": referenceRange(ref),
+		})
+	}
+
+	s.Logger.Printf("Found %d reference(s) to: %s", len(locations), fqn)
+	return locations
+}
+
+// methodLocations lists the definitions, calls and symbol mentions of a method name.
+// Without type information every method sharing the name is conflated. When the
+// class is known — the cursor is on a def, or the call has a constant receiver —
+// mentions tied to an unrelated class (Other.name, a def in Other) are dropped.
+func (s *Server) methodLocations(id interface{}, params interface{}, name string, includeDeclaration bool) interface{} {
+	idx := s.Indexer
+	owner := s.methodOwnerAtPosition(params)
+
+	locations := []interface{}{}
+	for i, ref := range idx.MethodReferences(name, s.openSources()) {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
+		}
+		if ref.Definition && !includeDeclaration {
+			continue
+		}
+		if owner != "" && !s.referenceMatchesClass(ref, owner) {
+			continue
+		}
+		locations = append(locations, map[string]interface{}{
+			"uri":   store.PathToURI(ref.FilePath),
+			"range": lineRange(ref.Line, ref.Character, ref.EndCharacter),
+		})
+	}
+
+	s.Logger.Printf("Found %d reference(s) to method: %s", len(locations), name)
+	return locations
+}
+
+// methodOwnerAtPosition returns the class of the method under the cursor when it
+// can be told: the enclosing class of a def, or a constant receiver (Order.find)
+func (s *Server) methodOwnerAtPosition(params interface{}) string {
+	idx := s.Indexer
+	uri, pos := extractTextDocumentPosition(params)
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return ""
+	}
+
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+
+	if receiver := receiverBefore(doc.Source, pos.Line, token.StartCharacter); receiver != "" {
+		if isCapitalized(receiver) {
+			return idx.ResolveConstantPath(receiver, scope)
+		}
+		return ""
+	}
+
+	lines := strings.Split(doc.Source, "\n")
+	before := string([]rune(lines[pos.Line])[:token.StartCharacter])
+	if indexer.IsDefinitionPrefix(before) {
+		return scope
+	}
+	return ""
+}
+
+// referenceMatchesClass reports whether a method mention may belong to the given
+// class: definitions must be in a related class, constant receivers must resolve to one.
+// Mentions whose class cannot be told are kept.
+func (s *Server) referenceMatchesClass(ref indexer.MethodReference, owner string) bool {
+	idx := s.Indexer
+
+	class := ""
+	switch {
+	case ref.Definition:
+		class = idx.EnclosingScope(ref.FilePath, ref.Line)
+	case ref.Receiver != "" && isCapitalized(ref.Receiver):
+		scope := idx.EnclosingScope(ref.FilePath, ref.Line)
+		if len(idx.LookupInScope(ref.Receiver, scope)) == 0 {
+			return true
+		}
+		class = idx.ResolveConstantPath(ref.Receiver, scope)
+	default:
+		return true
+	}
+
+	if class == owner {
+		return true
+	}
+	for _, superclass := range idx.SuperclassChain(class) {
+		if superclass == owner {
+			return true
+		}
+	}
+	for _, superclass := range idx.SuperclassChain(owner) {
+		if superclass == class {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleRename handles textDocument/rename request. Constants and methods can be renamed.
+// For a constant every reference resolving to the same definition is rewritten, nothing else;
+// for a method every definition, call and symbol naming it (alias, delegate, define_method).
+func (s *Server) HandleRename(params interface{}) interface{} {
+	s.Logger.Println("Processing rename request")
+
+	newName := ""
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		newName, _ = paramMap["newName"].(string)
+	}
+
+	if fqn, ok := s.constantAtPosition(params); ok {
+		return s.renameConstant(fqn, newName)
+	}
+	if name, ok := s.methodAtPosition(params); ok {
+		return s.renameMethod(params, name, newName)
+	}
+	return nil
+}
+
+// renameConstant rewrites every reference to a constant
+func (s *Server) renameConstant(fqn string, newName string) interface{} {
+	if !constantNamePattern.MatchString(newName) {
+		s.Logger.Printf("Refusing to rename %s to invalid constant name %q", fqn, newName)
+		return nil
+	}
+
+	changes := make(map[string][]interface{})
+	for _, ref := range s.Indexer.ConstantReferences(fqn) {
+		uri := store.PathToURI(ref.FilePath)
+		changes[uri] = append(changes[uri], map[string]interface{}{
+			"range":   referenceRange(ref),
+			"newText": newName,
+		})
+	}
+
+	s.Logger.Printf("Renaming %s to %s in %d file(s)", fqn, newName, len(changes))
+	return map[string]interface{}{
+		"changes": changes,
+	}
+}
+
+// renameMethod rewrites the mentions of a method name across the indexed files,
+// reading open documents from their buffers. Mentions tied to a class unrelated
+// to the renamed method's (Other.name, a def in Other) are left alone.
+func (s *Server) renameMethod(params interface{}, name string, newName string) interface{} {
+	if !methodNamePattern.MatchString(newName) {
+		s.Logger.Printf("Refusing to rename %s to invalid method name %q", name, newName)
+		return nil
+	}
+
+	owner := s.methodOwnerAtPosition(params)
+	if owner == "" {
+		owner = s.soleMethodOwner(name)
+	}
+
+	idx := s.Indexer
+	changes := make(map[string][]interface{})
+	for _, ref := range idx.MethodReferences(name, s.openSources()) {
+		if owner != "" && !s.referenceMatchesClass(ref, owner) {
+			continue
+		}
+		uri := store.PathToURI(ref.FilePath)
+		changes[uri] = append(changes[uri], map[string]interface{}{
+			"range":   lineRange(ref.Line, ref.Character, ref.EndCharacter),
+			"newText": newName,
+		})
+	}
+
+	s.Logger.Printf("Renaming method %s to %s in %d file(s)", name, newName, len(changes))
+	return map[string]interface{}{
+		"changes": changes,
+	}
+}
+
+// soleMethodOwner returns the class defining every indexed method of a name,
+// "" when methods of that name are defined in more than one
+func (s *Server) soleMethodOwner(name string) string {
+	owner := ""
+	for _, entry := range s.Indexer.Lookup(name) {
+		if entry.Type != indexer.SymbolMethod && entry.Type != indexer.SymbolSingletonMethod {
+			continue
+		}
+		if owner != "" && entry.Parent != owner {
+			return ""
+		}
+		owner = entry.Parent
+	}
+	return owner
+}
+
+// openSources returns the buffers of open files by file path
+func (s *Server) openSources() map[string]string {
+	sources := make(map[string]string)
+	for uri, doc := range s.Store.SnapshotAll() {
+		if strings.HasPrefix(uri, "file://") {
+			sources[uriToFilePath(uri)] = doc.Source
+		}
+	}
+	return sources
+}
+
+// methodAtPosition returns the method name under the cursor, written as a call,
+// definition or symbol, when a method of that name is indexed
+func (s *Server) methodAtPosition(params interface{}) (string, bool) {
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return "", false
+	}
+
+	uri, pos := extractTextDocumentPosition(params)
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return "", false
+	}
+
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if token.Kind != indexer.TokenIdentifier && token.Kind != indexer.TokenSymbol {
+		return "", false
+	}
+	// A symbol (before_save :normalize) names the method without its colon
+	name := token.Name()
+	for _, entry := range idx.Lookup(name) {
+		switch entry.Type {
+		case indexer.SymbolMethod, indexer.SymbolSingletonMethod:
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// constantAtPosition resolves the constant under the cursor to its fully qualified
+// name, taking the lexical scope at the cursor into account
+func (s *Server) constantAtPosition(params interface{}) (string, bool) {
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return "", false
+	}
+
+	uri, pos := extractTextDocumentPosition(params)
+	if uri == "" {
+		return "", false
+	}
+
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return "", false
+	}
+
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if token.Kind != indexer.TokenConstant {
+		return "", false
+	}
+
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+	return idx.ResolveConstantPath(token.Qualified(), scope), true
+}
+
+// referenceRange converts a constant reference to an LSP range
+func referenceRange(ref indexer.ConstantReference) map[string]interface{} {
+	return lineRange(ref.Line, ref.Character, ref.EndCharacter)
+}
+
+// nameEndCharacter returns the character where an entry's name ends on its line,
+// counting the name in UTF-16 code units like the rest of the position
+func nameEndCharacter(entry indexer.SymbolEntry) int {
+	return entry.Character + indexer.UTF16Column(entry.Name, len(entry.Name))
+}
+
+// lineRange builds an LSP range within a single 1-based line
+func lineRange(line int, character int, endCharacter int) map[string]interface{} {
+	return map[string]interface{}{
+		"start": map[string]interface{}{
+			"line":      line - 1, // LSP is 0-indexed
+			"character": character,
+		},
+		"end": map[string]interface{}{
+			"line":      line - 1,
+			"character": endCharacter,
+		},
+	}
+}
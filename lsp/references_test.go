@@ -0,0 +1,132 @@
+package lsp
+
+import (
+	"sort"
+	"testing"
+)
+
+// A model, a controller and a view mentioning the model's normalize method
+var renameFixture = map[string]string{
+	"app/models/user.rb": `class User
+  before_save :normalize
+
+  def normalize
+    self.email = email.downcase
+  end
+
+  alias_method :clean, :normalize
+end
+`,
+	"app/controllers/users_controller.rb": `class UsersController
+  def update
+    @user = User.find(params[:id])
+    @user.normalize # "normalize" in a comment or string is not renamed
+  end
+end
+`,
+	"app/views/users/show.json.jbuilder": `json.email @user.normalize
+json.updated_at I18n.l(@user.updated_at)
+`,
+}
+
+// editedLines lists the 0-based lines and columns a workspace edit rewrites in a file
+func editedLines(edit testWorkspaceEdit, name string) []testPosition {
+	var positions []testPosition
+	for _, change := range edit.Changes[testFileURI(name)] {
+		positions = append(positions, change.Range.Start)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Line != positions[j].Line {
+			return positions[i].Line < positions[j].Line
+		}
+		return positions[i].Character < positions[j].Character
+	})
+	return positions
+}
+
+func samePositions(got []testPosition, want ...testPosition) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRenameMethodFromSymbolCoversModelControllerAndView(t *testing.T) {
+	s := NewTestServer(renameFixture)
+
+	params := positionParams("app/models/user.rb", 1, 16) // before_save :normalize
+	params["newName"] = "canonicalize"
+
+	var edit testWorkspaceEdit
+	decode(t, s.HandleRename(params), &edit)
+
+	if len(edit.Changes) != 3 {
+		t.Fatalf("rename changed %d files, want the model, controller and view: %+v", len(edit.Changes), edit.Changes)
+	}
+	if got := editedLines(edit, "app/models/user.rb"); !samePositions(got, testPosition{1, 15}, testPosition{3, 6}, testPosition{7, 24}) {
+		t.Errorf("model edits at %v, want the before_save symbol, the def and the alias_method symbol", got)
+	}
+	if got := editedLines(edit, "app/controllers/users_controller.rb"); !samePositions(got, testPosition{3, 10}) {
+		t.Errorf("controller edits at %v, want only the call", got)
+	}
+	if got := editedLines(edit, "app/views/users/show.json.jbuilder"); !samePositions(got, testPosition{0, 17}) {
+		t.Errorf("view edits at %v, want the call", got)
+	}
+	for uri, changes := range edit.Changes {
+		for _, change := range changes {
+			if change.NewText != "canonicalize" || change.Range.End.Character-change.Range.Start.Character != len("normalize") {
+				t.Errorf("%s: edit %+v does not replace the name alone", uri, change)
+			}
+		}
+	}
+}
+
+func TestRenameMethodLeavesUnrelatedClassesAlone(t *testing.T) {
+	files := map[string]string{
+		"app/models/account.rb": "class Account\n  def normalize\n  end\nend\n\nAccount.normalize\n",
+	}
+	for name, source := range renameFixture {
+		files[name] = source
+	}
+	s := NewTestServer(files)
+
+	params := positionParams("app/models/user.rb", 3, 8) // def normalize
+	params["newName"] = "canonicalize"
+
+	var edit testWorkspaceEdit
+	decode(t, s.HandleRename(params), &edit)
+
+	if got := editedLines(edit, "app/models/account.rb"); len(got) != 0 {
+		t.Errorf("Account edited at %v, want it untouched", got)
+	}
+	if got := editedLines(edit, "app/models/user.rb"); len(got) != 3 {
+		t.Errorf("User edited at %v, want 3 mentions", got)
+	}
+}
+
+func TestReferencesFromSymbolResolveTheMethod(t *testing.T) {
+	s := NewTestServer(renameFixture)
+
+	var locations []testLocation
+	decode(t, s.HandleReferences(1, positionParams("app/models/user.rb", 7, 26)), &locations) // alias_method :clean, :normalize
+
+	files := make(map[string]int)
+	for _, location := range locations {
+		files[location.URI]++
+	}
+	want := map[string]int{
+		testFileURI("app/models/user.rb"):                  3,
+		testFileURI("app/controllers/users_controller.rb"): 1,
+		testFileURI("app/views/users/show.json.jbuilder"):  1,
+	}
+	for uri, count := range want {
+		if files[uri] != count {
+			t.Errorf("%d reference(s) in %s, want %d (all: %+v)", files[uri], uri, count, locations)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A require, require_relative or load naming a file with a string literal
+var requirePattern = regexp.MustCompile(`^\s*(require|require_relative|load)\s*\(?\s*["']([^"']+)["']`)
+
+// A require, require_relative or load whose string is still being typed at the end of the text
+var requirePrefixPattern = regexp.MustCompile(`^\s*(require|require_relative|load)\s*\(?\s*["']([^"']*)$`)
+
+// requiredFiles resolves the workspace files Ruby source requires: require_relative
+// against the file's own directory, require and load against the lib directory
+// and the root of each workspace folder, as a typical $LOAD_PATH would. Requires
+// of gems and the standard library resolve to nothing and are skipped.
+func (s *Server) requiredFiles(source string, filePath string) []string {
+	var roots []string
+	if idx := s.Indexer; idx != nil {
+		roots = idx.Roots()
+	}
+
+	var files []string
+	for _, line := range strings.Split(source, "\n") {
+		matches := requirePattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		name := matches[2]
+		if filepath.Ext(name) == "" {
+			name += ".rb"
+		}
+		var candidates []string
+		if matches[1] == "require_relative" {
+			candidates = []string{filepath.Join(filepath.Dir(filePath), name)}
+		} else {
+			for _, root := range roots {
+				candidates = append(candidates, filepath.Join(root, "lib", name), filepath.Join(root, name))
+			}
+		}
+		for _, candidate := range candidates {
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				files = append(files, candidate)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// reachableFiles returns the files whose definitions Ruby source can count on
+// through require: the file itself, the files it requires and the files those
+// require in turn. Deeper requires are not followed. The result is cached for
+// the file until its requires change or a file it reaches is edited, saved or
+// changed on disk, so completions do not stat and read the required files on
+// every keystroke.
+func (s *Server) reachableFiles(source string, filePath string) map[string]bool {
+	requires := requireLines(source)
+	s.reachableMutex.Lock()
+	cached, ok := s.reachableCache[filePath]
+	s.reachableMutex.Unlock()
+	if ok && cached.requires == requires {
+		return cached.files
+	}
+
+	reachable := map[string]bool{filePath: true}
+	required := s.requiredFiles(source, filePath)
+	for _, path := range required {
+		reachable[path] = true
+	}
+
+	for _, path := range required {
+		var content string
+		if doc, open := s.Store.GetByPath(path); open {
+			content = doc.Source
+		} else if data, err := os.ReadFile(path); err == nil {
+			content = string(data)
+		}
+		for _, nested := range s.requiredFiles(content, path) {
+			reachable[nested] = true
+		}
+	}
+
+	s.reachableMutex.Lock()
+	if s.reachableCache == nil {
+		s.reachableCache = make(map[string]reachableEntry)
+	}
+	s.reachableCache[filePath] = reachableEntry{requires: requires, files: reachable}
+	s.reachableMutex.Unlock()
+	return reachable
+}
+
+// reachableEntry is what reachableFiles found for a file, with the require lines
+// it was found from
+type reachableEntry struct {
+	requires string
+	files    map[string]bool
+}
+
+// requireLines returns the require lines of Ruby source, joined, as the key of
+// what it reaches
+func requireLines(source string) string {
+	var lines []string
+	for _, line := range strings.Split(source, "\n") {
+		if requirePattern.MatchString(line) {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// invalidateReachable forgets what reachableFiles found through a file whose
+// contents changed, as its own requires may have; "" forgets everything, for
+// files created or deleted on disk that requires may now resolve to or not
+func (s *Server) invalidateReachable(path string) {
+	s.reachableMutex.Lock()
+	defer s.reachableMutex.Unlock()
+
+	for file, entry := range s.reachableCache {
+		if path == "" || (file != path && entry.files[path]) {
+			delete(s.reachableCache, file)
+		}
+	}
+}
+
+// requirePath is a completion offered inside the string of a require
+type requirePath struct {
+	path string // as it completes the string: no .rb, a trailing / for directories
+	kind int
+}
+
+// requirePathCandidates returns what may complete the path typed in a require:
+// for require_relative the Ruby files and directories next to the current file,
+// for require and load those under the lib directory and the root of each
+// workspace folder, and the gems of their Gemfiles. The directories named by the
+// typed path so far are listed, keeping the entries starting with what follows
+// its last slash.
+func (s *Server) requirePathCandidates(method string, typed string, filePath string) []requirePath {
+	var bases []string
+	if method == "require_relative" {
+		if filePath == "" {
+			return nil
+		}
+		bases = []string{filepath.Dir(filePath)}
+	} else if idx := s.Indexer; idx != nil {
+		for _, root := range idx.Roots() {
+			bases = append(bases, filepath.Join(root, "lib"), root)
+		}
+	}
+
+	dir, partial := "", typed
+	if slash := strings.LastIndex(typed, "/"); slash >= 0 {
+		dir, partial = typed[:slash+1], typed[slash+1:]
+	}
+
+	seen := make(map[string]bool)
+	var candidates []requirePath
+	add := func(path string, kind int) {
+		if !seen[path] {
+			seen[path] = true
+			candidates = append(candidates, requirePath{path: path, kind: kind})
+		}
+	}
+	for _, base := range bases {
+		entries, err := os.ReadDir(filepath.Join(base, filepath.FromSlash(dir)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") || !strings.HasPrefix(name, partial) {
+				continue
+			}
+			switch {
+			case entry.IsDir():
+				add(dir+name+"/", completionKindFolder)
+			case filepath.Ext(name) == ".rb":
+				add(dir+strings.TrimSuffix(name, ".rb"), completionKindFile)
+			}
+		}
+	}
+
+	// Gems are required by name (require "sidekiq")
+	if method == "require" && dir == "" {
+		if idx := s.Indexer; idx != nil {
+			for _, root := range idx.Roots() {
+				for _, gem := range directGems(filepath.Join(root, "Gemfile"), gemfileGemPattern, "") {
+					if strings.HasPrefix(gem, partial) {
+						add(gem, completionKindModule)
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].path < candidates[j].path
+	})
+	return candidates
+}
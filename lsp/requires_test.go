@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+func TestReachableFilesCachedUntilInvalidated(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"lib/billing.rb":     "require \"billing/tax\"\n\nmodule Billing\nend\n",
+		"lib/billing/tax.rb": "module Billing\n  class Tax\n  end\nend\n",
+		"lib/shipping.rb":    "module Shipping\nend\n",
+	})
+	s := NewTestServer(nil)
+	s.Indexer = indexer.New(root, log.New(io.Discard, "", 0))
+
+	app := filepath.Join(root, "app.rb")
+	billing := filepath.Join(root, "lib", "billing.rb")
+	tax := filepath.Join(root, "lib", "billing", "tax.rb")
+	shipping := filepath.Join(root, "lib", "shipping.rb")
+	source := "require \"billing\"\n\nBilling::\n"
+
+	reachable := s.reachableFiles(source, app)
+	for _, path := range []string{app, billing, tax} {
+		if !reachable[path] {
+			t.Errorf("%s not reachable from app.rb: %v", path, reachable)
+		}
+	}
+	if reachable[shipping] {
+		t.Error("shipping.rb reachable without being required")
+	}
+
+	// Cached: the nested require is not read again, even once it is gone
+	if err := os.WriteFile(billing, []byte("module Billing\nend\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !s.reachableFiles(source+"Billing::Tax\n", app)[tax] {
+		t.Error("reachableFiles recomputed for an edit that left the requires alone")
+	}
+
+	// Editing a required file drops what was found through it
+	s.invalidateReachable(billing)
+	if s.reachableFiles(source, app)[tax] {
+		t.Error("tax.rb still reachable after billing.rb stopped requiring it")
+	}
+
+	// Changing the file's own requires recomputes
+	if !s.reachableFiles(source+"require \"shipping\"\n", app)[shipping] {
+		t.Error("shipping.rb not reachable once required")
+	}
+}
+
+func TestRequireAwareCompletionRanksRequiredFilesFirst(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"lib/billing.rb":  "class TaxRate\nend\n",
+		"lib/shipping.rb": "class TaxZone\nend\n",
+	})
+	idx := indexer.New(root, log.New(io.Discard, "", 0))
+	idx.BuildIndex(context.Background())
+
+	s := NewTestServer(nil)
+	s.Indexer = idx
+	s.GlobalState.RequireAware = true
+	uri := store.PathToURI(filepath.Join(root, "app.rb"))
+	s.Store.Set(uri, "require \"billing\"\n\nTax\n", 1, "ruby")
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+		"position":     map[string]interface{}{"line": float64(2), "character": float64(3)},
+	}), &list)
+
+	sortTexts := make(map[string]string)
+	for _, item := range list.Items {
+		sortTexts[item.Label] = item.SortText
+	}
+	if rate, zone := sortTexts["TaxRate"], sortTexts["TaxZone"]; rate == "" || zone == "" || rate >= zone {
+		t.Errorf("sortText TaxRate %q, TaxZone %q; want the required file's class first", rate, zone)
+	}
+}
+
+func TestCompletionOfRequirePaths(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"app/boot.rb":                      "",
+		"app/models/user.rb":               "",
+		"app/models/user_session.rb":       "",
+		"app/models/order.rb":              "",
+		"app/models/concerns/auditable.rb": "",
+		"app/models/README.md":             "",
+		"app/models/.hidden.rb":            "",
+		"lib/billing.rb":                   "",
+		"lib/billing/tax.rb":               "",
+		"Gemfile":                          "gem \"rails\"\ngem \"bigdecimal\"\ngem \"sidekiq\"\n",
+	})
+	s := NewTestServer(nil)
+	s.Indexer = indexer.New(root, log.New(io.Discard, "", 0))
+	uri := store.PathToURI(filepath.Join(root, "app/boot.rb"))
+
+	type item struct {
+		Label    string `json:"label"`
+		Kind     int    `json:"kind"`
+		TextEdit struct {
+			Range   testRange `json:"range"`
+			NewText string    `json:"newText"`
+		} `json:"textEdit"`
+	}
+	complete := func(line string) map[string]item {
+		s.Store.Set(uri, line+"\n", 1, "ruby")
+		var list struct {
+			Items []item `json:"items"`
+		}
+		decode(t, s.HandleCompletion(1, map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"position":     map[string]interface{}{"line": float64(0), "character": float64(len(line))},
+		}), &list)
+		items := make(map[string]item)
+		for _, got := range list.Items {
+			items[got.Label] = got
+		}
+		return items
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want map[string]int
+	}{
+		{
+			name: "files and directories next to the current file",
+			line: `require_relative "models/`,
+			want: map[string]int{
+				"models/user":         completionKindFile,
+				"models/user_session": completionKindFile,
+				"models/order":        completionKindFile,
+				"models/concerns/":    completionKindFolder,
+			},
+		},
+		{
+			name: "entries starting with what follows the last slash",
+			line: `require_relative("models/us`,
+			want: map[string]int{"models/user": completionKindFile, "models/user_session": completionKindFile},
+		},
+		{
+			name: "lib files and gems of the Gemfile",
+			line: `require "bi`,
+			want: map[string]int{"billing": completionKindFile, "billing/": completionKindFolder, "bigdecimal": completionKindModule},
+		},
+		{
+			name: "gems only at the top of a path",
+			line: `require 'billing/`,
+			want: map[string]int{"billing/tax": completionKindFile},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items := complete(test.line)
+			if len(items) != len(test.want) {
+				t.Errorf("completion of %s = %+v, want %v", test.line, items, test.want)
+			}
+			typed := test.line[strings.IndexAny(test.line, `"'`)+1:]
+			for label, kind := range test.want {
+				got, ok := items[label]
+				if !ok {
+					t.Errorf("%s missing from the completion of %s", label, test.line)
+					continue
+				}
+				if got.Kind != kind {
+					t.Errorf("%s kind = %d, want %d", label, got.Kind, kind)
+				}
+				// The whole path typed so far is replaced
+				if r := got.TextEdit.Range; got.TextEdit.NewText != label || r.Start.Character != len(test.line)-len(typed) || r.End.Character != len(test.line) {
+					t.Errorf("%s text edit = %+v, want %q over the typed path", label, got.TextEdit, label)
+				}
+			}
+		})
+	}
+}
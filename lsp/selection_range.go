@@ -0,0 +1,108 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/documents"
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// HandleSelectionRange handles textDocument/selectionRange request. Each position
+// expands from the word under it to its statement, then through every enclosing
+// block, method, class and module body, and finally the whole file.
+func (s *Server) HandleSelectionRange(params interface{}) interface{} {
+	s.Logger.Println("Processing selection range request")
+
+	results := []interface{}{}
+	uri := extractTextDocumentURI(params)
+	if uri == "" {
+		return results
+	}
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return results
+	}
+
+	var positions []documents.Position
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if list, ok := paramMap["positions"].([]interface{}); ok {
+			for _, item := range list {
+				if posMap, ok := item.(map[string]interface{}); ok {
+					line, _ := posMap["line"].(float64)
+					character, _ := posMap["character"].(float64)
+					positions = append(positions, documents.Position{Line: int(line), Character: int(character)})
+				}
+			}
+		}
+	}
+
+	lines := strings.Split(doc.Source, "\n")
+	bodies := indexer.BodyRanges(doc.Source)
+	for _, pos := range positions {
+		results = append(results, selectionRange(lines, bodies, doc.Source, pos))
+	}
+	return results
+}
+
+// selectionRange builds the chain of ranges around a position, innermost first,
+// each linked to the next larger one through its parent
+func selectionRange(lines []string, bodies []indexer.BodyRange, source string, pos documents.Position) map[string]interface{} {
+	var chain []documents.Range
+
+	if pos.Line >= 0 && pos.Line < len(lines) {
+		token := indexer.GetTokenAtPosition(source, pos.Line, pos.Character)
+		if token.Kind != indexer.TokenNone {
+			chain = append(chain, documents.Range{
+				Start: documents.Position{Line: pos.Line, Character: token.StartCharacter},
+				End:   documents.Position{Line: pos.Line, Character: token.EndCharacter},
+			})
+		}
+
+		// The statement is the line's code, without indentation
+		line := strings.TrimRight(lines[pos.Line], " \t\r")
+		start := len(line) - len(strings.TrimLeft(line, " \t"))
+		if start < len(line) {
+			chain = append(chain, documents.Range{
+				Start: documents.Position{Line: pos.Line, Character: indexer.UTF16Column(line, start)},
+				End:   documents.Position{Line: pos.Line, Character: indexer.UTF16Column(line, len(line))},
+			})
+		}
+	}
+
+	// Bodies around the line, the innermost (latest opened) first
+	var enclosing []indexer.BodyRange
+	for _, body := range bodies {
+		if body.Line <= pos.Line+1 && pos.Line+1 <= body.EndLine {
+			enclosing = append(enclosing, body)
+		}
+	}
+	sort.Slice(enclosing, func(i, j int) bool {
+		return enclosing[i].Line > enclosing[j].Line
+	})
+	for _, body := range enclosing {
+		chain = append(chain, documents.Range{
+			Start: documents.Position{Line: body.Line - 1, Character: body.Character},
+			End:   documents.Position{Line: body.EndLine - 1, Character: body.EndCharacter},
+		})
+	}
+
+	lastLine := len(lines) - 1
+	chain = append(chain, documents.Range{
+		End: documents.Position{Line: lastLine, Character: indexer.UTF16Column(lines[lastLine], len(lines[lastLine]))},
+	})
+
+	// Clients expect every parent to be strictly larger than its child
+	var result map[string]interface{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if i < len(chain)-1 && chain[i] == chain[i+1] {
+			continue
+		}
+		current := map[string]interface{}{"range": chain[i]}
+		if result != nil {
+			current["parent"] = result
+		}
+		result = current
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testSelectionRange struct {
+	Range  testRange           `json:"range"`
+	Parent *testSelectionRange `json:"parent"`
+}
+
+func TestSelectionRangeExpandsThroughEveryEnclosingBody(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/shop/billing/invoice.rb": `module Shop
+  module Billing
+    class Invoice
+      def total
+        items.each do |item|
+          sum += item.price
+        end
+      end
+    end
+  end
+end
+`,
+	})
+
+	params := documentParams("app/models/shop/billing/invoice.rb")
+	params["positions"] = []interface{}{map[string]interface{}{"line": float64(5), "character": float64(24)}}
+	var results []testSelectionRange
+	decode(t, s.HandleSelectionRange(params), &results)
+	if len(results) != 1 {
+		t.Fatalf("selection ranges = %+v, want one chain", results)
+	}
+
+	var chain [][4]int
+	for r := &results[0]; r != nil; r = r.Parent {
+		chain = append(chain, [4]int{r.Range.Start.Line, r.Range.Start.Character, r.Range.End.Line, r.Range.End.Character})
+	}
+	want := [][4]int{
+		{5, 22, 5, 27}, // price
+		{5, 10, 5, 27}, // the statement
+		{4, 8, 6, 11},  // the do block
+		{3, 6, 7, 9},   // total
+		{2, 4, 8, 7},   // Invoice
+		{1, 2, 9, 5},   // Billing
+		{0, 0, 10, 3},  // Shop
+		{0, 0, 11, 0},  // the file
+	}
+	if !reflect.DeepEqual(chain, want) {
+		t.Errorf("selection range chain = %v, want %v", chain, want)
+	}
+}
@@ -1,13 +1,20 @@
 package lsp
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/url"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/humberto/ruby-lsp-go/documents"
 	"github.com/humberto/ruby-lsp-go/indexer"
@@ -16,37 +23,201 @@ import (
 
 // HandleInitialize handles the LSP initialize request
 func (s *Server) HandleInitialize(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing initialize request")
+	s.Logger.Println("Processing initialize request")
 
-	capabilities := map[string]interface{}{
-		"capabilities": map[string]interface{}{
-			"textDocumentSync": map[string]interface{}{
-				"change":    2, // incremental
-				"openClose": true,
-				"save":      map[string]interface{}{"includeText": false},
-			},
-			"completionProvider": map[string]interface{}{
-				"triggerCharacters": []string{".", ":", "@"},
-			},
-			"hoverProvider":              true,
-			"definitionProvider":         true,
-			"documentSymbolProvider":     true,
-			"workspaceSymbolProvider":    true,
-			"documentFormattingProvider": true,
-			"documentHighlightProvider":  true,
-			"codeActionProvider": map[string]interface{}{
-				"codeActionKinds": []string{"quickfix", "refactor"},
+	s.GlobalState.Mutex.Lock()
+	s.GlobalState.ReindexDebounce = defaultReindexDebounce
+	testLibraryConfigured := false
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if clientCapabilities, ok := paramMap["capabilities"].(map[string]interface{}); ok {
+			s.GlobalState.ClientCapabilities = clientCapabilities
+		}
+		if options, ok := paramMap["initializationOptions"].(map[string]interface{}); ok {
+			if debounceMs, ok := options["reindexDebounceMs"].(float64); ok && debounceMs >= 0 {
+				s.GlobalState.ReindexDebounce = time.Duration(debounceMs) * time.Millisecond
+			}
+			if limit, ok := options["completionLimit"].(float64); ok && limit > 0 {
+				s.GlobalState.CompletionLimit = int(limit)
+			}
+			if limit, ok := options["workspaceSymbolLimit"].(float64); ok && limit > 0 {
+				s.GlobalState.SymbolLimit = int(limit)
+			}
+			if debug, ok := options["debug"].(bool); ok {
+				s.GlobalState.Debug = debug
+			}
+			if testLibrary, ok := options["testLibrary"].(string); ok && testLibrary != "" {
+				s.GlobalState.TestLibrary = testLibrary
+				testLibraryConfigured = true
+			}
+			if completion, ok := options["completion"].(map[string]interface{}); ok {
+				if requireAware, ok := completion["requireAware"].(bool); ok {
+					s.GlobalState.RequireAware = requireAware
+				}
+				if showFilePath, ok := completion["showFilePath"].(bool); ok {
+					s.GlobalState.CompletionPaths = showFilePath
+				}
+			}
+			if inflections, ok := options["inflections"].(map[string]interface{}); ok {
+				// Irregular nouns as Rails declares them (inflect.irregular "person", "people")
+				if irregular, ok := inflections["irregular"].(map[string]interface{}); ok {
+					s.GlobalState.IndexOptions.Irregulars = make(map[string]string)
+					for singular, plural := range irregular {
+						if plural, ok := plural.(string); ok {
+							s.GlobalState.IndexOptions.Irregulars[singular] = plural
+						}
+					}
+				}
+			}
+			if hover, ok := options["hover"].(map[string]interface{}); ok {
+				if showSource, ok := hover["showSource"].(bool); ok {
+					s.GlobalState.HoverShowSource = showSource
+				}
+				if preferType, ok := hover["preferType"].(string); ok {
+					switch preferType {
+					case "auto", "sorbet", "rbs", "yard":
+						s.GlobalState.HoverPreferType = preferType
+					default:
+						s.Logger.Printf("Warning: unknown hover type preference %q, using auto", preferType)
+					}
+				}
+			}
+			if index, ok := options["index"].(map[string]interface{}); ok {
+				if typeSignatures, ok := index["typeSignatures"].(bool); ok {
+					s.GlobalState.IndexOptions.TypeSignatures = typeSignatures
+				}
+				if schemaColumns, ok := index["schemaColumns"].(bool); ok {
+					s.GlobalState.IndexOptions.SchemaColumns = schemaColumns
+				}
+				if mode, ok := index["mode"].(string); ok {
+					switch mode {
+					case indexer.ModeEager, indexer.ModeLazy, indexer.ModeOnSave:
+						s.GlobalState.IndexOptions.Mode = mode
+					default:
+						s.Logger.Printf("Warning: unknown index mode %q, indexing eagerly", mode)
+					}
+				}
+				if classVariables, ok := index["classVariables"].(bool); ok {
+					s.GlobalState.IndexOptions.ClassVariables = classVariables
+				}
+				if gitignore, ok := index["gitignore"].(bool); ok {
+					s.GlobalState.IndexOptions.Gitignore = gitignore
+				}
+				if followSymlinks, ok := index["followSymlinks"].(bool); ok {
+					s.GlobalState.IndexOptions.FollowSymlinks = followSymlinks
+				}
+				if maxSymbols, ok := index["maxSymbols"].(float64); ok && maxSymbols > 0 {
+					s.GlobalState.IndexOptions.MaxSymbols = int(maxSymbols)
+				}
+				if maxFileSymbols, ok := index["maxFileSymbols"].(float64); ok && maxFileSymbols > 0 {
+					s.GlobalState.IndexOptions.MaxFileSymbols = int(maxFileSymbols)
+				}
+				if maxFileSize, ok := index["maxFileSize"].(float64); ok && maxFileSize > 0 {
+					s.GlobalState.IndexOptions.MaxFileSize = int64(maxFileSize)
+				}
+				if excludeDirs, ok := index["excludeDirs"].([]interface{}); ok {
+					for _, dir := range excludeDirs {
+						if name, ok := dir.(string); ok {
+							s.GlobalState.IndexOptions.ExcludeDirs = append(s.GlobalState.IndexOptions.ExcludeDirs, name)
+						}
+					}
+				}
+				if excludeGlobs, ok := index["excludeGlobs"].([]interface{}); ok {
+					for _, glob := range excludeGlobs {
+						if pattern, ok := glob.(string); ok {
+							s.GlobalState.IndexOptions.ExcludeGlobs = append(s.GlobalState.IndexOptions.ExcludeGlobs, pattern)
+						}
+					}
+				}
+				if rubyFiles, ok := index["rubyFiles"].([]interface{}); ok {
+					for _, pattern := range rubyFiles {
+						if name, ok := pattern.(string); ok {
+							s.GlobalState.IndexOptions.RubyFiles = append(s.GlobalState.IndexOptions.RubyFiles, name)
+						}
+					}
+				}
+			}
+			if features, ok := options["enabledFeatures"].(map[string]interface{}); ok {
+				for name, value := range features {
+					if enabled, ok := value.(bool); ok {
+						s.GlobalState.EnabledFeatures[name] = enabled
+					}
+				}
+			}
+		}
+	}
+	workspacePath := s.GlobalState.WorkspacePath
+	s.GlobalState.Mutex.Unlock()
+
+	// Unless configured, the test library is the one the Gemfile depends on
+	if !testLibraryConfigured {
+		if testLibrary := detectTestLibrary(workspacePath); testLibrary != "" {
+			s.GlobalState.Mutex.Lock()
+			s.GlobalState.TestLibrary = testLibrary
+			s.GlobalState.Mutex.Unlock()
+			s.Logger.Printf("Detected test library: %s", testLibrary)
+		}
+	}
+
+	// Features backed by missing tools are not advertised
+	s.detectTools()
+
+	serverCapabilities := map[string]interface{}{
+		"textDocumentSync": map[string]interface{}{
+			"change":    2, // incremental
+			"openClose": true,
+			"save":      map[string]interface{}{"includeText": true},
+		},
+		"completionProvider": map[string]interface{}{
+			"triggerCharacters": []string{".", ":", "@", "/", "\"", "'"},
+			"resolveProvider":   true,
+		},
+		"signatureHelpProvider": map[string]interface{}{
+			"triggerCharacters": []string{"(", ","},
+		},
+		"hoverProvider":              true,
+		"callHierarchyProvider":      true,
+		"typeHierarchyProvider":      true,
+		"selectionRangeProvider":     true,
+		"linkedEditingRangeProvider": true,
+		"monikerProvider":            true,
+		"definitionProvider":         true,
+		"typeDefinitionProvider":     true,
+		"codeLensProvider": map[string]interface{}{
+			"resolveProvider": false,
+		},
+		"documentSymbolProvider":     true,
+		"workspaceSymbolProvider":    true,
+		"documentFormattingProvider": s.formattingAvailable(),
+		"documentHighlightProvider":  true,
+		"documentLinkProvider": map[string]interface{}{
+			"resolveProvider": false,
+		},
+		"codeActionProvider": map[string]interface{}{
+			"codeActionKinds": []string{"quickfix", "refactor"},
+		},
+		"executeCommandProvider": map[string]interface{}{
+			"commands": []string{commandIndexStats, commandToggleTestFile},
+		},
+		"foldingRangeProvider": true,
+		"renameProvider":      true,
+		"referencesProvider":  true,
+		"workspace": map[string]interface{}{
+			"workspaceFolders": map[string]interface{}{
+				"supported":           true,
+				"changeNotifications": true,
 			},
-			"foldingRangeProvider": true,
-			"renameProvider":      true,
-			"referencesProvider":  true,
 		},
+	}
+	s.gateProviders(serverCapabilities)
+
+	capabilities := map[string]interface{}{
+		"capabilities": serverCapabilities,
 		"serverInfo": map[string]string{
 			"name":    "Ruby LSP Go",
 			"version": "1.2.0",
 		},
-		"formatter":     "none",
-		"degraded_mode": false,
+		"formatter":     s.FormatterBackend(),
+		"degraded_mode": len(s.disabledFeatures()) > 0,
 	}
 
 	return capabilities
@@ -54,8 +225,9 @@ func (s *Server) HandleInitialize(params interface{}) interface{} {
 
 // HandleInitialized handles the initialized notification
 func (s *Server) HandleInitialized() {
-	s.Logger.(*log.Logger).Println("Initialization complete")
-	s.Logger.(*log.Logger).Println("Performing initial indexing...")
+	s.Logger.Println("Initialization complete")
+	s.reportDisabledFeatures()
+	s.Logger.Println("Performing initial indexing...")
 }
 
 // HandleDidOpen handles textDocument/didOpen notification
@@ -67,10 +239,15 @@ func (s *Server) HandleDidOpen(params interface{}) {
 			version, _ := textDoc["version"].(float64)
 			languageID, _ := textDoc["languageId"].(string)
 
-			storeInst := s.Store.(*store.Store)
+			storeInst := s.Store
 			storeInst.Set(uri, text, int(version), languageID)
+			s.publishStructureDiagnostics(uri)
+			s.checkWithTools(uri)
+			if idx := s.Indexer; idx != nil && strings.HasPrefix(uri, "file://") {
+				s.RunInBackground(func(context.Context) { idx.IndexOnDemand(uriToFilePath(uri)) })
+			}
 
-			s.Logger.(*log.Logger).Printf("Opened document: %s", uri)
+			s.Logger.Printf("Opened document: %s", uri)
 		}
 	}
 }
@@ -81,14 +258,55 @@ func (s *Server) HandleDidClose(params interface{}) {
 		if textDoc, ok := paramMap["textDocument"].(map[string]interface{}); ok {
 			uri, _ := textDoc["uri"].(string)
 
-			storeInst := s.Store.(*store.Store)
+			storeInst := s.Store
 			storeInst.Delete(uri)
+			s.invalidateReachable(uriToFilePath(uri))
+			s.clearDiagnostics(uri)
+
+			// Drop any pending buffer re-index and fall back to what is on disk
+			s.cancelReindex(uri)
+			if idx := s.Indexer; idx != nil && strings.HasPrefix(uri, "file://") && idx.ShouldIndex(uriToFilePath(uri)) && idx.Covers(uriToFilePath(uri)) {
+				s.RunInBackground(func(context.Context) { idx.UpdateFile(uriToFilePath(uri)) })
+			}
 
-			s.Logger.(*log.Logger).Printf("Closed document: %s", uri)
+			s.Logger.Printf("Closed document: %s", uri)
 		}
 	}
 }
 
+// HandleDidSave handles textDocument/didSave notification. The saved file is
+// re-indexed from the text sent with the notification when there is one, which
+// is what the editor wrote, and otherwise from disk.
+func (s *Server) HandleDidSave(params interface{}) {
+	paramMap, ok := params.(map[string]interface{})
+	if !ok {
+		return
+	}
+	textDoc, ok := paramMap["textDocument"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	uri, _ := textDoc["uri"].(string)
+	s.invalidateReachable(uriToFilePath(uri))
+	s.checkWithTools(uri)
+	idx := s.Indexer
+	if idx == nil || !strings.HasPrefix(uri, "file://") {
+		return
+	}
+	filePath := uriToFilePath(uri)
+
+	// RBS signatures are only parsed from disk
+	text, hasText := paramMap["text"].(string)
+	if !hasText || !idx.ShouldIndex(filePath) {
+		s.RunInBackground(func(context.Context) { idx.UpdateFile(filePath) })
+		return
+	}
+
+	// The saved text supersedes any buffer re-index still pending
+	s.cancelReindex(uri)
+	s.RunInBackground(func(context.Context) { idx.UpdateFileFromSource(filePath, text) })
+}
+
 // HandleDidChange handles textDocument/didChange notification
 func (s *Server) HandleDidChange(params interface{}) {
 	if paramMap, ok := params.(map[string]interface{}); ok {
@@ -96,7 +314,7 @@ func (s *Server) HandleDidChange(params interface{}) {
 			uri, _ := textDoc["uri"].(string)
 
 			if changes, ok := paramMap["contentChanges"].([]interface{}); ok {
-				storeInst := s.Store.(*store.Store)
+				storeInst := s.Store
 
 				edits := make([]documents.TextEdit, 0, len(changes))
 				for _, change := range changes {
@@ -144,22 +362,55 @@ func (s *Server) HandleDidChange(params interface{}) {
 
 				if doc, exists := storeInst.Get(uri); exists {
 					rubyDoc := documents.New(doc.URI, doc.Source, doc.Version, doc.LanguageID)
-					rubyDoc.Update(edits)
+					if err := rubyDoc.Update(edits); err != nil {
+						s.rejectChange(uri, err)
+						return
+					}
+					delete(s.invalidChanges, uri)
 					storeInst.Set(uri, rubyDoc.Source, rubyDoc.Version, rubyDoc.LanguageID)
+					s.invalidateReachable(uriToFilePath(uri))
+					s.scheduleReindex(uri)
+					s.publishStructureDiagnostics(uri)
 				}
 
-				s.Logger.(*log.Logger).Printf("Changed document: %s", uri)
+				s.Logger.Printf("Changed document: %s", uri)
 			}
 		}
 	}
 }
 
+// maxInvalidChanges is how many changes in a row may fail to apply before a
+// document is considered out of sync with the editor
+const maxInvalidChanges = 3
+
+// rejectChange records a didChange whose edits did not fit the stored buffer,
+// which is kept unchanged. Once the buffer is out of sync it is dropped, and the
+// user asked to reopen the file so the editor sends its full text again.
+func (s *Server) rejectChange(uri string, err error) {
+	s.Logger.Printf("Warning: ignoring change to %s: %v", uri, err)
+
+	if s.invalidChanges == nil {
+		s.invalidChanges = make(map[string]int)
+	}
+	s.invalidChanges[uri]++
+	if s.invalidChanges[uri] < maxInvalidChanges {
+		return
+	}
+	delete(s.invalidChanges, uri)
+	s.Store.Delete(uri)
+	s.clearDiagnostics(uri)
+	s.SendNotification("window/showMessage", map[string]interface{}{
+		"type":    messageTypeWarning,
+		"message": fmt.Sprintf("Ruby LSP Go lost track of the contents of %s. Close and reopen it to resync.", filepath.Base(uriToFilePath(uri))),
+	})
+}
+
 // HandleDefinition handles textDocument/definition request (Ctrl+Click)
-func (s *Server) HandleDefinition(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing definition request")
+func (s *Server) HandleDefinition(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing definition request")
 
-	idx, hasIndexer := s.Indexer.(*indexer.Index)
-	if !hasIndexer || !idx.IsReady() {
+	idx := s.Indexer
+	if s.stillIndexing("Definitions") || idx == nil || s.isCancelled(id) {
 		return []interface{}{}
 	}
 
@@ -169,46 +420,99 @@ func (s *Server) HandleDefinition(params interface{}) interface{} {
 	}
 
 	// Get the document source to find the word at cursor
-	storeInst := s.Store.(*store.Store)
+	storeInst := s.Store
 	doc, exists := storeInst.Get(uri)
 	if !exists {
 		return []interface{}{}
 	}
 
-	word := indexer.GetWordAtPosition(doc.Source, pos.Line, pos.Character)
-	if word == "" {
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if token.Kind == indexer.TokenNone {
 		return []interface{}{}
 	}
+	word := token.Qualified()
 
-	s.Logger.(*log.Logger).Printf("Definition lookup for: %s", word)
+	s.Logger.Printf("Definition lookup for: %s", word)
 
 	// Remove leading colons (e.g., :user → user, then capitalize)
-	cleanWord := strings.TrimPrefix(word, ":")
-
-	// Try direct lookup first
-	entries := idx.Lookup(cleanWord)
+	cleanWord := word
+	if token.Kind == indexer.TokenSymbol {
+		cleanWord = token.Name()
+	}
 
-	// If nothing found, try capitalized version (Rails association → Model)
-	if len(entries) == 0 && !isCapitalized(cleanWord) {
-		capitalized := capitalize(cleanWord)
-		entries = idx.Lookup(capitalized)
+	// A local variable bound earlier in the method shadows methods and models of its name
+	if local, ok := localDefinition(doc.Source, token, pos.Line); ok {
+		return []interface{}{map[string]interface{}{
+			"uri":   uri,
+			"range": lineRange(local.Line, local.Character, local.EndCharacter),
+		}}
 	}
 
-	// Try Rails conventions
-	if len(entries) == 0 {
-		lookupWord := cleanWord
-		if !isCapitalized(lookupWord) {
-			lookupWord = capitalize(lookupWord)
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+
+	var entries []indexer.SymbolEntry
+	if token.Kind == indexer.TokenInstanceVariable {
+		// Instance variables resolve to their assignments within the enclosing class
+		entries = idx.InstanceVariableAssignments(scope, token.Text)
+	} else if token.Kind == indexer.TokenClassVariable {
+		// Class variables are shared with subclasses, so superclasses assign them too
+		entries = idx.ClassVariableAssignments(scope, token.Text)
+	} else if isSuperCall(token) {
+		// super calls the overridden method, not one named super
+		entries = superDefinitions(idx, uriToFilePath(uri), pos.Line+1)
+	} else {
+		// The setter for an assignment through a receiver, else the name as Ruby
+		// would resolve it at the cursor (Rails association -> Model as a last resort)
+		if setter := setterCallName(doc.Source, token); setter != "" {
+			entries = idx.Lookup(setter)
+		}
+		if len(entries) == 0 {
+			entries = idx.LookupScoped(cleanWord, nestingOf(scope))
+		}
+		if token.Kind == indexer.TokenConstant {
+			entries = resolveAliases(idx, entries)
+		}
+
+		// Prefer methods reachable from the call site; an explicit receiver can't reach private ones
+		if token.Kind == indexer.TokenIdentifier && len(entries) > 1 {
+			receiver := receiverBefore(doc.Source, pos.Line, token.StartCharacter)
+			site := newCallSite(idx, receiver, scope)
+			if callable := site.filterCallable(entries); len(callable) > 0 {
+				entries = callable
+			}
+			entries = forwardedMethods(idx, entries, doc.Source, pos.Line, receiver, scope)
+		}
+
+		// On an association's own declaration, the definition sought is its model's
+		if declared := filterEntries(entries, func(entry indexer.SymbolEntry) bool {
+			return entry.Type == indexer.SymbolAssociation && entry.FilePath == uriToFilePath(uri) && entry.Line == pos.Line+1
+		}); len(declared) > 0 {
+			if targets := idx.AssociationTarget(declared[0]); len(targets) > 0 {
+				entries = targets
+			}
 		}
-		entries = idx.LookupByConvention(lookupWord)
 	}
 
+	// Convention lookups may have hit the filesystem; drop the result if nobody is waiting
+	if s.isCancelled(id) {
+		return []interface{}{}
+	}
+
+	// Editors that jump straight to the first result should land on the nearest definition
+	entries = s.sortByProximity(collapseModuleFunctions(entries), uriToFilePath(uri))
+
 	// Filter to only class/module definitions for Ctrl+Click (most common use case)
 	var locations []interface{}
 	for _, entry := range entries {
+		// Route helpers are not written in routes.rb, so the whole route line is the target
+		endCharacter := nameEndCharacter(entry)
+		if entry.Type == indexer.SymbolRoute {
+			endCharacter = entry.EndCharacter
+		}
+
 		// For class/module/constant lookups, prioritize non-method results
 		loc := map[string]interface{}{
-			"uri": pathToURI(entry.FilePath),
+			"uri": store.PathToURI(entry.FilePath),
 			"range": map[string]interface{}{
 				"start": map[string]interface{}{
 					"line":      entry.Line - 1, // LSP is 0-indexed
@@ -216,7 +520,7 @@ func (s *Server) HandleDefinition(params interface{}) interface{} {
 				},
 				"end": map[string]interface{}{
 					"line":      entry.Line - 1,
-					"character": entry.Character + len(entry.Name),
+					"character": endCharacter,
 				},
 			},
 		}
@@ -224,9 +528,9 @@ func (s *Server) HandleDefinition(params interface{}) interface{} {
 	}
 
 	if len(locations) == 0 {
-		s.Logger.(*log.Logger).Printf("No definition found for: %s", word)
+		s.Logger.Printf("No definition found for: %s", word)
 	} else {
-		s.Logger.(*log.Logger).Printf("Found %d definition(s) for: %s", len(locations), word)
+		s.Logger.Printf("Found %d definition(s) for: %s", len(locations), word)
 	}
 
 	return locations
@@ -234,10 +538,13 @@ func (s *Server) HandleDefinition(params interface{}) interface{} {
 
 // HandleHover handles textDocument/hover request
 func (s *Server) HandleHover(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing hover request")
+	s.Logger.Println("Processing hover request")
 
-	idx, hasIndexer := s.Indexer.(*indexer.Index)
-	if !hasIndexer || !idx.IsReady() {
+	idx := s.Indexer
+	if s.stillIndexing("Hovers") {
+		return map[string]interface{}{"contents": indexingMessage}
+	}
+	if idx == nil {
 		return map[string]interface{}{"contents": ""}
 	}
 
@@ -246,30 +553,47 @@ func (s *Server) HandleHover(params interface{}) interface{} {
 		return map[string]interface{}{"contents": ""}
 	}
 
-	storeInst := s.Store.(*store.Store)
+	storeInst := s.Store
 	doc, exists := storeInst.Get(uri)
 	if !exists {
 		return map[string]interface{}{"contents": ""}
 	}
 
-	word := indexer.GetWordAtPosition(doc.Source, pos.Line, pos.Character)
-	if word == "" {
+	token := indexer.GetTokenAtPosition(doc.Source, pos.Line, pos.Character)
+	if token.Kind == indexer.TokenNone {
 		return map[string]interface{}{"contents": ""}
 	}
 
-	cleanWord := strings.TrimPrefix(word, ":")
+	cleanWord := token.Qualified()
+	if token.Kind == indexer.TokenSymbol {
+		cleanWord = token.Name()
+	}
 
-	// Try lookup
-	entries := idx.Lookup(cleanWord)
-	if len(entries) == 0 && !isCapitalized(cleanWord) {
-		entries = idx.Lookup(capitalize(cleanWord))
+	if token.Kind == indexer.TokenInstanceVariable {
+		scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+		return s.variableHover(indexer.SymbolInstanceVariable, token.Text, scope, idx.InstanceVariableAssignments(scope, token.Text))
 	}
-	if len(entries) == 0 {
-		lookupWord := cleanWord
-		if !isCapitalized(lookupWord) {
-			lookupWord = capitalize(lookupWord)
+	if token.Kind == indexer.TokenClassVariable {
+		scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+		return s.variableHover(indexer.SymbolClassVar, token.Text, scope, idx.ClassVariableAssignments(scope, token.Text))
+	}
+
+	if local, ok := localDefinition(doc.Source, token, pos.Line); ok {
+		return localVariableHover(doc.Source, token.Text, local)
+	}
+
+	// Resolve the name like definitions do, the setter an assignment calls or
+	// the method super overrides
+	var entries []indexer.SymbolEntry
+	if isSuperCall(token) {
+		entries = superDefinitions(idx, uriToFilePath(uri), pos.Line+1)
+	} else {
+		if setter := setterCallName(doc.Source, token); setter != "" {
+			entries = idx.Lookup(setter)
+		}
+		if len(entries) == 0 {
+			entries = idx.LookupScoped(cleanWord, nestingOf(idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)))
 		}
-		entries = idx.LookupByConvention(lookupWord)
 	}
 
 	if len(entries) == 0 {
@@ -278,33 +602,84 @@ func (s *Server) HandleHover(params interface{}) interface{} {
 
 	// Build hover markdown
 	var mdParts []string
-	for _, entry := range entries {
-		typeStr := indexer.SymbolTypeString(entry.Type)
-		relPath := entry.FilePath
-		if s.GlobalState.WorkspacePath != "" {
-			if rel, err := filepath.Rel(s.GlobalState.WorkspacePath, entry.FilePath); err == nil {
-				relPath = rel
+	for _, entry := range collapseReopenedClasses(collapseModuleFunctions(entries)) {
+		// A class reopened across files is described once, from the body declaring it
+		var bodies []indexer.SymbolEntry
+		var mixins []string
+		if entry.Type == indexer.SymbolClass || entry.Type == indexer.SymbolModule {
+			if merged, ok := idx.MergedClass(entry.FullyQualifiedName); ok {
+				entry, bodies, mixins = merged.Definition, merged.Bodies, merged.Mixins
 			}
 		}
 
+		typeStr := indexer.SymbolTypeString(entry.Type)
+		relPath := s.relativePath(entry.FilePath)
+
 		header := fmt.Sprintf("```ruby\n%s %s\n```", typeStr, entry.FullyQualifiedName)
 		detail := fmt.Sprintf("**Defined in:** `%s:%d`", relPath, entry.Line)
+		if entry.Gem != "" {
+			detail = fmt.Sprintf("**Defined in:** %s %s (`%s:%d`)", entry.Gem, idx.GemVersion(entry.Gem), relPath, entry.Line)
+		} else if len(bodies) > 1 {
+			var locations []string
+			for _, body := range bodies {
+				locations = append(locations, fmt.Sprintf("`%s:%d`", s.relativePath(body.FilePath), body.Line))
+			}
+			detail = "**Defined in:** " + strings.Join(locations, ", ")
+		}
 
 		extra := ""
-		if entry.Detail != "" {
+		if entry.Type == indexer.SymbolClass {
+			// Reopened classes omit the superclass, so resolve the chain from the index
+			if chain := idx.SuperclassChain(entry.FullyQualifiedName); len(chain) > 0 {
+				extra = fmt.Sprintf("\n\n**Inherits from:** `%s < %s`", entry.FullyQualifiedName, strings.Join(chain, " < "))
+			}
+			extra += formatColumns(idx.Columns(entry.FullyQualifiedName))
+		} else if entry.Detail != "" {
 			switch entry.Type {
-			case indexer.SymbolClass:
-				extra = fmt.Sprintf("\n\n**Inherits from:** `%s`", entry.Detail)
 			case indexer.SymbolAssociation:
-				extra = fmt.Sprintf("\n\n**Association type:** `%s`", entry.Detail)
+				extra = fmt.Sprintf("\n\n**Association type:** `%s`", indexer.AssociationType(entry))
+				extra += formatAssociationTarget(idx.AssociationClassName(entry), idx.AssociationTarget(entry))
+				extra += formatColumns(idx.Columns(idx.AssociationClassName(entry)))
 			case indexer.SymbolAttrAccessor:
 				extra = fmt.Sprintf("\n\n**Accessor type:** `%s`", entry.Detail)
 			case indexer.SymbolScope:
 				extra = "\n\n**Type:** ActiveRecord scope"
+			case indexer.SymbolConstant:
+				if target, ok := indexer.AliasTarget(entry); ok {
+					extra = fmt.Sprintf("\n\n**Alias of:** `%s`", idx.ResolveConstantPath(target, entry.Parent))
+				}
+			}
+		}
+		if len(mixins) > 0 {
+			extra += fmt.Sprintf("\n\n**Includes:** `%s`", strings.Join(mixins, "`, `"))
+		}
+
+		if entry.Type == indexer.SymbolMethod || entry.Type == indexer.SymbolSingletonMethod {
+			types := preferTypeSignatures(idx.TypeSignatures(entry), s.hoverPreferType())
+			for _, sig := range types {
+				extra += fmt.Sprintf("\n\n**Signature (%s):** `%s`", sig.Source, sig.Format(entry.Name))
+			}
+			if len(types) == 0 {
+				extra += fmt.Sprintf("\n\n**Signature:** `%s` (arity %d)", indexer.FormatSignature(entry), indexer.Arity(entry))
 			}
+			if s.hoverShowSource() {
+				extra += methodSource(entry)
+			}
+			if indexer.IsModuleFunction(entry) {
+				extra += fmt.Sprintf("\n\n**Callable as:** `%s.%s` and as an instance method (%s)", entry.Parent, entry.Name, entry.Detail)
+			}
+		}
+
+		if entry.MixedIn {
+			extra += fmt.Sprintf("\n\n**Mixed in:** from the `included` block of `%s` into the classes including it", entry.Parent)
 		}
 
-		mdParts = append(mdParts, header+"\n\n"+detail+extra)
+		docs := ""
+		if comment := indexer.ParseDocComment(indexer.ReadDocComment(entry.FilePath, entry.Line)); !comment.IsEmpty() {
+			docs = formatDocComment(comment) + "\n\n"
+		}
+
+		mdParts = append(mdParts, header+"\n\n"+docs+detail+extra)
 	}
 
 	return map[string]interface{}{
@@ -315,12 +690,156 @@ func (s *Server) HandleHover(params interface{}) interface{} {
 	}
 }
 
+// formatAssociationTarget renders a hover section naming the model an
+// association refers to, linking to its definitions when they are indexed
+func formatAssociationTarget(className string, targets []indexer.SymbolEntry) string {
+	if len(targets) == 0 {
+		return fmt.Sprintf("\n\n**Model:** `%s`", className)
+	}
+
+	var links []string
+	for _, target := range targets {
+		links = append(links, fmt.Sprintf("[`%s`](%s#L%d)", target.FullyQualifiedName, store.PathToURI(target.FilePath), target.Line))
+	}
+	return "\n\n**Model:** " + strings.Join(links, ", ")
+}
+
+// maxHoverColumns caps the columns listed in a hover so wide tables stay readable
+const maxHoverColumns = 20
+
+// formatColumns renders a hover section listing schema columns and their types
+func formatColumns(columns []indexer.SymbolEntry) string {
+	if len(columns) == 0 {
+		return ""
+	}
+
+	lines := []string{"\n\n**Columns:**"}
+	for i, column := range columns {
+		if i == maxHoverColumns {
+			lines = append(lines, fmt.Sprintf("- …and %d more", len(columns)-maxHoverColumns))
+			break
+		}
+		columnType, _ := indexer.ColumnType(column)
+		lines = append(lines, fmt.Sprintf("- `%s`: %s", column.Name, columnType))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// maxHoverSourceLines caps the method source shown in a hover
+const maxHoverSourceLines = 15
+
+// Type sources in the order hovers list them by default
+var typeSourceOrder = []string{"sorbet", "rbs", "yard"}
+
+// preferTypeSignatures orders a method's signatures by source: the preferred
+// source first, then the others in typeSourceOrder. "auto" keeps the default.
+func preferTypeSignatures(types []indexer.TypeSignature, prefer string) []indexer.TypeSignature {
+	rank := func(source string) int {
+		if source == prefer {
+			return -1
+		}
+		for i, candidate := range typeSourceOrder {
+			if source == candidate {
+				return i
+			}
+		}
+		return len(typeSourceOrder)
+	}
+
+	sort.SliceStable(types, func(i, j int) bool {
+		return rank(types[i].Source) < rank(types[j].Source)
+	})
+	return types
+}
+
+// methodSource renders a hover section with the source of a method, from its
+// def to its end, dedented and cut short for long methods
+func methodSource(entry indexer.SymbolEntry) string {
+	file, err := os.Open(entry.FilePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	endLine := entry.EndLine
+	if endLine < entry.Line {
+		endLine = entry.Line // one-liners and endless methods have no end of their own
+	}
+
+	var lines []string
+	truncated := false
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan() && lineNumber <= endLine; lineNumber++ {
+		if lineNumber < entry.Line {
+			continue
+		}
+		if len(lines) == maxHoverSourceLines {
+			truncated = true
+			break
+		}
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	indent := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	if truncated {
+		lines = append(lines, "# …")
+	}
+	return "\n\n```ruby\n" + strings.Join(lines, "\n") + "\n```"
+}
+
+// variableHover lists the sites assigning an instance or class variable
+func (s *Server) variableHover(variableType indexer.SymbolType, name string, scope string, entries []indexer.SymbolEntry) interface{} {
+	if len(entries) == 0 {
+		return map[string]interface{}{"contents": ""}
+	}
+
+	qualified := name
+	if scope != "" {
+		qualified = scope + "#" + name
+	}
+
+	lines := []string{
+		fmt.Sprintf("```ruby\n%s %s\n```", indexer.SymbolTypeString(variableType), qualified),
+		"",
+		"**Assigned in:**",
+	}
+	for _, entry := range entries {
+		relPath := s.relativePath(entry.FilePath)
+		lines = append(lines, fmt.Sprintf("- `%s:%d`", relPath, entry.Line))
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]interface{}{
+			"kind":  "markdown",
+			"value": strings.Join(lines, "\n"),
+		},
+	}
+}
+
+// localVariableHover describes a local variable by the line binding it
+func localVariableHover(source string, name string, local indexer.Occurrence) interface{} {
+	lines := strings.Split(source, "\n")
+	binding := strings.TrimSpace(lines[local.Line-1])
+
+	return map[string]interface{}{
+		"contents": map[string]interface{}{
+			"kind":  "markdown",
+			"value": fmt.Sprintf("```ruby\nlocal variable %s\n```\n\n**Defined on line %d:**\n\n```ruby\n%s\n```", name, local.Line, binding),
+		},
+	}
+}
+
 // HandleCompletion handles textDocument/completion request
-func (s *Server) HandleCompletion(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing completion request")
+func (s *Server) HandleCompletion(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing completion request")
 
-	idx, hasIndexer := s.Indexer.(*indexer.Index)
-	if !hasIndexer || !idx.IsReady() {
+	if s.isCancelled(id) {
 		return map[string]interface{}{
 			"isIncomplete": false,
 			"items":        []interface{}{},
@@ -335,7 +854,7 @@ func (s *Server) HandleCompletion(params interface{}) interface{} {
 		}
 	}
 
-	storeInst := s.Store.(*store.Store)
+	storeInst := s.Store
 	doc, exists := storeInst.Get(uri)
 	if !exists {
 		return map[string]interface{}{
@@ -344,20 +863,51 @@ func (s *Server) HandleCompletion(params interface{}) interface{} {
 		}
 	}
 
-	word := indexer.GetWordAtPosition(doc.Source, pos.Line, pos.Character)
-	if word == "" || len(word) < 2 {
-		return map[string]interface{}{
-			"isIncomplete": false,
-			"items":        []interface{}{},
-		}
+	// ".", "@" and "::" each complete a different kind of name
+	ctx := parseCompletionContext(params, doc.Source, pos)
+	search, release := s.requestContext(id)
+	defer release()
+	ctx.search = search
+
+	if ctx.mode == completionRequirePath {
+		return s.requirePathCompletion(ctx, uri, pos)
 	}
 
-	entries := idx.PrefixSearch(word)
+	// Keywords need no index, so they are offered while indexing is still running
+	var entries []rankedEntry
+	limit := s.completionLimit()
+	idx := s.Indexer
+	if idx != nil && idx.IsReady() {
+		filePath := uriToFilePath(uri)
+		scope := idx.EnclosingScope(filePath, pos.Line+1)
+		if ctx.mode == completionMethods {
+			ctx.receiverClass = resolveReceiverClass(idx, doc.Source, pos.Line, ctx.qualifier, scope)
+		}
+		// Decorators and presenters answer for what their delegate_missing_to target does
+		if class := ctx.memberClass(scope); class != "" {
+			ctx.forwardedClass = idx.ForwardedClass(class)
+		}
+		if s.requireAware() {
+			reachable := s.reachableFiles(doc.Source, filePath)
+			subtree := s.subtreeOf(filePath)
+			ctx.reachable = func(path string) bool {
+				return reachable[path] || (subtree != "" && s.subtreeOf(path) == subtree)
+			}
+		}
+		entries = rankCandidates(idx, completionCandidates(idx, ctx, scope), ctx, scope, filePath, limit)
+	}
 
 	var items []interface{}
 	seen := make(map[string]bool)
+	showFilePath := s.completionFilePaths()
+	labelDetails := s.clientCapability("textDocument", "completion", "completionItem", "labelDetailsSupport") == true
 
-	for _, entry := range entries {
+	for i, candidate := range entries {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
+		}
+
+		entry := candidate.entry
 		label := entry.Name
 		if seen[label] {
 			continue
@@ -366,32 +916,146 @@ func (s *Server) HandleCompletion(params interface{}) interface{} {
 
 		kind := indexer.CompletionKindFromType(entry.Type)
 		detail := indexer.SymbolTypeString(entry.Type)
+		if columnType, ok := indexer.ColumnType(entry); ok {
+			kind = completionKindField
+			detail = columnType + " column"
+		}
 		if entry.Parent != "" {
 			detail += " in " + entry.Parent
 		}
+		if entry.Summary != "" {
+			detail += " — " + entry.Summary
+		}
+		// Labels shared by several classes are told apart by their parameters and file
+		relativePath := ""
+		if showFilePath && entry.FilePath != "" {
+			relativePath = filepath.ToSlash(s.relativePath(entry.FilePath))
+			if !labelDetails {
+				detail += " (" + relativePath + ")"
+			}
+		}
+
+		// Members of the receiver's or enclosing class rank above same-file symbols,
+		// which rank above matches elsewhere
+		sortText := strconv.Itoa(candidate.rank) + label
 
 		item := map[string]interface{}{
-			"label":  label,
-			"kind":   kind,
-			"detail": detail,
+			"label":    label,
+			"kind":     kind,
+			"detail":   detail,
+			"sortText": sortText,
+			// Where the definition is, for completionItem/resolve to read its documentation
+			"data": map[string]interface{}{
+				"filePath": entry.FilePath,
+				"line":     entry.Line,
+			},
+		}
+		if labelDetails {
+			details := make(map[string]interface{})
+			if len(entry.Params) > 0 {
+				details["detail"] = strings.TrimPrefix(indexer.FormatSignature(entry), entry.Name)
+			}
+			if relativePath != "" {
+				details["description"] = relativePath
+			}
+			if len(details) > 0 {
+				item["labelDetails"] = details
+			}
 		}
 		items = append(items, item)
 
-		// Cap at 50 results for performance
-		if len(items) >= 50 {
+		// Capped for performance; the client re-queries as the user keeps typing
+		if len(items) >= limit {
 			break
 		}
 	}
+	// Until indexing completes the client must ask again for the indexed symbols
+	isIncomplete := len(items) >= limit || search.Err() != nil || s.stillIndexing("Completions")
+
+	if s.featureEnabled("keywordCompletion") {
+		for _, keyword := range keywordCandidates(ctx) {
+			if seen[keyword] {
+				continue
+			}
+			seen[keyword] = true
+			items = append(items, map[string]interface{}{
+				"label":    keyword,
+				"kind":     completionKindKeyword,
+				"detail":   "keyword",
+				"sortText": "3" + keyword, // below indexed symbols
+			})
+		}
+	}
 
+	// Words of the buffer cover names typed since its last re-index
+	if s.featureEnabled("bufferWordCompletion") {
+		for _, word := range bufferWordCandidates(ctx, doc.Source) {
+			if seen[word] {
+				continue
+			}
+			seen[word] = true
+			items = append(items, map[string]interface{}{
+				"label":    word,
+				"kind":     completionKindText,
+				"detail":   "word in this file",
+				"sortText": "4" + word, // below indexed symbols and keywords
+			})
+		}
+	}
+
+	if len(items) == 0 {
+		items = []interface{}{}
+	}
+	return map[string]interface{}{
+		"isIncomplete": isIncomplete,
+		"items":        items,
+	}
+}
+
+// requirePathCompletion completes the path typed in the string of a require,
+// replacing the whole string typed so far
+func (s *Server) requirePathCompletion(ctx completionContext, uri string, pos documents.Position) interface{} {
+	filePath := ""
+	if strings.HasPrefix(uri, "file://") {
+		filePath = uriToFilePath(uri)
+	}
+
+	start := pos.Character - utf8.RuneCountInString(ctx.prefix)
+	items := []interface{}{}
+	for _, candidate := range s.requirePathCandidates(ctx.qualifier, ctx.prefix, filePath) {
+		detail := "file"
+		switch candidate.kind {
+		case completionKindFolder:
+			detail = "directory"
+		case completionKindModule:
+			detail = "gem"
+		}
+		items = append(items, map[string]interface{}{
+			"label":      candidate.path,
+			"kind":       candidate.kind,
+			"detail":     detail,
+			"filterText": candidate.path,
+			"textEdit": map[string]interface{}{
+				"range":   lineRange(pos.Line+1, start, pos.Character),
+				"newText": candidate.path,
+			},
+		})
+		if len(items) >= s.completionLimit() {
+			break
+		}
+	}
 	return map[string]interface{}{
-		"isIncomplete": len(items) >= 50,
+		"isIncomplete": len(items) >= s.completionLimit(),
 		"items":        items,
 	}
 }
 
-// HandleDocumentSymbol handles textDocument/documentSymbol request
+// HandleDocumentSymbol handles textDocument/documentSymbol request. The outline
+// is built from the file's entries in the index, so repeated requests cost what
+// the symbols do rather than what the file does; a file the index covers but has
+// not parsed yet is parsed once into the index for the requests that follow.
 func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing document symbol request")
+	s.Logger.Println("Processing document symbol request")
 
 	uri := extractTextDocumentURI(params)
 	if uri == "" {
@@ -399,19 +1063,25 @@ func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
 	}
 
 	filePath := uriToFilePath(uri)
-	idx, hasIndexer := s.Indexer.(*indexer.Index)
+	idx := s.Indexer
 
 	var entries []indexer.SymbolEntry
-	if hasIndexer {
+	if idx != nil {
 		entries = idx.GetFileSymbols(filePath)
 	}
 
-	// If indexer doesn't have it, parse from store
+	// If indexer doesn't have it, parse the buffer from store with the same parser;
+	// the document AST only serves when there is no workspace index
 	if len(entries) == 0 {
-		storeInst := s.Store.(*store.Store)
-		if doc, exists := storeInst.Get(uri); exists {
-			rubyDoc := documents.New(doc.URI, doc.Source, doc.Version, doc.LanguageID)
-			ast, err := rubyDoc.Parse()
+		storeInst := s.Store
+		doc, exists := storeInst.Get(uri)
+		if exists && idx != nil && strings.HasPrefix(uri, "file://") && idx.ShouldIndex(filePath) && idx.Covers(filePath) {
+			idx.UpdateFileFromSource(filePath, doc.Source)
+			entries = idx.GetFileSymbols(filePath)
+		} else if exists && idx != nil {
+			entries = idx.ParseSource(doc.Source, filePath)
+		} else if exists {
+			ast, err := doc.RubyDocument().Parse()
 			if err != nil {
 				return []interface{}{}
 			}
@@ -420,11 +1090,30 @@ func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
 			extractSymbolsFromAST(ast, &symbols)
 			return symbols
 		}
+	}
+	if len(entries) == 0 {
 		return []interface{}{}
 	}
 
-	var symbols []interface{}
+	// Definitions with a body span through their end and enclose the symbols within
+	type outlineNode struct {
+		symbol   map[string]interface{}
+		endLine  int
+		children []*outlineNode
+	}
+
+	var roots, open []*outlineNode
 	for _, entry := range entries {
+		// Instance and class variable assignments are navigation targets, not outline entries
+		if entry.Type == indexer.SymbolInstanceVariable || entry.Type == indexer.SymbolClassVar {
+			continue
+		}
+
+		endLine, endCharacter := entry.Line, nameEndCharacter(entry)
+		if entry.EndLine > entry.Line {
+			endLine, endCharacter = entry.EndLine, entry.EndCharacter
+		}
+
 		kind := indexer.SymbolKindToLSP(entry.Type)
 		symbol := map[string]interface{}{
 			"name": entry.Name,
@@ -435,8 +1124,8 @@ func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
 					"character": 0,
 				},
 				"end": map[string]interface{}{
-					"line":      entry.Line - 1,
-					"character": entry.Character + len(entry.Name),
+					"line":      endLine - 1,
+					"character": endCharacter,
 				},
 			},
 			"selectionRange": map[string]interface{}{
@@ -446,7 +1135,7 @@ func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
 				},
 				"end": map[string]interface{}{
 					"line":      entry.Line - 1,
-					"character": entry.Character + len(entry.Name),
+					"character": nameEndCharacter(entry),
 				},
 			},
 		}
@@ -455,77 +1144,509 @@ func (s *Server) HandleDocumentSymbol(params interface{}) interface{} {
 			symbol["detail"] = entry.Detail
 		}
 
-		symbols = append(symbols, symbol)
-	}
+		for len(open) > 0 && open[len(open)-1].endLine < entry.Line {
+			open = open[:len(open)-1]
+		}
 
-	return symbols
-}
+		node := &outlineNode{symbol: symbol, endLine: endLine}
+		if len(open) > 0 {
+			parent := open[len(open)-1]
+			parent.children = append(parent.children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		if endLine > entry.Line {
+			open = append(open, node)
+		}
+	}
 
-// HandleWorkspaceSymbol handles workspace/symbol request (Ctrl+T)
-func (s *Server) HandleWorkspaceSymbol(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing workspace symbol request")
+	var toSymbols func(nodes []*outlineNode) []interface{}
+	toSymbols = func(nodes []*outlineNode) []interface{} {
+		symbols := make([]interface{}, 0, len(nodes))
+		for _, node := range nodes {
+			if len(node.children) > 0 {
+				node.symbol["children"] = toSymbols(node.children)
+			}
+			symbols = append(symbols, node.symbol)
+		}
+		return symbols
+	}
+
+	return toSymbols(roots)
+}
 
-	idx, hasIndexer := s.Indexer.(*indexer.Index)
-	if !hasIndexer || !idx.IsReady() {
+// HandleWorkspaceSymbol handles workspace/symbol request (Ctrl+T).
+// Results are capped at the workspace symbol limit. A client that passes a
+// partialResultToken instead receives every match, streamed as $/progress
+// notifications of up to limit symbols each, best matches first; the response
+// itself is then empty, as partial results require. A "kinds" list of LSP
+// SymbolKinds in the params keeps only symbols of those kinds.
+func (s *Server) HandleWorkspaceSymbol(id interface{}, params interface{}) interface{} {
+	s.Logger.Println("Processing workspace symbol request")
+
+	idx := s.Indexer
+	if s.stillIndexing("Workspace symbols") || idx == nil || s.isCancelled(id) {
 		return []interface{}{}
 	}
 
 	query := ""
+	var partialResultToken interface{}
+	kinds := make(map[int]bool)
 	if paramMap, ok := params.(map[string]interface{}); ok {
 		if q, ok := paramMap["query"].(string); ok {
 			query = q
 		}
+		partialResultToken = paramMap["partialResultToken"]
+		// Not part of the protocol: clients may narrow results to some SymbolKinds
+		if requested, ok := paramMap["kinds"].([]interface{}); ok {
+			for _, kind := range requested {
+				if number, ok := kind.(float64); ok {
+					kinds[int(number)] = true
+				}
+			}
+		}
 	}
 
 	if query == "" || len(query) < 2 {
 		return []interface{}{}
 	}
 
-	entries := idx.PrefixSearch(query)
+	// Best matches first: exact, prefix, then word initials (AR -> ApplicationRecord)
+	limit := s.symbolLimit()
+	ctx, release := s.requestContext(id)
+	defer release()
+	var keep func(indexer.SymbolEntry) bool
+	if len(kinds) > 0 {
+		keep = func(entry indexer.SymbolEntry) bool {
+			return kinds[indexer.SymbolKindToLSP(entry.Type)]
+		}
+	}
+	search := func(limit int) []indexer.SymbolEntry {
+		return idx.SearchSymbols(ctx, query, limit, keep)
+	}
+	if partialResultToken != nil {
+		entries := search(0)
+		for start := 0; start < len(entries); start += limit {
+			if s.isCancelled(id) {
+				return nil
+			}
+			end := start + limit
+			if end > len(entries) {
+				end = len(entries)
+			}
+			batch := make([]interface{}, 0, end-start)
+			for _, entry := range entries[start:end] {
+				batch = append(batch, s.workspaceSymbol(entry))
+			}
+			s.SendNotification("$/progress", map[string]interface{}{
+				"token": partialResultToken,
+				"value": batch,
+			})
+		}
+		return []interface{}{}
+	}
 
 	var symbols []interface{}
-	for _, entry := range entries {
-		kind := indexer.SymbolKindToLSP(entry.Type)
-
-		relPath := entry.FilePath
-		if s.GlobalState.WorkspacePath != "" {
-			if rel, err := filepath.Rel(s.GlobalState.WorkspacePath, entry.FilePath); err == nil {
-				relPath = rel
-			}
+	for i, entry := range search(limit) {
+		if i%cancelCheckInterval == 0 && s.isCancelled(id) {
+			return nil
 		}
+		symbols = append(symbols, s.workspaceSymbol(entry))
+	}
 
-		symbol := map[string]interface{}{
-			"name": entry.FullyQualifiedName,
-			"kind": kind,
-			"location": map[string]interface{}{
-				"uri": pathToURI(entry.FilePath),
-				"range": map[string]interface{}{
-					"start": map[string]interface{}{
-						"line":      entry.Line - 1,
-						"character": entry.Character,
-					},
-					"end": map[string]interface{}{
-						"line":      entry.Line - 1,
-						"character": entry.Character + len(entry.Name),
-					},
+	return symbols
+}
+
+// workspaceSymbol converts an index entry to an LSP SymbolInformation, contained
+// in its namespace so pickers group it (User → save), or in its file when it is
+// defined at the top level
+func (s *Server) workspaceSymbol(entry indexer.SymbolEntry) map[string]interface{} {
+	container := entry.Parent
+	if container == "" {
+		container = s.relativePath(entry.FilePath)
+	}
+	return map[string]interface{}{
+		"name": entry.Name,
+		"kind": indexer.SymbolKindToLSP(entry.Type),
+		"location": map[string]interface{}{
+			"uri": store.PathToURI(entry.FilePath),
+			"range": map[string]interface{}{
+				"start": map[string]interface{}{
+					"line":      entry.Line - 1,
+					"character": entry.Character,
+				},
+				"end": map[string]interface{}{
+					"line":      entry.Line - 1,
+					"character": nameEndCharacter(entry),
 				},
 			},
-			"containerName": relPath,
+		},
+		"containerName": container,
+	}
+}
+
+// HandleFormatting handles textDocument/formatting request by piping the buffer
+// through the formatter backend and replacing the whole document with its
+// output. Nothing changes when the backend cannot run or fails.
+func (s *Server) HandleFormatting(params interface{}) interface{} {
+	backend := s.FormatterBackend()
+	s.Logger.Printf("Processing formatting request (formatter: %s)", backend)
+
+	doc, exists := s.Store.Get(extractTextDocumentURI(params))
+	if !exists || !s.formattingAvailable() {
+		return []interface{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch backend {
+	case "rubocop":
+		// Offenses go to stderr, leaving only the corrected source on stdout
+		cmd = s.toolCommand(ctx, "rubocop", "--autocorrect", "--stderr", "--format", "quiet", "--stdin", uriToFilePath(doc.URI))
+	case "syntax_tree":
+		cmd = s.toolCommand(ctx, "stree", "format")
+	}
+	cmd.Stdin = strings.NewReader(doc.Source)
+	output, err := cmd.Output()
+	// rubocop exits 1 when offenses remain after correcting what it could
+	var exitErr *exec.ExitError
+	if err != nil && !(backend == "rubocop" && errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		s.Logger.Printf("Formatting with %s failed: %v", backend, err)
+		return []interface{}{}
+	}
+	if len(output) == 0 || string(output) == doc.Source {
+		return []interface{}{}
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"start": map[string]interface{}{"line": 0, "character": 0},
+				"end":   map[string]interface{}{"line": strings.Count(doc.Source, "\n") + 1, "character": 0},
+			},
+			"newText": string(output),
+		},
+	}
+}
+
+// sortByProximity stably orders entries by how close their file is to fromPath:
+// the same directory first, then the same subtree (app/models, lib), then the rest
+func (s *Server) sortByProximity(entries []indexer.SymbolEntry, fromPath string) []indexer.SymbolEntry {
+	if len(entries) < 2 {
+		return entries
+	}
+
+	fromDir := filepath.Dir(fromPath)
+	fromSubtree := s.subtreeOf(fromPath)
+	rank := func(entry indexer.SymbolEntry) int {
+		switch {
+		case filepath.Dir(entry.FilePath) == fromDir:
+			return 0
+		case fromSubtree != "" && s.subtreeOf(entry.FilePath) == fromSubtree:
+			return 1
 		}
-		symbols = append(symbols, symbol)
+		return 2
+	}
 
-		if len(symbols) >= 50 {
-			break
+	sorted := append([]indexer.SymbolEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
+// collapseModuleFunctions drops the module-level copy of a module_function (or
+// extend self) method when its instance method is also among the entries, since
+// both point at the same def
+func collapseModuleFunctions(entries []indexer.SymbolEntry) []indexer.SymbolEntry {
+	instances := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Type == indexer.SymbolMethod && indexer.IsModuleFunction(entry) {
+			instances[fmt.Sprintf("%s:%d", entry.FilePath, entry.Line)] = true
 		}
 	}
+	if len(instances) == 0 {
+		return entries
+	}
+	return filterEntries(entries, func(entry indexer.SymbolEntry) bool {
+		return entry.Type != indexer.SymbolSingletonMethod || !indexer.IsModuleFunction(entry) ||
+			!instances[fmt.Sprintf("%s:%d", entry.FilePath, entry.Line)]
+	})
+}
 
-	return symbols
+// collapseReopenedClasses keeps the first entry of each class or module among
+// entries, so a class reopened in several files is described once
+func collapseReopenedClasses(entries []indexer.SymbolEntry) []indexer.SymbolEntry {
+	seen := make(map[string]bool)
+	return filterEntries(entries, func(entry indexer.SymbolEntry) bool {
+		if entry.Type != indexer.SymbolClass && entry.Type != indexer.SymbolModule {
+			return true
+		}
+		if seen[entry.FullyQualifiedName] {
+			return false
+		}
+		seen[entry.FullyQualifiedName] = true
+		return true
+	})
 }
 
-// HandleFormatting handles textDocument/formatting request
-func (s *Server) HandleFormatting(params interface{}) interface{} {
-	s.Logger.(*log.Logger).Println("Processing formatting request")
-	return []interface{}{}
+// resolveAliases replaces the constant aliases among entries with the definitions
+// they alias, keeping an alias whose target is not indexed
+func resolveAliases(idx indexer.SymbolIndex, entries []indexer.SymbolEntry) []indexer.SymbolEntry {
+	var resolved []indexer.SymbolEntry
+	for _, entry := range entries {
+		if targets := idx.ResolveAlias(entry); len(targets) > 0 {
+			resolved = append(resolved, targets...)
+		} else {
+			resolved = append(resolved, entry)
+		}
+	}
+	return resolved
+}
+
+// subtreeOf returns the top-level part of the workspace a file belongs to:
+// two levels under app/ (app/models), one level elsewhere (lib, spec)
+func (s *Server) subtreeOf(path string) string {
+	segments := strings.Split(filepath.ToSlash(s.relativePath(path)), "/")
+	if len(segments) < 2 || segments[0] == ".." {
+		return ""
+	}
+	if segments[0] == "app" && len(segments) > 2 {
+		return segments[0] + "/" + segments[1]
+	}
+	return segments[0]
+}
+
+// relativePath returns a path relative to the workspace folder containing it
+func (s *Server) relativePath(path string) string {
+	root := s.GlobalState.WorkspacePath
+	if idx := s.Indexer; idx != nil {
+		root = idx.RootOf(path)
+	}
+	if root == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// Hover shown while the workspace is being indexed
+const indexingMessage = "Indexing workspace…"
+
+// stillIndexing reports whether the workspace index is still being built. The
+// first request to find it so tells the client with a window/logMessage; the rest
+// of the indexing run stays quiet.
+func (s *Server) stillIndexing(feature string) bool {
+	idx := s.Indexer
+	if idx == nil || idx.IsReady() {
+		return false
+	}
+
+	s.noticeMutex.Lock()
+	noticed := s.indexingNoticed
+	s.indexingNoticed = true
+	s.noticeMutex.Unlock()
+	if !noticed {
+		s.logMessage(messageTypeInfo, feature+" are incomplete until workspace indexing finishes")
+	}
+	return true
+}
+
+// featureEnabled reports whether an optional feature is on. Features are enabled
+// unless the client turned them off through enabledFeatures.
+func (s *Server) featureEnabled(name string) bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	enabled, configured := s.GlobalState.EnabledFeatures[name]
+	return !configured || enabled
+}
+
+// completionLimit returns the configured number of completion items per request
+func (s *Server) completionLimit() int {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	if s.GlobalState.CompletionLimit > 0 {
+		return s.GlobalState.CompletionLimit
+	}
+	return defaultResultLimit
+}
+
+// requireAware reports whether completion ranks symbols by what the file requires
+func (s *Server) requireAware() bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	return s.GlobalState.RequireAware
+}
+
+// completionFilePaths reports whether completion items show the relative path
+// of the file defining them
+func (s *Server) completionFilePaths() bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	return s.GlobalState.CompletionPaths
+}
+
+// hoverPreferType returns the type source hovers list first, "auto" when unset
+func (s *Server) hoverPreferType() string {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	if s.GlobalState.HoverPreferType == "" {
+		return "auto"
+	}
+	return s.GlobalState.HoverPreferType
+}
+
+// hoverShowSource reports whether method hovers include the method's source
+func (s *Server) hoverShowSource() bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	return s.GlobalState.HoverShowSource
+}
+
+// symbolLimit returns the configured number of workspace symbols per request
+func (s *Server) symbolLimit() int {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+
+	if s.GlobalState.SymbolLimit > 0 {
+		return s.GlobalState.SymbolLimit
+	}
+	return defaultResultLimit
+}
+
+// FormatterBackend resolves the configured formatter to the backend that will be used.
+// "auto" picks rubocop or syntax_tree based on the config files present in the workspace.
+func (s *Server) FormatterBackend() string {
+	s.GlobalState.Mutex.Lock()
+	formatter := s.GlobalState.Formatter
+	workspacePath := s.GlobalState.WorkspacePath
+	s.GlobalState.Mutex.Unlock()
+
+	if formatter != "auto" {
+		return formatter
+	}
+
+	if workspacePath != "" {
+		if _, err := os.Stat(filepath.Join(workspacePath, ".rubocop.yml")); err == nil {
+			return "rubocop"
+		}
+		if _, err := os.Stat(filepath.Join(workspacePath, ".streerc")); err == nil {
+			return "syntax_tree"
+		}
+	}
+	return "none"
+}
+
+// HandleDidChangeConfiguration handles workspace/didChangeConfiguration notification.
+// Settings may arrive namespaced under "rubyLspGo" or flat.
+func (s *Server) HandleDidChangeConfiguration(params interface{}) {
+	paramMap, ok := params.(map[string]interface{})
+	if !ok {
+		return
+	}
+	settings, ok := paramMap["settings"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if nested, ok := settings["rubyLspGo"].(map[string]interface{}); ok {
+		settings = nested
+	}
+
+	s.GlobalState.Mutex.Lock()
+	if formatter, ok := settings["formatter"].(string); ok && formatter != "" {
+		s.GlobalState.Formatter = formatter
+	}
+	if testLibrary, ok := settings["testLibrary"].(string); ok && testLibrary != "" {
+		s.GlobalState.TestLibrary = testLibrary
+	}
+	if features, ok := settings["enabledFeatures"].(map[string]interface{}); ok {
+		for name, value := range features {
+			if enabled, ok := value.(bool); ok {
+				s.GlobalState.EnabledFeatures[name] = enabled
+			}
+		}
+	}
+	formatter := s.GlobalState.Formatter
+	testLibrary := s.GlobalState.TestLibrary
+	s.GlobalState.Mutex.Unlock()
+
+	s.Logger.Printf("Configuration changed (formatter: %s, test library: %s)", formatter, testLibrary)
+}
+
+// HandleDidChangeWorkspaceFolders handles workspace/didChangeWorkspaceFolders notification.
+// Removed folders are dropped from the index right away; added folders are indexed in the background.
+func (s *Server) HandleDidChangeWorkspaceFolders(params interface{}) {
+	paramMap, ok := params.(map[string]interface{})
+	if !ok {
+		return
+	}
+	event, ok := paramMap["event"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	added := workspaceFolderPaths(event["added"])
+	removed := workspaceFolderPaths(event["removed"])
+
+	s.GlobalState.Mutex.Lock()
+	var folders []string
+	for _, folder := range s.GlobalState.WorkspaceFolders {
+		keep := true
+		for _, path := range removed {
+			keep = keep && folder != path
+		}
+		if keep {
+			folders = append(folders, folder)
+		}
+	}
+	folders = append(folders, added...)
+	s.GlobalState.WorkspaceFolders = folders
+	options := s.GlobalState.IndexOptions
+	s.GlobalState.Mutex.Unlock()
+
+	if s.Indexer == nil {
+		if len(added) == 0 {
+			return
+		}
+		s.StartIndexing(indexer.NewForRoots(added, s.Logger, options))
+		return
+	}
+	idx := s.Indexer
+	if idx == nil {
+		return
+	}
+
+	for _, path := range removed {
+		idx.RemoveRoot(path)
+	}
+	for _, path := range added {
+		path := path
+		s.RunInBackground(func(ctx context.Context) { idx.AddRoot(ctx, path) })
+	}
+
+	s.Logger.Printf("Workspace folders changed (%d added, %d removed)", len(added), len(removed))
+}
+
+// workspaceFolderPaths converts a WorkspaceFolder[] to file system paths
+func workspaceFolderPaths(folders interface{}) []string {
+	var paths []string
+	list, _ := folders.([]interface{})
+	for _, folder := range list {
+		if folderMap, ok := folder.(map[string]interface{}); ok {
+			if uri, ok := folderMap["uri"].(string); ok {
+				paths = append(paths, uriToFilePath(uri))
+			}
+		}
+	}
+	return paths
 }
 
 // SendResponse sends a response back to the client
@@ -536,46 +1657,280 @@ func (s *Server) SendResponse(id interface{}, result interface{}) {
 		"result":  result,
 	}
 
-	jsonBytes, err := json.Marshal(response)
+	s.OutgoingQueue <- response
+}
+
+// SendNotification sends a JSON-RPC notification to the client
+func (s *Server) SendNotification(method string, params interface{}) {
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}
+
+	s.OutgoingQueue <- notification
+}
+
+// SendError sends a JSON-RPC error response back to the client
+func (s *Server) SendError(id interface{}, code int, message string) {
+	response := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	}
+
+	s.OutgoingQueue <- response
+}
+
+// writeMessage frames a message and writes it to stdout
+func (s *Server) writeMessage(message interface{}) {
+	jsonBytes, err := json.Marshal(message)
 	if err != nil {
-		s.Logger.(*log.Logger).Printf("Error marshaling response: %v", err)
+		s.Logger.Printf("Error marshaling response: %v", err)
 		return
 	}
 
 	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(jsonBytes), jsonBytes)
 }
 
-// DispatchOutgoingMessages dispatches messages from the outgoing queue
+// DispatchOutgoingMessages writes the messages of the outgoing queue to stdout.
+// Requests are handled concurrently, so this is the only goroutine writing there,
+// which keeps frames from interleaving.
 func (s *Server) DispatchOutgoingMessages() {
-	s.Logger.(*log.Logger).Println("Starting message dispatcher...")
+	s.Logger.Println("Starting message dispatcher...")
+	for message := range s.OutgoingQueue {
+		s.writeMessage(message)
+	}
 }
 
-// Shutdown handles server shutdown
+// Shutdown handles server shutdown. Later requests are rejected, pending buffer
+// re-indexes are dropped and background indexing is cancelled, waiting up to
+// shutdownGracePeriod for it to stop. The queues stay open for the shutdown
+// response and whatever background work still reports.
 func (s *Server) Shutdown() {
-	s.Logger.(*log.Logger).Println("Shutting down Ruby LSP Go server")
-	close(s.IncomingQueue)
-	close(s.OutgoingQueue)
+	s.Logger.Println("Shutting down Ruby LSP Go server")
+	s.shuttingDown = true
+
+	s.reindexMutex.Lock()
+	for uri, timer := range s.reindexTimers {
+		timer.Stop()
+		delete(s.reindexTimers, uri)
+	}
+	s.reindexMutex.Unlock()
+
+	s.backgroundMutex.Lock()
+	s.backgroundContextLocked()
+	s.stopBackground()
+	s.backgroundMutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownGracePeriod):
+		s.Logger.Printf("Background work still running %v after shutdown", shutdownGracePeriod)
+	}
+}
+
+// RunInBackground runs work on its own goroutine with a context cancelled at
+// shutdown, which waits for the work to return. Work started after shutdown is
+// dropped.
+func (s *Server) RunInBackground(work func(ctx context.Context)) {
+	s.backgroundMutex.Lock()
+	defer s.backgroundMutex.Unlock()
+
+	ctx := s.backgroundContextLocked()
+	if ctx.Err() != nil {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		work(ctx)
+	}()
+}
+
+// StartIndexing makes idx the server's index and builds it in the background.
+// Requests answered before it is ready notify the client once for this run.
+func (s *Server) StartIndexing(idx *indexer.Index) {
+	s.noticeMutex.Lock()
+	s.indexingNoticed = false
+	s.noticeMutex.Unlock()
+
+	s.Indexer = idx
+	s.RunInBackground(idx.BuildIndex)
+}
+
+// backgroundContextLocked returns the context of background work, creating it on
+// first use. backgroundMutex must be held.
+func (s *Server) backgroundContextLocked() context.Context {
+	if s.backgroundContext == nil {
+		s.backgroundContext, s.stopBackground = context.WithCancel(context.Background())
+	}
+	return s.backgroundContext
 }
 
-// HandleCancelRequest handles cancellation of requests
+// IsShuttingDown reports whether shutdown was requested
+func (s *Server) IsShuttingDown() bool {
+	return s.shuttingDown
+}
+
+// HandleCancelRequest handles cancellation of requests.
+// Only requests still in flight are marked, so late cancellations don't accumulate.
 func (s *Server) HandleCancelRequest(params interface{}) {
-	s.Logger.(*log.Logger).Println("Handling cancel request")
+	s.Logger.Println("Handling cancel request")
 	if paramMap, ok := params.(map[string]interface{}); ok {
 		if idParam, exists := paramMap["id"]; exists {
-			var id int
-			switch v := idParam.(type) {
-			case float64:
-				id = int(v)
-			case string:
-				if intVal, err := strconv.Atoi(v); err == nil {
-					id = intVal
+			id := requestKey(idParam)
+
+			s.cancelMutex.Lock()
+			if _, inFlight := s.CancelledRequests[id]; inFlight {
+				s.CancelledRequests[id] = true
+				if cancel, ok := s.requestCancels[id]; ok {
+					cancel()
 				}
 			}
-			s.CancelledRequests[id] = true
+			s.cancelMutex.Unlock()
 		}
 	}
 }
 
+// BeginRequest registers a request as in flight so it can be cancelled
+func (s *Server) BeginRequest(id interface{}) {
+	s.cancelMutex.Lock()
+	defer s.cancelMutex.Unlock()
+	s.CancelledRequests[requestKey(id)] = false
+}
+
+// isCancelled reports whether the client cancelled the request
+func (s *Server) isCancelled(id interface{}) bool {
+	s.cancelMutex.Lock()
+	defer s.cancelMutex.Unlock()
+	return s.CancelledRequests[requestKey(id)]
+}
+
+// requestContext returns the context bounding the index scans of a request: done
+// once the client cancels the request or after searchTimeout. The returned
+// function releases it when the request is answered.
+func (s *Server) requestContext(id interface{}) (context.Context, context.CancelFunc) {
+	key := requestKey(id)
+	ctx, cancel := context.WithTimeout(context.Background(), searchTimeout)
+
+	s.cancelMutex.Lock()
+	defer s.cancelMutex.Unlock()
+	if s.CancelledRequests[key] {
+		cancel()
+	}
+	if s.requestCancels == nil {
+		s.requestCancels = make(map[string]context.CancelFunc)
+	}
+	s.requestCancels[key] = cancel
+
+	return ctx, func() {
+		s.cancelMutex.Lock()
+		delete(s.requestCancels, key)
+		s.cancelMutex.Unlock()
+		cancel()
+	}
+}
+
+// SendResult responds to an in-flight request, sending a RequestCancelled error
+// instead of the result when the client cancelled it meanwhile
+func (s *Server) SendResult(id interface{}, result interface{}) {
+	key := requestKey(id)
+
+	s.cancelMutex.Lock()
+	cancelled := s.CancelledRequests[key]
+	delete(s.CancelledRequests, key)
+	s.cancelMutex.Unlock()
+
+	if cancelled {
+		s.SendError(id, RequestCancelled, "Request cancelled")
+		return
+	}
+	s.SendResponse(id, result)
+}
+
+// requestKey normalizes a JSON-RPC request ID for the cancellation map. Numbers
+// decode as float64 from JSON but are ints when passed in-process, so both format
+// alike; string IDs are quoted, keeping "7" apart from 7 and every non-numeric
+// ID apart from the others.
+func requestKey(id interface{}) string {
+	switch v := id.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	}
+	return fmt.Sprint(id)
+}
+
+// scheduleReindex re-indexes a document's buffer once it has stopped changing for
+// the debounce interval. Each change restarts the timer, so a burst of keystrokes
+// results in a single parse of the latest source.
+func (s *Server) scheduleReindex(uri string) {
+	idx := s.Indexer
+	if idx == nil || !strings.HasPrefix(uri, "file://") || !idx.ShouldIndex(uriToFilePath(uri)) {
+		return
+	}
+	// Files indexed only as they are saved keep what was saved until the next save
+	if idx.Mode() == indexer.ModeOnSave {
+		return
+	}
+
+	s.GlobalState.Mutex.Lock()
+	delay := s.GlobalState.ReindexDebounce
+	s.GlobalState.Mutex.Unlock()
+
+	s.reindexMutex.Lock()
+	defer s.reindexMutex.Unlock()
+
+	if s.reindexTimers == nil {
+		s.reindexTimers = make(map[string]*time.Timer)
+	}
+	if pending, ok := s.reindexTimers[uri]; ok {
+		pending.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		s.reindexMutex.Lock()
+		if s.reindexTimers[uri] != timer {
+			// Superseded by a later change
+			s.reindexMutex.Unlock()
+			return
+		}
+		delete(s.reindexTimers, uri)
+		s.reindexMutex.Unlock()
+
+		s.RunInBackground(func(context.Context) {
+			if doc, exists := s.Store.Get(uri); exists {
+				idx.UpdateFileFromSource(uriToFilePath(uri), doc.Source)
+			}
+		})
+	})
+	s.reindexTimers[uri] = timer
+}
+
+// cancelReindex drops the pending buffer re-index of a document, if any
+func (s *Server) cancelReindex(uri string) {
+	s.reindexMutex.Lock()
+	defer s.reindexMutex.Unlock()
+
+	if pending, ok := s.reindexTimers[uri]; ok {
+		pending.Stop()
+		delete(s.reindexTimers, uri)
+	}
+}
+
 // --- Helper functions ---
 
 // extractTextDocumentPosition extracts URI and Position from LSP params
@@ -613,22 +1968,32 @@ func extractTextDocumentURI(params interface{}) string {
 
 // uriToFilePath converts a file:// URI to a filesystem path
 func uriToFilePath(uri string) string {
-	if strings.HasPrefix(uri, "file://") {
-		parsed, err := url.Parse(uri)
-		if err == nil {
-			return parsed.Path
-		}
-		return strings.TrimPrefix(uri, "file://")
+	return store.URIToPath(uri)
+}
+
+// nestingOf splits a lexical scope into the namespaces nesting it, outermost first
+func nestingOf(scope string) []string {
+	if scope == "" {
+		return nil
 	}
-	return uri
+	return strings.Split(scope, "::")
 }
 
-// pathToURI converts a filesystem path to a file:// URI
-func pathToURI(path string) string {
-	if strings.HasPrefix(path, "/") {
-		return "file://" + path
+// An assignment following a name, as opposed to a comparison, match or hash arrow
+var assignmentAfterPattern = regexp.MustCompile(`^\s*=(?:[^=~>]|$)`)
+
+// setterCallName returns the setter an identifier calls when it is assigned through
+// a receiver (name= for user.name = "x"), "" for anything else
+func setterCallName(source string, token indexer.Token) string {
+	if token.Kind != indexer.TokenIdentifier || receiverBefore(source, token.Line, token.StartCharacter) == "" {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	runes := []rune(lines[token.Line])
+	if token.EndCharacter > len(runes) || !assignmentAfterPattern.MatchString(string(runes[token.EndCharacter:])) {
+		return ""
 	}
-	return "file:///" + path
+	return token.Text + "="
 }
 
 // isCapitalized checks if a string starts with an uppercase letter
@@ -656,6 +2021,69 @@ func capitalize(s string) string {
 	return result.String()
 }
 
+// formatDocComment renders a parsed YARD comment as hover markdown
+func formatDocComment(doc *indexer.DocComment) string {
+	var parts []string
+
+	if len(doc.Description) > 0 {
+		parts = append(parts, strings.Join(doc.Description, "\n"))
+	}
+
+	if len(doc.Params) > 0 {
+		lines := []string{"**Parameters:**"}
+		for _, param := range doc.Params {
+			line := fmt.Sprintf("- `%s`", param.Name)
+			if param.Types != "" {
+				line += fmt.Sprintf(" (`%s`)", param.Types)
+			}
+			if param.Text != "" {
+				line += " — " + param.Text
+			}
+			lines = append(lines, line)
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+
+	if doc.Return != nil {
+		line := "**Returns:**"
+		if doc.Return.Types != "" {
+			line += fmt.Sprintf(" `%s`", doc.Return.Types)
+		}
+		if doc.Return.Text != "" {
+			line += " — " + doc.Return.Text
+		}
+		parts = append(parts, line)
+	}
+
+	for _, tag := range doc.Tags {
+		switch tag.Tag {
+		case "example":
+			title := "**Example:**"
+			if tag.Name != "" {
+				title = fmt.Sprintf("**Example:** %s", tag.Name)
+			}
+			parts = append(parts, fmt.Sprintf("%s\n```ruby\n%s\n```", title, strings.TrimSpace(tag.Text)))
+		default:
+			line := fmt.Sprintf("**@%s**", tag.Tag)
+			if tag.Tag == "raise" {
+				line = "**Raises:**"
+			}
+			if tag.Name != "" {
+				line += fmt.Sprintf(" `%s`", tag.Name)
+			}
+			if tag.Types != "" {
+				line += fmt.Sprintf(" `%s`", tag.Types)
+			}
+			if tag.Text != "" {
+				line += " — " + tag.Text
+			}
+			parts = append(parts, line)
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
 // extractSymbolsFromAST extracts symbols from the AST for document symbols (fallback)
 func extractSymbolsFromAST(node *documents.Node, symbols *[]interface{}) {
 	if node.Type == "class" || node.Type == "method" || node.Type == "module" {
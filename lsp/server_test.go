@@ -0,0 +1,172 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// captureOutgoing replaces the drained outgoing queue of a test server with one
+// the test reads from
+func captureOutgoing(s *Server) chan interface{} {
+	s.OutgoingQueue = make(chan interface{}, 100)
+	return s.OutgoingQueue
+}
+
+// notifications returns the notifications of a method queued so far
+func notifications(queue chan interface{}, method string) []map[string]interface{} {
+	var found []map[string]interface{}
+	for {
+		select {
+		case message := <-queue:
+			if notification, ok := message.(map[string]interface{}); ok && notification["method"] == method {
+				found = append(found, notification)
+			}
+		default:
+			return found
+		}
+	}
+}
+
+func TestStillIndexingNotifiesOncePerRun(t *testing.T) {
+	s := NewTestServer(map[string]string{"app/models/user.rb": "class User\nend\n"})
+	queue := captureOutgoing(s)
+	unbuilt := func() *indexer.Index {
+		return indexer.New(testWorkspace, log.New(io.Discard, "", 0))
+	}
+
+	if s.stillIndexing("Hovers") {
+		t.Fatal("stillIndexing = true with a ready index")
+	}
+	s.Indexer = unbuilt()
+	for _, feature := range []string{"Hovers", "Completions", "Definitions"} {
+		if !s.stillIndexing(feature) {
+			t.Fatalf("stillIndexing(%s) = false while indexing", feature)
+		}
+	}
+	if logged := notifications(queue, "window/logMessage"); len(logged) != 1 {
+		t.Errorf("window/logMessage sent %d times during one indexing run, want once", len(logged))
+	}
+
+	// A new indexing run notifies again
+	s.StartIndexing(unbuilt())
+	s.Indexer = unbuilt()
+	s.stillIndexing("Hovers")
+	s.stillIndexing("Hovers")
+	if logged := notifications(queue, "window/logMessage"); len(logged) != 1 {
+		t.Errorf("window/logMessage sent %d times during the next indexing run, want once", len(logged))
+	}
+}
+
+func TestDidSaveReindexesFromTheSavedText(t *testing.T) {
+	s := NewTestServer(map[string]string{"app/models/user.rb": "class User\n  def name\n  end\nend\n"})
+
+	// The file exists nowhere on disk, so only the saved text can be indexed
+	params := documentParams("app/models/user.rb")
+	params["text"] = "class User\n  def full_name\n  end\nend\n"
+	s.HandleDidSave(params)
+	s.background.Wait()
+
+	if entries := s.Indexer.Lookup("full_name"); len(entries) != 1 || entries[0].FilePath != testFilePath("app/models/user.rb") {
+		t.Errorf("Lookup(full_name) = %+v, want the method of the saved text", entries)
+	}
+	if entries := s.Indexer.Lookup("name"); len(entries) != 0 {
+		t.Errorf("Lookup(name) = %+v, want the method removed by the save", entries)
+	}
+}
+
+func TestShutdownMidIndexStopsBackgroundWork(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		files[fmt.Sprintf("app/models/model_%d.rb", i)] = fmt.Sprintf("class Model%d\n  def name\n  end\nend\n", i)
+	}
+	root := writeWorkspace(t, files)
+
+	s := NewTestServer(nil)
+	s.GlobalState.ReindexDebounce = time.Millisecond
+	idx := indexer.NewForRoots([]string{root}, s.Logger, indexer.Options{})
+	s.StartIndexing(idx)
+
+	// A buffer re-index pending at shutdown is dropped rather than run
+	uri := store.PathToURI(filepath.Join(root, "app/models/model_0.rb"))
+	s.Store.Set(uri, "class Model0\n  def renamed\n  end\nend\n", 2, "ruby")
+	s.scheduleReindex(uri)
+
+	start := time.Now()
+	s.Shutdown()
+	if elapsed := time.Since(start); elapsed >= shutdownGracePeriod {
+		t.Errorf("Shutdown took %v, want indexing to stop before the grace period", elapsed)
+	}
+
+	if idx.IsReady() {
+		t.Error("index ready after shutdown, want indexing cancelled mid-walk")
+	}
+
+	// Nothing started at or after shutdown runs
+	ran := false
+	s.RunInBackground(func(context.Context) { ran = true })
+	time.Sleep(10 * time.Millisecond)
+	s.background.Wait()
+	if ran {
+		t.Error("work started after shutdown ran")
+	}
+	if entries := idx.Lookup("renamed"); len(entries) != 0 {
+		t.Errorf("Lookup(renamed) = %+v, want the pending re-index dropped", entries)
+	}
+}
+
+// didChangeParams builds a didChange of one ranged edit
+func didChangeParams(name string, startLine, startCharacter, endLine, endCharacter int, text string) map[string]interface{} {
+	params := documentParams(name)
+	params["contentChanges"] = []interface{}{map[string]interface{}{
+		"range": map[string]interface{}{
+			"start": map[string]interface{}{"line": float64(startLine), "character": float64(startCharacter)},
+			"end":   map[string]interface{}{"line": float64(endLine), "character": float64(endCharacter)},
+		},
+		"text": text,
+	}}
+	return params
+}
+
+func TestDidChangeOutsideTheBufferLeavesItIntact(t *testing.T) {
+	source := "class User\n  def name\n  end\nend\n"
+	s := NewTestServer(map[string]string{"app/models/user.rb": source})
+	queue := captureOutgoing(s)
+	uri := testFileURI("app/models/user.rb")
+
+	for i := 1; i < maxInvalidChanges; i++ {
+		s.HandleDidChange(didChangeParams("app/models/user.rb", 3, 0, 12, 4, "x"))
+		doc, exists := s.Store.Get(uri)
+		if !exists || doc.Source != source {
+			t.Fatalf("after %d out-of-range edit(s), buffer = %+v, want it unchanged", i, doc)
+		}
+	}
+
+	// A valid change in between means the buffer is still in sync
+	s.HandleDidChange(didChangeParams("app/models/user.rb", 1, 6, 1, 10, "full_name"))
+	if doc, _ := s.Store.Get(uri); doc.Source != "class User\n  def full_name\n  end\nend\n" {
+		t.Fatalf("buffer after a valid edit = %q", doc.Source)
+	}
+
+	// Too many rejected changes in a row and the buffer is dropped for a resync
+	for i := 1; i < maxInvalidChanges; i++ {
+		s.HandleDidChange(didChangeParams("app/models/user.rb", 8, 0, 9, 0, "x"))
+	}
+	if _, exists := s.Store.Get(uri); !exists {
+		t.Fatal("buffer dropped before maxInvalidChanges rejected changes in a row")
+	}
+	s.HandleDidChange(didChangeParams("app/models/user.rb", 8, 0, 9, 0, "x"))
+	if _, exists := s.Store.Get(uri); exists {
+		t.Error("buffer kept after repeated out-of-range edits, want it dropped")
+	}
+	if shown := notifications(queue, "window/showMessage"); len(shown) != 1 {
+		t.Errorf("window/showMessage sent %d times, want the user asked once to reopen the file", len(shown))
+	}
+}
@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// Signatures offered at most for a call, since a common name matches many methods
+const maxSignatures = 10
+
+// openCall is the method call whose argument list contains the cursor
+type openCall struct {
+	name           string
+	receiver       string // expression before ".", "" for a call on implicit self
+	activeArgument int    // 0-based index of the argument being typed
+}
+
+// HandleSignatureHelp handles textDocument/signatureHelp request
+func (s *Server) HandleSignatureHelp(params interface{}) interface{} {
+	s.Logger.Println("Processing signature help request")
+
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return nil
+	}
+
+	uri, pos := extractTextDocumentPosition(params)
+	if uri == "" {
+		return nil
+	}
+
+	doc, exists := s.Store.Get(uri)
+	if !exists {
+		return nil
+	}
+
+	lines := strings.Split(doc.Source, "\n")
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return nil
+	}
+	runes := []rune(strings.TrimSuffix(lines[pos.Line], "\r"))
+	if pos.Character < len(runes) {
+		runes = runes[:pos.Character]
+	}
+
+	call, ok := enclosingCall(string(runes))
+	if !ok {
+		return nil
+	}
+
+	methods := filterEntries(idx.Lookup(call.name), func(entry indexer.SymbolEntry) bool {
+		return entry.Type == indexer.SymbolMethod || entry.Type == indexer.SymbolSingletonMethod
+	})
+
+	// Narrow to the receiver's class when it is known and defines the method
+	scope := idx.EnclosingScope(uriToFilePath(uri), pos.Line+1)
+	receiver := call.receiver
+	if receiver == "" {
+		receiver = "self"
+	}
+	if class := resolveReceiverClass(idx, doc.Source, pos.Line, receiver, scope); class != "" {
+		members := filterEntries(methods, func(entry indexer.SymbolEntry) bool {
+			return isMemberOf(idx, entry, class)
+		})
+		if len(members) > 0 {
+			methods = members
+		}
+	}
+
+	var signatures []interface{}
+	for _, entry := range methods {
+		// Declared types are more useful than names alone, so they replace them
+		types := idx.TypeSignatures(entry)
+		if len(types) == 0 {
+			var labels []string
+			for _, param := range indexer.Parameters(entry) {
+				labels = append(labels, param.Format())
+			}
+			information := signatureInformation(indexer.FormatSignature(entry), labels)
+			information["documentation"] = fmt.Sprintf("arity %d", indexer.Arity(entry))
+			signatures = append(signatures, information)
+		}
+		for _, sig := range types {
+			labels := make([]string, 0, len(sig.Params))
+			for _, param := range sig.Params {
+				labels = append(labels, param.Format())
+			}
+			signatures = append(signatures, signatureInformation(sig.Format(entry.Name), labels))
+		}
+		if len(signatures) >= maxSignatures {
+			break
+		}
+	}
+
+	if len(signatures) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"signatures":      signatures,
+		"activeSignature": 0,
+		"activeParameter": call.activeArgument,
+	}
+}
+
+// signatureInformation builds an LSP SignatureInformation whose parameter labels
+// are substrings of its label
+func signatureInformation(label string, params []string) map[string]interface{} {
+	parameters := make([]interface{}, 0, len(params))
+	for _, param := range params {
+		parameters = append(parameters, map[string]interface{}{"label": param})
+	}
+	return map[string]interface{}{
+		"label":      label,
+		"parameters": parameters,
+	}
+}
+
+// enclosingCall finds the innermost call whose parenthesized argument list is
+// still open at the end of text, skipping over string literals
+func enclosingCall(text string) (openCall, bool) {
+	type frame struct {
+		open   int
+		paren  bool
+		commas int
+	}
+
+	var frames []frame
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '#':
+			return openCall{}, false // the cursor is in a comment
+		case '(', '[', '{':
+			frames = append(frames, frame{open: i, paren: c == '('})
+		case ')', ']', '}':
+			if len(frames) > 0 {
+				frames = frames[:len(frames)-1]
+			}
+		case ',':
+			if len(frames) > 0 {
+				frames[len(frames)-1].commas++
+			}
+		}
+	}
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		if !frames[i].paren {
+			continue
+		}
+		before := text[:frames[i].open]
+		name := trailingExpression(before, false)
+		if strings.Contains(name, "@") {
+			return openCall{}, false
+		}
+		name = strings.TrimLeft(name, "?!")
+		if name == "" || isCapitalized(name) {
+			return openCall{}, false
+		}
+
+		call := openCall{name: name, activeArgument: frames[i].commas}
+		rest := strings.TrimSuffix(before, name)
+		if strings.HasSuffix(rest, ".") || strings.HasSuffix(rest, "&.") {
+			call.receiver = trailingExpression(strings.TrimSuffix(strings.TrimSuffix(rest, "."), "&"), false)
+		}
+		if strings.HasSuffix(strings.TrimSpace(rest), "def") {
+			return openCall{}, false // a definition's own parameter list
+		}
+		return call, true
+	}
+	return openCall{}, false
+}
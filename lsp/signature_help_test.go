@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// testSignatureHelp is the shape of a signature help result
+type testSignatureHelp struct {
+	Signatures []struct {
+		Label         string `json:"label"`
+		Documentation string `json:"documentation"`
+		Parameters    []struct {
+			Label string `json:"label"`
+		} `json:"parameters"`
+	} `json:"signatures"`
+	ActiveParameter int `json:"activeParameter"`
+}
+
+// A model method typed with a sorbet sig, and one without a sig
+var typedModelFixture = map[string]string{
+	"app/models/order.rb": `class Order < ApplicationRecord
+  extend T::Sig
+
+  sig { params(force: T::Boolean).returns(T::Boolean) }
+  def save(force: false)
+    true
+  end
+
+  def touch(time = nil)
+  end
+end
+`,
+	"app/services/checkout.rb": "class Checkout\n  def run(order)\n    Order.new.save(force: true)\n    Order.new.touch(\n  end\nend\n",
+}
+
+func TestSignatureHelpShowsSigTypes(t *testing.T) {
+	s := newTestServerWithOptions(typedModelFixture, indexer.Options{TypeSignatures: true})
+
+	var help testSignatureHelp
+	decode(t, s.HandleSignatureHelp(positionParams("app/services/checkout.rb", 2, 19)), &help)
+	if len(help.Signatures) != 1 {
+		t.Fatalf("signature help = %+v, want the signature of save", help)
+	}
+	if label := help.Signatures[0].Label; label != "save(force: T::Boolean) -> T::Boolean" {
+		t.Errorf("signature of save = %q, want its sig types", label)
+	}
+
+	// Without a sig the parameters are shown as written
+	decode(t, s.HandleSignatureHelp(positionParams("app/services/checkout.rb", 3, 20)), &help)
+	if len(help.Signatures) != 1 || help.Signatures[0].Label != "touch(time = nil)" {
+		t.Errorf("signature help = %+v, want the untyped signature of touch", help)
+	}
+}
+
+func TestHoverShowsSigReturnType(t *testing.T) {
+	s := newTestServerWithOptions(typedModelFixture, indexer.Options{TypeSignatures: true})
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("app/services/checkout.rb", 2, 15)), &hover)
+	if value := hover.Contents.Value; !strings.Contains(value, "`save(force: T::Boolean) -> T::Boolean`") {
+		t.Errorf("hover on save = %q, want its typed signature", value)
+	}
+}
+
+func TestSignatureHelpShowsEveryKindOfParameterAndTheArity(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/report.rb": "class Report\n  def m(a, b = 1, *c, d:, **e, &f)\n  end\n\n  def run\n    m(1, \n  end\nend\n",
+	})
+
+	var help testSignatureHelp
+	decode(t, s.HandleSignatureHelp(positionParams("app/models/report.rb", 5, 9)), &help)
+	if len(help.Signatures) != 1 {
+		t.Fatalf("signature help = %+v, want the signature of m", help)
+	}
+	signature := help.Signatures[0]
+	if signature.Label != "m(a, b = 1, *c, d:, **e, &f)" || signature.Documentation != "arity -3" {
+		t.Errorf("signature = %q (%s), want every parameter as written and arity -3", signature.Label, signature.Documentation)
+	}
+	var labels []string
+	for _, param := range signature.Parameters {
+		labels = append(labels, param.Label)
+	}
+	if want := []string{"a", "b = 1", "*c", "d:", "**e", "&f"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("parameters = %v, want %v", labels, want)
+	}
+	if help.ActiveParameter != 1 {
+		t.Errorf("activeParameter = %d, want 1 after the first comma", help.ActiveParameter)
+	}
+}
+
+func TestSignatureHelpAndHoverShowYardTypes(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb":      "class Order\n  # @param amount [Integer] in cents\n  # @return [Receipt, nil]\n  def charge(amount)\n  end\nend\n",
+		"app/services/checkout.rb": "class Checkout\n  def run(order)\n    Order.new.charge(\n  end\nend\n",
+	})
+
+	var help testSignatureHelp
+	decode(t, s.HandleSignatureHelp(positionParams("app/services/checkout.rb", 2, 21)), &help)
+	if len(help.Signatures) != 1 || help.Signatures[0].Label != "charge(amount: Integer) -> Receipt | nil" {
+		t.Errorf("signature help = %+v, want the YARD types of charge", help)
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("app/services/checkout.rb", 2, 15)), &hover)
+	if value := hover.Contents.Value; !strings.Contains(value, "`charge(amount: Integer) -> Receipt | nil`") {
+		t.Errorf("hover on charge = %q, want its YARD types", value)
+	}
+}
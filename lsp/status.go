@@ -0,0 +1,44 @@
+package lsp
+
+// ServerStatus is the answer to $/rubyLsp/status: a snapshot of what the server
+// is up to, for editors and smoke tests checking that it came up healthy
+type ServerStatus struct {
+	Ready         bool            `json:"ready"`         // indexing is complete, or there is no workspace to index
+	IndexMode     string          `json:"indexMode"`     // eager, lazy or onSave; "" without a workspace
+	Files         int             `json:"files"`         // files indexed
+	Symbols       int             `json:"symbols"`       // symbols indexed
+	FailedFiles   int             `json:"failedFiles"`   // files that could not be read or parsed
+	Formatter     string          `json:"formatter"`     // formatter backend in use, "none" for none
+	TestLibrary   string          `json:"testLibrary"`   // configured or detected test library
+	Tools         map[string]bool `json:"tools"`         // external tool -> found on the PATH
+	OpenDocuments int             `json:"openDocuments"` // documents the client has open
+}
+
+// HandleStatus handles the $/rubyLsp/status request, which takes no params.
+// Unlike the debug requests it is always answered, so it can be polled.
+func (s *Server) HandleStatus() ServerStatus {
+	s.Logger.Println("Processing status request")
+
+	status := ServerStatus{
+		Ready:         true,
+		Formatter:     s.FormatterBackend(),
+		OpenDocuments: s.Store.Len(),
+	}
+	if idx := s.Indexer; idx != nil {
+		stats := idx.Stats()
+		status.Ready = idx.IsReady()
+		status.IndexMode = idx.Mode()
+		status.Files = stats.Files
+		status.Symbols = stats.Symbols
+		status.FailedFiles = len(stats.Errors)
+	}
+
+	s.GlobalState.Mutex.Lock()
+	status.TestLibrary = s.GlobalState.TestLibrary
+	status.Tools = make(map[string]bool, len(externalTools))
+	for _, tool := range externalTools {
+		status.Tools[tool] = s.GlobalState.AvailableTools[tool]
+	}
+	s.GlobalState.Mutex.Unlock()
+	return status
+}
@@ -0,0 +1,55 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+func TestStatusReportsServerHealth(t *testing.T) {
+	stubTools(t, "ruby", "rubocop", "bundle")
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb":   "class Order\n  def total\n  end\nend\n",
+		"app/models/invoice.rb": "class Invoice\nend\n",
+	})
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".rubocop.yml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.GlobalState.WorkspacePath = root
+	s.HandleInitialize(map[string]interface{}{})
+	// The fixtures are open, and so is a buffer not indexed yet
+	s.Store.Set(testFileURI("app/models/refund.rb"), "class Refund\nend\n", 1, "ruby")
+
+	want := ServerStatus{
+		Ready:         true,
+		IndexMode:     indexer.ModeEager,
+		Files:         2,
+		Symbols:       3,
+		Formatter:     "rubocop",
+		TestLibrary:   "minitest",
+		Tools:         map[string]bool{"ruby": true, "rubocop": true, "stree": false, "bundle": true},
+		OpenDocuments: 3,
+	}
+	if got := s.HandleStatus(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HandleStatus() = %+v, want %+v", got, want)
+	}
+
+	// Without a workspace there is nothing to wait for
+	s.Indexer = nil
+	status := s.HandleStatus()
+	if !status.Ready || status.IndexMode != "" || status.Files != 0 || status.Symbols != 0 {
+		t.Errorf("HandleStatus() without an index = %+v, want ready with nothing indexed", status)
+	}
+}
+
+func TestStatusOfAnIndexStillBuilding(t *testing.T) {
+	s := NewTestServer(nil)
+	s.Indexer = indexer.New(t.TempDir(), s.Logger)
+	if status := s.HandleStatus(); status.Ready {
+		t.Errorf("HandleStatus() before indexing = %+v, want not ready", status)
+	}
+}
@@ -0,0 +1,34 @@
+package lsp
+
+import "github.com/humberto/ruby-lsp-go/indexer"
+
+// isSuperCall reports whether a token is the super keyword
+func isSuperCall(token indexer.Token) bool {
+	return token.Kind == indexer.TokenIdentifier && token.Text == "super"
+}
+
+// superDefinitions returns the methods a super written at a 1-based line calls:
+// those named like the enclosing method in the nearest ancestor of its class
+// defining one. In a module the ancestors are the module's own mixins, since
+// which class it ends up in is not known.
+func superDefinitions(idx indexer.SymbolIndex, filePath string, line int) []indexer.SymbolEntry {
+	method, ok := idx.EnclosingDefinition(filePath, line)
+	if !ok || (method.Type != indexer.SymbolMethod && method.Type != indexer.SymbolSingletonMethod) || method.Parent == "" {
+		return nil
+	}
+
+	candidates := filterEntries(idx.Lookup(method.Name), func(entry indexer.SymbolEntry) bool {
+		return entry.Type == method.Type
+	})
+	for _, ancestor := range idx.AncestorsOf(method.Parent) {
+		if ancestor == method.Parent {
+			continue
+		}
+		if defined := filterEntries(candidates, func(entry indexer.SymbolEntry) bool {
+			return entry.Parent == ancestor
+		}); len(defined) > 0 {
+			return defined
+		}
+	}
+	return nil
+}
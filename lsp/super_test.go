@@ -0,0 +1,56 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+// Subclasses overriding a model method and calling the original through super
+var superFixture = map[string]string{
+	"app/models/user.rb":       "class User < ApplicationRecord\n  def full_name\n    \"#{first_name} #{last_name}\"\n  end\nend\n",
+	"app/models/admin_user.rb": "class AdminUser < User\n  def full_name\n    super + \" (admin)\"\n  end\nend\n",
+	"app/models/titled.rb":     "module Titled\n  def full_name\n    \"#{title} #{super}\"\n  end\nend\n",
+	"app/models/doctor.rb":     "class Doctor < User\n  include Titled\n\n  def full_name\n    super.strip\n  end\nend\n",
+}
+
+func TestDefinitionOfSuperIsTheOverriddenMethod(t *testing.T) {
+	s := NewTestServer(superFixture)
+
+	tests := []struct {
+		name     string
+		file     string
+		line     int
+		wantURI  string
+		wantLine int
+	}{
+		{"superclass method", "app/models/admin_user.rb", 2, "app/models/user.rb", 1},
+		// An included module is searched before the superclass
+		{"included module method", "app/models/doctor.rb", 4, "app/models/titled.rb", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var locations []testLocation
+			decode(t, s.HandleDefinition(1, positionParams(test.file, test.line, 6)), &locations)
+			if len(locations) != 1 {
+				t.Fatalf("definitions of super = %+v, want one", locations)
+			}
+			if got := locations[0]; got.URI != testFileURI(test.wantURI) || got.Range.Start.Line != test.wantLine {
+				t.Errorf("definition = %s:%d, want %s:%d", got.URI, got.Range.Start.Line, test.wantURI, test.wantLine)
+			}
+		})
+	}
+}
+
+func TestHoverOnSuperDescribesTheOverriddenMethod(t *testing.T) {
+	s := NewTestServer(superFixture)
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams("app/models/admin_user.rb", 2, 6)), &hover)
+	if value := hover.Contents.Value; !strings.Contains(value, "full_name") || !strings.Contains(value, "app/models/user.rb") {
+		t.Errorf("hover on super = %q, want User#full_name", value)
+	}
+}
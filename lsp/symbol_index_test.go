@@ -0,0 +1,165 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// stubIndex is a backend other than *indexer.Index, knowing a single class
+type stubIndex struct{}
+
+var stubUser = indexer.SymbolEntry{
+	Name:               "User",
+	FullyQualifiedName: "User",
+	Type:               indexer.SymbolClass,
+	FilePath:           testFilePath("app/models/user.rb"),
+	Line:               1,
+	EndLine:            2,
+}
+
+func (stubIndex) BuildIndex(context.Context)                       {}
+func (stubIndex) IsReady() bool                                    { return true }
+func (stubIndex) Mode() string                                     { return "stub" }
+func (stubIndex) Stats() indexer.Stats                             { return indexer.Stats{Files: 1, Symbols: 1} }
+func (stubIndex) ShouldIndex(path string) bool                     { return strings.HasSuffix(path, ".rb") }
+func (stubIndex) Covers(string) bool                               { return true }
+func (stubIndex) IndexOnDemand(string)                             {}
+func (stubIndex) UpdateFile(string)                                {}
+func (stubIndex) UpdateFileFromSource(string, string)              {}
+func (stubIndex) RemoveFile(string)                                {}
+func (stubIndex) IndexGems(context.Context) (int, int)             { return 0, 0 }
+func (stubIndex) Roots() []string                                  { return []string{testWorkspace} }
+func (stubIndex) RootOf(string) string                             { return testWorkspace }
+func (stubIndex) AddRoot(context.Context, string)                  {}
+func (stubIndex) RemoveRoot(string)                                {}
+func (stubIndex) AllSymbols(fn func(indexer.SymbolEntry) bool)     { fn(stubUser) }
+func (stubIndex) ResolveConstantPath(path string, _ string) string { return path }
+func (stubIndex) ResolveAlias(indexer.SymbolEntry) []indexer.SymbolEntry {
+	return nil
+}
+func (stubIndex) ParseSource(string, string) []indexer.SymbolEntry { return nil }
+func (stubIndex) EnclosingScope(string, int) string                { return "" }
+func (stubIndex) EnclosingDefinition(string, int) (indexer.SymbolEntry, bool) {
+	return indexer.SymbolEntry{}, false
+}
+func (stubIndex) SuperclassChain(string) []string                 { return nil }
+func (stubIndex) AncestorsOf(fqn string) []string                 { return []string{fqn} }
+func (stubIndex) MergedClass(string) (indexer.MergedClass, bool)  { return indexer.MergedClass{}, false }
+func (stubIndex) ForwardedClass(string) string                    { return "" }
+func (stubIndex) Supertypes(string) []string                      { return nil }
+func (stubIndex) Subtypes(string) []string                        { return nil }
+func (stubIndex) Mixins(string) []string                          { return nil }
+func (stubIndex) AssociationClassName(indexer.SymbolEntry) string { return "" }
+func (stubIndex) Columns(string) []indexer.SymbolEntry            { return nil }
+func (stubIndex) Migrations(string) []indexer.Migration           { return nil }
+func (stubIndex) TypeSignatures(indexer.SymbolEntry) []indexer.TypeSignature {
+	return nil
+}
+func (stubIndex) GemVersion(string) string                              { return "" }
+func (stubIndex) ConstantReferences(string) []indexer.ConstantReference { return nil }
+func (stubIndex) AssociationTarget(indexer.SymbolEntry) []indexer.SymbolEntry {
+	return nil
+}
+func (stubIndex) InstanceVariableAssignments(string, string) []indexer.SymbolEntry {
+	return nil
+}
+func (stubIndex) ClassVariableAssignments(string, string) []indexer.SymbolEntry {
+	return nil
+}
+func (stubIndex) MethodReferences(string, map[string]string) []indexer.MethodReference {
+	return nil
+}
+
+func (stubIndex) Lookup(name string) []indexer.SymbolEntry {
+	if name == "User" {
+		return []indexer.SymbolEntry{stubUser}
+	}
+	return nil
+}
+func (s stubIndex) PrefixSearch(_ context.Context, prefix string) []indexer.SymbolEntry {
+	if strings.HasPrefix("User", prefix) {
+		return s.Lookup("User")
+	}
+	return nil
+}
+func (s stubIndex) SearchSymbols(ctx context.Context, query string, _ int, _ func(indexer.SymbolEntry) bool) []indexer.SymbolEntry {
+	return s.PrefixSearch(ctx, query)
+}
+func (s stubIndex) LookupByConvention(word string) []indexer.SymbolEntry      { return s.Lookup(word) }
+func (s stubIndex) LookupInScope(path string, _ string) []indexer.SymbolEntry { return s.Lookup(path) }
+func (s stubIndex) LookupScoped(name string, _ []string) []indexer.SymbolEntry {
+	return s.Lookup(name)
+}
+func (s stubIndex) TypeDefinition(fqn string) (indexer.SymbolEntry, bool) {
+	if entries := s.Lookup(fqn); len(entries) > 0 {
+		return entries[0], true
+	}
+	return indexer.SymbolEntry{}, false
+}
+func (stubIndex) GetFileSymbols(filePath string) []indexer.SymbolEntry {
+	if filePath == stubUser.FilePath {
+		return []indexer.SymbolEntry{stubUser}
+	}
+	return nil
+}
+
+func TestHandlersResolveThroughAnotherBackend(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/controllers/users_controller.rb": "class UsersController\n  def show\n    user = User.find(1)\n    Us\n  end\nend\n",
+	})
+	s.Indexer = stubIndex{}
+	s.GlobalState.EnabledFeatures["keywordCompletion"] = false
+	s.GlobalState.EnabledFeatures["bufferWordCompletion"] = false
+	file := "app/controllers/users_controller.rb"
+
+	var locations []testLocation
+	decode(t, s.HandleDefinition(1, positionParams(file, 2, 12)), &locations)
+	if len(locations) != 1 || locations[0].URI != testFileURI("app/models/user.rb") || locations[0].Range.Start.Line != 0 {
+		t.Errorf("definition of User = %+v, want the backend's app/models/user.rb:0", locations)
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+	decode(t, s.HandleHover(positionParams(file, 2, 12)), &hover)
+	if !strings.Contains(hover.Contents.Value, "class User") || !strings.Contains(hover.Contents.Value, "app/models/user.rb:1") {
+		t.Errorf("hover on User = %q, want the backend's class", hover.Contents.Value)
+	}
+
+	var list testCompletionList
+	decode(t, s.HandleCompletion(1, positionParams(file, 3, 6)), &list)
+	if len(list.Items) != 1 || list.Items[0].Label != "User" {
+		t.Errorf("completion of Us = %+v, want the backend's User", list.Items)
+	}
+
+	// The rest of the handlers answer without the default index
+	requests := map[string]func() interface{}{
+		"references":     func() interface{} { return s.HandleReferences(1, positionParams(file, 2, 12)) },
+		"rename":         func() interface{} { return s.HandleRename(positionParams(file, 2, 12)) },
+		"documentSymbol": func() interface{} { return s.HandleDocumentSymbol(documentParams(file)) },
+		"callHierarchy":  func() interface{} { return s.HandlePrepareCallHierarchy(positionParams(file, 1, 6)) },
+		"typeHierarchy":  func() interface{} { return s.HandlePrepareTypeHierarchy(positionParams(file, 2, 12)) },
+		"codeLens":       func() interface{} { return s.HandleCodeLens(documentParams(file)) },
+	}
+	for name, request := range requests {
+		t.Run(name, func(t *testing.T) {
+			request()
+		})
+	}
+
+	var items []struct {
+		Name string `json:"name"`
+	}
+	decode(t, s.HandlePrepareTypeHierarchy(positionParams(file, 2, 12)), &items)
+	if len(items) != 1 || items[0].Name != "User" {
+		t.Errorf("type hierarchy of User = %+v, want the backend's class", items)
+	}
+	if status := s.HandleStatus(); !status.Ready || status.Files != 1 || status.IndexMode != "stub" {
+		t.Errorf("status = %+v, want the backend's readiness, mode and stats", status)
+	}
+}
@@ -0,0 +1,172 @@
+package lsp
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// testLayout is where a test library keeps its tests and how it names them
+type testLayout struct {
+	library, dir, suffix string
+}
+
+// Layouts of the test libraries, minitest's first as the Rails default
+var testLayouts = []testLayout{
+	{"minitest", "test", "_test.rb"},
+	{"rspec", "spec", "_spec.rb"},
+}
+
+// Gems a project depends on directly: gem lines of the Gemfile, and entries of
+// the DEPENDENCIES section of Gemfile.lock
+var (
+	gemfileGemPattern = regexp.MustCompile(`^\s*gem\s+["']([\w.-]+)["']`)
+	lockDependPattern = regexp.MustCompile(`^  ([\w.-]+)`)
+)
+
+// detectTestLibrary returns the test library a project's Gemfile or Gemfile.lock
+// depends on, "" when neither names one. rspec-rails wins over minitest, which
+// wins over a bare rspec, as Rails apps using RSpec often keep minitest around.
+func detectTestLibrary(root string) string {
+	if root == "" {
+		return ""
+	}
+
+	gems := make(map[string]bool)
+	for _, name := range directGems(filepath.Join(root, "Gemfile"), gemfileGemPattern, "") {
+		gems[name] = true
+	}
+	for _, name := range directGems(filepath.Join(root, "Gemfile.lock"), lockDependPattern, "DEPENDENCIES") {
+		gems[name] = true
+	}
+
+	switch {
+	case gems["rspec-rails"]:
+		return "rspec"
+	case gems["minitest"] || gems["minitest-rails"]:
+		return "minitest"
+	case gems["rspec"] || gems["rspec-core"]:
+		return "rspec"
+	}
+	return ""
+}
+
+// directGems returns the gem names a pattern finds in a file, only within the
+// section under a heading line when one is given
+func directGems(path string, pattern *regexp.Regexp, heading string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var names []string
+	inSection := heading == ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if heading != "" && line != "" && !strings.HasPrefix(line, " ") {
+			inSection = line == heading
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if matches := pattern.FindStringSubmatch(line); matches != nil {
+			names = append(names, matches[1])
+		}
+	}
+	return names
+}
+
+// toggleTestFile returns the URI of the test of the source file at a URI, or of
+// the source file a test covers, "" when no counterpart exists on disk
+func (s *Server) toggleTestFile(uri string) string {
+	s.GlobalState.Mutex.Lock()
+	testLibrary := s.GlobalState.TestLibrary
+	s.GlobalState.Mutex.Unlock()
+
+	for _, candidate := range testCounterparts(uriToFilePath(uri), testLibrary) {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return store.PathToURI(candidate)
+		}
+	}
+	return ""
+}
+
+// testCounterparts returns the conventional paths of the test of a source file,
+// or of the source file of a test, most likely first. app/models/user.rb pairs
+// with test/models/user_test.rb and spec/models/user_spec.rb, lib/parser.rb with
+// test/lib/parser_test.rb and spec/lib/parser_spec.rb; tests of the configured
+// library come first. The innermost app, lib, test or spec directory anchors the
+// mapping, so engines nested in a project pair their own files.
+func testCounterparts(path string, testLibrary string) []string {
+	dir, base := filepath.Split(path)
+	segments := strings.Split(filepath.Clean(dir), string(filepath.Separator))
+
+	// Tests map back to app/ or lib/, whichever holds the source
+	for _, layout := range testLayouts {
+		name, isTest := strings.CutSuffix(base, layout.suffix)
+		if !isTest {
+			continue
+		}
+		anchor := lastSegment(segments, layout.dir)
+		if anchor < 0 {
+			return nil
+		}
+		root := segmentsPath(segments[:anchor])
+		rest := segments[anchor+1:]
+		if len(rest) > 0 && rest[0] == "lib" {
+			return []string{filepath.Join(root, filepath.Join(rest...), name+".rb")}
+		}
+		relative := filepath.Join(append(rest, name+".rb")...)
+		return []string{filepath.Join(root, "app", relative), filepath.Join(root, "lib", relative)}
+	}
+
+	name, isRuby := strings.CutSuffix(base, ".rb")
+	anchor := max(lastSegment(segments, "app"), lastSegment(segments, "lib"))
+	if !isRuby || anchor < 0 {
+		return nil
+	}
+	root := segmentsPath(segments[:anchor])
+	rest := segments[anchor+1:]
+	if segments[anchor] == "lib" {
+		rest = segments[anchor:]
+	}
+
+	// Tests of the configured library come first
+	layouts := append([]testLayout(nil), testLayouts...)
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return layouts[i].library == testLibrary && layouts[j].library != testLibrary
+	})
+	var candidates []string
+	for _, layout := range layouts {
+		candidates = append(candidates, filepath.Join(root, layout.dir, filepath.Join(rest...), name+layout.suffix))
+	}
+	return candidates
+}
+
+// segmentsPath rejoins the leading segments of a split absolute directory,
+// keeping its root: / on POSIX, the drive's C:\ on Windows
+func segmentsPath(segments []string) string {
+	path := strings.Join(segments, string(filepath.Separator))
+	if path == "" || strings.HasSuffix(path, ":") {
+		path += string(filepath.Separator)
+	}
+	return path
+}
+
+// lastSegment returns the index of the last path segment equal to name, -1 if none
+func lastSegment(segments []string, name string) int {
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] == name {
+			return i
+		}
+	}
+	return -1
+}
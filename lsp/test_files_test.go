@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+func TestTestCounterparts(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		testLibrary string
+		want        []string
+	}{
+		{
+			name:        "model to its minitest test",
+			path:        "/app/models/user.rb",
+			testLibrary: "minitest",
+			want:        []string{"/test/models/user_test.rb", "/spec/models/user_spec.rb"},
+		},
+		{
+			name:        "model to its rspec spec",
+			path:        "/app/models/user.rb",
+			testLibrary: "rspec",
+			want:        []string{"/spec/models/user_spec.rb", "/test/models/user_test.rb"},
+		},
+		{
+			name: "minitest test to its model",
+			path: "/test/models/user_test.rb",
+			want: []string{"/app/models/user.rb", "/lib/models/user.rb"},
+		},
+		{
+			name: "rspec spec to its model",
+			path: "/spec/models/user_spec.rb",
+			want: []string{"/app/models/user.rb", "/lib/models/user.rb"},
+		},
+		{
+			name:        "lib file to its minitest test",
+			path:        "/lib/billing/parser.rb",
+			testLibrary: "minitest",
+			want:        []string{"/test/lib/billing/parser_test.rb", "/spec/lib/billing/parser_spec.rb"},
+		},
+		{
+			name:        "lib file to its rspec spec",
+			path:        "/lib/billing/parser.rb",
+			testLibrary: "rspec",
+			want:        []string{"/spec/lib/billing/parser_spec.rb", "/test/lib/billing/parser_test.rb"},
+		},
+		{
+			name: "minitest lib test to its lib file",
+			path: "/test/lib/billing/parser_test.rb",
+			want: []string{"/lib/billing/parser.rb"},
+		},
+		{
+			name: "rspec lib spec to its lib file",
+			path: "/spec/lib/billing/parser_spec.rb",
+			want: []string{"/lib/billing/parser.rb"},
+		},
+		{
+			name:        "engine nested in a project",
+			path:        "/engines/billing/app/models/invoice.rb",
+			testLibrary: "rspec",
+			want:        []string{"/engines/billing/spec/models/invoice_spec.rb", "/engines/billing/test/models/invoice_test.rb"},
+		},
+		{
+			name: "file outside app and lib",
+			path: "/config/routes.rb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "project")
+			var want []string
+			for _, path := range test.want {
+				want = append(want, filepath.Join(root, filepath.FromSlash(path)))
+			}
+			got := testCounterparts(filepath.Join(root, filepath.FromSlash(test.path)), test.testLibrary)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("testCounterparts(%s) = %q, want %q", test.path, got, want)
+			}
+		})
+	}
+}
+
+func TestSegmentsPathKeepsTheRoot(t *testing.T) {
+	separator := string(filepath.Separator)
+	tests := []struct {
+		segments []string
+		want     string
+	}{
+		{[]string{""}, separator},
+		{[]string{"", "home", "dev"}, separator + "home" + separator + "dev"},
+		{[]string{"C:"}, "C:" + separator},
+		{[]string{"C:", "Users", "dev"}, "C:" + separator + "Users" + separator + "dev"},
+	}
+	for _, test := range tests {
+		if got := segmentsPath(test.segments); got != test.want {
+			t.Errorf("segmentsPath(%q) = %q, want %q", test.segments, got, test.want)
+		}
+	}
+}
+
+func TestToggleTestFile(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{
+		"app/models/user.rb":              "class User\nend\n",
+		"spec/models/user_spec.rb":        "RSpec.describe User do\nend\n",
+		"lib/billing/parser.rb":           "module Billing\nend\n",
+		"test/lib/billing/parser_test.rb": "class ParserTest\nend\n",
+	})
+	s := NewTestServer(nil)
+	s.GlobalState.TestLibrary = "minitest"
+
+	pairs := [][2]string{
+		// Only the rspec spec exists, though minitest is configured
+		{"app/models/user.rb", "spec/models/user_spec.rb"},
+		{"spec/models/user_spec.rb", "app/models/user.rb"},
+		{"lib/billing/parser.rb", "test/lib/billing/parser_test.rb"},
+		{"test/lib/billing/parser_test.rb", "lib/billing/parser.rb"},
+	}
+	for _, pair := range pairs {
+		uri := s.toggleTestFile(store.PathToURI(filepath.Join(root, filepath.FromSlash(pair[0]))))
+		if want := store.PathToURI(filepath.Join(root, filepath.FromSlash(pair[1]))); uri != want {
+			t.Errorf("toggleTestFile(%s) = %q, want %q", pair[0], uri, want)
+		}
+	}
+	if uri := s.toggleTestFile(store.PathToURI(filepath.Join(root, "app", "models", "order.rb"))); uri != "" {
+		t.Errorf("toggleTestFile of a file without a test = %q, want none", uri)
+	}
+}
+
+func TestDetectTestLibrary(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"rspec-rails in the Gemfile", map[string]string{"Gemfile": "source \"https://rubygems.org\"\n\ngroup :development, :test do\n  gem \"rspec-rails\", \"~> 6.0\"\nend\n"}, "rspec"},
+		{"minitest in the Gemfile", map[string]string{"Gemfile": "gem 'rails'\ngem 'minitest', require: false\n"}, "minitest"},
+		{"rspec-rails kept alongside minitest", map[string]string{"Gemfile": "gem 'minitest'\ngem 'rspec-rails'\n"}, "rspec"},
+		{"minitest kept alongside a bare rspec", map[string]string{"Gemfile": "gem 'rspec'\ngem 'minitest'\n"}, "minitest"},
+		{"bare rspec", map[string]string{"Gemfile": "gem \"rspec-core\"\n"}, "rspec"},
+		{"commented out", map[string]string{"Gemfile": "# gem 'rspec-rails'\n"}, ""},
+		{
+			"dependencies of Gemfile.lock only",
+			map[string]string{"Gemfile.lock": "GEM\n  specs:\n    minitest (5.20.0)\n    rspec-rails (6.1.0)\n\nDEPENDENCIES\n  rspec-rails\n\nBUNDLED WITH\n   2.5.3\n"},
+			"rspec",
+		},
+		// Gems only locked as dependencies of others say nothing
+		{"transitive gems of Gemfile.lock", map[string]string{"Gemfile.lock": "GEM\n  specs:\n    minitest (5.20.0)\n\nDEPENDENCIES\n  rails\n"}, ""},
+		{"no Gemfile", nil, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := detectTestLibrary(writeWorkspace(t, test.files)); got != test.want {
+				t.Errorf("detectTestLibrary = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInitializeDetectsTestLibraryUnlessConfigured(t *testing.T) {
+	root := writeWorkspace(t, map[string]string{"Gemfile": "gem \"rails\"\ngem \"rspec-rails\"\n"})
+
+	s := NewTestServer(nil)
+	s.GlobalState.WorkspacePath = root
+	s.HandleInitialize(map[string]interface{}{})
+	if s.GlobalState.TestLibrary != "rspec" {
+		t.Errorf("TestLibrary = %q, want rspec detected from the Gemfile", s.GlobalState.TestLibrary)
+	}
+
+	s = NewTestServer(nil)
+	s.GlobalState.WorkspacePath = root
+	s.HandleInitialize(map[string]interface{}{
+		"initializationOptions": map[string]interface{}{"testLibrary": "minitest"},
+	})
+	if s.GlobalState.TestLibrary != "minitest" {
+		t.Errorf("TestLibrary = %q, want the configured minitest", s.GlobalState.TestLibrary)
+	}
+}
@@ -0,0 +1,118 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// External programs features depend on
+var externalTools = []string{"ruby", "rubocop", "stree", "bundle"}
+
+// Gems run through bundle exec when the workspace has a Gemfile, so the version
+// the project locks runs rather than whichever happens to be installed
+var bundledTools = map[string]bool{"rubocop": true, "stree": true}
+
+// lookPath finds an executable on the PATH; a variable so availability can be stubbed
+var lookPath = exec.LookPath
+
+// LSP MessageType for window/showMessage warnings
+const messageTypeWarning = 2
+
+// detectTools records which external tools are installed
+func (s *Server) detectTools() {
+	available := make(map[string]bool, len(externalTools))
+	for _, tool := range externalTools {
+		_, err := lookPath(tool)
+		available[tool] = err == nil
+	}
+
+	s.GlobalState.Mutex.Lock()
+	s.GlobalState.AvailableTools = available
+	s.GlobalState.Mutex.Unlock()
+}
+
+// toolAvailable reports whether an external tool was found at startup
+func (s *Server) toolAvailable(tool string) bool {
+	s.GlobalState.Mutex.Lock()
+	defer s.GlobalState.Mutex.Unlock()
+	return s.GlobalState.AvailableTools[tool]
+}
+
+// runsBundled reports whether a tool runs through bundle exec: it is a gem, the
+// workspace has a Gemfile and bundle is installed
+func (s *Server) runsBundled(tool string) bool {
+	if !bundledTools[tool] || !s.toolAvailable("bundle") {
+		return false
+	}
+	s.GlobalState.Mutex.Lock()
+	workspacePath := s.GlobalState.WorkspacePath
+	s.GlobalState.Mutex.Unlock()
+
+	_, err := os.Stat(filepath.Join(workspacePath, "Gemfile"))
+	return workspacePath != "" && err == nil
+}
+
+// toolUsable reports whether a tool can run, on the PATH or through bundle exec
+func (s *Server) toolUsable(tool string) bool {
+	return s.toolAvailable(tool) || s.runsBundled(tool)
+}
+
+// toolCommand returns the command running a tool with args in the workspace,
+// through bundle exec when runsBundled says so
+func (s *Server) toolCommand(ctx context.Context, tool string, args ...string) *exec.Cmd {
+	name := tool
+	if s.runsBundled(tool) {
+		name, args = "bundle", append([]string{"exec", tool}, args...)
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	s.GlobalState.Mutex.Lock()
+	cmd.Dir = s.GlobalState.WorkspacePath
+	s.GlobalState.Mutex.Unlock()
+	return cmd
+}
+
+// formatterTool returns the executable a formatter backend runs, "" for none
+func formatterTool(backend string) string {
+	switch backend {
+	case "rubocop":
+		return "rubocop"
+	case "syntax_tree":
+		return "stree"
+	}
+	return ""
+}
+
+// formattingAvailable reports whether the formatter backend can actually run
+func (s *Server) formattingAvailable() bool {
+	tool := formatterTool(s.FormatterBackend())
+	return tool != "" && s.toolUsable(tool)
+}
+
+// disabledFeatures explains what is unavailable for lack of a tool. The server
+// runs in degraded mode when this is not empty.
+func (s *Server) disabledFeatures() []string {
+	var disabled []string
+	if !s.toolAvailable("ruby") {
+		disabled = append(disabled, "syntax diagnostics (ruby was not found on the PATH)")
+	}
+	backend := s.FormatterBackend()
+	if tool := formatterTool(backend); tool != "" && !s.toolUsable(tool) {
+		disabled = append(disabled, fmt.Sprintf("formatting and diagnostics with %s (%s was not found on the PATH)", backend, tool))
+	}
+	return disabled
+}
+
+// reportDisabledFeatures tells the user which features degraded mode turned off
+func (s *Server) reportDisabledFeatures() {
+	if disabled := s.disabledFeatures(); len(disabled) > 0 {
+		s.SendNotification("window/showMessage", map[string]interface{}{
+			"type":    messageTypeWarning,
+			"message": "Ruby LSP Go is running in degraded mode. Disabled: " + strings.Join(disabled, "; "),
+		})
+	}
+}
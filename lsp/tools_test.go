@@ -0,0 +1,208 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stubTools makes lookPath find only the given tools until the test ends
+func stubTools(t *testing.T, installed ...string) {
+	t.Helper()
+	original := lookPath
+	t.Cleanup(func() { lookPath = original })
+	lookPath = func(tool string) (string, error) {
+		for _, name := range installed {
+			if name == tool {
+				return "/usr/bin/" + tool, nil
+			}
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+}
+
+// newToolsTestServer returns a test server whose workspace is a directory on
+// disk holding files, so Gemfile and formatter configuration are found
+func newToolsTestServer(t *testing.T, files ...string) *Server {
+	t.Helper()
+	s := NewTestServer(nil)
+	root := t.TempDir()
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.GlobalState.WorkspacePath = root
+	return s
+}
+
+func TestMissingToolsDisableTheirFeatures(t *testing.T) {
+	tests := []struct {
+		name       string
+		installed  []string
+		files      []string
+		formatting bool
+		disabled   []string
+	}{
+		{
+			name:       "everything installed",
+			installed:  []string{"ruby", "rubocop", "stree", "bundle"},
+			files:      []string{".rubocop.yml"},
+			formatting: true,
+		},
+		{
+			name:       "nothing installed",
+			files:      []string{".rubocop.yml"},
+			disabled:   []string{"syntax diagnostics", "formatting and diagnostics with rubocop"},
+			formatting: false,
+		},
+		{
+			name:       "rubocop bundled with the project",
+			installed:  []string{"ruby", "bundle"},
+			files:      []string{".rubocop.yml", "Gemfile"},
+			formatting: true,
+		},
+		{
+			name:      "bundle without a Gemfile",
+			installed: []string{"ruby", "bundle"},
+			files:     []string{".streerc"},
+			disabled:  []string{"formatting and diagnostics with syntax_tree"},
+		},
+		{
+			name:      "no formatter configured",
+			installed: []string{"ruby"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubTools(t, test.installed...)
+			s := newToolsTestServer(t, test.files...)
+
+			result := s.HandleInitialize(map[string]interface{}{}).(map[string]interface{})
+			capabilities := result["capabilities"].(map[string]interface{})
+			if formatting := capabilities["documentFormattingProvider"]; formatting != test.formatting {
+				t.Errorf("documentFormattingProvider = %v, want %v", formatting, test.formatting)
+			}
+			if degraded := result["degraded_mode"]; degraded != (len(test.disabled) > 0) {
+				t.Errorf("degraded_mode = %v, want %v", degraded, len(test.disabled) > 0)
+			}
+
+			disabled := s.disabledFeatures()
+			if len(disabled) != len(test.disabled) {
+				t.Fatalf("disabledFeatures = %q, want %q", disabled, test.disabled)
+			}
+			for i, prefix := range test.disabled {
+				if !strings.HasPrefix(disabled[i], prefix) {
+					t.Errorf("disabled feature %d = %q, want %q", i, disabled[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestToolCommandRunsGemsThroughBundler(t *testing.T) {
+	tests := []struct {
+		name      string
+		installed []string
+		files     []string
+		tool      string
+		want      []string
+	}{
+		{"gem with a Gemfile", []string{"bundle", "rubocop"}, []string{"Gemfile"}, "rubocop", []string{"bundle", "exec", "rubocop", "--stdin", "app.rb"}},
+		{"gem without a Gemfile", []string{"bundle", "rubocop"}, nil, "rubocop", []string{"rubocop", "--stdin", "app.rb"}},
+		{"gem without bundle", []string{"rubocop"}, []string{"Gemfile"}, "rubocop", []string{"rubocop", "--stdin", "app.rb"}},
+		{"ruby itself", []string{"bundle", "ruby"}, []string{"Gemfile"}, "ruby", []string{"ruby", "--stdin", "app.rb"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubTools(t, test.installed...)
+			s := newToolsTestServer(t, test.files...)
+			s.detectTools()
+
+			cmd := s.toolCommand(context.Background(), test.tool, "--stdin", "app.rb")
+			if !reflect.DeepEqual(cmd.Args, test.want) {
+				t.Errorf("toolCommand(%s) = %q, want %q", test.tool, cmd.Args, test.want)
+			}
+			if cmd.Dir != s.GlobalState.WorkspacePath {
+				t.Errorf("toolCommand runs in %q, want the workspace", cmd.Dir)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsWithheldWithoutTools(t *testing.T) {
+	stubTools(t)
+	s := newToolsTestServer(t, ".rubocop.yml")
+	s.detectTools()
+	queue := captureOutgoing(s)
+
+	s.HandleDidOpen(map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        testFileURI("app.rb"),
+			"languageId": "ruby",
+			"version":    float64(1),
+			"text":       "class Foo\n  def bar\n  end\nend\n",
+		},
+	})
+	s.background.Wait()
+
+	published := notifications(queue, "textDocument/publishDiagnostics")
+	if len(published) != 1 {
+		t.Fatalf("publishDiagnostics sent %d times, want only the structure diagnostics", len(published))
+	}
+}
+
+func TestRubySyntaxDiagnostics(t *testing.T) {
+	output := "-:2: warning: assigned but unused variable - total\n-:5: syntax error, unexpected end-of-input, expecting `end'\n"
+	got := rubySyntaxDiagnostics(output)
+	want := []struct {
+		line     int
+		severity int
+		message  string
+	}{
+		{1, diagnosticSeverityWarning, "assigned but unused variable - total"},
+		{4, diagnosticSeverityError, "syntax error, unexpected end-of-input, expecting `end'"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rubySyntaxDiagnostics = %+v, want %d diagnostics", got, len(want))
+	}
+	for i, w := range want {
+		diagnostic := got[i].(map[string]interface{})
+		line := diagnostic["range"].(map[string]interface{})["start"].(map[string]interface{})["line"]
+		if line != w.line || diagnostic["severity"] != w.severity || diagnostic["message"] != w.message {
+			t.Errorf("diagnostic %d = %+v, want line %d severity %d %q", i, diagnostic, w.line, w.severity, w.message)
+		}
+	}
+
+	if got := rubySyntaxDiagnostics("Syntax OK\n"); len(got) != 0 {
+		t.Errorf("rubySyntaxDiagnostics(Syntax OK) = %+v, want none", got)
+	}
+}
+
+func TestRubocopDiagnostics(t *testing.T) {
+	output := `{"files":[{"path":"app.rb","offenses":[{"severity":"convention","message":"Use snake_case for method names.","cop_name":"Naming/MethodName","location":{"start_line":2,"start_column":7,"last_line":2,"last_column":13}}]}]}`
+	got := rubocopDiagnostics([]byte(output))
+	if len(got) != 1 {
+		t.Fatalf("rubocopDiagnostics = %+v, want 1 diagnostic", got)
+	}
+	var diagnostic struct {
+		Range    testRange `json:"range"`
+		Severity int       `json:"severity"`
+		Code     string    `json:"code"`
+	}
+	decode(t, got[0], &diagnostic)
+	want := testRange{Start: testPosition{Line: 1, Character: 6}, End: testPosition{Line: 1, Character: 13}}
+	if diagnostic.Range != want || diagnostic.Severity != diagnosticSeverityInformation || diagnostic.Code != "Naming/MethodName" {
+		t.Errorf("diagnostic = %+v, want %+v, information, Naming/MethodName", diagnostic, want)
+	}
+
+	if got := rubocopDiagnostics([]byte("rubocop: command not found")); got != nil {
+		t.Errorf("rubocopDiagnostics of an error = %+v, want nil", got)
+	}
+}
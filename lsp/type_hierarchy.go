@@ -0,0 +1,75 @@
+package lsp
+
+import "github.com/humberto/ruby-lsp-go/indexer"
+
+// HandlePrepareTypeHierarchy handles textDocument/prepareTypeHierarchy request
+// for the class or module named at the cursor
+func (s *Server) HandlePrepareTypeHierarchy(params interface{}) interface{} {
+	s.Logger.Println("Processing prepare type hierarchy request")
+
+	fqn, ok := s.constantAtPosition(params)
+	if !ok {
+		return nil
+	}
+	idx := s.Indexer
+	entry, ok := idx.TypeDefinition(fqn)
+	if !ok {
+		return nil
+	}
+	return []interface{}{typeHierarchyItem(entry)}
+}
+
+// HandleSupertypes handles typeHierarchy/supertypes request: the superclass and
+// the included or prepended modules, merged across reopened bodies. Supertypes
+// that are not indexed, like those of gems outside the workspace, are left out.
+func (s *Server) HandleSupertypes(params interface{}) interface{} {
+	s.Logger.Println("Processing supertypes request")
+
+	return s.typeHierarchyItems(params, indexer.SymbolIndex.Supertypes)
+}
+
+// HandleSubtypes handles typeHierarchy/subtypes request: the classes inheriting
+// from a class, and the classes and modules mixing in a module
+func (s *Server) HandleSubtypes(params interface{}) interface{} {
+	s.Logger.Println("Processing subtypes request")
+
+	return s.typeHierarchyItems(params, indexer.SymbolIndex.Subtypes)
+}
+
+// typeHierarchyItems lists the indexed types related to a request's item
+func (s *Server) typeHierarchyItems(params interface{}, related func(indexer.SymbolIndex, string) []string) interface{} {
+	items := []interface{}{}
+
+	idx := s.Indexer
+	if idx == nil || !idx.IsReady() {
+		return items
+	}
+	paramMap, ok := params.(map[string]interface{})
+	if !ok {
+		return items
+	}
+	item, ok := paramMap["item"].(map[string]interface{})
+	if !ok {
+		return items
+	}
+	data, _ := item["data"].(map[string]interface{})
+	fqn, _ := data["fqn"].(string)
+	if fqn == "" {
+		return items
+	}
+
+	for _, name := range related(idx, fqn) {
+		if entry, ok := idx.TypeDefinition(name); ok {
+			items = append(items, typeHierarchyItem(entry))
+		}
+	}
+	return items
+}
+
+// typeHierarchyItem builds an LSP TypeHierarchyItem, carrying the fully qualified
+// name the follow-up requests resolve
+func typeHierarchyItem(entry indexer.SymbolEntry) map[string]interface{} {
+	item := hierarchyItem(entry)
+	item["data"] = map[string]interface{}{"fqn": entry.FullyQualifiedName}
+	return item
+}
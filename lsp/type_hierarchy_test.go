@@ -0,0 +1,35 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSupertypesListEveryIncludedModule(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/base.rb":     "class Base\nend\n",
+		"app/models/concerns.rb": "module Searchable\nend\n\nmodule Auditable\nend\n",
+		"app/models/user.rb":     "class User < Base\n  include Searchable, Auditable\nend\n",
+	})
+
+	var items []struct {
+		Name string `json:"name"`
+		Data struct {
+			FQN string `json:"fqn"`
+		} `json:"data"`
+	}
+	decode(t, s.HandlePrepareTypeHierarchy(positionParams("app/models/user.rb", 0, 7)), &items)
+	if len(items) != 1 || items[0].Data.FQN != "User" {
+		t.Fatalf("prepareTypeHierarchy = %+v, want User", items)
+	}
+
+	params := map[string]interface{}{"item": map[string]interface{}{"data": map[string]interface{}{"fqn": "User"}}}
+	decode(t, s.HandleSupertypes(params), &items)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"Base", "Auditable", "Searchable"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("supertypes of User = %v, want %v", names, want)
+	}
+}
@@ -1,9 +1,41 @@
 package lsp
 
 import (
+	"context"
+	"log"
 	"sync"
+	"time"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+	"github.com/humberto/ruby-lsp-go/store"
+)
+
+// JSON-RPC error codes
+const (
+	InvalidRequest   = -32600
+	MethodNotFound   = -32601
+	RequestCancelled = -32800
 )
 
+// How many result entries long-running handlers process between cancellation checks
+const cancelCheckInterval = 100
+
+// How long a document must stay unchanged before its buffer is re-indexed
+const defaultReindexDebounce = 300 * time.Millisecond
+
+// How long shutdown waits for background indexing to notice it was cancelled
+const shutdownGracePeriod = 2 * time.Second
+
+// How long completion and workspace symbol requests may scan the index before
+// answering with what they found so far
+const searchTimeout = 500 * time.Millisecond
+
+// How long an external tool (ruby, rubocop, stree) may run for a request
+const toolTimeout = 10 * time.Second
+
+// Results returned by completion and workspace symbol requests unless configured
+const defaultResultLimit = 50
+
 type Message struct {
 	ID     interface{} `json:"id,omitempty"`
 	Method string      `json:"method,omitempty"`
@@ -13,21 +45,52 @@ type Message struct {
 type GlobalState struct {
 	WorkspaceURI       string
 	WorkspacePath      string
+	WorkspaceFolders   []string // paths of every workspace folder, WorkspacePath among them
 	Formatter          string
 	TestLibrary        string
 	HasTypeChecker     bool
 	ClientCapabilities map[string]interface{}
 	EnabledFeatures    map[string]bool
+	ReindexDebounce    time.Duration
+	CompletionLimit    int    // completion items per request, 0 for defaultResultLimit
+	SymbolLimit        int    // workspace symbols per request, 0 for defaultResultLimit
+	HoverShowSource    bool   // hovers on methods include the start of their source
+	HoverPreferType    string // type source hovers list first: rbs, sorbet, yard or auto
+	RequireAware       bool   // completion ranks symbols of files the current one cannot reach last
+	CompletionPaths    bool   // completion items show the relative path of the file defining them
+	Debug              bool   // developer requests such as $/rubyLsp/debugAst are answered
+	IndexOptions       indexer.Options
+	AvailableTools     map[string]bool // external tools (ruby, rubocop, stree, bundle) found on the PATH
 	Mutex              sync.Mutex
 }
 
 type Server struct {
 	GlobalState       *GlobalState
-	Store             interface{} // Will be defined in the store package
-	Indexer           interface{} // Workspace indexer
+	Store             *store.Store
+	Indexer           indexer.SymbolIndex // workspace indexer, nil until there is a workspace to index
 	IncomingQueue     chan Message
-	OutgoingQueue     chan Message
-	CancelledRequests map[int]bool
-	Logger            interface{} // Logger interface
-}
+	OutgoingQueue     chan interface{} // JSON-RPC responses and notifications awaiting the dispatcher
+	CancelledRequests map[string]bool  // in-flight request ID -> cancelled
+	Logger            *log.Logger
+
+	cancelMutex    sync.Mutex
+	requestCancels map[string]context.CancelFunc // in-flight request ID -> ends the context of its index scans
+
+	shuttingDown bool // shutdown received; only exit is accepted from then on
+
+	invalidChanges map[string]int // URI -> changes in a row that did not apply, kept by the message loop
 
+	reindexMutex  sync.Mutex
+	reindexTimers map[string]*time.Timer // URI -> pending re-index of its buffer
+
+	reachableMutex sync.Mutex
+	reachableCache map[string]reachableEntry // file path -> files its requires reach, for require-aware completion
+
+	noticeMutex     sync.Mutex
+	indexingNoticed bool // the client was told results are incomplete during this indexing run
+
+	backgroundMutex   sync.Mutex
+	background        sync.WaitGroup     // work started by RunInBackground still running
+	backgroundContext context.Context    // cancelled at shutdown, created on first use
+	stopBackground    context.CancelFunc // cancels backgroundContext
+}
@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/humberto/ruby-lsp-go/indexer"
+)
+
+// callSite describes where a method is being called from, which decides whether
+// private and protected methods are reachable
+type callSite struct {
+	receiver string          // explicit receiver before ".", empty for an implicit self call
+	classes  map[string]bool // the enclosing class and its superclasses
+}
+
+// newCallSite builds the call site for a receiver written within a lexical scope
+func newCallSite(idx indexer.SymbolIndex, receiver string, scope string) callSite {
+	classes := map[string]bool{scope: true}
+	for _, superclass := range idx.SuperclassChain(scope) {
+		classes[superclass] = true
+	}
+	return callSite{receiver: receiver, classes: classes}
+}
+
+// canCall reports whether a method entry may be called from the call site:
+// private methods only on the implicit (or literal) self of their own class,
+// protected methods from within their own class hierarchy.
+// Entries other than methods are always visible.
+func (c callSite) canCall(entry indexer.SymbolEntry) bool {
+	switch entry.Type {
+	case indexer.SymbolMethod, indexer.SymbolSingletonMethod, indexer.SymbolAttrAccessor,
+		indexer.SymbolAssociation, indexer.SymbolScope:
+	default:
+		return true
+	}
+
+	switch entry.Visibility {
+	case "private":
+		return c.classes[entry.Parent] && (c.receiver == "" || c.receiver == "self")
+	case "protected":
+		return c.classes[entry.Parent]
+	}
+	return true
+}
+
+// filterCallable keeps the entries callable from the call site
+func (c callSite) filterCallable(entries []indexer.SymbolEntry) []indexer.SymbolEntry {
+	return filterEntries(entries, c.canCall)
+}
+
+// receiverBefore returns the explicit receiver written before the identifier
+// starting at a rune column of a line ("" for an implicit self call)
+func receiverBefore(source string, line int, character int) string {
+	lines := strings.Split(source, "\n")
+	if line < 0 || line >= len(lines) {
+		return ""
+	}
+	runes := []rune(lines[line])
+	if character > len(runes) {
+		character = len(runes)
+	}
+
+	before := string(runes[:character])
+	if !strings.HasSuffix(before, ".") || strings.HasSuffix(before, "..") {
+		return ""
+	}
+	return trailingExpression(strings.TrimSuffix(before, "."), false)
+}
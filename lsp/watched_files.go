@@ -0,0 +1,83 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// LSP FileChangeType values
+const fileDeleted = 3
+
+// LSP MessageType values for window/logMessage
+const messageTypeInfo = 3
+
+// HandleDidChangeWatchedFiles handles workspace/didChangeWatchedFiles notification.
+// Changed files are re-indexed from disk and deleted ones dropped; a change to
+// Gemfile or Gemfile.lock re-reads the locked gem versions and the gem sources.
+// The work runs in the background so requests keep being answered meanwhile.
+func (s *Server) HandleDidChangeWatchedFiles(params interface{}) {
+	s.Logger.Println("Processing watched files change")
+	// Requires may resolve differently once files are created or deleted
+	s.invalidateReachable("")
+
+	idx := s.Indexer
+	if idx == nil {
+		return
+	}
+
+	var changed, deleted []string
+	gemsChanged := false
+	if paramMap, ok := params.(map[string]interface{}); ok {
+		if changes, ok := paramMap["changes"].([]interface{}); ok {
+			for _, change := range changes {
+				changeMap, ok := change.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				uri, _ := changeMap["uri"].(string)
+				if uri == "" {
+					continue
+				}
+				path := uriToFilePath(uri)
+
+				switch changeType, _ := changeMap["type"].(float64); {
+				case filepath.Base(path) == "Gemfile" || filepath.Base(path) == "Gemfile.lock":
+					gemsChanged = true
+				case int(changeType) == fileDeleted:
+					deleted = append(deleted, path)
+				default:
+					changed = append(changed, path)
+				}
+			}
+		}
+	}
+
+	s.RunInBackground(func(ctx context.Context) {
+		for _, path := range deleted {
+			idx.RemoveFile(path)
+		}
+		for _, path := range changed {
+			if ctx.Err() != nil {
+				return
+			}
+			// Files the index does not cover yet are left for when they are needed
+			if idx.Covers(path) {
+				idx.UpdateFile(path)
+			}
+		}
+		if gemsChanged && ctx.Err() == nil {
+			s.logMessage(messageTypeInfo, "Gemfile changed, re-indexing gems")
+			updated, removed := idx.IndexGems(ctx)
+			s.logMessage(messageTypeInfo, fmt.Sprintf("Gem re-index finished: %d files re-parsed, %d removed", updated, removed))
+		}
+	})
+}
+
+// logMessage shows a message in the client's log through window/logMessage
+func (s *Server) logMessage(messageType int, message string) {
+	s.SendNotification("window/logMessage", map[string]interface{}{
+		"type":    messageType,
+		"message": message,
+	})
+}
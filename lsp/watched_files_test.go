@@ -0,0 +1,34 @@
+package lsp
+
+import "testing"
+
+func TestWatchedFileDeletionDropsDefinitions(t *testing.T) {
+	s := NewTestServer(map[string]string{
+		"app/models/order.rb":        "class Order\nend\n",
+		"app/models/legacy_order.rb": "class LegacyOrder\nend\n",
+		"app/services/checkout.rb":   "class Checkout\n  def run\n    LegacyOrder.new\n  end\nend\n",
+	})
+
+	definitionOfLegacyOrder := func() []testLocation {
+		var locations []testLocation
+		decode(t, s.HandleDefinition(1, positionParams("app/services/checkout.rb", 2, 6)), &locations)
+		return locations
+	}
+	if len(definitionOfLegacyOrder()) != 1 {
+		t.Fatal("no definition of LegacyOrder before its file was deleted")
+	}
+
+	s.HandleDidChangeWatchedFiles(map[string]interface{}{
+		"changes": []interface{}{
+			map[string]interface{}{"uri": testFileURI("app/models/legacy_order.rb"), "type": float64(fileDeleted)},
+		},
+	})
+	s.background.Wait()
+
+	if locations := definitionOfLegacyOrder(); len(locations) != 0 {
+		t.Errorf("definition of LegacyOrder = %+v after its file was deleted, want none", locations)
+	}
+	if len(s.Indexer.Lookup("Order")) != 1 {
+		t.Error("Order dropped along with legacy_order.rb")
+	}
+}
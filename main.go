@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -22,7 +22,7 @@ func main() {
 	
 	// Create the server
 	globalState := &lsp.GlobalState{
-		WorkspaceURI:       fmt.Sprintf("file://%s", os.Getenv("PWD")),
+		WorkspaceURI:       store.PathToURI(os.Getenv("PWD")),
 		Formatter:          "auto",
 		TestLibrary:        "minitest",
 		HasTypeChecker:     false,
@@ -37,8 +37,8 @@ func main() {
 		GlobalState:       globalState,
 		Store:             storeInstance,
 		IncomingQueue:     make(chan lsp.Message, 100),
-		OutgoingQueue:     make(chan lsp.Message, 100),
-		CancelledRequests: make(map[int]bool),
+		OutgoingQueue:     make(chan interface{}, 100),
+		CancelledRequests: make(map[string]bool),
 		Logger:            logger,
 	}
 
@@ -46,7 +46,7 @@ func main() {
 	go server.DispatchOutgoingMessages()
 
 	// Read initialization message if provided
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReaderSize(os.Stdin, readerBufferSize)
 	
 	// Handle LSP communication over stdin/stdout
 	scanner := NewMessageScanner(reader)
@@ -61,6 +61,14 @@ func main() {
 			continue
 		}
 
+		// After shutdown only exit is accepted; requests get an error, notifications are dropped
+		if server.IsShuttingDown() && msg.Method != "exit" {
+			if msg.ID != nil {
+				server.SendError(msg.ID, lsp.InvalidRequest, "Server is shutting down")
+			}
+			continue
+		}
+
 		// Route messages based on method type
 		switch msg.Method {
 		case "initialize":
@@ -68,21 +76,39 @@ func main() {
 			if paramMap, ok := msg.Params.(map[string]interface{}); ok {
 				if rootURI, ok := paramMap["rootUri"].(string); ok {
 					globalState.WorkspaceURI = rootURI
-					globalState.WorkspacePath = uriToPath(rootURI)
+					globalState.WorkspacePath = store.URIToPath(rootURI)
 				} else if rootPath, ok := paramMap["rootPath"].(string); ok {
 					globalState.WorkspacePath = rootPath
-					globalState.WorkspaceURI = "file://" + rootPath
+					globalState.WorkspaceURI = store.PathToURI(rootPath)
+				}
+
+				// Multi-root clients list every folder; the root becomes the first one if missing
+				if folders, ok := paramMap["workspaceFolders"].([]interface{}); ok {
+					for _, folder := range folders {
+						if folderMap, ok := folder.(map[string]interface{}); ok {
+							if uri, ok := folderMap["uri"].(string); ok {
+								globalState.WorkspaceFolders = append(globalState.WorkspaceFolders, store.URIToPath(uri))
+							}
+						}
+					}
+				}
+				if globalState.WorkspacePath == "" && len(globalState.WorkspaceFolders) > 0 {
+					globalState.WorkspacePath = globalState.WorkspaceFolders[0]
+					globalState.WorkspaceURI = store.PathToURI(globalState.WorkspacePath)
+				}
+				if len(globalState.WorkspaceFolders) == 0 && globalState.WorkspacePath != "" {
+					globalState.WorkspaceFolders = []string{globalState.WorkspacePath}
 				}
 			}
 
+			// Options from initializationOptions must be read before the index is built
+			response := server.HandleInitialize(msg.Params)
+
 			// Start workspace indexing in background
 			if globalState.WorkspacePath != "" {
-				idx := indexer.New(globalState.WorkspacePath, logger)
-				server.Indexer = idx
-				go idx.BuildIndex()
+				server.StartIndexing(indexer.NewForRoots(globalState.WorkspaceFolders, logger, globalState.IndexOptions))
 			}
 
-			response := server.HandleInitialize(msg.Params)
 			server.SendResponse(msg.ID, response)
 		case "initialized":
 			server.HandleInitialized()
@@ -93,42 +119,130 @@ func main() {
 		case "textDocument/didChange":
 			server.HandleDidChange(msg.Params)
 		case "textDocument/didSave":
-			// Re-index the saved file
-			if paramMap, ok := msg.Params.(map[string]interface{}); ok {
-				if textDoc, ok := paramMap["textDocument"].(map[string]interface{}); ok {
-					if uri, ok := textDoc["uri"].(string); ok {
-						filePath := uriToPath(uri)
-						if idx, ok := server.Indexer.(*indexer.Index); ok {
-							go idx.UpdateFile(filePath)
-						}
-					}
-				}
-			}
+			server.HandleDidSave(msg.Params)
 		case "textDocument/completion":
-			result := server.HandleCompletion(msg.Params)
+			// Long-running requests run concurrently so $/cancelRequest can reach them
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleCompletion(msg.ID, msg.Params))
+			}(msg)
+		case "completionItem/resolve":
+			result := server.HandleCompletionResolve(msg.Params)
 			server.SendResponse(msg.ID, result)
 		case "textDocument/hover":
 			result := server.HandleHover(msg.Params)
 			server.SendResponse(msg.ID, result)
+		case "textDocument/signatureHelp":
+			result := server.HandleSignatureHelp(msg.Params)
+			server.SendResponse(msg.ID, result)
 		case "textDocument/definition":
-			result := server.HandleDefinition(msg.Params)
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleDefinition(msg.ID, msg.Params))
+			}(msg)
+		case "textDocument/typeDefinition":
+			result := server.HandleTypeDefinition(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/prepareCallHierarchy":
+			result := server.HandlePrepareCallHierarchy(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "callHierarchy/incomingCalls":
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleIncomingCalls(msg.ID, msg.Params))
+			}(msg)
+		case "callHierarchy/outgoingCalls":
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleOutgoingCalls(msg.ID, msg.Params))
+			}(msg)
+		case "textDocument/prepareTypeHierarchy":
+			result := server.HandlePrepareTypeHierarchy(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "typeHierarchy/supertypes":
+			result := server.HandleSupertypes(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "typeHierarchy/subtypes":
+			result := server.HandleSubtypes(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/foldingRange":
+			result := server.HandleFoldingRange(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/selectionRange":
+			result := server.HandleSelectionRange(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/linkedEditingRange":
+			result := server.HandleLinkedEditingRange(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/moniker":
+			result := server.HandleMoniker(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/codeLens":
+			result := server.HandleCodeLens(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/references":
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleReferences(msg.ID, msg.Params))
+			}(msg)
+		case "textDocument/rename":
+			result := server.HandleRename(msg.Params)
 			server.SendResponse(msg.ID, result)
 		case "textDocument/documentSymbol":
 			result := server.HandleDocumentSymbol(msg.Params)
 			server.SendResponse(msg.ID, result)
+		case "textDocument/codeAction":
+			result := server.HandleCodeAction(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "textDocument/documentLink":
+			result := server.HandleDocumentLink(msg.Params)
+			server.SendResponse(msg.ID, result)
 		case "textDocument/formatting":
 			result := server.HandleFormatting(msg.Params)
 			server.SendResponse(msg.ID, result)
 		case "workspace/symbol":
-			result := server.HandleWorkspaceSymbol(msg.Params)
+			server.BeginRequest(msg.ID)
+			go func(msg lsp.Message) {
+				server.SendResult(msg.ID, server.HandleWorkspaceSymbol(msg.ID, msg.Params))
+			}(msg)
+		case "workspace/didChangeWatchedFiles":
+			server.HandleDidChangeWatchedFiles(msg.Params)
+		case "workspace/executeCommand":
+			result := server.HandleExecuteCommand(msg.Params)
 			server.SendResponse(msg.ID, result)
+		case "workspace/didChangeConfiguration":
+			server.HandleDidChangeConfiguration(msg.Params)
+		case "workspace/didChangeWorkspaceFolders":
+			server.HandleDidChangeWorkspaceFolders(msg.Params)
 		case "shutdown":
 			server.Shutdown()
 			server.SendResponse(msg.ID, nil)
 		case "exit":
+			// The exit code tells the client whether shutdown came first
+			if !server.IsShuttingDown() {
+				os.Exit(1)
+			}
 			return
 		case "$/cancelRequest":
 			server.HandleCancelRequest(msg.Params)
+		case "$/rubyLsp/debugAst":
+			// Only answered when the client asked for debugging at initialization
+			if !server.DebugEnabled() {
+				server.SendError(msg.ID, lsp.MethodNotFound, "Unhandled method "+msg.Method)
+				break
+			}
+			result := server.HandleDebugAst(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "$/rubyLsp/fileSymbols":
+			if !server.DebugEnabled() {
+				server.SendError(msg.ID, lsp.MethodNotFound, "Unhandled method "+msg.Method)
+				break
+			}
+			result := server.HandleDebugFileSymbols(msg.Params)
+			server.SendResponse(msg.ID, result)
+		case "$/rubyLsp/status":
+			result := server.HandleStatus()
+			server.SendResponse(msg.ID, result)
 		default:
 			// Queue other messages for background processing
 			server.IncomingQueue <- msg
@@ -136,36 +250,64 @@ func main() {
 	}
 }
 
+// Sizes of the stdin buffer and of the largest message read, which guards
+// against allocating whatever a corrupt Content-Length asks for
+const (
+	readerBufferSize      = 64 * 1024
+	defaultMaxMessageSize = 8 * 1024 * 1024
+)
+
 // MessageScanner handles LSP protocol message scanning (Content-Length headers)
 type MessageScanner struct {
-	reader *bufio.Reader
+	reader         *bufio.Reader
+	MaxMessageSize int // larger messages are skipped with an error
 }
 
 func NewMessageScanner(reader *bufio.Reader) *MessageScanner {
-	return &MessageScanner{reader: reader}
+	return &MessageScanner{reader: reader, MaxMessageSize: defaultMaxMessageSize}
 }
 
 func (ms *MessageScanner) Scan() (lsp.Message, error) {
 	var msg lsp.Message
 	
-	// Read Content-Length header
-	header, err := ms.reader.ReadString('\n')
-	if err != nil {
-		return msg, err
-	}
+	// Read headers up to the empty line ending them; Content-Type and other
+	// headers are ignored, and lines may end in \r\n or a bare \n
+	contentLength := -1
+	for {
+		header, err := ms.reader.ReadString('\n')
+		if err != nil {
+			return msg, err
+		}
+		header = strings.TrimRight(header, "\r\n")
+		if header == "" {
+			break
+		}
 
-	var contentLength int
-	if _, err := fmt.Sscanf(header, "Content-Length: %d\r", &contentLength); err != nil {
-		return msg, fmt.Errorf("failed to parse Content-Length: %v", err)
+		name, value, found := strings.Cut(header, ":")
+		if !found || !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			continue
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || length < 0 {
+			return msg, fmt.Errorf("failed to parse Content-Length: %q", value)
+		}
+		contentLength = length
+	}
+	if contentLength < 0 {
+		return msg, fmt.Errorf("message has no Content-Length header")
 	}
 
-	// Skip empty line
-	ms.reader.ReadString('\n')
+	// Skip an oversized message so the next one can still be read
+	if contentLength > ms.MaxMessageSize {
+		if _, err := io.CopyN(io.Discard, ms.reader, int64(contentLength)); err != nil {
+			return msg, err
+		}
+		return msg, fmt.Errorf("message of %d bytes exceeds the %d byte limit", contentLength, ms.MaxMessageSize)
+	}
 
 	// Read the actual JSON content
 	buf := make([]byte, contentLength)
-	_, err = io.ReadFull(ms.reader, buf)
-	if err != nil {
+	if _, err := io.ReadFull(ms.reader, buf); err != nil {
 		return msg, err
 	}
 
@@ -209,15 +351,3 @@ func SendJSON(w io.Writer, v interface{}) error {
 	_, err = w.Write(data)
 	return err
 }
-
-// uriToPath converts a file:// URI to a local filesystem path
-func uriToPath(uri string) string {
-	if strings.HasPrefix(uri, "file://") {
-		parsed, err := url.Parse(uri)
-		if err == nil {
-			return parsed.Path
-		}
-		return strings.TrimPrefix(uri, "file://")
-	}
-	return uri
-}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMessageScannerHeaders(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	length := len(body)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"CRLF", "Content-Length: " + strconv.Itoa(length) + "\r\n\r\n" + body},
+		{"Content-Type header", "Content-Length: " + strconv.Itoa(length) + "\r\nContent-Type: application/vscode-jsonrpc; charset=utf-8\r\n\r\n" + body},
+		{"Content-Type first", "Content-Type: application/vscode-jsonrpc\r\nContent-Length: " + strconv.Itoa(length) + "\r\n\r\n" + body},
+		{"bare LF", "Content-Length: " + strconv.Itoa(length) + "\n\n" + body},
+		{"lowercase name", "content-length:" + strconv.Itoa(length) + "\r\n\r\n" + body},
+	}
+	for _, test := range tests {
+		scanner := NewMessageScanner(bufio.NewReader(strings.NewReader(test.input)))
+		msg, err := scanner.Scan()
+		if err != nil {
+			t.Errorf("%s: Scan error: %v", test.name, err)
+			continue
+		}
+		if msg.ID != 1 || msg.Method != "initialize" {
+			t.Errorf("%s: Scan = %+v, want the initialize request", test.name, msg)
+		}
+	}
+}
+
+func TestMessageScannerReadsConsecutiveMessages(t *testing.T) {
+	first := `{"jsonrpc":"2.0","method":"initialized","params":{}}`
+	second := `{"jsonrpc":"2.0","id":"b","method":"shutdown"}`
+	input := "Content-Length: " + strconv.Itoa(len(first)) + "\nContent-Type: application/vscode-jsonrpc\n\n" + first +
+		"Content-Length: " + strconv.Itoa(len(second)) + "\r\n\r\n" + second
+	scanner := NewMessageScanner(bufio.NewReader(strings.NewReader(input)))
+
+	for _, want := range []string{"initialized", "shutdown"} {
+		msg, err := scanner.Scan()
+		if err != nil || msg.Method != want {
+			t.Fatalf("Scan = %+v, %v; want %s", msg, err, want)
+		}
+	}
+}
+
+func TestMessageScannerWithoutContentLength(t *testing.T) {
+	scanner := NewMessageScanner(bufio.NewReader(strings.NewReader("Content-Type: application/vscode-jsonrpc\r\n\r\n{}")))
+	if _, err := scanner.Scan(); err == nil || !strings.Contains(err.Error(), "no Content-Length") {
+		t.Errorf("Scan error = %v, want one naming the missing Content-Length", err)
+	}
+}
+
+// didOpenMessage frames a didOpen notification of a document of size bytes
+func didOpenMessage(size int) string {
+	body := `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///big.rb","text":"` +
+		strings.Repeat("a", size) + `"}}}`
+	return "Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
+
+func TestMessageScannerSizeLimit(t *testing.T) {
+	input := didOpenMessage(3*1024*1024) + didOpenMessage(defaultMaxMessageSize) + didOpenMessage(10)
+	scanner := NewMessageScanner(bufio.NewReaderSize(strings.NewReader(input), readerBufferSize))
+
+	msg, err := scanner.Scan()
+	if err != nil || msg.Method != "textDocument/didOpen" {
+		t.Fatalf("Scan of a 3MB didOpen = %v, want it read", err)
+	}
+	text := msg.Params.(map[string]interface{})["textDocument"].(map[string]interface{})["text"].(string)
+	if len(text) != 3*1024*1024 {
+		t.Errorf("didOpen text = %d bytes, want all 3MB", len(text))
+	}
+
+	if _, err := scanner.Scan(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Scan of a message over the limit = %v, want a size error", err)
+	}
+	// The oversized message is skipped, so the next one is read intact
+	if msg, err := scanner.Scan(); err != nil || msg.Method != "textDocument/didOpen" {
+		t.Errorf("Scan after an oversized message = %+v, %v; want the next didOpen", msg, err)
+	}
+}
@@ -1,11 +1,19 @@
 package store
 
 import (
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"unicode"
+
+	"github.com/humberto/ruby-lsp-go/documents"
 )
 
 type Store struct {
 	documents   map[string]*Document
+	paths       map[string]string // filesystem path -> URI of open file:// documents
 	mutex       sync.RWMutex
 	globalState interface{}
 }
@@ -15,12 +23,25 @@ type Document struct {
 	Version    int
 	Source     string
 	LanguageID string
+
+	// Live parsed view of this version, shared by every request on it
+	ruby *documents.RubyDocument
+}
+
+// RubyDocument returns the parsed document for this version. Its AST is
+// computed once and reused until the document is replaced in the store.
+func (d *Document) RubyDocument() *documents.RubyDocument {
+	if d.ruby == nil {
+		return documents.New(d.URI, d.Source, d.Version, d.LanguageID)
+	}
+	return d.ruby
 }
 
 // New creates a new store
 func New(gs interface{}) *Store {
 	return &Store{
 		documents:   make(map[string]*Document),
+		paths:       make(map[string]string),
 		globalState: gs,
 	}
 }
@@ -38,24 +59,50 @@ func (s *Store) Get(uri string) (*Document, bool) {
 func (s *Store) Set(uri string, source string, version int, languageID string) *Document {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	
+
+	// The stored source never carries a BOM, so positions match what the editor shows
+	ruby := documents.New(uri, source, version, languageID)
+	if previous, ok := s.documents[uri]; ok && previous.ruby != nil && previous.ruby.HasBOM {
+		ruby.HasBOM = true
+	}
+
 	doc := &Document{
 		URI:       uri,
 		Version:   version,
-		Source:    source,
+		Source:    ruby.Source,
 		LanguageID: languageID,
+		ruby:       ruby,
 	}
-	
+
 	s.documents[uri] = doc
+	if path := URIToPath(uri); path != uri {
+		s.paths[filepath.Clean(path)] = uri
+	}
 	return doc
 }
 
+// GetByPath retrieves the open document of a file by its filesystem path
+func (s *Store) GetByPath(path string) (*Document, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	uri, exists := s.paths[filepath.Clean(path)]
+	if !exists {
+		return nil, false
+	}
+	doc, exists := s.documents[uri]
+	return doc, exists
+}
+
 // Delete removes a document from the store
 func (s *Store) Delete(uri string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	
 	delete(s.documents, uri)
+	if path := URIToPath(uri); path != uri {
+		delete(s.paths, filepath.Clean(path))
+	}
 }
 
 // Clear removes all documents from the store
@@ -64,9 +111,12 @@ func (s *Store) Clear() {
 	defer s.mutex.Unlock()
 	
 	s.documents = make(map[string]*Document)
+	s.paths = make(map[string]string)
 }
 
-// Each iterates over all documents in the store
+// Each iterates over all documents in the store. The store stays read-locked
+// while fn runs, blocking didChange and didOpen, so fn must be quick; slow work
+// over every document (re-indexing them all) belongs on SnapshotAll.
 func (s *Store) Each(fn func(string, *Document)) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -76,6 +126,28 @@ func (s *Store) Each(fn func(string, *Document)) {
 	}
 }
 
+// SnapshotAll copies every document by URI under the lock and returns at once,
+// so callers can take their time over the documents without holding up writers.
+// The copies keep the version they had when taken.
+func (s *Store) SnapshotAll() map[string]Document {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snapshot := make(map[string]Document, len(s.documents))
+	for uri, doc := range s.documents {
+		snapshot[uri] = *doc
+	}
+	return snapshot
+}
+
+// Len returns how many documents the store holds
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	
+	return len(s.documents)
+}
+
 // Keys returns all URIs in the store
 func (s *Store) Keys() []string {
 	s.mutex.RLock()
@@ -88,3 +160,43 @@ func (s *Store) Keys() []string {
 	return keys
 }
 
+
+// A Windows drive letter starting a path (c:/Users, C:\Users)
+var windowsDrivePattern = regexp.MustCompile(`^[A-Za-z]:(?:[/\\]|$)`)
+
+// PathToURI converts a filesystem path to a percent-encoded file:// URI,
+// file:///c:/Users/... for a Windows path
+func PathToURI(path string) string {
+	if windowsDrivePattern.MatchString(path) {
+		path = "/" + strings.ReplaceAll(path, "\\", "/")
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// URIToPath converts a file:// URI to a filesystem path, decoding percent-encoding
+// and dropping the slash before the drive letter of a Windows URI (file:///c%3A/Users).
+// A # left unencoded belongs to the path, as file URIs have no fragment.
+// Other URIs are returned unchanged.
+func URIToPath(uri string) string {
+	if !strings.HasPrefix(uri, "file://") {
+		return uri
+	}
+
+	path := strings.TrimPrefix(uri, "file://")
+	if parsed, err := url.Parse(uri); err == nil {
+		path = parsed.Path
+		if strings.Contains(uri, "#") {
+			path += "#" + parsed.Fragment
+		}
+	} else if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' && unicode.IsLetter(rune(path[1])) {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
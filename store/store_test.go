@@ -0,0 +1,115 @@
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestURIRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		uri  string
+		back string // what URIToPath returns, when it is not path
+
+	}{
+		{name: "posix", path: "/home/dev/app/models/user.rb", uri: "file:///home/dev/app/models/user.rb"},
+		{name: "posix with spaces", path: "/home/dev/my app/user.rb", uri: "file:///home/dev/my%20app/user.rb"},
+		{name: "posix with a hash", path: "/home/dev/c#/user.rb", uri: "file:///home/dev/c%23/user.rb"},
+		{name: "posix with non-ASCII", path: "/home/dév/app.rb", uri: "file:///home/d%C3%A9v/app.rb"},
+		{name: "windows with slashes", path: "c:/Users/dev/app.rb", uri: "file:///c:/Users/dev/app.rb"},
+		{name: "windows with backslashes", path: `C:\Users\dev\my app\app.rb`, uri: "file:///C:/Users/dev/my%20app/app.rb", back: "C:/Users/dev/my app/app.rb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if uri := PathToURI(test.path); uri != test.uri {
+				t.Errorf("PathToURI(%q) = %q, want %q", test.path, uri, test.uri)
+			}
+			back := test.back
+			if back == "" {
+				back = test.path
+			}
+			if path := URIToPath(test.uri); path != filepath.FromSlash(back) {
+				t.Errorf("URIToPath(%q) = %q, want %q", test.uri, path, filepath.FromSlash(back))
+			}
+		})
+	}
+}
+
+func TestURIToPath(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		// Clients may percent-encode the drive letter's colon
+		{"file:///c%3A/Users/dev/app.rb", "c:/Users/dev/app.rb"},
+		{"file:///home/dev/app%2Bbeta.rb", "/home/dev/app+beta.rb"},
+		// Paths some clients send without encoding them
+		{"file:///home/dev/my app/user.rb", "/home/dev/my app/user.rb"},
+		{"file:///home/dev/c#/user.rb", "/home/dev/c#/user.rb"},
+		{"file:///home/dev/notes#", "/home/dev/notes#"},
+		// URIs of other schemes are not paths and are returned as they are
+		{"untitled:Untitled-1", "untitled:Untitled-1"},
+	}
+	for _, test := range tests {
+		want := test.want
+		if strings.HasPrefix(test.uri, "file://") {
+			want = filepath.FromSlash(want)
+		}
+		if got := URIToPath(test.uri); got != want {
+			t.Errorf("URIToPath(%q) = %q, want %q", test.uri, got, want)
+		}
+	}
+}
+
+func TestSnapshotAllIsUnaffectedByLaterWrites(t *testing.T) {
+	s := New(nil)
+	s.Set("file:///app/models/user.rb", "class User\nend\n", 1, "ruby")
+	s.Set("file:///app/models/order.rb", "class Order\nend\n", 1, "ruby")
+
+	snapshot := s.SnapshotAll()
+	s.Set("file:///app/models/user.rb", "class User < ApplicationRecord\nend\n", 2, "ruby")
+	s.Delete("file:///app/models/order.rb")
+
+	if len(snapshot) != 2 {
+		t.Fatalf("SnapshotAll = %d documents, want 2", len(snapshot))
+	}
+	if user := snapshot["file:///app/models/user.rb"]; user.Version != 1 || user.Source != "class User\nend\n" {
+		t.Errorf("snapshot of user.rb = version %d %q, want the version taken", user.Version, user.Source)
+	}
+	if _, ok := snapshot["file:///app/models/order.rb"]; !ok {
+		t.Error("snapshot lost order.rb when the store deleted it")
+	}
+}
+
+func TestGetByPath(t *testing.T) {
+	s := New(nil)
+	s.Set("file:///home/dev/my%20app/user.rb", "class User\nend\n", 1, "ruby")
+	s.Set("untitled:Untitled-1", "puts 1\n", 1, "ruby")
+
+	path := filepath.FromSlash("/home/dev/my app/user.rb")
+	doc, ok := s.GetByPath(path)
+	if !ok || doc.URI != "file:///home/dev/my%20app/user.rb" {
+		t.Fatalf("GetByPath(%q) = %+v, %v; want the document set by URI", path, doc, ok)
+	}
+	if _, ok := s.GetByPath(filepath.FromSlash("/home/dev/my app/models/../user.rb")); !ok {
+		t.Error("GetByPath of an unclean path found nothing")
+	}
+
+	// An update keeps the path, and the path goes with the document
+	s.Set("file:///home/dev/my%20app/user.rb", "class User < Base\nend\n", 2, "ruby")
+	if doc, ok := s.GetByPath(path); !ok || doc.Version != 2 {
+		t.Errorf("GetByPath after an update = %+v, %v; want version 2", doc, ok)
+	}
+	s.Delete("file:///home/dev/my%20app/user.rb")
+	if _, ok := s.GetByPath(path); ok {
+		t.Error("GetByPath found a deleted document")
+	}
+
+	// Documents without a file have no path
+	if _, ok := s.GetByPath("untitled:Untitled-1"); ok {
+		t.Error("GetByPath found an untitled document")
+	}
+}
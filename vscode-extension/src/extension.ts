@@ -56,7 +56,10 @@ export async function activate(context: ExtensionContext) {
       { scheme: "file", language: "rbs" },
     ],
     synchronize: {
-      fileEvents: workspace.createFileSystemWatcher("**/*.rb"),
+      fileEvents: [
+        workspace.createFileSystemWatcher("**/*.rb"),
+        workspace.createFileSystemWatcher("**/{Gemfile,Gemfile.lock}"),
+      ],
     },
     outputChannel: outputChannel,
     initializationOptions: {